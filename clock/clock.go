@@ -0,0 +1,146 @@
+// Package clock provides the time source behind every time-based behavior of
+// the emulator: timestamps, scheduled destruction and automatic rotation.
+package clock
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Clock reports the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// Observable is a Clock that can jump, notifying subscribers so scheduled
+// events fire without waiting for wall-clock time to pass.
+type Observable interface {
+	Clock
+	// OnChange registers fn to run after every jump, with the new time. The
+	// returned func unregisters it.
+	OnChange(fn func(now time.Time)) (remove func())
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// Real returns the wall clock.
+func Real() Clock {
+	return realClock{}
+}
+
+// Virtual is a controllable clock. It starts running in step with the wall
+// clock and can be frozen, set to an arbitrary time or advanced by a duration.
+// It is safe for concurrent use.
+type Virtual struct {
+	mu sync.Mutex
+	// base is the virtual time at anchor, the wall time of the last change.
+	base   time.Time
+	anchor time.Time
+	frozen bool
+	wall   func() time.Time
+
+	listenersMu sync.Mutex
+	listeners   []*func(time.Time)
+}
+
+var _ Observable = (*Virtual)(nil)
+
+// NewVirtual returns a running virtual clock that reads start now.
+func NewVirtual(start time.Time) *Virtual {
+	return newVirtual(start, time.Now)
+}
+
+func newVirtual(start time.Time, wall func() time.Time) *Virtual {
+	return &Virtual{base: start, anchor: wall(), wall: wall}
+}
+
+// Now returns the current virtual time.
+func (v *Virtual) Now() time.Time {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.nowLocked()
+}
+
+func (v *Virtual) nowLocked() time.Time {
+	if v.frozen {
+		return v.base
+	}
+	return v.base.Add(v.wall().Sub(v.anchor))
+}
+
+// Frozen reports whether the clock is stopped.
+func (v *Virtual) Frozen() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.frozen
+}
+
+// Freeze stops the clock at its current time.
+func (v *Virtual) Freeze() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.frozen {
+		return
+	}
+	v.base = v.nowLocked()
+	v.frozen = true
+}
+
+// Resume lets a frozen clock run again from the time it was frozen at.
+func (v *Virtual) Resume() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !v.frozen {
+		return
+	}
+	v.anchor = v.wall()
+	v.frozen = false
+}
+
+// Set moves the clock to t, which may be in the past, and notifies subscribers.
+func (v *Virtual) Set(t time.Time) {
+	v.mu.Lock()
+	v.base, v.anchor = t, v.wall()
+	v.mu.Unlock()
+	v.notify(t)
+}
+
+// Advance moves the clock forward by d and notifies subscribers.
+func (v *Virtual) Advance(d time.Duration) error {
+	if d < 0 {
+		return errors.New("clock: cannot advance by a negative duration")
+	}
+	v.mu.Lock()
+	now := v.nowLocked().Add(d)
+	v.base, v.anchor = now, v.wall()
+	v.mu.Unlock()
+	v.notify(now)
+	return nil
+}
+
+// OnChange registers fn to run synchronously after every Set and Advance
+// until the returned func is called.
+func (v *Virtual) OnChange(fn func(now time.Time)) (remove func()) {
+	listener := &fn
+	v.listenersMu.Lock()
+	defer v.listenersMu.Unlock()
+	v.listeners = append(v.listeners, listener)
+	return func() {
+		v.listenersMu.Lock()
+		defer v.listenersMu.Unlock()
+		v.listeners = slices.DeleteFunc(v.listeners, func(l *func(time.Time)) bool { return l == listener })
+	}
+}
+
+func (v *Virtual) notify(now time.Time) {
+	v.listenersMu.Lock()
+	listeners := slices.Clone(v.listeners)
+	v.listenersMu.Unlock()
+	for _, fn := range listeners {
+		(*fn)(now)
+	}
+}
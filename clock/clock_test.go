@@ -0,0 +1,82 @@
+package clock
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeWall struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (w *fakeWall) Now() time.Time {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.now
+}
+
+func (w *fakeWall) sleep(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.now = w.now.Add(d)
+}
+
+func TestVirtual(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	wall := &fakeWall{now: time.Date(2030, 6, 1, 0, 0, 0, 0, time.UTC)}
+	v := newVirtual(start, wall.Now)
+
+	var notified []time.Time
+	remove := v.OnChange(func(now time.Time) { notified = append(notified, now) })
+
+	requireNow := func(t *testing.T, want time.Time) {
+		t.Helper()
+		if got := v.Now(); !got.Equal(want) {
+			t.Fatalf("Now() = %v, want %v", got, want)
+		}
+	}
+
+	requireNow(t, start)
+	wall.sleep(time.Minute)
+	requireNow(t, start.Add(time.Minute))
+
+	v.Freeze()
+	wall.sleep(time.Hour)
+	requireNow(t, start.Add(time.Minute))
+	if !v.Frozen() {
+		t.Fatal("Frozen() = false after Freeze")
+	}
+
+	if err := v.Advance(48 * time.Hour); err != nil {
+		t.Fatalf("advance: %v", err)
+	}
+	requireNow(t, start.Add(48*time.Hour+time.Minute))
+	if err := v.Advance(-time.Second); err == nil {
+		t.Fatal("advance by a negative duration succeeded")
+	}
+
+	target := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	v.Set(target)
+	wall.sleep(time.Hour)
+	requireNow(t, target)
+
+	v.Resume()
+	wall.sleep(time.Second)
+	requireNow(t, target.Add(time.Second))
+
+	want := []time.Time{start.Add(48*time.Hour + time.Minute), target}
+	if len(notified) != len(want) || !notified[0].Equal(want[0]) || !notified[1].Equal(want[1]) {
+		t.Fatalf("notifications = %v, want %v", notified, want)
+	}
+
+	remove()
+	if err := v.Advance(time.Hour); err != nil {
+		t.Fatalf("advance: %v", err)
+	}
+	if len(notified) != len(want) {
+		t.Fatalf("notifications = %v after removing the listener, want %v", notified, want)
+	}
+}
@@ -10,22 +10,33 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
+	"google.golang.org/grpc"
+
+	"github.com/winor30/fake-cloud-kms/clock"
 	"github.com/winor30/fake-cloud-kms/cmdutil"
 	"github.com/winor30/fake-cloud-kms/kmscrypto"
+	"github.com/winor30/fake-cloud-kms/operations"
 	"github.com/winor30/fake-cloud-kms/seed"
 	"github.com/winor30/fake-cloud-kms/service"
 	"github.com/winor30/fake-cloud-kms/store"
 	"github.com/winor30/fake-cloud-kms/store/memory"
+	"github.com/winor30/fake-cloud-kms/transport/admin"
 	grpcserver "github.com/winor30/fake-cloud-kms/transport/grpc"
 )
 
 // Config captures runtime flags for the emulator binary.
 type Config struct {
-	ListenAddr string
-	SeedFile   string
-	Store      store.StoreType
-	LogLevel   slog.Level
+	ListenAddr      string
+	AdminListenAddr string
+	SeedFile        string
+	Store           store.StoreType
+	LogLevel        slog.Level
+	EnforceIAM      bool
+	LocationsFile   string
+	StrictLocations bool
+	OperationTiming operations.Timing
 }
 
 func main() {
@@ -52,8 +63,24 @@ func run() cmdutil.ExitStatus {
 		return cmdutil.Errorf(ctx, "invalid store", err)
 	}
 
+	clk := clock.NewVirtual(time.Now())
 	engine := kmscrypto.NewTinkEngine()
-	kmsService := service.New(strg, engine)
+	svcOpts := []service.Option{service.WithClock(clk)}
+	if cfg.LocationsFile != "" {
+		locations, err := seed.LoadLocations(cfg.LocationsFile)
+		if err != nil {
+			return cmdutil.Errorf(ctx, "failed to load locations file", err)
+		}
+		svcOpts = append(svcOpts, service.WithLocations(locations))
+	}
+	if cfg.StrictLocations {
+		svcOpts = append(svcOpts, service.WithStrictLocations())
+	}
+	if cfg.OperationTiming != (operations.Timing{}) {
+		svcOpts = append(svcOpts, service.WithOperationTiming(cfg.OperationTiming))
+	}
+	kmsService := service.New(strg, engine, svcOpts...)
+	defer kmsService.Close()
 
 	if cfg.SeedFile != "" {
 		if err := seed.Apply(ctx, kmsService, cfg.SeedFile); err != nil {
@@ -61,7 +88,21 @@ func run() cmdutil.ExitStatus {
 		}
 	}
 
-	srv := grpcserver.New(kmsService)
+	go kmsService.RunRotator(ctx, service.DefaultRotationInterval)
+	if cfg.AdminListenAddr != "" {
+		go func() {
+			if err := admin.New(clk).ListenAndServe(ctx, cfg.AdminListenAddr); err != nil {
+				slog.ErrorContext(ctx, "admin server error", "error", err)
+				stop()
+			}
+		}()
+	}
+
+	var grpcOpts []grpc.ServerOption
+	if cfg.EnforceIAM {
+		grpcOpts = append(grpcOpts, grpc.ChainUnaryInterceptor(grpcserver.AuthorizationInterceptor(kmsService)))
+	}
+	srv := grpcserver.New(kmsService, grpcOpts...)
 	if err := srv.ListenAndServe(ctx, cfg.ListenAddr); err != nil && !errors.Is(err, context.Canceled) {
 		return cmdutil.Errorf(ctx, "server error", err)
 	}
@@ -77,7 +118,13 @@ func parseConfig(args []string) (*Config, error) {
 
 	fs := flag.NewFlagSet("fake-cloud-kms", flag.ContinueOnError)
 	fs.StringVar(&cfg.ListenAddr, "grpc-listen-addr", cfg.ListenAddr, "gRPC listen address (host:port)")
+	fs.StringVar(&cfg.AdminListenAddr, "admin-listen-addr", "", "Optional HTTP admin API listen address (host:port) for controlling the virtual clock")
 	fs.StringVar(&cfg.SeedFile, "seed-file", "", "Optional path to yaml seed definition")
+	fs.StringVar(&cfg.LocationsFile, "locations-file", "", "Optional path to a yaml location catalog replacing the built-in one")
+	fs.BoolVar(&cfg.StrictLocations, "strict-locations", false, "Reject Create RPCs in locations missing from the catalog")
+	fs.DurationVar(&cfg.OperationTiming.Delay, "operation-delay", 0, "How long long-running operations stay pending (0 completes them immediately)")
+	fs.BoolVar(&cfg.OperationTiming.UseClock, "operation-delay-clock", false, "Measure --operation-delay on the virtual clock, so operations complete when it is advanced")
+	fs.BoolVar(&cfg.EnforceIAM, "enforce-iam", false, "Require callers to hold the cloudkms.* permission for each RPC under the stored IAM policies")
 	// custom parser for store
 	fs.Func("store", "State store (memory)", func(s string) error {
 		t := store.StoreType(strings.ToLower(strings.TrimSpace(s)))
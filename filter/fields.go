@@ -0,0 +1,157 @@
+package filter
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	timestampName protoreflect.FullName = "google.protobuf.Timestamp"
+	durationName  protoreflect.FullName = "google.protobuf.Duration"
+)
+
+// fieldPath is a dotted member reference resolved against a message descriptor.
+type fieldPath struct {
+	fields []protoreflect.FieldDescriptor
+	// mapKey selects an entry when the leaf field is a map.
+	mapKey *string
+}
+
+func (f fieldPath) leaf() protoreflect.FieldDescriptor {
+	return f.fields[len(f.fields)-1]
+}
+
+// resolvePath resolves a dotted path such as "primary.state" or "labels.env".
+// allowMaps permits a trailing map key segment.
+func resolvePath(md protoreflect.MessageDescriptor, member string, allowMaps bool) (fieldPath, error) {
+	var out fieldPath
+	segments := strings.Split(member, ".")
+	current := md
+	for i, seg := range segments {
+		if current == nil {
+			return fieldPath{}, fmt.Errorf("field %q has no subfield %q", strings.Join(segments[:i], "."), seg)
+		}
+		fd := current.Fields().ByName(protoreflect.Name(seg))
+		if fd == nil {
+			return fieldPath{}, fmt.Errorf("unknown field %q", member)
+		}
+		out.fields = append(out.fields, fd)
+
+		switch {
+		case fd.IsMap():
+			if !allowMaps {
+				return fieldPath{}, fmt.Errorf("map field %q is not supported here", member)
+			}
+			if rest := segments[i+1:]; len(rest) > 0 {
+				key := strings.Join(rest, ".")
+				out.mapKey = &key
+			}
+			return out, nil
+		case fd.Kind() == protoreflect.MessageKind && !isScalarMessage(fd):
+			current = fd.Message()
+		default:
+			current = nil
+		}
+	}
+	if current != nil {
+		return fieldPath{}, fmt.Errorf("field %q is a message and cannot be compared", member)
+	}
+	return out, nil
+}
+
+// resolve returns the leaf value of the path in msg and whether it is present.
+// Unset intermediate messages and missing map keys are reported as absent.
+func (f fieldPath) resolve(msg protoreflect.Message) (protoreflect.Value, bool) {
+	for _, fd := range f.fields[:len(f.fields)-1] {
+		if !msg.Has(fd) {
+			return protoreflect.Value{}, false
+		}
+		msg = msg.Get(fd).Message()
+	}
+	fd := f.leaf()
+	if fd.IsMap() {
+		if f.mapKey == nil {
+			return msg.Get(fd), msg.Has(fd)
+		}
+		m := msg.Get(fd).Map()
+		key := protoreflect.ValueOfString(*f.mapKey).MapKey()
+		if !m.Has(key) {
+			return protoreflect.Value{}, false
+		}
+		return m.Get(key), true
+	}
+	if fd.Kind() == protoreflect.MessageKind && !msg.Has(fd) {
+		return protoreflect.Value{}, false
+	}
+	return msg.Get(fd), true
+}
+
+func isScalarMessage(fd protoreflect.FieldDescriptor) bool {
+	name := fd.Message().FullName()
+	return name == timestampName || name == durationName
+}
+
+func timestampValue(v protoreflect.Value) time.Time {
+	m := v.Message()
+	fields := m.Descriptor().Fields()
+	return time.Unix(m.Get(fields.ByName("seconds")).Int(), m.Get(fields.ByName("nanos")).Int()).UTC()
+}
+
+func durationValue(v protoreflect.Value) time.Duration {
+	m := v.Message()
+	fields := m.Descriptor().Fields()
+	return time.Duration(m.Get(fields.ByName("seconds")).Int())*time.Second + time.Duration(m.Get(fields.ByName("nanos")).Int())
+}
+
+func numericValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) float64 {
+	switch fd.Kind() {
+	case protoreflect.Uint32Kind, protoreflect.Uint64Kind, protoreflect.Fixed32Kind, protoreflect.Fixed64Kind:
+		return float64(v.Uint())
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return v.Float()
+	default:
+		return float64(v.Int())
+	}
+}
+
+func compareFloat(a, b float64) int {
+	return cmp.Compare(a, b)
+}
+
+// compareValues orders two values of the leaf field fd. Absent values sort first.
+func compareValues(fd protoreflect.FieldDescriptor, a protoreflect.Value, aOK bool, b protoreflect.Value, bOK bool) int {
+	switch {
+	case !aOK && !bOK:
+		return 0
+	case !aOK:
+		return -1
+	case !bOK:
+		return 1
+	}
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return strings.Compare(a.String(), b.String())
+	case protoreflect.EnumKind:
+		return cmp.Compare(a.Enum(), b.Enum())
+	case protoreflect.BoolKind:
+		return cmp.Compare(boolRank(a.Bool()), boolRank(b.Bool()))
+	case protoreflect.MessageKind:
+		if fd.Message().FullName() == timestampName {
+			return timestampValue(a).Compare(timestampValue(b))
+		}
+		return cmp.Compare(durationValue(a), durationValue(b))
+	default:
+		return compareFloat(numericValue(fd, a), numericValue(fd, b))
+	}
+}
+
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,402 @@
+// Package filter implements the subset of AIP-160 filtering and AIP-132
+// ordering that Cloud KMS List RPCs accept.
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Filter is a compiled filter expression bound to a message type.
+type Filter struct {
+	root node
+}
+
+// Parse compiles expr against the fields of md. Field paths use proto field
+// names (for example "labels.env" or "version_template.algorithm").
+func Parse(expr string, md protoreflect.MessageDescriptor) (*Filter, error) {
+	toks, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks, md: md}
+	if p.peek().kind == tokEOF {
+		return nil, errors.New("filter is empty")
+	}
+	root, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q", tok.text)
+	}
+	return &Filter{root: root}, nil
+}
+
+// Matches reports whether msg satisfies the filter.
+func (f *Filter) Matches(msg proto.Message) bool {
+	return f.root.eval(msg.ProtoReflect())
+}
+
+type node interface {
+	eval(msg protoreflect.Message) bool
+}
+
+type andNode []node
+
+func (n andNode) eval(msg protoreflect.Message) bool {
+	for _, child := range n {
+		if !child.eval(msg) {
+			return false
+		}
+	}
+	return true
+}
+
+type orNode []node
+
+func (n orNode) eval(msg protoreflect.Message) bool {
+	for _, child := range n {
+		if child.eval(msg) {
+			return true
+		}
+	}
+	return false
+}
+
+type notNode struct {
+	child node
+}
+
+func (n notNode) eval(msg protoreflect.Message) bool {
+	return !n.child.eval(msg)
+}
+
+// restriction compares the field at path against a literal.
+type restriction struct {
+	field fieldPath
+	op    string
+	// presence is set for "field:*" and "map:key" restrictions.
+	presence bool
+	match    func(v protoreflect.Value) bool
+}
+
+func (r *restriction) eval(msg protoreflect.Message) bool {
+	v, ok := r.field.resolve(msg)
+	if r.presence {
+		return ok
+	}
+	if !ok {
+		return r.op == "!="
+	}
+	return r.match(v)
+}
+
+// ---- parsing ----
+
+type parser struct {
+	toks []token
+	pos  int
+	md   protoreflect.MessageDescriptor
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.toks[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) isKeyword(word string) bool {
+	tok := p.peek()
+	return tok.kind == tokText && tok.text == word
+}
+
+// parseExpression: sequence {"AND" sequence}.
+func (p *parser) parseExpression() (node, error) {
+	first, err := p.parseSequence()
+	if err != nil {
+		return nil, err
+	}
+	nodes := andNode{first}
+	for p.isKeyword("AND") {
+		p.next()
+		next, err := p.parseSequence()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, next)
+	}
+	if len(nodes) == 1 {
+		return first, nil
+	}
+	return nodes, nil
+}
+
+// parseSequence: factor {factor}, joined by implicit AND.
+func (p *parser) parseSequence() (node, error) {
+	first, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	nodes := andNode{first}
+	for p.startsTerm() {
+		next, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, next)
+	}
+	if len(nodes) == 1 {
+		return first, nil
+	}
+	return nodes, nil
+}
+
+func (p *parser) startsTerm() bool {
+	tok := p.peek()
+	switch tok.kind {
+	case tokLParen:
+		return true
+	case tokText:
+		return tok.text != "AND" && tok.text != "OR"
+	default:
+		return false
+	}
+}
+
+// parseFactor: term {"OR" term}. OR binds tighter than AND in AIP-160.
+func (p *parser) parseFactor() (node, error) {
+	first, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	nodes := orNode{first}
+	for p.isKeyword("OR") {
+		p.next()
+		next, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, next)
+	}
+	if len(nodes) == 1 {
+		return first, nil
+	}
+	return nodes, nil
+}
+
+// parseTerm: ["NOT" | "-"] simple.
+func (p *parser) parseTerm() (node, error) {
+	if p.isKeyword("NOT") {
+		p.next()
+		child, err := p.parseSimple()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{child: child}, nil
+	}
+	if tok := p.peek(); tok.kind == tokText && len(tok.text) > 1 && tok.text[0] == '-' {
+		p.toks[p.pos].text = tok.text[1:]
+		child, err := p.parseSimple()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{child: child}, nil
+	}
+	return p.parseSimple()
+}
+
+// parseSimple: restriction | "(" expression ")".
+func (p *parser) parseSimple() (node, error) {
+	if p.peek().kind == tokLParen {
+		p.next()
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok.kind != tokRParen {
+			return nil, errors.New("missing closing parenthesis")
+		}
+		return expr, nil
+	}
+	return p.parseRestriction()
+}
+
+func (p *parser) parseRestriction() (node, error) {
+	member := p.next()
+	if member.kind != tokText {
+		return nil, fmt.Errorf("expected field name, got %q", member.text)
+	}
+	cmp := p.next()
+	if cmp.kind != tokComparator {
+		return nil, fmt.Errorf("%q must be followed by a comparator; global restrictions are not supported", member.text)
+	}
+	arg := p.next()
+	if arg.kind != tokText && arg.kind != tokString {
+		return nil, fmt.Errorf("%s%s must be followed by a value", member.text, cmp.text)
+	}
+
+	field, err := resolvePath(p.md, member.text, true)
+	if err != nil {
+		return nil, err
+	}
+	return compileRestriction(field, cmp.text, arg)
+}
+
+func compileRestriction(field fieldPath, op string, arg token) (*restriction, error) {
+	r := &restriction{field: field, op: op}
+	if op == ":" && arg.kind == tokText && arg.text == "*" {
+		r.presence = true
+		return r, nil
+	}
+
+	fd := field.leaf()
+	if fd.IsMap() && field.mapKey == nil {
+		if op != ":" {
+			return nil, fmt.Errorf("map field %q only supports the ':' operator", fd.Name())
+		}
+		field.mapKey = &arg.text
+		r.field = field
+		r.presence = true
+		return r, nil
+	}
+	if fd.IsList() {
+		return nil, fmt.Errorf("repeated field %q cannot be filtered", fd.Name())
+	}
+
+	if field.mapKey != nil {
+		fd = fd.MapValue()
+	}
+	match, err := compileMatch(fd, op, arg)
+	if err != nil {
+		return nil, err
+	}
+	r.match = match
+	return r, nil
+}
+
+func compileMatch(fd protoreflect.FieldDescriptor, op string, arg token) (func(protoreflect.Value) bool, error) {
+	lit := arg.text
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		switch op {
+		case "=", "!=":
+			want := op == "="
+			return func(v protoreflect.Value) bool { return globMatch(lit, v.String()) == want }, nil
+		case ":":
+			return func(v protoreflect.Value) bool { return strings.Contains(v.String(), lit) }, nil
+		default:
+			return ordered(op, func(v protoreflect.Value) int { return strings.Compare(v.String(), lit) })
+		}
+
+	case protoreflect.EnumKind:
+		ev := fd.Enum().Values().ByName(protoreflect.Name(lit))
+		if ev == nil {
+			return nil, fmt.Errorf("%q is not a valid value for %s", lit, fd.Name())
+		}
+		switch op {
+		case "=", ":":
+			return func(v protoreflect.Value) bool { return v.Enum() == ev.Number() }, nil
+		case "!=":
+			return func(v protoreflect.Value) bool { return v.Enum() != ev.Number() }, nil
+		default:
+			return nil, fmt.Errorf("enum field %s only supports '=' and '!='", fd.Name())
+		}
+
+	case protoreflect.BoolKind:
+		want, err := strconv.ParseBool(lit)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid boolean for %s", lit, fd.Name())
+		}
+		switch op {
+		case "=", ":":
+			return func(v protoreflect.Value) bool { return v.Bool() == want }, nil
+		case "!=":
+			return func(v protoreflect.Value) bool { return v.Bool() != want }, nil
+		default:
+			return nil, fmt.Errorf("boolean field %s only supports '=' and '!='", fd.Name())
+		}
+
+	case protoreflect.Int32Kind, protoreflect.Int64Kind, protoreflect.Sint32Kind, protoreflect.Sint64Kind,
+		protoreflect.Sfixed32Kind, protoreflect.Sfixed64Kind, protoreflect.Uint32Kind, protoreflect.Uint64Kind,
+		protoreflect.Fixed32Kind, protoreflect.Fixed64Kind, protoreflect.FloatKind, protoreflect.DoubleKind:
+		want, err := strconv.ParseFloat(lit, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid number for %s", lit, fd.Name())
+		}
+		return ordered(op, func(v protoreflect.Value) int { return compareFloat(numericValue(fd, v), want) })
+
+	case protoreflect.MessageKind:
+		switch fd.Message().FullName() {
+		case timestampName:
+			want, err := time.Parse(time.RFC3339Nano, lit)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not a valid RFC 3339 timestamp for %s", lit, fd.Name())
+			}
+			return ordered(op, func(v protoreflect.Value) int { return timestampValue(v).Compare(want) })
+		case durationName:
+			want, err := parseDuration(lit)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not a valid duration for %s", lit, fd.Name())
+			}
+			return ordered(op, func(v protoreflect.Value) int { return compareFloat(float64(durationValue(v)), float64(want)) })
+		}
+	}
+	return nil, fmt.Errorf("field %s cannot be filtered", fd.Name())
+}
+
+// ordered builds a matcher for comparators over an ordered type. cmp returns
+// the sign of (field value - literal).
+func ordered(op string, cmp func(protoreflect.Value) int) (func(protoreflect.Value) bool, error) {
+	switch op {
+	case "=", ":":
+		return func(v protoreflect.Value) bool { return cmp(v) == 0 }, nil
+	case "!=":
+		return func(v protoreflect.Value) bool { return cmp(v) != 0 }, nil
+	case "<":
+		return func(v protoreflect.Value) bool { return cmp(v) < 0 }, nil
+	case "<=":
+		return func(v protoreflect.Value) bool { return cmp(v) <= 0 }, nil
+	case ">":
+		return func(v protoreflect.Value) bool { return cmp(v) > 0 }, nil
+	case ">=":
+		return func(v protoreflect.Value) bool { return cmp(v) >= 0 }, nil
+	default:
+		return nil, fmt.Errorf("unsupported comparator %q", op)
+	}
+}
+
+// globMatch compares value against pattern, where '*' in pattern matches any
+// run of characters.
+func globMatch(pattern, value string) bool {
+	if !strings.Contains(pattern, "*") {
+		return pattern == value
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, "?", `\?`, "[", `\[`).Replace(pattern)
+	// path.Match treats '/' as a separator for '*'; resource names contain
+	// slashes, so map them to a character that cannot appear in the pattern.
+	ok, err := path.Match(strings.ReplaceAll(escaped, "/", "\x00"), strings.ReplaceAll(value, "/", "\x00"))
+	return err == nil && ok
+}
+
+func parseDuration(lit string) (time.Duration, error) {
+	if seconds, ok := strings.CutSuffix(lit, "s"); ok {
+		if f, err := strconv.ParseFloat(seconds, 64); err == nil {
+			return time.Duration(f * float64(time.Second)), nil
+		}
+	}
+	return time.ParseDuration(lit)
+}
@@ -0,0 +1,130 @@
+package filter_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/winor30/fake-cloud-kms/filter"
+)
+
+func TestFilterMatches(t *testing.T) {
+	t.Parallel()
+	ck := &kmspb.CryptoKey{
+		Name:       "projects/demo/locations/global/keyRings/app/cryptoKeys/signer",
+		Purpose:    kmspb.CryptoKey_ASYMMETRIC_SIGN,
+		Labels:     map[string]string{"env": "prod", "team": "payments"},
+		CreateTime: timestamppb.New(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)),
+		Primary:    &kmspb.CryptoKeyVersion{State: kmspb.CryptoKeyVersion_ENABLED},
+		VersionTemplate: &kmspb.CryptoKeyVersionTemplate{
+			Algorithm: kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256,
+		},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{expr: "labels.env=prod", want: true},
+		{expr: `labels.env = "dev"`, want: false},
+		{expr: "labels.missing!=prod", want: true},
+		{expr: "labels:team", want: true},
+		{expr: "labels:owner", want: false},
+		{expr: "labels.env:*", want: true},
+		{expr: "purpose=ASYMMETRIC_SIGN", want: true},
+		{expr: "purpose!=ASYMMETRIC_SIGN", want: false},
+		{expr: "primary.state=ENABLED", want: true},
+		{expr: "version_template.algorithm=EC_SIGN_SECP256K1_SHA256", want: true},
+		{expr: "name:signer", want: true},
+		{expr: "name=*/cryptoKeys/sig*", want: true},
+		{expr: `create_time > "2024-01-01T00:00:00Z"`, want: true},
+		{expr: `create_time < "2024-01-01T00:00:00Z"`, want: false},
+		{expr: "labels.env=prod AND purpose=ENCRYPT_DECRYPT", want: false},
+		{expr: "labels.env=prod purpose=ASYMMETRIC_SIGN", want: true},
+		{expr: "labels.env=dev OR labels.team=payments", want: true},
+		{expr: "NOT labels.env=prod", want: false},
+		{expr: "-labels.env=dev", want: true},
+		{expr: "(labels.env=dev OR labels.env=prod) AND import_only=false", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := filter.Parse(tt.expr, ck.ProtoReflect().Descriptor())
+			if err != nil {
+				t.Fatalf("parse %q: %v", tt.expr, err)
+			}
+			if got := f.Matches(ck); got != tt.want {
+				t.Fatalf("Matches(%q) = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterParseErrors(t *testing.T) {
+	t.Parallel()
+	md := (&kmspb.CryptoKey{}).ProtoReflect().Descriptor()
+	for _, expr := range []string{
+		"",
+		"prod",
+		"unknown_field=1",
+		"purpose=NOT_A_PURPOSE",
+		"purpose>ENCRYPT_DECRYPT",
+		"labels=prod",
+		"(labels.env=prod",
+		`labels.env="unterminated`,
+		"create_time>yesterday",
+		"import_only=maybe",
+		"primary=ENABLED",
+		"labels.env=prod AND",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := filter.Parse(expr, md); err == nil {
+				t.Fatalf("Parse(%q) succeeded, want error", expr)
+			}
+		})
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	t.Parallel()
+	versions := []*kmspb.CryptoKeyVersion{
+		{Name: "v/1", State: kmspb.CryptoKeyVersion_DISABLED, CreateTime: timestamppb.New(time.Unix(10, 0))},
+		{Name: "v/2", State: kmspb.CryptoKeyVersion_ENABLED, CreateTime: timestamppb.New(time.Unix(30, 0))},
+		{Name: "v/3", State: kmspb.CryptoKeyVersion_ENABLED, CreateTime: timestamppb.New(time.Unix(20, 0))},
+	}
+	md := versions[0].ProtoReflect().Descriptor()
+
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{expr: "name desc", want: []string{"v/3", "v/2", "v/1"}},
+		{expr: "create_time", want: []string{"v/1", "v/3", "v/2"}},
+		{expr: "state, create_time desc", want: []string{"v/2", "v/3", "v/1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			ob, err := filter.ParseOrderBy(tt.expr, md)
+			if err != nil {
+				t.Fatalf("parse order_by: %v", err)
+			}
+			sorted := slices.Clone(versions)
+			slices.SortStableFunc(sorted, func(a, b *kmspb.CryptoKeyVersion) int { return ob.Compare(a, b) })
+			var got []string
+			for _, v := range sorted {
+				got = append(got, v.GetName())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, expr := range []string{"", "name sideways", "labels", "bogus desc"} {
+		if _, err := filter.ParseOrderBy(expr, md); err == nil {
+			t.Fatalf("ParseOrderBy(%q) succeeded, want error", expr)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokText
+	tokString
+	tokComparator
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// comparators is ordered so two-character operators match first.
+var comparators = []string{"<=", ">=", "!=", "=", "<", ">", ":"}
+
+func lex(expr string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			toks = append(toks, token{kind: tokLParen, text: "("})
+			i++
+		case c == ')':
+			toks = append(toks, token{kind: tokRParen, text: ")"})
+			i++
+		case c == '"' || c == '\'':
+			text, n, err := lexString(expr[i:])
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, token{kind: tokString, text: text})
+			i += n
+		default:
+			if op, ok := comparatorAt(expr[i:]); ok {
+				toks = append(toks, token{kind: tokComparator, text: op})
+				i += len(op)
+				continue
+			}
+			start := i
+			for i < len(expr) && isTextByte(expr[i]) {
+				i++
+			}
+			if i == start {
+				return nil, fmt.Errorf("unexpected character %q", expr[i])
+			}
+			toks = append(toks, token{kind: tokText, text: expr[start:i]})
+		}
+	}
+	return append(toks, token{kind: tokEOF}), nil
+}
+
+func comparatorAt(s string) (string, bool) {
+	for _, op := range comparators {
+		if strings.HasPrefix(s, op) {
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func isTextByte(b byte) bool {
+	switch b {
+	case ' ', '\t', '\n', '\r', '(', ')', '"', '\'', '=', '!', '<', '>', ':':
+		return false
+	default:
+		return true
+	}
+}
+
+// lexString reads a quoted literal starting at s[0] and returns its unescaped
+// value and the number of bytes consumed.
+func lexString(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 >= len(s) {
+				return "", 0, errors.New("unterminated string literal")
+			}
+			i++
+			b.WriteByte(s[i])
+		case quote:
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, errors.New("unterminated string literal")
+}
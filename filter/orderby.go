@@ -0,0 +1,72 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// OrderBy is a compiled order_by clause such as "state, create_time desc".
+type OrderBy struct {
+	keys []orderKey
+}
+
+type orderKey struct {
+	field fieldPath
+	desc  bool
+}
+
+// ParseOrderBy compiles a comma-separated list of fields, each optionally
+// followed by "asc" or "desc", against the fields of md.
+func ParseOrderBy(expr string, md protoreflect.MessageDescriptor) (*OrderBy, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, errors.New("order_by is empty")
+	}
+	var out OrderBy
+	for clause := range strings.SplitSeq(expr, ",") {
+		parts := strings.Fields(clause)
+		if len(parts) == 0 || len(parts) > 2 {
+			return nil, fmt.Errorf("invalid order_by clause %q", strings.TrimSpace(clause))
+		}
+		key := orderKey{}
+		if len(parts) == 2 {
+			switch strings.ToLower(parts[1]) {
+			case "asc":
+			case "desc":
+				key.desc = true
+			default:
+				return nil, fmt.Errorf("invalid sort direction %q", parts[1])
+			}
+		}
+		field, err := resolvePath(md, parts[0], false)
+		if err != nil {
+			return nil, err
+		}
+		if field.leaf().IsList() {
+			return nil, fmt.Errorf("repeated field %q cannot be ordered", parts[0])
+		}
+		key.field = field
+		out.keys = append(out.keys, key)
+	}
+	return &out, nil
+}
+
+// Compare orders a and b by the clause. Messages that tie on every key compare equal.
+func (o *OrderBy) Compare(a, b proto.Message) int {
+	ma, mb := a.ProtoReflect(), b.ProtoReflect()
+	for _, key := range o.keys {
+		va, aOK := key.field.resolve(ma)
+		vb, bOK := key.field.resolve(mb)
+		c := compareValues(key.field.leaf(), va, aOK, vb, bOK)
+		if key.desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
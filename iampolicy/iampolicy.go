@@ -0,0 +1,230 @@
+// Package iampolicy describes the IAM permissions that apply to Cloud KMS
+// resources and evaluates policies against callers.
+package iampolicy
+
+import (
+	"slices"
+	"strings"
+
+	"cloud.google.com/go/iam/apiv1/iampb"
+
+	"github.com/winor30/fake-cloud-kms/names"
+)
+
+var (
+	cryptoKeyPermissions = []string{
+		"cloudkms.cryptoKeys.get",
+		"cloudkms.cryptoKeys.update",
+		"cloudkms.cryptoKeys.getIamPolicy",
+		"cloudkms.cryptoKeys.setIamPolicy",
+		"cloudkms.cryptoKeyVersions.create",
+		"cloudkms.cryptoKeyVersions.get",
+		"cloudkms.cryptoKeyVersions.list",
+		"cloudkms.cryptoKeyVersions.update",
+		"cloudkms.cryptoKeyVersions.destroy",
+		"cloudkms.cryptoKeyVersions.restore",
+		"cloudkms.cryptoKeyVersions.useToEncrypt",
+		"cloudkms.cryptoKeyVersions.useToDecrypt",
+		"cloudkms.cryptoKeyVersions.useToSign",
+		"cloudkms.cryptoKeyVersions.useToVerify",
+		"cloudkms.cryptoKeyVersions.useToDecapsulate",
+		"cloudkms.cryptoKeyVersions.viewPublicKey",
+	}
+	importJobPermissions = []string{
+		"cloudkms.importJobs.get",
+		"cloudkms.importJobs.useToImport",
+		"cloudkms.importJobs.getIamPolicy",
+		"cloudkms.importJobs.setIamPolicy",
+	}
+	// keyRingPermissions also covers the key ring's crypto keys and import
+	// jobs, which inherit its policy.
+	keyRingPermissions = slices.Concat([]string{
+		"cloudkms.keyRings.get",
+		"cloudkms.keyRings.getIamPolicy",
+		"cloudkms.keyRings.setIamPolicy",
+		"cloudkms.cryptoKeys.create",
+		"cloudkms.cryptoKeys.list",
+		"cloudkms.importJobs.create",
+		"cloudkms.importJobs.list",
+	}, cryptoKeyPermissions, importJobPermissions)
+	// projectPermissions is every permission the emulator checks, including
+	// the Resource Manager permissions guarding the project policy itself.
+	projectPermissions = slices.Concat([]string{
+		"cloudkms.keyRings.create",
+		"cloudkms.keyRings.list",
+		"cloudkms.locations.get",
+		"cloudkms.locations.list",
+		"cloudkms.locations.generateRandomBytes",
+		"cloudkms.keyHandles.create",
+		"cloudkms.keyHandles.get",
+		"cloudkms.keyHandles.list",
+		"cloudkms.autokeyConfigs.get",
+		"cloudkms.autokeyConfigs.update",
+		"cloudkms.projects.showEffectiveAutokeyConfig",
+		"cloudkms.ekmConnections.create",
+		"cloudkms.ekmConnections.get",
+		"cloudkms.ekmConnections.list",
+		"cloudkms.ekmConnections.update",
+		"cloudkms.ekmConnections.verifyConnectivity",
+		"cloudkms.ekmConfigs.get",
+		"cloudkms.ekmConfigs.update",
+		"cloudkms.operations.get",
+		"cloudkms.operations.list",
+		"cloudkms.operations.cancel",
+		"resourcemanager.projects.getIamPolicy",
+		"resourcemanager.projects.setIamPolicy",
+	}, keyRingPermissions)
+)
+
+// roles maps the predefined roles the emulator understands to the Cloud KMS
+// permissions they grant.
+var roles = map[string][]string{
+	"roles/owner":  projectPermissions,
+	"roles/editor": selectPermissions(func(p string) bool { return !strings.HasSuffix(p, ".setIamPolicy") }),
+	"roles/viewer": selectPermissions(isReadPermission),
+
+	"roles/cloudkms.admin": selectPermissions(func(p string) bool {
+		return isKMSPermission(p) && !strings.Contains(p, ".useTo") && p != "cloudkms.locations.generateRandomBytes"
+	}),
+	"roles/cloudkms.viewer": selectPermissions(func(p string) bool { return isKMSPermission(p) && isReadPermission(p) }),
+	"roles/cloudkms.cryptoKeyEncrypterDecrypter": {
+		"cloudkms.cryptoKeyVersions.useToEncrypt",
+		"cloudkms.cryptoKeyVersions.useToDecrypt",
+	},
+	"roles/cloudkms.cryptoKeyEncrypter": {"cloudkms.cryptoKeyVersions.useToEncrypt"},
+	"roles/cloudkms.cryptoKeyDecrypter": {"cloudkms.cryptoKeyVersions.useToDecrypt"},
+	"roles/cloudkms.signerVerifier": {
+		"cloudkms.cryptoKeyVersions.useToSign",
+		"cloudkms.cryptoKeyVersions.useToVerify",
+		"cloudkms.cryptoKeyVersions.viewPublicKey",
+	},
+	"roles/cloudkms.signer":          {"cloudkms.cryptoKeyVersions.useToSign"},
+	"roles/cloudkms.publicKeyViewer": {"cloudkms.cryptoKeyVersions.viewPublicKey"},
+	"roles/cloudkms.importer": {
+		"cloudkms.importJobs.get",
+		"cloudkms.importJobs.list",
+		"cloudkms.importJobs.useToImport",
+	},
+	"roles/cloudkms.autokeyAdmin": {
+		"cloudkms.autokeyConfigs.get",
+		"cloudkms.autokeyConfigs.update",
+		"cloudkms.projects.showEffectiveAutokeyConfig",
+	},
+	"roles/cloudkms.autokeyUser": {
+		"cloudkms.keyHandles.create",
+		"cloudkms.keyHandles.get",
+		"cloudkms.keyHandles.list",
+	},
+	"roles/cloudkms.ekmConnectionsAdmin": {
+		"cloudkms.ekmConnections.create",
+		"cloudkms.ekmConnections.get",
+		"cloudkms.ekmConnections.list",
+		"cloudkms.ekmConnections.update",
+		"cloudkms.ekmConnections.verifyConnectivity",
+		"cloudkms.ekmConfigs.get",
+		"cloudkms.ekmConfigs.update",
+	},
+	"roles/cloudkms.cryptoOperator": selectPermissions(func(p string) bool {
+		return p == "cloudkms.cryptoKeyVersions.viewPublicKey" || p == "cloudkms.locations.generateRandomBytes" ||
+			strings.HasPrefix(p, "cloudkms.cryptoKeyVersions.useTo")
+	}),
+}
+
+// Applicable returns the permissions that can be granted on resource, which
+// must name a project, key ring, crypto key or import job. ok is false for
+// any other name.
+func Applicable(resource string) (permissions []string, ok bool) {
+	if _, err := names.ParseProject(resource); err == nil {
+		return projectPermissions, true
+	}
+	if _, err := names.ParseKeyRing(resource); err == nil {
+		return keyRingPermissions, true
+	}
+	if _, err := names.ParseCryptoKey(resource); err == nil {
+		return cryptoKeyPermissions, true
+	}
+	if _, err := names.ParseImportJob(resource); err == nil {
+		return importJobPermissions, true
+	}
+	return nil, false
+}
+
+// Ancestors returns the resources whose policies govern access to resource,
+// nearest first: resource itself when it can hold a policy, then its crypto
+// key, key ring and project as applicable. Locations and crypto key versions
+// hold no policy of their own.
+func Ancestors(resource string) []string {
+	parts := strings.Split(resource, "/")
+	if len(parts)%2 != 0 || parts[0] != "projects" {
+		return nil
+	}
+	var ancestors []string
+	for i := 0; i < len(parts); i += 2 {
+		switch parts[i] {
+		case "projects", "keyRings", "cryptoKeys", "importJobs":
+			ancestors = append(ancestors, strings.Join(parts[:i+2], "/"))
+		}
+	}
+	slices.Reverse(ancestors)
+	return ancestors
+}
+
+// RolePermissions returns the Cloud KMS permissions granted by a predefined
+// role. Custom and unknown roles grant none.
+func RolePermissions(role string) []string {
+	return roles[role]
+}
+
+// Grants reports whether policy grants permission to principal, a member
+// such as "user:alice@example.com". Conditions are not evaluated, so
+// conditional bindings grant nothing. Group membership is unknown to the
+// emulator, so group members never match.
+func Grants(policy *iampb.Policy, principal, permission string) bool {
+	for _, binding := range policy.GetBindings() {
+		if binding.GetCondition() != nil || !slices.Contains(RolePermissions(binding.GetRole()), permission) {
+			continue
+		}
+		for _, member := range binding.GetMembers() {
+			if memberMatches(member, principal) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func memberMatches(member, principal string) bool {
+	switch member {
+	case principal, "allUsers", "allAuthenticatedUsers":
+		return true
+	}
+	domain, ok := strings.CutPrefix(member, "domain:")
+	if !ok {
+		return false
+	}
+	kind, email, _ := strings.Cut(principal, ":")
+	if kind != "user" && kind != "serviceAccount" {
+		return false
+	}
+	_, principalDomain, found := strings.Cut(email, "@")
+	return found && principalDomain == domain
+}
+
+func isKMSPermission(permission string) bool {
+	return strings.HasPrefix(permission, "cloudkms.")
+}
+
+func isReadPermission(permission string) bool {
+	return strings.HasSuffix(permission, ".get") || strings.HasSuffix(permission, ".list") ||
+		strings.HasSuffix(permission, ".getIamPolicy")
+}
+
+func selectPermissions(keep func(string) bool) []string {
+	var selected []string
+	for _, permission := range projectPermissions {
+		if keep(permission) {
+			selected = append(selected, permission)
+		}
+	}
+	return selected
+}
@@ -0,0 +1,123 @@
+package iampolicy_test
+
+import (
+	"slices"
+	"testing"
+
+	"cloud.google.com/go/iam/apiv1/iampb"
+	"google.golang.org/genproto/googleapis/type/expr"
+
+	"github.com/winor30/fake-cloud-kms/iampolicy"
+)
+
+func TestAncestors(t *testing.T) {
+	t.Parallel()
+	keyRing := "projects/demo/locations/global/keyRings/app"
+	for _, tc := range []struct {
+		resource string
+		want     []string
+	}{
+		{"projects/demo/locations/global", []string{"projects/demo"}},
+		{keyRing, []string{keyRing, "projects/demo"}},
+		{keyRing + "/cryptoKeys/pair/cryptoKeyVersions/1", []string{keyRing + "/cryptoKeys/pair", keyRing, "projects/demo"}},
+		{keyRing + "/importJobs/byok", []string{keyRing + "/importJobs/byok", keyRing, "projects/demo"}},
+		{"folders/1", nil},
+		{"projects/demo/locations", nil},
+	} {
+		if got := iampolicy.Ancestors(tc.resource); !slices.Equal(got, tc.want) {
+			t.Errorf("Ancestors(%q) = %v, want %v", tc.resource, got, tc.want)
+		}
+	}
+}
+
+func TestApplicable(t *testing.T) {
+	t.Parallel()
+	keyRing := "projects/demo/locations/global/keyRings/app"
+	project, _ := iampolicy.Applicable("projects/demo")
+	ring, _ := iampolicy.Applicable(keyRing)
+	key, _ := iampolicy.Applicable(keyRing + "/cryptoKeys/pair")
+	job, _ := iampolicy.Applicable(keyRing + "/importJobs/byok")
+
+	if !slices.Contains(project, "cloudkms.keyRings.create") || slices.Contains(ring, "cloudkms.keyRings.create") {
+		t.Fatal("keyRings.create must apply to projects only")
+	}
+	if !slices.Contains(ring, "cloudkms.cryptoKeyVersions.useToEncrypt") || !slices.Contains(ring, "cloudkms.importJobs.useToImport") {
+		t.Fatal("key ring permissions must cover its crypto keys and import jobs")
+	}
+	if !slices.Contains(key, "cloudkms.cryptoKeyVersions.useToEncrypt") || slices.Contains(key, "cloudkms.importJobs.useToImport") {
+		t.Fatalf("crypto key permissions = %v", key)
+	}
+	if slices.Contains(job, "cloudkms.cryptoKeys.get") {
+		t.Fatalf("import job permissions = %v", job)
+	}
+	if _, ok := iampolicy.Applicable(keyRing + "/cryptoKeys/pair/cryptoKeyVersions/1"); ok {
+		t.Fatal("crypto key versions must not hold policies")
+	}
+}
+
+func TestRolePermissions(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		role       string
+		permission string
+		want       bool
+	}{
+		{"roles/owner", "cloudkms.cryptoKeys.setIamPolicy", true},
+		{"roles/editor", "cloudkms.cryptoKeys.setIamPolicy", false},
+		{"roles/viewer", "cloudkms.cryptoKeys.get", true},
+		{"roles/viewer", "cloudkms.cryptoKeyVersions.useToEncrypt", false},
+		{"roles/cloudkms.admin", "cloudkms.cryptoKeyVersions.destroy", true},
+		{"roles/cloudkms.admin", "cloudkms.cryptoKeyVersions.useToDecrypt", false},
+		{"roles/owner", "resourcemanager.projects.setIamPolicy", true},
+		{"roles/editor", "resourcemanager.projects.setIamPolicy", false},
+		{"roles/cloudkms.admin", "resourcemanager.projects.setIamPolicy", false},
+		{"roles/cloudkms.viewer", "resourcemanager.projects.getIamPolicy", false},
+		{"roles/cloudkms.cryptoKeyEncrypter", "cloudkms.cryptoKeyVersions.useToEncrypt", true},
+		{"roles/cloudkms.cryptoKeyEncrypter", "cloudkms.cryptoKeyVersions.useToDecrypt", false},
+		{"roles/cloudkms.cryptoOperator", "cloudkms.locations.generateRandomBytes", true},
+		{"roles/cloudkms.cryptoOperator", "cloudkms.importJobs.useToImport", false},
+		{"roles/cloudkms.autokeyUser", "cloudkms.keyHandles.create", true},
+		{"roles/cloudkms.autokeyUser", "cloudkms.autokeyConfigs.update", false},
+		{"roles/cloudkms.ekmConnectionsAdmin", "cloudkms.ekmConnections.verifyConnectivity", true},
+		{"roles/cloudkms.ekmConnectionsAdmin", "cloudkms.cryptoKeys.get", false},
+		{"projects/demo/roles/custom", "cloudkms.cryptoKeys.get", false},
+	} {
+		if got := slices.Contains(iampolicy.RolePermissions(tc.role), tc.permission); got != tc.want {
+			t.Errorf("%s grants %s = %v, want %v", tc.role, tc.permission, got, tc.want)
+		}
+	}
+}
+
+func TestGrants(t *testing.T) {
+	t.Parallel()
+	const permission = "cloudkms.cryptoKeyVersions.useToEncrypt"
+	binding := func(members ...string) *iampb.Policy {
+		return &iampb.Policy{Bindings: []*iampb.Binding{{Role: "roles/cloudkms.cryptoKeyEncrypter", Members: members}}}
+	}
+	for _, tc := range []struct {
+		name      string
+		policy    *iampb.Policy
+		principal string
+		want      bool
+	}{
+		{"exact member", binding("user:alice@example.com"), "user:alice@example.com", true},
+		{"other member", binding("user:bob@example.com"), "user:alice@example.com", false},
+		{"domain", binding("domain:example.com"), "serviceAccount:ci@example.com", true},
+		{"other domain", binding("domain:example.org"), "user:alice@example.com", false},
+		{"all users", binding("allUsers"), "user:alice@example.com", true},
+		{"group", binding("group:team@example.com"), "user:alice@example.com", false},
+		{"empty policy", nil, "user:alice@example.com", false},
+		{"conditional binding", &iampb.Policy{Bindings: []*iampb.Binding{{
+			Role:      "roles/cloudkms.cryptoKeyEncrypter",
+			Members:   []string{"user:alice@example.com"},
+			Condition: &expr.Expr{Title: "always", Expression: "true"},
+		}}}, "user:alice@example.com", false},
+		{"role without the permission", &iampb.Policy{Bindings: []*iampb.Binding{
+			{Role: "roles/cloudkms.cryptoKeyDecrypter", Members: []string{"user:alice@example.com"}},
+		}}, "user:alice@example.com", false},
+	} {
+		if got := iampolicy.Grants(tc.policy, tc.principal, permission); got != tc.want {
+			t.Errorf("%s: Grants = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package kmscrypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+)
+
+// ecAlgorithms maps Cloud KMS NIST curve signing algorithm names to their curve.
+var ecAlgorithms = map[string]elliptic.Curve{
+	"EC_SIGN_P256_SHA256": elliptic.P256(),
+	"EC_SIGN_P384_SHA384": elliptic.P384(),
+}
+
+func generateECKey(curve elliptic.Curve) (KeyMaterial, error) {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate ec key: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("marshal ec key: %w", err)
+	}
+	return KeyMaterial(der), nil
+}
+
+// signEC returns the DER-encoded ECDSA signature of digest.
+func signEC(keyMaterial KeyMaterial, digest []byte) ([]byte, error) {
+	parsed, err := x509.ParsePKCS8PrivateKey(keyMaterial)
+	if err != nil {
+		return nil, fmt.Errorf("parse ec key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("key material is %T, not an EC key", parsed)
+	}
+	return ecdsa.SignASN1(rand.Reader, key, digest)
+}
@@ -0,0 +1,59 @@
+package kmscrypto
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+)
+
+func TestTinkEngineNISTCurveSignAndVerify(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := NewTinkEngine()
+	message := []byte("hello kms")
+	sum256 := sha256.Sum256(message)
+	sum384 := sha512.Sum384(message)
+
+	for _, tt := range []struct {
+		algorithm string
+		bitSize   int
+		digest    []byte
+	}{
+		{"EC_SIGN_P256_SHA256", 256, sum256[:]},
+		{"EC_SIGN_P384_SHA384", 384, sum384[:]},
+	} {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			material, err := engine.GenerateAsymmetricKeyMaterial(ctx, tt.algorithm)
+			if err != nil {
+				t.Fatalf("generate key material: %v", err)
+			}
+			sig, err := engine.Sign(ctx, material, tt.algorithm, tt.digest)
+			if err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+			pemBytes, err := engine.GetPublicKeyPEM(ctx, material, tt.algorithm)
+			if err != nil {
+				t.Fatalf("get public key: %v", err)
+			}
+			block, _ := pem.Decode(pemBytes)
+			if block == nil {
+				t.Fatal("failed to decode PEM")
+			}
+			parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				t.Fatalf("parse public key: %v", err)
+			}
+			pub, ok := parsed.(*ecdsa.PublicKey)
+			if !ok || pub.Curve.Params().BitSize != tt.bitSize {
+				t.Fatalf("public key = %T, want %d-bit ECDSA", parsed, tt.bitSize)
+			}
+			if !ecdsa.VerifyASN1(pub, tt.digest, sig) {
+				t.Fatal("signature verification failed")
+			}
+		})
+	}
+}
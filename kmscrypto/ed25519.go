@@ -0,0 +1,33 @@
+package kmscrypto
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+)
+
+func generateEd25519Key() (KeyMaterial, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate ed25519 key: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("marshal ed25519 key: %w", err)
+	}
+	return KeyMaterial(der), nil
+}
+
+// signEd25519 signs the full message; Ed25519 does not sign digests.
+func signEd25519(keyMaterial KeyMaterial, message []byte) ([]byte, error) {
+	parsed, err := x509.ParsePKCS8PrivateKey(keyMaterial)
+	if err != nil {
+		return nil, fmt.Errorf("parse ed25519 key: %w", err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("key material is %T, not an Ed25519 key", parsed)
+	}
+	return ed25519.Sign(key, message), nil
+}
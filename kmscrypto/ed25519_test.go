@@ -0,0 +1,45 @@
+package kmscrypto
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+)
+
+func TestTinkEngineEd25519SignAndVerify(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := NewTinkEngine()
+
+	material, err := engine.GenerateAsymmetricKeyMaterial(ctx, "EC_SIGN_ED25519")
+	if err != nil {
+		t.Fatalf("generate key material: %v", err)
+	}
+	message := []byte("ssh-ed25519-cert-v01@openssh.com")
+	sig, err := engine.Sign(ctx, material, "EC_SIGN_ED25519", message)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	pemBytes, err := engine.GetPublicKeyPEM(ctx, material, "EC_SIGN_ED25519")
+	if err != nil {
+		t.Fatalf("get public key: %v", err)
+	}
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		t.Fatal("failed to decode PEM")
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("parse public key: %v", err)
+	}
+	pub, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		t.Fatalf("public key is %T, want ed25519.PublicKey", parsed)
+	}
+	if !ed25519.Verify(pub, message, sig) {
+		t.Fatal("signature verification failed")
+	}
+}
@@ -26,12 +26,30 @@ type Engine interface {
 	Decrypt(ctx context.Context, keyMaterial KeyMaterial, ciphertext, associatedData []byte) ([]byte, error)
 
 	GenerateAsymmetricKeyMaterial(ctx context.Context, algorithm string) (KeyMaterial, error)
-	Sign(ctx context.Context, keyMaterial KeyMaterial, digest []byte) ([]byte, error)
-	GetPublicKeyPEM(ctx context.Context, keyMaterial KeyMaterial) ([]byte, error)
+	Sign(ctx context.Context, keyMaterial KeyMaterial, algorithm string, digest []byte) ([]byte, error)
+	GetPublicKeyPEM(ctx context.Context, keyMaterial KeyMaterial, algorithm string) ([]byte, error)
+	AsymmetricDecrypt(ctx context.Context, keyMaterial KeyMaterial, algorithm string, ciphertext []byte) ([]byte, error)
+	GetRawPublicKey(ctx context.Context, keyMaterial KeyMaterial, algorithm string) ([]byte, error)
+	Decapsulate(ctx context.Context, keyMaterial KeyMaterial, algorithm string, ciphertext []byte) ([]byte, error)
+
+	GenerateMacKeyMaterial(ctx context.Context, algorithm string) (KeyMaterial, error)
+	MacSign(ctx context.Context, keyMaterial KeyMaterial, algorithm string, data []byte) ([]byte, error)
+	MacVerify(ctx context.Context, keyMaterial KeyMaterial, algorithm string, data, mac []byte) (bool, error)
+
+	GenerateRawKeyMaterial(ctx context.Context, algorithm string) (KeyMaterial, error)
+	RawEncrypt(ctx context.Context, keyMaterial KeyMaterial, algorithm string, plaintext, associatedData, iv []byte) ([]byte, []byte, error)
+	RawDecrypt(ctx context.Context, keyMaterial KeyMaterial, algorithm string, ciphertext, associatedData, iv []byte, tagLength int) ([]byte, error)
+
+	GenerateImportJobKeyMaterial(ctx context.Context, method string) (KeyMaterial, error)
+	UnwrapImportedKey(ctx context.Context, keyMaterial KeyMaterial, method string, wrappedKey []byte) ([]byte, error)
+	ImportKeyMaterial(ctx context.Context, algorithm string, key []byte) (KeyMaterial, error)
 }
 
-// TinkEngine implements Engine using tink-go AES256-GCM primitives
-// and btcec for secp256k1 asymmetric operations.
+// TinkEngine implements Engine using tink-go AES256-GCM primitives,
+// btcec for secp256k1 asymmetric operations, crypto/rsa for RSA keys,
+// crypto/mlkem for key encapsulation, tink-go ML-DSA/SLH-DSA signers for
+// post-quantum signing, crypto/hmac for MAC keys, crypto/aes for raw AES
+// keys and tink-go AES-KWP for unwrapping imported keys.
 type TinkEngine struct{}
 
 var _ Engine = &TinkEngine{}
@@ -80,12 +98,33 @@ func (e *TinkEngine) Decrypt(ctx context.Context, keyMaterial KeyMaterial, ciphe
 	return primitive.Decrypt(ciphertext, associatedData)
 }
 
-// GenerateAsymmetricKeyMaterial generates a secp256k1 private key and returns
-// the raw 32-byte scalar as KeyMaterial.
+// GenerateAsymmetricKeyMaterial generates a private key for algorithm. secp256k1
+// keys are stored as the raw 32-byte scalar, NIST curve, Ed25519 and RSA keys as PKCS#8
+// DER, ML-KEM/X-Wing keys as their private seed and ML-DSA/SLH-DSA keys in
+// their FIPS 204/205 private key encoding. RSA keys come from a background
+// pool of pre-generated keys.
 func (e *TinkEngine) GenerateAsymmetricKeyMaterial(ctx context.Context, algorithm string) (KeyMaterial, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
+	if alg, ok := rsaDecryptAlgorithms[algorithm]; ok {
+		return generateRSAKey(alg.bits)
+	}
+	if alg, ok := rsaSignAlgorithms[algorithm]; ok {
+		return generateRSAKey(alg.bits)
+	}
+	if curve, ok := ecAlgorithms[algorithm]; ok {
+		return generateECKey(curve)
+	}
+	if algorithm == "EC_SIGN_ED25519" {
+		return generateEd25519Key()
+	}
+	if _, ok := kemSeedSizes[algorithm]; ok {
+		return generateKEMKey(algorithm)
+	}
+	if _, ok := pqSignAlgorithms[algorithm]; ok {
+		return generatePQSignKey(algorithm)
+	}
 	if algorithm != "EC_SIGN_SECP256K1_SHA256" {
 		return nil, fmt.Errorf("unsupported algorithm: %s", algorithm)
 	}
@@ -96,23 +135,42 @@ func (e *TinkEngine) GenerateAsymmetricKeyMaterial(ctx context.Context, algorith
 	return KeyMaterial(privKey.Serialize()), nil
 }
 
-// Sign signs a digest using the secp256k1 private key stored in keyMaterial.
-// Returns a DER-encoded ECDSA signature.
-func (e *TinkEngine) Sign(ctx context.Context, keyMaterial KeyMaterial, digest []byte) ([]byte, error) {
+// Sign signs a digest using the private key stored in keyMaterial. ECDSA
+// signatures are DER-encoded; RSA_SIGN_RAW_PKCS1, EC_SIGN_ED25519 and the
+// PQ_SIGN algorithms take the data to sign in place of a digest.
+func (e *TinkEngine) Sign(ctx context.Context, keyMaterial KeyMaterial, algorithm string, digest []byte) ([]byte, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
+	if _, ok := ecAlgorithms[algorithm]; ok {
+		return signEC(keyMaterial, digest)
+	}
+	if _, ok := rsaSignAlgorithms[algorithm]; ok {
+		return signRSA(keyMaterial, algorithm, digest)
+	}
+	if algorithm == "EC_SIGN_ED25519" {
+		return signEd25519(keyMaterial, digest)
+	}
+	if _, ok := pqSignAlgorithms[algorithm]; ok {
+		return signPQ(keyMaterial, algorithm, digest)
+	}
+	if algorithm != "EC_SIGN_SECP256K1_SHA256" {
+		return nil, fmt.Errorf("unsupported algorithm: %s", algorithm)
+	}
 	privKey, _ := btcec.PrivKeyFromBytes(keyMaterial)
 	sig := btcecdsa.Sign(privKey, digest)
 	return sig.Serialize(), nil
 }
 
-// GetPublicKeyPEM returns the secp256k1 public key in PKIX/PEM format
-// with the correct secp256k1 OID (1.3.132.0.10).
-func (e *TinkEngine) GetPublicKeyPEM(ctx context.Context, keyMaterial KeyMaterial) ([]byte, error) {
+// GetPublicKeyPEM returns the public key of algorithm in PKIX/PEM format.
+// secp256k1 keys carry the secp256k1 OID (1.3.132.0.10).
+func (e *TinkEngine) GetPublicKeyPEM(ctx context.Context, keyMaterial KeyMaterial, algorithm string) ([]byte, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
+	if algorithm != "EC_SIGN_SECP256K1_SHA256" {
+		return pkcs8PublicKeyPEM(keyMaterial)
+	}
 	privKey, _ := btcec.PrivKeyFromBytes(keyMaterial)
 	pubKey := privKey.PubKey()
 
@@ -100,7 +100,7 @@ func TestTinkEngineGenerateSecp256k1_UnsupportedAlgorithm(t *testing.T) {
 	ctx := context.Background()
 	engine := NewTinkEngine()
 
-	_, err := engine.GenerateAsymmetricKeyMaterial(ctx, "RSA_SIGN_PSS_2048_SHA256")
+	_, err := engine.GenerateAsymmetricKeyMaterial(ctx, "GOOGLE_SYMMETRIC_ENCRYPTION")
 	if err == nil {
 		t.Fatal("expected error for unsupported algorithm")
 	}
@@ -117,7 +117,7 @@ func TestTinkEngineSignAndVerify(t *testing.T) {
 	}
 
 	digest := sha256.Sum256([]byte("hello world"))
-	sig, err := engine.Sign(ctx, material, digest[:])
+	sig, err := engine.Sign(ctx, material, "EC_SIGN_SECP256K1_SHA256", digest[:])
 	if err != nil {
 		t.Fatalf("sign: %v", err)
 	}
@@ -126,7 +126,7 @@ func TestTinkEngineSignAndVerify(t *testing.T) {
 	}
 
 	// Verify DER-encoded signature with the public key
-	pemBytes, err := engine.GetPublicKeyPEM(ctx, material)
+	pemBytes, err := engine.GetPublicKeyPEM(ctx, material, "EC_SIGN_SECP256K1_SHA256")
 	if err != nil {
 		t.Fatalf("get public key pem: %v", err)
 	}
@@ -158,7 +158,7 @@ func TestTinkEngineGetPublicKeyPEM(t *testing.T) {
 		t.Fatalf("generate key material: %v", err)
 	}
 
-	pemBytes, err := engine.GetPublicKeyPEM(ctx, material)
+	pemBytes, err := engine.GetPublicKeyPEM(ctx, material, "EC_SIGN_SECP256K1_SHA256")
 	if err != nil {
 		t.Fatalf("get public key pem: %v", err)
 	}
@@ -202,11 +202,11 @@ func TestTinkEngineSignDeterministicPublicKey(t *testing.T) {
 		t.Fatalf("generate key material: %v", err)
 	}
 
-	pem1, err := engine.GetPublicKeyPEM(ctx, material)
+	pem1, err := engine.GetPublicKeyPEM(ctx, material, "EC_SIGN_SECP256K1_SHA256")
 	if err != nil {
 		t.Fatalf("get public key pem 1: %v", err)
 	}
-	pem2, err := engine.GetPublicKeyPEM(ctx, material)
+	pem2, err := engine.GetPublicKeyPEM(ctx, material, "EC_SIGN_SECP256K1_SHA256")
 	if err != nil {
 		t.Fatalf("get public key pem 2: %v", err)
 	}
@@ -231,10 +231,10 @@ func TestTinkEngineAsymmetricContextCancellation(t *testing.T) {
 		t.Fatalf("generate key material: %v", err)
 	}
 
-	if _, err := engine.Sign(cancelled, material, []byte("digest")); !errors.Is(err, context.Canceled) {
+	if _, err := engine.Sign(cancelled, material, "EC_SIGN_SECP256K1_SHA256", []byte("digest")); !errors.Is(err, context.Canceled) {
 		t.Fatalf("Sign: expected context cancellation, got %v", err)
 	}
-	if _, err := engine.GetPublicKeyPEM(cancelled, material); !errors.Is(err, context.Canceled) {
+	if _, err := engine.GetPublicKeyPEM(cancelled, material, "EC_SIGN_SECP256K1_SHA256"); !errors.Is(err, context.Canceled) {
 		t.Fatalf("GetPublicKeyPEM: expected context cancellation, got %v", err)
 	}
 }
@@ -0,0 +1,325 @@
+package kmscrypto
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/tink-crypto/tink-go/v2/aead/aesgcm"
+	"github.com/tink-crypto/tink-go/v2/insecurecleartextkeyset"
+	"github.com/tink-crypto/tink-go/v2/insecuresecretdataaccess"
+	"github.com/tink-crypto/tink-go/v2/keyset"
+	kwp "github.com/tink-crypto/tink-go/v2/kwp/subtle"
+	"github.com/tink-crypto/tink-go/v2/secretdata"
+)
+
+// ErrInvalidKeyMaterial is returned when imported key material does not
+// match the algorithm it is imported as.
+var ErrInvalidKeyMaterial = errors.New("invalid key material")
+
+// importMethods maps Cloud KMS import methods to the modulus size and OAEP
+// hash of their RSA wrapping key, and whether the target key is wrapped with
+// an ephemeral AES-256 key (CKM_RSA_AES_KEY_WRAP) rather than by RSA-OAEP
+// alone.
+var importMethods = map[string]struct {
+	bits    int
+	hash    crypto.Hash
+	aesWrap bool
+}{
+	"RSA_OAEP_3072_SHA1_AES_256":   {3072, crypto.SHA1, true},
+	"RSA_OAEP_4096_SHA1_AES_256":   {4096, crypto.SHA1, true},
+	"RSA_OAEP_3072_SHA256_AES_256": {3072, crypto.SHA256, true},
+	"RSA_OAEP_4096_SHA256_AES_256": {4096, crypto.SHA256, true},
+	"RSA_OAEP_3072_SHA256":         {3072, crypto.SHA256, false},
+	"RSA_OAEP_4096_SHA256":         {4096, crypto.SHA256, false},
+}
+
+// importAESKeySize is the size of the ephemeral AES-256 key of *_AES_256
+// import methods.
+const importAESKeySize = 32
+
+// GenerateImportJobKeyMaterial generates the RSA wrapping key of an import
+// job using method, stored as PKCS#8 DER. Keys come from the same background
+// pool as RSA key versions.
+func (e *TinkEngine) GenerateImportJobKeyMaterial(ctx context.Context, method string) (KeyMaterial, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m, ok := importMethods[method]
+	if !ok {
+		return nil, fmt.Errorf("unsupported import method: %s", method)
+	}
+	return generateRSAKey(m.bits)
+}
+
+// UnwrapImportedKey recovers the formatted target key from wrappedKey using
+// the import job wrapping key in keyMaterial. Wrapped keys that do not
+// unwrap under the job's key yield ErrDecryption.
+func (e *TinkEngine) UnwrapImportedKey(ctx context.Context, keyMaterial KeyMaterial, method string, wrappedKey []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m, ok := importMethods[method]
+	if !ok {
+		return nil, fmt.Errorf("unsupported import method: %s", method)
+	}
+	key, err := parseRSAKey(keyMaterial)
+	if err != nil {
+		return nil, err
+	}
+	if !m.aesWrap {
+		if len(wrappedKey) != key.Size() {
+			return nil, fmt.Errorf("%w: wrapped key must be %d bytes", ErrDecryption, key.Size())
+		}
+		target, err := rsa.DecryptOAEP(m.hash.New(), nil, key, wrappedKey, nil)
+		if err != nil {
+			return nil, ErrDecryption
+		}
+		return target, nil
+	}
+
+	if len(wrappedKey) <= key.Size() {
+		return nil, fmt.Errorf("%w: wrapped key must be longer than %d bytes", ErrDecryption, key.Size())
+	}
+	aesKey, err := rsa.DecryptOAEP(m.hash.New(), nil, key, wrappedKey[:key.Size()], nil)
+	if err != nil || len(aesKey) != importAESKeySize {
+		return nil, ErrDecryption
+	}
+	defer clear(aesKey)
+	cipher, err := kwp.NewKWP(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	target, err := cipher.Unwrap(wrappedKey[key.Size():])
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	return target, nil
+}
+
+// WrapKeyForImport wraps a formatted target key for ImportCryptoKeyVersion
+// the way Cloud KMS clients do, using the PEM wrapping key of an import job
+// created with method. *_AES_256 methods wrap a fresh AES-256 key with
+// RSA-OAEP and the target key with AES-KWP (RFC 5649); the other methods
+// wrap the target key with RSA-OAEP directly.
+func WrapKeyForImport(publicKeyPEM []byte, method string, key []byte) ([]byte, error) {
+	m, ok := importMethods[method]
+	if !ok {
+		return nil, fmt.Errorf("unsupported import method: %s", method)
+	}
+	block, _ := pem.Decode(publicKeyPEM)
+	if block == nil {
+		return nil, errors.New("wrapping key is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse wrapping key: %w", err)
+	}
+	pub, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("wrapping key is %T, not an RSA key", parsed)
+	}
+	if !m.aesWrap {
+		return rsa.EncryptOAEP(m.hash.New(), rand.Reader, pub, key, nil)
+	}
+
+	aesKey := make([]byte, importAESKeySize)
+	if _, err := rand.Read(aesKey); err != nil {
+		return nil, err
+	}
+	defer clear(aesKey)
+	wrappedAESKey, err := rsa.EncryptOAEP(m.hash.New(), rand.Reader, pub, aesKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	cipher, err := kwp.NewKWP(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	wrappedTarget, err := cipher.Wrap(key)
+	if err != nil {
+		return nil, err
+	}
+	return append(wrappedAESKey, wrappedTarget...), nil
+}
+
+// ImportKeyMaterial converts an unwrapped key into the stored format of
+// algorithm. Symmetric keys are plain bytes of the algorithm's key size and
+// asymmetric keys PKCS#8 DER; secp256k1 keys use the secp256k1 curve OID.
+// Post-quantum keys cannot be imported. Keys that do not match algorithm
+// yield ErrInvalidKeyMaterial.
+func (e *TinkEngine) ImportKeyMaterial(ctx context.Context, algorithm string, key []byte) (KeyMaterial, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if algorithm == "GOOGLE_SYMMETRIC_ENCRYPTION" {
+		return importAESGCMKey(key)
+	}
+	if alg, ok := hmacAlgorithms[algorithm]; ok {
+		return importSymmetricKey(key, alg.keySize)
+	}
+	if alg, ok := rawAlgorithms[algorithm]; ok {
+		return importSymmetricKey(key, alg.keySize)
+	}
+	if alg, ok := rsaDecryptAlgorithms[algorithm]; ok {
+		return importRSAKey(key, alg.bits)
+	}
+	if alg, ok := rsaSignAlgorithms[algorithm]; ok {
+		return importRSAKey(key, alg.bits)
+	}
+	if curve, ok := ecAlgorithms[algorithm]; ok {
+		return importPKCS8Key(key, func(k crypto.PrivateKey) error {
+			ec, ok := k.(*ecdsa.PrivateKey)
+			if !ok {
+				return fmt.Errorf("key is %T, not an EC key", k)
+			}
+			if ec.Curve != curve {
+				return fmt.Errorf("key is on curve %s, want %s", ec.Curve.Params().Name, curve.Params().Name)
+			}
+			return nil
+		})
+	}
+	if algorithm == "EC_SIGN_ED25519" {
+		return importPKCS8Key(key, func(k crypto.PrivateKey) error {
+			if _, ok := k.(ed25519.PrivateKey); !ok {
+				return fmt.Errorf("key is %T, not an Ed25519 key", k)
+			}
+			return nil
+		})
+	}
+	if algorithm == "EC_SIGN_SECP256K1_SHA256" {
+		return importSecp256k1Key(key)
+	}
+	return nil, fmt.Errorf("%w: %s keys cannot be imported", ErrInvalidKeyMaterial, algorithm)
+}
+
+func importSymmetricKey(key []byte, size int) (KeyMaterial, error) {
+	if len(key) != size {
+		return nil, fmt.Errorf("%w: key must be %d bytes, got %d", ErrInvalidKeyMaterial, size, len(key))
+	}
+	return KeyMaterial(slices.Clone(key)), nil
+}
+
+// importAESGCMKey wraps a 32-byte AES key in a serialized AES256-GCM keyset,
+// the format GenerateKeyMaterial produces.
+func importAESGCMKey(key []byte) (KeyMaterial, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("%w: key must be 32 bytes, got %d", ErrInvalidKeyMaterial, len(key))
+	}
+	params, err := aesgcm.NewParameters(aesgcm.ParametersOpts{
+		KeySizeInBytes: 32,
+		IVSizeInBytes:  12,
+		TagSizeInBytes: 16,
+		Variant:        aesgcm.VariantNoPrefix,
+	})
+	if err != nil {
+		return nil, err
+	}
+	aesKey, err := aesgcm.NewKey(secretdata.NewBytesFromData(key, insecuresecretdataaccess.Token{}), 0, params)
+	if err != nil {
+		return nil, err
+	}
+	manager := keyset.NewManager()
+	id, err := manager.AddKey(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := manager.SetPrimary(id); err != nil {
+		return nil, err
+	}
+	handle, err := manager.Handle()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := insecurecleartextkeyset.Write(handle, keyset.NewBinaryWriter(&buf)); err != nil {
+		return nil, err
+	}
+	return KeyMaterial(buf.Bytes()), nil
+}
+
+func importRSAKey(key []byte, bits int) (KeyMaterial, error) {
+	return importPKCS8Key(key, func(k crypto.PrivateKey) error {
+		rsaKey, ok := k.(*rsa.PrivateKey)
+		if !ok {
+			return fmt.Errorf("key is %T, not an RSA key", k)
+		}
+		if got := rsaKey.N.BitLen(); got != bits {
+			return fmt.Errorf("key is %d bits, want %d", got, bits)
+		}
+		return nil
+	})
+}
+
+// importPKCS8Key parses a PKCS#8 private key, checks it with validate and
+// re-encodes it.
+func importPKCS8Key(key []byte, validate func(crypto.PrivateKey) error) (KeyMaterial, error) {
+	parsed, err := x509.ParsePKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: parse PKCS#8 key: %v", ErrInvalidKeyMaterial, err)
+	}
+	if err := validate(parsed); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKeyMaterial, err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("marshal private key: %w", err)
+	}
+	return KeyMaterial(der), nil
+}
+
+// pkcs8PrivateKeyInfo is the PrivateKeyInfo structure of RFC 5208.
+type pkcs8PrivateKeyInfo struct {
+	Version    int
+	Algorithm  pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// ecPrivateKey is the ECPrivateKey structure of RFC 5915.
+type ecPrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+// importSecp256k1Key extracts the raw scalar from a PKCS#8 secp256k1 key,
+// which crypto/x509 cannot parse.
+func importSecp256k1Key(key []byte) (KeyMaterial, error) {
+	var info pkcs8PrivateKeyInfo
+	if rest, err := asn1.Unmarshal(key, &info); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("%w: key is not PKCS#8 DER", ErrInvalidKeyMaterial)
+	}
+	var curve asn1.ObjectIdentifier
+	if !info.Algorithm.Algorithm.Equal(oidECPublicKey) {
+		return nil, fmt.Errorf("%w: key is not an EC key", ErrInvalidKeyMaterial)
+	}
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &curve); err != nil || !curve.Equal(oidSecp256k1) {
+		return nil, fmt.Errorf("%w: key is not on curve secp256k1", ErrInvalidKeyMaterial)
+	}
+	var ecKey ecPrivateKey
+	if rest, err := asn1.Unmarshal(info.PrivateKey, &ecKey); err != nil || len(rest) > 0 || ecKey.Version != 1 {
+		return nil, fmt.Errorf("%w: malformed EC private key", ErrInvalidKeyMaterial)
+	}
+	if len(ecKey.PrivateKey) > 32 {
+		return nil, fmt.Errorf("%w: secp256k1 private key must be at most 32 bytes", ErrInvalidKeyMaterial)
+	}
+	scalar := padTo32(ecKey.PrivateKey)
+	var s btcec.ModNScalar
+	if overflow := s.SetByteSlice(scalar); overflow || s.IsZero() {
+		return nil, fmt.Errorf("%w: secp256k1 private key is out of range", ErrInvalidKeyMaterial)
+	}
+	return KeyMaterial(slices.Clone(scalar)), nil
+}
@@ -0,0 +1,170 @@
+package kmscrypto
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+func TestWrapAndUnwrapImportedKey(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := NewTinkEngine()
+
+	for _, method := range []string{"RSA_OAEP_3072_SHA1_AES_256", "RSA_OAEP_3072_SHA256"} {
+		t.Run(method, func(t *testing.T) {
+			t.Parallel()
+			jobKey, err := engine.GenerateImportJobKeyMaterial(ctx, method)
+			if err != nil {
+				t.Fatalf("generate import job key: %v", err)
+			}
+			publicKey, err := engine.GetPublicKeyPEM(ctx, jobKey, method)
+			if err != nil {
+				t.Fatalf("get wrapping key: %v", err)
+			}
+
+			target := bytes.Repeat([]byte{7}, 32)
+			wrapped, err := WrapKeyForImport(publicKey, method, target)
+			if err != nil {
+				t.Fatalf("wrap key: %v", err)
+			}
+			got, err := engine.UnwrapImportedKey(ctx, jobKey, method, wrapped)
+			if err != nil {
+				t.Fatalf("unwrap key: %v", err)
+			}
+			if !bytes.Equal(got, target) {
+				t.Fatalf("unwrapped key = %x, want %x", got, target)
+			}
+
+			wrapped[len(wrapped)-1] ^= 1
+			if _, err := engine.UnwrapImportedKey(ctx, jobKey, method, wrapped); !errors.Is(err, ErrDecryption) {
+				t.Fatalf("unwrap tampered key: got %v, want ErrDecryption", err)
+			}
+			if _, err := engine.UnwrapImportedKey(ctx, jobKey, method, wrapped[:16]); !errors.Is(err, ErrDecryption) {
+				t.Fatalf("unwrap truncated key: got %v, want ErrDecryption", err)
+			}
+		})
+	}
+}
+
+func TestImportKeyMaterial(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := NewTinkEngine()
+
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate p256 key: %v", err)
+	}
+	p256DER, err := x509.MarshalPKCS8PrivateKey(p256)
+	if err != nil {
+		t.Fatalf("marshal p256 key: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ed25519 key: %v", err)
+	}
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatalf("marshal ed25519 key: %v", err)
+	}
+	secp, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatalf("generate secp256k1 key: %v", err)
+	}
+
+	t.Run("symmetric key encrypts", func(t *testing.T) {
+		material, err := engine.ImportKeyMaterial(ctx, "GOOGLE_SYMMETRIC_ENCRYPTION", bytes.Repeat([]byte{1}, 32))
+		if err != nil {
+			t.Fatalf("import key: %v", err)
+		}
+		ciphertext, err := engine.Encrypt(ctx, material, []byte("hello"), nil)
+		if err != nil {
+			t.Fatalf("encrypt: %v", err)
+		}
+		plaintext, err := engine.Decrypt(ctx, material, ciphertext, nil)
+		if err != nil || string(plaintext) != "hello" {
+			t.Fatalf("decrypt = %q, %v", plaintext, err)
+		}
+	})
+
+	t.Run("p256 key signs", func(t *testing.T) {
+		material, err := engine.ImportKeyMaterial(ctx, "EC_SIGN_P256_SHA256", p256DER)
+		if err != nil {
+			t.Fatalf("import key: %v", err)
+		}
+		digest := make([]byte, 32)
+		sig, err := engine.Sign(ctx, material, "EC_SIGN_P256_SHA256", digest)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		if !ecdsa.VerifyASN1(&p256.PublicKey, digest, sig) {
+			t.Fatal("signature does not verify with the imported key")
+		}
+	})
+
+	t.Run("secp256k1 key keeps its scalar", func(t *testing.T) {
+		material, err := engine.ImportKeyMaterial(ctx, "EC_SIGN_SECP256K1_SHA256", marshalSecp256k1PKCS8(t, secp))
+		if err != nil {
+			t.Fatalf("import key: %v", err)
+		}
+		if !bytes.Equal(material, secp.Serialize()) {
+			t.Fatalf("material = %x, want %x", material, secp.Serialize())
+		}
+	})
+
+	for _, tc := range []struct {
+		name      string
+		algorithm string
+		key       []byte
+	}{
+		{"short AES key", "AES_256_GCM", make([]byte, 16)},
+		{"wrong HMAC size", "HMAC_SHA256", make([]byte, 20)},
+		{"wrong curve", "EC_SIGN_P384_SHA384", p256DER},
+		{"EC key as Ed25519", "EC_SIGN_ED25519", p256DER},
+		{"Ed25519 key as RSA", "RSA_SIGN_PSS_2048_SHA256", edDER},
+		{"P-256 key as secp256k1", "EC_SIGN_SECP256K1_SHA256", p256DER},
+		{"not DER", "EC_SIGN_P256_SHA256", []byte("garbage")},
+		{"post-quantum", "PQ_SIGN_ML_DSA_65", make([]byte, 32)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := engine.ImportKeyMaterial(ctx, tc.algorithm, tc.key); !errors.Is(err, ErrInvalidKeyMaterial) {
+				t.Fatalf("import: got %v, want ErrInvalidKeyMaterial", err)
+			}
+		})
+	}
+}
+
+// marshalSecp256k1PKCS8 encodes key as PKCS#8 DER with the secp256k1 OID.
+func marshalSecp256k1PKCS8(t *testing.T, key *btcec.PrivateKey) []byte {
+	t.Helper()
+	curve, err := asn1.Marshal(oidSecp256k1)
+	if err != nil {
+		t.Fatalf("marshal curve: %v", err)
+	}
+	inner, err := asn1.Marshal(ecPrivateKey{Version: 1, PrivateKey: key.Serialize()})
+	if err != nil {
+		t.Fatalf("marshal ec private key: %v", err)
+	}
+	der, err := asn1.Marshal(pkcs8PrivateKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidECPublicKey,
+			Parameters: asn1.RawValue{FullBytes: curve},
+		},
+		PrivateKey: inner,
+	})
+	if err != nil {
+		t.Fatalf("marshal pkcs8: %v", err)
+	}
+	return der
+}
@@ -0,0 +1,196 @@
+package kmscrypto
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/mlkem"
+	"crypto/rand"
+	"crypto/sha3"
+	"fmt"
+)
+
+// kemSeedSizes maps Cloud KMS key encapsulation algorithm names to the size
+// of the private seed stored as their KeyMaterial. ML-KEM keys are stored as
+// the 64-byte FIPS 203 seed (d || z) and X-Wing keys as the 32-byte seed of
+// draft-connolly-cfrg-xwing-kem.
+var kemSeedSizes = map[string]int{
+	"ML_KEM_768":  mlkem.SeedSize,
+	"ML_KEM_1024": mlkem.SeedSize,
+	"KEM_XWING":   xwingSeedSize,
+}
+
+const (
+	xwingSeedSize = 32
+	// XWingCiphertextSize is the size of an X-Wing ciphertext: an ML-KEM-768
+	// ciphertext followed by an X25519 public key.
+	XWingCiphertextSize = mlkem.CiphertextSize768 + 32
+)
+
+// xwingLabel is the domain separator appended to the X-Wing combiner input.
+var xwingLabel = []byte(`\.//^\`)
+
+func generateKEMKey(algorithm string) (KeyMaterial, error) {
+	seed := make([]byte, kemSeedSizes[algorithm])
+	if _, err := rand.Read(seed); err != nil {
+		return nil, fmt.Errorf("generate kem seed: %w", err)
+	}
+	return KeyMaterial(seed), nil
+}
+
+// GetRawPublicKey returns the public key of a post-quantum algorithm in its
+// standard raw encoding: the FIPS 203 encapsulation key for ML-KEM, the
+// 1216-byte X-Wing public key for KEM_XWING, and the FIPS 204/205 public key
+// for ML-DSA/SLH-DSA.
+func (e *TinkEngine) GetRawPublicKey(ctx context.Context, keyMaterial KeyMaterial, algorithm string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if _, ok := pqSignAlgorithms[algorithm]; ok {
+		return pqPublicKey(keyMaterial, algorithm)
+	}
+	switch algorithm {
+	case "ML_KEM_768":
+		dk, err := mlkem.NewDecapsulationKey768(keyMaterial)
+		if err != nil {
+			return nil, err
+		}
+		return dk.EncapsulationKey().Bytes(), nil
+	case "ML_KEM_1024":
+		dk, err := mlkem.NewDecapsulationKey1024(keyMaterial)
+		if err != nil {
+			return nil, err
+		}
+		return dk.EncapsulationKey().Bytes(), nil
+	case "KEM_XWING":
+		key, err := expandXWingKey(keyMaterial)
+		if err != nil {
+			return nil, err
+		}
+		return key.publicKey(), nil
+	default:
+		return nil, fmt.Errorf("unsupported algorithm: %s", algorithm)
+	}
+}
+
+// Decapsulate recovers the shared secret encapsulated in ciphertext. A
+// ciphertext of the wrong size yields ErrDecryption; as ML-KEM uses implicit
+// rejection, other invalid ciphertexts produce an unrelated shared secret.
+func (e *TinkEngine) Decapsulate(ctx context.Context, keyMaterial KeyMaterial, algorithm string, ciphertext []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	switch algorithm {
+	case "ML_KEM_768":
+		if len(ciphertext) != mlkem.CiphertextSize768 {
+			return nil, fmt.Errorf("%w: ciphertext must be %d bytes", ErrDecryption, mlkem.CiphertextSize768)
+		}
+		dk, err := mlkem.NewDecapsulationKey768(keyMaterial)
+		if err != nil {
+			return nil, err
+		}
+		return dk.Decapsulate(ciphertext)
+	case "ML_KEM_1024":
+		if len(ciphertext) != mlkem.CiphertextSize1024 {
+			return nil, fmt.Errorf("%w: ciphertext must be %d bytes", ErrDecryption, mlkem.CiphertextSize1024)
+		}
+		dk, err := mlkem.NewDecapsulationKey1024(keyMaterial)
+		if err != nil {
+			return nil, err
+		}
+		return dk.Decapsulate(ciphertext)
+	case "KEM_XWING":
+		if len(ciphertext) != XWingCiphertextSize {
+			return nil, fmt.Errorf("%w: ciphertext must be %d bytes", ErrDecryption, XWingCiphertextSize)
+		}
+		key, err := expandXWingKey(keyMaterial)
+		if err != nil {
+			return nil, err
+		}
+		return key.decapsulate(ciphertext)
+	default:
+		return nil, fmt.Errorf("unsupported algorithm: %s", algorithm)
+	}
+}
+
+// xwingKey is an expanded X-Wing private key.
+type xwingKey struct {
+	mlkem  *mlkem.DecapsulationKey768
+	x25519 *ecdh.PrivateKey
+}
+
+func expandXWingKey(seed []byte) (*xwingKey, error) {
+	if len(seed) != xwingSeedSize {
+		return nil, fmt.Errorf("x-wing seed must be %d bytes", xwingSeedSize)
+	}
+	expanded := sha3.SumSHAKE256(seed, 96)
+	dk, err := mlkem.NewDecapsulationKey768(expanded[:64])
+	if err != nil {
+		return nil, err
+	}
+	sk, err := ecdh.X25519().NewPrivateKey(expanded[64:96])
+	if err != nil {
+		return nil, err
+	}
+	return &xwingKey{mlkem: dk, x25519: sk}, nil
+}
+
+func (k *xwingKey) publicKey() []byte {
+	return append(k.mlkem.EncapsulationKey().Bytes(), k.x25519.PublicKey().Bytes()...)
+}
+
+func (k *xwingKey) decapsulate(ciphertext []byte) ([]byte, error) {
+	ctM, ctX := ciphertext[:mlkem.CiphertextSize768], ciphertext[mlkem.CiphertextSize768:]
+	ssM, err := k.mlkem.Decapsulate(ctM)
+	if err != nil {
+		return nil, err
+	}
+	peer, err := ecdh.X25519().NewPublicKey(ctX)
+	if err != nil {
+		return nil, err
+	}
+	ssX, err := k.x25519.ECDH(peer)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecryption, err)
+	}
+	return xwingCombine(ssM, ssX, ctX, k.x25519.PublicKey().Bytes()), nil
+}
+
+// EncapsulateXWing encapsulates a fresh shared secret to an X-Wing public key
+// as returned in the XWING_RAW_BYTES format. It is the client-side
+// counterpart of Decapsulate, which the standard library does not provide.
+func EncapsulateXWing(publicKey []byte) (sharedSecret, ciphertext []byte, err error) {
+	if len(publicKey) != mlkem.EncapsulationKeySize768+32 {
+		return nil, nil, fmt.Errorf("x-wing public key must be %d bytes", mlkem.EncapsulationKeySize768+32)
+	}
+	pkM, pkX := publicKey[:mlkem.EncapsulationKeySize768], publicKey[mlkem.EncapsulationKeySize768:]
+	ek, err := mlkem.NewEncapsulationKey768(pkM)
+	if err != nil {
+		return nil, nil, err
+	}
+	peer, err := ecdh.X25519().NewPublicKey(pkX)
+	if err != nil {
+		return nil, nil, err
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	ssX, err := ephemeral.ECDH(peer)
+	if err != nil {
+		return nil, nil, err
+	}
+	ssM, ctM := ek.Encapsulate()
+	ctX := ephemeral.PublicKey().Bytes()
+	return xwingCombine(ssM, ssX, ctX, pkX), append(ctM, ctX...), nil
+}
+
+// xwingCombine derives the X-Wing shared secret from its ML-KEM and X25519 parts.
+func xwingCombine(ssM, ssX, ctX, pkX []byte) []byte {
+	h := sha3.New256()
+	h.Write(ssM)
+	h.Write(ssX)
+	h.Write(ctX)
+	h.Write(pkX)
+	h.Write(xwingLabel)
+	return h.Sum(nil)
+}
@@ -0,0 +1,85 @@
+package kmscrypto
+
+import (
+	"bytes"
+	"context"
+	"crypto/mlkem"
+	"errors"
+	"testing"
+)
+
+func TestTinkEngineMLKEMDecapsulate(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := NewTinkEngine()
+
+	tests := []struct {
+		algorithm    string
+		encapsulate  func(t *testing.T, publicKey []byte) (sharedSecret, ciphertext []byte)
+		publicKeyLen int
+	}{
+		{
+			algorithm: "ML_KEM_768",
+			encapsulate: func(t *testing.T, publicKey []byte) ([]byte, []byte) {
+				ek, err := mlkem.NewEncapsulationKey768(publicKey)
+				if err != nil {
+					t.Fatalf("parse encapsulation key: %v", err)
+				}
+				return ek.Encapsulate()
+			},
+			publicKeyLen: mlkem.EncapsulationKeySize768,
+		},
+		{
+			algorithm: "ML_KEM_1024",
+			encapsulate: func(t *testing.T, publicKey []byte) ([]byte, []byte) {
+				ek, err := mlkem.NewEncapsulationKey1024(publicKey)
+				if err != nil {
+					t.Fatalf("parse encapsulation key: %v", err)
+				}
+				return ek.Encapsulate()
+			},
+			publicKeyLen: mlkem.EncapsulationKeySize1024,
+		},
+		{
+			algorithm: "KEM_XWING",
+			encapsulate: func(t *testing.T, publicKey []byte) ([]byte, []byte) {
+				sharedSecret, ciphertext, err := EncapsulateXWing(publicKey)
+				if err != nil {
+					t.Fatalf("encapsulate: %v", err)
+				}
+				return sharedSecret, ciphertext
+			},
+			publicKeyLen: mlkem.EncapsulationKeySize768 + 32,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			t.Parallel()
+			material, err := engine.GenerateAsymmetricKeyMaterial(ctx, tt.algorithm)
+			if err != nil {
+				t.Fatalf("generate key material: %v", err)
+			}
+			publicKey, err := engine.GetRawPublicKey(ctx, material, tt.algorithm)
+			if err != nil {
+				t.Fatalf("get public key: %v", err)
+			}
+			if len(publicKey) != tt.publicKeyLen {
+				t.Fatalf("public key length = %d, want %d", len(publicKey), tt.publicKeyLen)
+			}
+
+			want, ciphertext := tt.encapsulate(t, publicKey)
+			got, err := engine.Decapsulate(ctx, material, tt.algorithm, ciphertext)
+			if err != nil {
+				t.Fatalf("decapsulate: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatal("shared secret mismatch")
+			}
+
+			if _, err := engine.Decapsulate(ctx, material, tt.algorithm, ciphertext[1:]); !errors.Is(err, ErrDecryption) {
+				t.Fatalf("truncated ciphertext error = %v, want ErrDecryption", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package kmscrypto
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"sync/atomic"
+)
+
+// rsaPoolSize is the number of spare RSA keys kept ready per modulus size.
+const rsaPoolSize = 2
+
+// rsaKeyPool hands out RSA keys generated ahead of time in the background,
+// so creating RSA key versions does not stall on prime generation. Every key
+// taken schedules a replacement; when the pool is empty the key is generated
+// inline. Pools only do work for modulus sizes that are actually used.
+type rsaKeyPool struct {
+	bits    int
+	ready   chan *rsa.PrivateKey
+	pending atomic.Int32
+}
+
+// rsaKeyPools holds one pool per supported modulus size, shared by all engines.
+var rsaKeyPools = map[int]*rsaKeyPool{
+	2048: newRSAKeyPool(2048),
+	3072: newRSAKeyPool(3072),
+	4096: newRSAKeyPool(4096),
+}
+
+func newRSAKeyPool(bits int) *rsaKeyPool {
+	return &rsaKeyPool{bits: bits, ready: make(chan *rsa.PrivateKey, rsaPoolSize)}
+}
+
+func (p *rsaKeyPool) get() (*rsa.PrivateKey, error) {
+	defer p.refill()
+	select {
+	case key := <-p.ready:
+		return key, nil
+	default:
+		return rsa.GenerateKey(rand.Reader, p.bits)
+	}
+}
+
+// refill starts background generation until the pool, counting keys still
+// being generated, is full again.
+func (p *rsaKeyPool) refill() {
+	for int(p.pending.Load())+len(p.ready) < rsaPoolSize {
+		p.pending.Add(1)
+		go func() {
+			defer p.pending.Add(-1)
+			key, err := rsa.GenerateKey(rand.Reader, p.bits)
+			if err != nil {
+				return
+			}
+			select {
+			case p.ready <- key:
+			default:
+			}
+		}()
+	}
+}
@@ -0,0 +1,66 @@
+package kmscrypto
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+)
+
+// hmacAlgorithms maps Cloud KMS HMAC algorithm names to their hash function
+// and key size in bytes. Key sizes follow the Cloud KMS defaults, which equal
+// the digest size of the underlying hash.
+var hmacAlgorithms = map[string]struct {
+	hash    func() hash.Hash
+	keySize int
+}{
+	"HMAC_SHA1":   {sha1.New, sha1.Size},
+	"HMAC_SHA224": {sha256.New224, sha256.Size224},
+	"HMAC_SHA256": {sha256.New, sha256.Size},
+	"HMAC_SHA384": {sha512.New384, sha512.Size384},
+	"HMAC_SHA512": {sha512.New, sha512.Size},
+}
+
+// GenerateMacKeyMaterial generates a random HMAC key for algorithm and
+// returns the raw key bytes as KeyMaterial.
+func (e *TinkEngine) GenerateMacKeyMaterial(ctx context.Context, algorithm string) (KeyMaterial, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	alg, ok := hmacAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported algorithm: %s", algorithm)
+	}
+	key := make([]byte, alg.keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate hmac key: %w", err)
+	}
+	return KeyMaterial(key), nil
+}
+
+// MacSign computes the HMAC tag of data using the key stored in keyMaterial.
+func (e *TinkEngine) MacSign(ctx context.Context, keyMaterial KeyMaterial, algorithm string, data []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	alg, ok := hmacAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported algorithm: %s", algorithm)
+	}
+	mac := hmac.New(alg.hash, keyMaterial)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+// MacVerify reports whether tag is the HMAC of data, comparing in constant time.
+func (e *TinkEngine) MacVerify(ctx context.Context, keyMaterial KeyMaterial, algorithm string, data, tag []byte) (bool, error) {
+	expected, err := e.MacSign(ctx, keyMaterial, algorithm, data)
+	if err != nil {
+		return false, err
+	}
+	return hmac.Equal(expected, tag), nil
+}
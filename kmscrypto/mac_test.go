@@ -0,0 +1,69 @@
+package kmscrypto
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestTinkEngineMacSignAndVerify(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := NewTinkEngine()
+
+	for algorithm, alg := range hmacAlgorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			material, err := engine.GenerateMacKeyMaterial(ctx, algorithm)
+			if err != nil {
+				t.Fatalf("generate mac key material: %v", err)
+			}
+			if len(material) != alg.keySize {
+				t.Fatalf("key size = %d, want %d", len(material), alg.keySize)
+			}
+
+			data := []byte("webhook payload")
+			tag, err := engine.MacSign(ctx, material, algorithm, data)
+			if err != nil {
+				t.Fatalf("mac sign: %v", err)
+			}
+			ok, err := engine.MacVerify(ctx, material, algorithm, data, tag)
+			if err != nil || !ok {
+				t.Fatalf("mac verify = %v, %v; want true", ok, err)
+			}
+			ok, err = engine.MacVerify(ctx, material, algorithm, []byte("tampered"), tag)
+			if err != nil || ok {
+				t.Fatalf("mac verify of tampered data = %v, %v; want false", ok, err)
+			}
+		})
+	}
+}
+
+func TestTinkEngineMacSignMatchesStdlib(t *testing.T) {
+	t.Parallel()
+	key := []byte("0123456789abcdef0123456789abcdef")
+	data := []byte("payload")
+
+	tag, err := NewTinkEngine().MacSign(context.Background(), key, "HMAC_SHA256", data)
+	if err != nil {
+		t.Fatalf("mac sign: %v", err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	if !hmac.Equal(tag, mac.Sum(nil)) {
+		t.Fatal("tag does not match crypto/hmac")
+	}
+}
+
+func TestTinkEngineMac_UnsupportedAlgorithm(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := NewTinkEngine()
+
+	if _, err := engine.GenerateMacKeyMaterial(ctx, "HMAC_MD5"); err == nil {
+		t.Fatal("expected error for unsupported algorithm")
+	}
+	if _, err := engine.MacSign(ctx, []byte("key"), "EC_SIGN_SECP256K1_SHA256", nil); err == nil {
+		t.Fatal("expected error for non-MAC algorithm")
+	}
+}
@@ -0,0 +1,121 @@
+package kmscrypto
+
+import (
+	"fmt"
+
+	"github.com/tink-crypto/tink-go/v2/insecuresecretdataaccess"
+	"github.com/tink-crypto/tink-go/v2/key"
+	"github.com/tink-crypto/tink-go/v2/keyset"
+	"github.com/tink-crypto/tink-go/v2/secretdata"
+	"github.com/tink-crypto/tink-go/v2/signature"
+	"github.com/tink-crypto/tink-go/v2/signature/mldsa"
+	"github.com/tink-crypto/tink-go/v2/signature/slhdsa"
+)
+
+// pqSignAlgorithms maps post-quantum signing algorithms to the tink
+// parameters of their keys. Keys carry no output prefix, so signatures are the
+// bare FIPS 204/205 encoding that Cloud KMS returns.
+var pqSignAlgorithms = map[string]func() (key.Parameters, error){
+	"PQ_SIGN_ML_DSA_65": func() (key.Parameters, error) {
+		return mldsa.NewParameters(mldsa.MLDSA65, mldsa.VariantNoPrefix)
+	},
+	"PQ_SIGN_SLH_DSA_SHA2_128S": func() (key.Parameters, error) {
+		return slhdsa.NewParameters(slhdsa.SHA2, 64, slhdsa.SmallSignature, slhdsa.VariantNoPrefix)
+	},
+}
+
+// pqPrivateKey is implemented by the tink ML-DSA and SLH-DSA private keys.
+type pqPrivateKey interface {
+	key.Key
+	PrivateKeyBytes() secretdata.Bytes
+	PublicKey() (key.Key, error)
+}
+
+// generatePQSignKey returns the private key bytes of a new key: the 32-byte
+// seed for ML-DSA and the full secret key for SLH-DSA.
+func generatePQSignKey(algorithm string) (KeyMaterial, error) {
+	params, err := pqSignAlgorithms[algorithm]()
+	if err != nil {
+		return nil, err
+	}
+	manager := keyset.NewManager()
+	id, err := manager.AddNewKeyFromParameters(params)
+	if err != nil {
+		return nil, fmt.Errorf("generate %s key: %w", algorithm, err)
+	}
+	if err := manager.SetPrimary(id); err != nil {
+		return nil, err
+	}
+	handle, err := manager.Handle()
+	if err != nil {
+		return nil, err
+	}
+	entry, err := handle.Primary()
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := entry.Key().(pqPrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("generated key is %T, not a post-quantum private key", entry.Key())
+	}
+	return KeyMaterial(priv.PrivateKeyBytes().Data(insecuresecretdataaccess.Token{})), nil
+}
+
+func parsePQSignKey(keyMaterial KeyMaterial, algorithm string) (pqPrivateKey, error) {
+	params, err := pqSignAlgorithms[algorithm]()
+	if err != nil {
+		return nil, err
+	}
+	secret := secretdata.NewBytesFromData(keyMaterial, insecuresecretdataaccess.Token{})
+	switch p := params.(type) {
+	case *mldsa.Parameters:
+		return mldsa.NewPrivateKey(secret, 0, p)
+	case *slhdsa.Parameters:
+		return slhdsa.NewPrivateKey(secret, 0, p)
+	default:
+		return nil, fmt.Errorf("unexpected parameters %T", params)
+	}
+}
+
+// signPQ signs the full message; ML-DSA and SLH-DSA keys are used in their
+// pure mode with an empty context string.
+func signPQ(keyMaterial KeyMaterial, algorithm string, message []byte) ([]byte, error) {
+	priv, err := parsePQSignKey(keyMaterial, algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s key: %w", algorithm, err)
+	}
+	manager := keyset.NewManager()
+	id, err := manager.AddKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	if err := manager.SetPrimary(id); err != nil {
+		return nil, err
+	}
+	handle, err := manager.Handle()
+	if err != nil {
+		return nil, err
+	}
+	signer, err := signature.NewSigner(handle)
+	if err != nil {
+		return nil, err
+	}
+	return signer.Sign(message)
+}
+
+// pqPublicKey returns the FIPS 204/205 encoding of the public key.
+func pqPublicKey(keyMaterial KeyMaterial, algorithm string) ([]byte, error) {
+	priv, err := parsePQSignKey(keyMaterial, algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s key: %w", algorithm, err)
+	}
+	pub, err := priv.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := pub.(interface{ KeyBytes() []byte })
+	if !ok {
+		return nil, fmt.Errorf("public key is %T, not a post-quantum public key", pub)
+	}
+	return raw.KeyBytes(), nil
+}
@@ -0,0 +1,92 @@
+package kmscrypto
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tink-crypto/tink-go/v2/key"
+	"github.com/tink-crypto/tink-go/v2/keyset"
+	"github.com/tink-crypto/tink-go/v2/signature"
+	"github.com/tink-crypto/tink-go/v2/signature/mldsa"
+	"github.com/tink-crypto/tink-go/v2/signature/slhdsa"
+)
+
+func TestTinkEnginePQSignAndVerify(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := NewTinkEngine()
+
+	tests := []struct {
+		algorithm    string
+		publicKeyLen int
+		publicKey    func(raw []byte, params key.Parameters) (key.Key, error)
+	}{
+		{
+			algorithm:    "PQ_SIGN_ML_DSA_65",
+			publicKeyLen: 1952,
+			publicKey: func(raw []byte, params key.Parameters) (key.Key, error) {
+				return mldsa.NewPublicKey(raw, 0, params.(*mldsa.Parameters))
+			},
+		},
+		{
+			algorithm:    "PQ_SIGN_SLH_DSA_SHA2_128S",
+			publicKeyLen: 32,
+			publicKey: func(raw []byte, params key.Parameters) (key.Key, error) {
+				return slhdsa.NewPublicKey(raw, 0, params.(*slhdsa.Parameters))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			t.Parallel()
+			material, err := engine.GenerateAsymmetricKeyMaterial(ctx, tt.algorithm)
+			if err != nil {
+				t.Fatalf("generate key material: %v", err)
+			}
+			message := []byte("firmware image")
+			sig, err := engine.Sign(ctx, material, tt.algorithm, message)
+			if err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+
+			raw, err := engine.GetRawPublicKey(ctx, material, tt.algorithm)
+			if err != nil {
+				t.Fatalf("get public key: %v", err)
+			}
+			if len(raw) != tt.publicKeyLen {
+				t.Fatalf("public key length = %d, want %d", len(raw), tt.publicKeyLen)
+			}
+			params, err := pqSignAlgorithms[tt.algorithm]()
+			if err != nil {
+				t.Fatalf("parameters: %v", err)
+			}
+			pub, err := tt.publicKey(raw, params)
+			if err != nil {
+				t.Fatalf("parse public key: %v", err)
+			}
+			manager := keyset.NewManager()
+			id, err := manager.AddKey(pub)
+			if err != nil {
+				t.Fatalf("add public key: %v", err)
+			}
+			if err := manager.SetPrimary(id); err != nil {
+				t.Fatalf("set primary: %v", err)
+			}
+			handle, err := manager.Handle()
+			if err != nil {
+				t.Fatalf("handle: %v", err)
+			}
+			verifier, err := signature.NewVerifier(handle)
+			if err != nil {
+				t.Fatalf("new verifier: %v", err)
+			}
+			if err := verifier.Verify(sig, message); err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			if err := verifier.Verify(sig, []byte("tampered")); err == nil {
+				t.Fatal("verify succeeded for a different message")
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package kmscrypto
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+)
+
+const (
+	// GCMIVSize is the nonce size used for AES-GCM raw encryption.
+	GCMIVSize = 12
+	// GCMTagSize is the default AES-GCM authentication tag size.
+	GCMTagSize = 16
+)
+
+// rawAlgorithms maps Cloud KMS raw AES algorithm names to their key size in
+// bytes and block cipher mode.
+var rawAlgorithms = map[string]struct {
+	keySize int
+	mode    string
+}{
+	"AES_128_GCM": {16, "GCM"},
+	"AES_256_GCM": {32, "GCM"},
+	"AES_128_CBC": {16, "CBC"},
+	"AES_256_CBC": {32, "CBC"},
+	"AES_128_CTR": {16, "CTR"},
+	"AES_256_CTR": {32, "CTR"},
+}
+
+// GenerateRawKeyMaterial generates a random AES key for algorithm and returns
+// the raw key bytes as KeyMaterial.
+func (e *TinkEngine) GenerateRawKeyMaterial(ctx context.Context, algorithm string) (KeyMaterial, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	alg, ok := rawAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported algorithm: %s", algorithm)
+	}
+	key := make([]byte, alg.keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate aes key: %w", err)
+	}
+	return KeyMaterial(key), nil
+}
+
+// RawEncrypt encrypts plaintext with the AES key stored in keyMaterial. When
+// iv is empty a random one is generated. AES-GCM ciphertexts carry the
+// authentication tag appended. It returns the ciphertext and the IV used.
+func (e *TinkEngine) RawEncrypt(ctx context.Context, keyMaterial KeyMaterial, algorithm string, plaintext, associatedData, iv []byte) ([]byte, []byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	mode, block, err := rawCipher(keyMaterial, algorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(iv) == 0 {
+		size := aes.BlockSize
+		if mode == "GCM" {
+			size = GCMIVSize
+		}
+		iv = make([]byte, size)
+		if _, err := rand.Read(iv); err != nil {
+			return nil, nil, fmt.Errorf("generate iv: %w", err)
+		}
+	}
+
+	switch mode {
+	case "GCM":
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(iv) != aead.NonceSize() {
+			return nil, nil, fmt.Errorf("iv must be %d bytes", aead.NonceSize())
+		}
+		return aead.Seal(nil, iv, plaintext, associatedData), iv, nil
+	case "CBC":
+		if len(iv) != aes.BlockSize {
+			return nil, nil, fmt.Errorf("iv must be %d bytes", aes.BlockSize)
+		}
+		if len(plaintext)%aes.BlockSize != 0 {
+			return nil, nil, fmt.Errorf("plaintext length must be a multiple of %d bytes", aes.BlockSize)
+		}
+		out := make([]byte, len(plaintext))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, plaintext)
+		return out, iv, nil
+	default: // CTR
+		if len(iv) != aes.BlockSize {
+			return nil, nil, fmt.Errorf("iv must be %d bytes", aes.BlockSize)
+		}
+		out := make([]byte, len(plaintext))
+		cipher.NewCTR(block, iv).XORKeyStream(out, plaintext)
+		return out, iv, nil
+	}
+}
+
+// RawDecrypt decrypts ciphertext produced by RawEncrypt. For AES-GCM,
+// tagLength is the size of the tag appended to ciphertext.
+func (e *TinkEngine) RawDecrypt(ctx context.Context, keyMaterial KeyMaterial, algorithm string, ciphertext, associatedData, iv []byte, tagLength int) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	mode, block, err := rawCipher(keyMaterial, algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	switch mode {
+	case "GCM":
+		aead, err := cipher.NewGCMWithTagSize(block, tagLength)
+		if err != nil {
+			return nil, err
+		}
+		if len(iv) != aead.NonceSize() {
+			return nil, fmt.Errorf("iv must be %d bytes", aead.NonceSize())
+		}
+		return aead.Open(nil, iv, ciphertext, associatedData)
+	case "CBC":
+		if len(iv) != aes.BlockSize {
+			return nil, fmt.Errorf("iv must be %d bytes", aes.BlockSize)
+		}
+		if len(ciphertext)%aes.BlockSize != 0 {
+			return nil, fmt.Errorf("ciphertext length must be a multiple of %d bytes", aes.BlockSize)
+		}
+		out := make([]byte, len(ciphertext))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, ciphertext)
+		return out, nil
+	default: // CTR
+		if len(iv) != aes.BlockSize {
+			return nil, fmt.Errorf("iv must be %d bytes", aes.BlockSize)
+		}
+		out := make([]byte, len(ciphertext))
+		cipher.NewCTR(block, iv).XORKeyStream(out, ciphertext)
+		return out, nil
+	}
+}
+
+func rawCipher(keyMaterial KeyMaterial, algorithm string) (string, cipher.Block, error) {
+	alg, ok := rawAlgorithms[algorithm]
+	if !ok {
+		return "", nil, fmt.Errorf("unsupported algorithm: %s", algorithm)
+	}
+	block, err := aes.NewCipher(keyMaterial)
+	if err != nil {
+		return "", nil, err
+	}
+	return alg.mode, block, nil
+}
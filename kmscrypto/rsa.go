@@ -0,0 +1,132 @@
+package kmscrypto
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// ErrDecryption is returned when a ciphertext cannot be decrypted with the
+// given key, for example because it was produced for a different key.
+var ErrDecryption = errors.New("decryption failed")
+
+// rsaDecryptAlgorithms maps Cloud KMS RSA-OAEP algorithm names to their
+// modulus size in bits and OAEP hash.
+var rsaDecryptAlgorithms = map[string]struct {
+	bits int
+	hash crypto.Hash
+}{
+	"RSA_DECRYPT_OAEP_2048_SHA256": {2048, crypto.SHA256},
+	"RSA_DECRYPT_OAEP_3072_SHA256": {3072, crypto.SHA256},
+	"RSA_DECRYPT_OAEP_4096_SHA256": {4096, crypto.SHA256},
+	"RSA_DECRYPT_OAEP_4096_SHA512": {4096, crypto.SHA512},
+	"RSA_DECRYPT_OAEP_2048_SHA1":   {2048, crypto.SHA1},
+	"RSA_DECRYPT_OAEP_3072_SHA1":   {3072, crypto.SHA1},
+	"RSA_DECRYPT_OAEP_4096_SHA1":   {4096, crypto.SHA1},
+}
+
+// AsymmetricDecrypt decrypts an RSA-OAEP ciphertext with the private key
+// stored in keyMaterial. Ciphertexts that do not decrypt under the key
+// yield ErrDecryption.
+func (e *TinkEngine) AsymmetricDecrypt(ctx context.Context, keyMaterial KeyMaterial, algorithm string, ciphertext []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	alg, ok := rsaDecryptAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported algorithm: %s", algorithm)
+	}
+	key, err := parseRSAKey(keyMaterial)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) != key.Size() {
+		return nil, fmt.Errorf("%w: ciphertext must be %d bytes", ErrDecryption, key.Size())
+	}
+	plaintext, err := rsa.DecryptOAEP(alg.hash.New(), nil, key, ciphertext, nil)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	return plaintext, nil
+}
+
+// rsaSignAlgorithms maps Cloud KMS RSA signing algorithm names to their
+// modulus size in bits, digest and padding. RAW_PKCS1 algorithms have no
+// digest and sign the caller's data as-is.
+var rsaSignAlgorithms = map[string]struct {
+	bits int
+	hash crypto.Hash
+	pss  bool
+}{
+	"RSA_SIGN_PSS_2048_SHA256":   {2048, crypto.SHA256, true},
+	"RSA_SIGN_PSS_3072_SHA256":   {3072, crypto.SHA256, true},
+	"RSA_SIGN_PSS_4096_SHA256":   {4096, crypto.SHA256, true},
+	"RSA_SIGN_PSS_4096_SHA512":   {4096, crypto.SHA512, true},
+	"RSA_SIGN_PKCS1_2048_SHA256": {2048, crypto.SHA256, false},
+	"RSA_SIGN_PKCS1_3072_SHA256": {3072, crypto.SHA256, false},
+	"RSA_SIGN_PKCS1_4096_SHA256": {4096, crypto.SHA256, false},
+	"RSA_SIGN_PKCS1_4096_SHA512": {4096, crypto.SHA512, false},
+	"RSA_SIGN_RAW_PKCS1_2048":    {2048, 0, false},
+	"RSA_SIGN_RAW_PKCS1_3072":    {3072, 0, false},
+	"RSA_SIGN_RAW_PKCS1_4096":    {4096, 0, false},
+}
+
+// signRSA signs digest, or the raw data for RAW_PKCS1 algorithms, with the
+// padding of algorithm. PSS signatures use a salt as long as the digest.
+func signRSA(keyMaterial KeyMaterial, algorithm string, digest []byte) ([]byte, error) {
+	alg := rsaSignAlgorithms[algorithm]
+	key, err := parseRSAKey(keyMaterial)
+	if err != nil {
+		return nil, err
+	}
+	if alg.pss {
+		return rsa.SignPSS(rand.Reader, key, alg.hash, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	}
+	return rsa.SignPKCS1v15(nil, key, alg.hash, digest)
+}
+
+func generateRSAKey(bits int) (KeyMaterial, error) {
+	key, err := rsaKeyPools[bits].get()
+	if err != nil {
+		return nil, fmt.Errorf("generate rsa key: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("marshal rsa key: %w", err)
+	}
+	return KeyMaterial(der), nil
+}
+
+func parseRSAKey(keyMaterial KeyMaterial) (*rsa.PrivateKey, error) {
+	parsed, err := x509.ParsePKCS8PrivateKey(keyMaterial)
+	if err != nil {
+		return nil, fmt.Errorf("parse rsa key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("key material is %T, not an RSA key", parsed)
+	}
+	return key, nil
+}
+
+// pkcs8PublicKeyPEM returns the PKIX/PEM public key of a PKCS#8 private key.
+func pkcs8PublicKeyPEM(keyMaterial KeyMaterial) ([]byte, error) {
+	parsed, err := x509.ParsePKCS8PrivateKey(keyMaterial)
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("key material is %T, not an asymmetric key", parsed)
+	}
+	der, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, fmt.Errorf("marshal public key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
@@ -0,0 +1,121 @@
+package kmscrypto
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+)
+
+func TestTinkEngineAsymmetricDecrypt(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := NewTinkEngine()
+
+	material, err := engine.GenerateAsymmetricKeyMaterial(ctx, "RSA_DECRYPT_OAEP_2048_SHA256")
+	if err != nil {
+		t.Fatalf("generate rsa key material: %v", err)
+	}
+	pemBytes, err := engine.GetPublicKeyPEM(ctx, material, "RSA_DECRYPT_OAEP_2048_SHA256")
+	if err != nil {
+		t.Fatalf("get public key: %v", err)
+	}
+	block, _ := pem.Decode(pemBytes)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		t.Fatalf("unexpected PEM: %s", pemBytes)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("parse public key: %v", err)
+	}
+	pub, ok := parsed.(*rsa.PublicKey)
+	if !ok || pub.Size() != 256 {
+		t.Fatalf("public key = %T, want 2048-bit RSA", parsed)
+	}
+
+	ciphertext, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, []byte("secret"), nil)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	plaintext, err := engine.AsymmetricDecrypt(ctx, material, "RSA_DECRYPT_OAEP_2048_SHA256", ciphertext)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if !bytes.Equal(plaintext, []byte("secret")) {
+		t.Fatalf("plaintext = %q, want %q", plaintext, "secret")
+	}
+
+	// The same ciphertext does not decrypt under a different OAEP hash.
+	if _, err := engine.AsymmetricDecrypt(ctx, material, "RSA_DECRYPT_OAEP_2048_SHA1", ciphertext); !errors.Is(err, ErrDecryption) {
+		t.Fatalf("decrypt with wrong hash: got %v, want ErrDecryption", err)
+	}
+	if _, err := engine.AsymmetricDecrypt(ctx, material, "RSA_DECRYPT_OAEP_2048_SHA256", ciphertext[:10]); !errors.Is(err, ErrDecryption) {
+		t.Fatalf("decrypt truncated ciphertext: got %v, want ErrDecryption", err)
+	}
+}
+
+func TestTinkEngineRSASign(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	engine := NewTinkEngine()
+	data := []byte("signed release")
+	digest := sha256.Sum256(data)
+
+	for _, tt := range []struct {
+		algorithm string
+		input     []byte
+		verify    func(pub *rsa.PublicKey, sig []byte) error
+	}{
+		{"RSA_SIGN_PKCS1_2048_SHA256", digest[:], func(pub *rsa.PublicKey, sig []byte) error {
+			return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig)
+		}},
+		{"RSA_SIGN_PSS_2048_SHA256", digest[:], func(pub *rsa.PublicKey, sig []byte) error {
+			return rsa.VerifyPSS(pub, crypto.SHA256, digest[:], sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}},
+		{"RSA_SIGN_RAW_PKCS1_2048", data, func(pub *rsa.PublicKey, sig []byte) error {
+			return rsa.VerifyPKCS1v15(pub, 0, data, sig)
+		}},
+	} {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			material, err := engine.GenerateAsymmetricKeyMaterial(ctx, tt.algorithm)
+			if err != nil {
+				t.Fatalf("generate rsa key material: %v", err)
+			}
+			sig, err := engine.Sign(ctx, material, tt.algorithm, tt.input)
+			if err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+			key, err := parseRSAKey(material)
+			if err != nil {
+				t.Fatalf("parse key: %v", err)
+			}
+			if err := tt.verify(&key.PublicKey, sig); err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+		})
+	}
+}
+
+func TestRSAKeyPool(t *testing.T) {
+	t.Parallel()
+	seen := map[string]bool{}
+	for range rsaPoolSize + 1 {
+		key, err := rsaKeyPools[2048].get()
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		if key.N.BitLen() != 2048 {
+			t.Fatalf("modulus = %d bits, want 2048", key.N.BitLen())
+		}
+		if seen[key.N.String()] {
+			t.Fatal("pool handed out the same key twice")
+		}
+		seen[key.N.String()] = true
+	}
+}
@@ -30,11 +30,48 @@ type CryptoKeyVersion struct {
 	Version string
 }
 
+// ImportJob identifies an import job resource.
+type ImportJob struct {
+	KeyRing
+	ImportJob string
+}
+
+// KeyHandle identifies an Autokey key handle resource.
+type KeyHandle struct {
+	Location
+	KeyHandle string
+}
+
+// EkmConnection identifies an EKM connection resource.
+type EkmConnection struct {
+	Location
+	EkmConnection string
+}
+
+// Operation identifies a long-running operation.
+type Operation struct {
+	Location
+	Operation string
+}
+
 var (
+	folderPattern  = regexp.MustCompile(`^[0-9]{1,32}$`)
 	idPattern      = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,63}$`)
 	versionPattern = regexp.MustCompile(`^[0-9]+$`)
 )
 
+// ParseProject parses projects/<project> and returns the project ID.
+func ParseProject(name string) (string, error) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 2 || parts[0] != "projects" {
+		return "", fmt.Errorf("invalid project name %q", name)
+	}
+	if err := validateID("project", parts[1]); err != nil {
+		return "", fmt.Errorf("invalid project name %q: %w", name, err)
+	}
+	return parts[1], nil
+}
+
 // ParseLocation parses projects/<project>/locations/<location>.
 func ParseLocation(name string) (Location, error) {
 	parts := strings.Split(name, "/")
@@ -127,6 +164,130 @@ func ParseCryptoKeyVersion(name string) (CryptoKeyVersion, error) {
 	}, nil
 }
 
+// ParseImportJob parses projects/<project>/locations/<location>/keyRings/<keyRing>/importJobs/<importJob>.
+func ParseImportJob(name string) (ImportJob, error) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 8 || parts[0] != "projects" || parts[2] != "locations" || parts[4] != "keyRings" || parts[6] != "importJobs" {
+		return ImportJob{}, fmt.Errorf("invalid import job name %q", name)
+	}
+	for _, label := range []struct {
+		kind string
+		val  string
+	}{
+		{"project", parts[1]},
+		{"location", parts[3]},
+		{"key_ring", parts[5]},
+		{"import_job", parts[7]},
+	} {
+		if err := validateID(label.kind, label.val); err != nil {
+			return ImportJob{}, fmt.Errorf("invalid import job name %q: %w", name, err)
+		}
+	}
+	return ImportJob{
+		KeyRing:   KeyRing{Location: Location{Project: parts[1], Location: parts[3]}, KeyRing: parts[5]},
+		ImportJob: parts[7],
+	}, nil
+}
+
+// ParseKeyHandle parses projects/<project>/locations/<location>/keyHandles/<keyHandle>.
+func ParseKeyHandle(name string) (KeyHandle, error) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 6 || parts[0] != "projects" || parts[2] != "locations" || parts[4] != "keyHandles" {
+		return KeyHandle{}, fmt.Errorf("invalid key handle name %q", name)
+	}
+	for _, label := range []struct {
+		kind string
+		val  string
+	}{
+		{"project", parts[1]},
+		{"location", parts[3]},
+		{"key_handle", parts[5]},
+	} {
+		if err := validateID(label.kind, label.val); err != nil {
+			return KeyHandle{}, fmt.Errorf("invalid key handle name %q: %w", name, err)
+		}
+	}
+	return KeyHandle{Location: Location{Project: parts[1], Location: parts[3]}, KeyHandle: parts[5]}, nil
+}
+
+// ParseEkmConnection parses projects/<project>/locations/<location>/ekmConnections/<ekmConnection>.
+func ParseEkmConnection(name string) (EkmConnection, error) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 6 || parts[0] != "projects" || parts[2] != "locations" || parts[4] != "ekmConnections" {
+		return EkmConnection{}, fmt.Errorf("invalid ekm connection name %q", name)
+	}
+	for _, label := range []struct {
+		kind string
+		val  string
+	}{
+		{"project", parts[1]},
+		{"location", parts[3]},
+		{"ekm_connection", parts[5]},
+	} {
+		if err := validateID(label.kind, label.val); err != nil {
+			return EkmConnection{}, fmt.Errorf("invalid ekm connection name %q: %w", name, err)
+		}
+	}
+	return EkmConnection{Location: Location{Project: parts[1], Location: parts[3]}, EkmConnection: parts[5]}, nil
+}
+
+// ParseEkmConfig parses projects/<project>/locations/<location>/ekmConfig and
+// returns its location.
+func ParseEkmConfig(name string) (Location, error) {
+	parent, ok := strings.CutSuffix(name, "/ekmConfig")
+	if !ok {
+		return Location{}, fmt.Errorf("invalid ekm config name %q", name)
+	}
+	loc, err := ParseLocation(parent)
+	if err != nil {
+		return Location{}, fmt.Errorf("invalid ekm config name %q: %w", name, err)
+	}
+	return loc, nil
+}
+
+// ParseOperation parses projects/<project>/locations/<location>/operations/<operation>.
+func ParseOperation(name string) (Operation, error) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 6 || parts[0] != "projects" || parts[2] != "locations" || parts[4] != "operations" {
+		return Operation{}, fmt.Errorf("invalid operation name %q", name)
+	}
+	for _, label := range []struct {
+		kind string
+		val  string
+	}{
+		{"project", parts[1]},
+		{"location", parts[3]},
+		{"operation", parts[5]},
+	} {
+		if err := validateID(label.kind, label.val); err != nil {
+			return Operation{}, fmt.Errorf("invalid operation name %q: %w", name, err)
+		}
+	}
+	return Operation{Location: Location{Project: parts[1], Location: parts[3]}, Operation: parts[5]}, nil
+}
+
+// ParseAutokeyConfig parses folders/<folder>/autokeyConfig or
+// projects/<project>/autokeyConfig and returns the folder or project name.
+func ParseAutokeyConfig(name string) (string, error) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 3 || parts[2] != "autokeyConfig" {
+		return "", fmt.Errorf("invalid autokey config name %q", name)
+	}
+	switch parts[0] {
+	case "folders":
+		if !folderPattern.MatchString(parts[1]) {
+			return "", fmt.Errorf("invalid autokey config name %q: folder must be numeric", name)
+		}
+	case "projects":
+		if err := validateID("project", parts[1]); err != nil {
+			return "", fmt.Errorf("invalid autokey config name %q: %w", name, err)
+		}
+	default:
+		return "", fmt.Errorf("invalid autokey config name %q", name)
+	}
+	return parts[0] + "/" + parts[1], nil
+}
+
 // Format helpers.
 func (l Location) ParentName() string {
 	return fmt.Sprintf("projects/%s/locations/%s", l.Project, l.Location)
@@ -144,6 +305,27 @@ func (v CryptoKeyVersion) ResourceName() string {
 	return fmt.Sprintf("%s/cryptoKeyVersions/%s", v.CryptoKey.ResourceName(), v.Version)
 }
 
+func (j ImportJob) ResourceName() string {
+	return fmt.Sprintf("%s/importJobs/%s", j.KeyRing.ResourceName(), j.ImportJob)
+}
+
+func (h KeyHandle) ResourceName() string {
+	return fmt.Sprintf("%s/keyHandles/%s", h.ParentName(), h.KeyHandle)
+}
+
+func (c EkmConnection) ResourceName() string {
+	return fmt.Sprintf("%s/ekmConnections/%s", c.ParentName(), c.EkmConnection)
+}
+
+// EkmConfigName returns the name of the location's EkmConfig singleton.
+func (l Location) EkmConfigName() string {
+	return l.ParentName() + "/ekmConfig"
+}
+
+func (o Operation) ResourceName() string {
+	return fmt.Sprintf("%s/operations/%s", o.ParentName(), o.Operation)
+}
+
 // FormatCryptoKeyVersion builds a crypto key version resource name.
 func FormatCryptoKeyVersion(cryptoKeyName, version string) string {
 	return fmt.Sprintf("%s/cryptoKeyVersions/%s", cryptoKeyName, version)
@@ -7,6 +7,14 @@ import (
 )
 
 func TestParseAndFormatResources(t *testing.T) {
+	project, err := names.ParseProject("projects/demo")
+	if err != nil {
+		t.Fatalf("parse project: %v", err)
+	}
+	if project != "demo" {
+		t.Fatalf("project mismatch: %s", project)
+	}
+
 	loc, err := names.ParseLocation("projects/demo/locations/global")
 	if err != nil {
 		t.Fatalf("parse location: %v", err)
@@ -38,6 +46,55 @@ func TestParseAndFormatResources(t *testing.T) {
 	if got := ver.ResourceName(); got != "projects/demo/locations/global/keyRings/app/cryptoKeys/pair/cryptoKeyVersions/1" {
 		t.Fatalf("version resource mismatch: %s", got)
 	}
+
+	job, err := names.ParseImportJob("projects/demo/locations/global/keyRings/app/importJobs/byok")
+	if err != nil {
+		t.Fatalf("parse import job: %v", err)
+	}
+	if got := job.ResourceName(); got != "projects/demo/locations/global/keyRings/app/importJobs/byok" {
+		t.Fatalf("import job resource mismatch: %s", got)
+	}
+
+	handle, err := names.ParseKeyHandle("projects/demo/locations/us-east1/keyHandles/bucket")
+	if err != nil {
+		t.Fatalf("parse key handle: %v", err)
+	}
+	if got := handle.ResourceName(); got != "projects/demo/locations/us-east1/keyHandles/bucket" {
+		t.Fatalf("key handle resource mismatch: %s", got)
+	}
+
+	conn, err := names.ParseEkmConnection("projects/demo/locations/us-east1/ekmConnections/vpc")
+	if err != nil {
+		t.Fatalf("parse ekm connection: %v", err)
+	}
+	if got := conn.ResourceName(); got != "projects/demo/locations/us-east1/ekmConnections/vpc" {
+		t.Fatalf("ekm connection resource mismatch: %s", got)
+	}
+	ekmConfig, err := names.ParseEkmConfig("projects/demo/locations/us-east1/ekmConfig")
+	if err != nil {
+		t.Fatalf("parse ekm config: %v", err)
+	}
+	if got := ekmConfig.EkmConfigName(); got != "projects/demo/locations/us-east1/ekmConfig" {
+		t.Fatalf("ekm config resource mismatch: %s", got)
+	}
+
+	op, err := names.ParseOperation("projects/demo/locations/us-east1/operations/5e1b0c2a-0d4f-4c1e-9a7b-3f2d1c0b9a8e")
+	if err != nil {
+		t.Fatalf("parse operation: %v", err)
+	}
+	if got := op.ResourceName(); got != "projects/demo/locations/us-east1/operations/5e1b0c2a-0d4f-4c1e-9a7b-3f2d1c0b9a8e" {
+		t.Fatalf("operation resource mismatch: %s", got)
+	}
+
+	for name, want := range map[string]string{
+		"folders/123/autokeyConfig":   "folders/123",
+		"projects/demo/autokeyConfig": "projects/demo",
+	} {
+		got, err := names.ParseAutokeyConfig(name)
+		if err != nil || got != want {
+			t.Fatalf("ParseAutokeyConfig(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
 }
 
 func TestParseRejectsInvalidIDs(t *testing.T) {
@@ -46,6 +103,25 @@ func TestParseRejectsInvalidIDs(t *testing.T) {
 		name string
 		call func() error
 	}{
+		{
+			name: "non-numeric folder",
+			call: func() error { _, err := names.ParseAutokeyConfig("folders/eng/autokeyConfig"); return err },
+		},
+		{
+			name: "ekm config without location",
+			call: func() error { _, err := names.ParseEkmConfig("projects/demo/ekmConfig"); return err },
+		},
+		{
+			name: "key handle in key ring",
+			call: func() error {
+				_, err := names.ParseKeyHandle("projects/demo/locations/global/keyRings/app/keyHandles/h")
+				return err
+			},
+		},
+		{
+			name: "project with location",
+			call: func() error { _, err := names.ParseProject("projects/demo/locations/global"); return err },
+		},
 		{
 			name: "invalid project",
 			call: func() error { _, err := names.ParseLocation("projects/!/locations/global"); return err },
@@ -71,6 +147,13 @@ func TestParseRejectsInvalidIDs(t *testing.T) {
 				return err
 			},
 		},
+		{
+			name: "crypto key as import job",
+			call: func() error {
+				_, err := names.ParseImportJob("projects/demo/locations/global/keyRings/app/cryptoKeys/pair")
+				return err
+			},
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
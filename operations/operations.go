@@ -0,0 +1,265 @@
+// Package operations tracks the google.longrunning operations started by the
+// emulator and decides when they complete.
+package operations
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/winor30/fake-cloud-kms/clock"
+)
+
+// clockPollInterval bounds how long Wait sleeps between checks of a
+// clock-timed operation, whose clock may resume without notice.
+const clockPollInterval = 50 * time.Millisecond
+
+// MaxRetained is how many finished operations a Registry remembers. Once
+// more have finished, the oldest are forgotten and reading them fails with
+// NotFound, as Cloud KMS eventually forgets finished operations too.
+const MaxRetained = 1000
+
+// Timing controls when operations complete. The zero value completes every
+// operation before Start returns.
+type Timing struct {
+	// Delay is how long an operation stays pending after Start.
+	Delay time.Duration
+	// UseClock measures Delay on the registry's clock instead of wall time,
+	// so operations on a frozen virtual clock complete only once it is
+	// advanced past their due time.
+	UseClock bool
+}
+
+// Work performs an operation and returns its response. It runs once, when
+// the operation completes; an error becomes the operation's error.
+type Work func(ctx context.Context) (proto.Message, error)
+
+// Registry holds operations in memory. It is safe for concurrent use.
+type Registry struct {
+	clock  clock.Clock
+	timing Timing
+	// unwatch stops settling operations when the clock jumps.
+	unwatch func()
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	// finished holds the names of finished operations, oldest first.
+	finished []string
+}
+
+type entry struct {
+	op *longrunningpb.Operation
+	// run performs the operation's work with the context of the RPC that
+	// started it, detached from its cancellation.
+	run func() (proto.Message, error)
+	// due is the completion time, on the registry clock when timing.UseClock
+	// is set and on the wall clock otherwise.
+	due time.Time
+	// running is set while run executes, outside the registry lock.
+	running bool
+	done    chan struct{}
+}
+
+// New returns an empty registry completing operations according to timing.
+// When c is Observable, clock-timed operations complete as soon as it jumps
+// past their due time.
+func New(c clock.Clock, timing Timing) *Registry {
+	r := &Registry{clock: c, timing: timing, unwatch: func() {}, entries: map[string]*entry{}}
+	if observable, ok := c.(clock.Observable); ok && timing.UseClock {
+		r.unwatch = observable.OnChange(func(time.Time) { r.settle() })
+	}
+	return r
+}
+
+// Close stops completing operations when the clock jumps, so a clock shared
+// with other registries no longer keeps this one reachable. Operations still
+// complete when read.
+func (r *Registry) Close() {
+	r.unwatch()
+}
+
+// Start registers the operation name with metadata and schedules work. With
+// no delay, work runs before Start returns and the operation is already done.
+func (r *Registry) Start(ctx context.Context, name string, metadata proto.Message, work Work) (*longrunningpb.Operation, error) {
+	packed, err := anypb.New(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("pack operation metadata: %w", err)
+	}
+	detached := context.WithoutCancel(ctx)
+	e := &entry{
+		op:   &longrunningpb.Operation{Name: name, Metadata: packed},
+		run:  func() (proto.Message, error) { return work(detached) },
+		due:  r.timeBase().Add(r.timing.Delay),
+		done: make(chan struct{}),
+	}
+
+	r.mu.Lock()
+	if _, exists := r.entries[name]; exists {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("operation %q already exists", name)
+	}
+	r.entries[name] = e
+	r.mu.Unlock()
+
+	if r.timing.Delay <= 0 {
+		r.settle()
+	} else {
+		time.AfterFunc(r.timing.Delay, r.settle)
+	}
+	return r.Get(name)
+}
+
+// Get returns a snapshot of the operation name, completing it first if it is
+// due. It fails with NotFound for an unknown operation.
+func (r *Registry) Get(name string) (*longrunningpb.Operation, error) {
+	r.settle()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.entries[name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "operation %q not found", name)
+	}
+	return proto.Clone(e.op).(*longrunningpb.Operation), nil
+}
+
+// Done reports whether the operation name exists and is done. Unlike Get, it
+// never runs due work.
+func (r *Registry) Done(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.entries[name]
+	return ok && e.op.GetDone()
+}
+
+// List returns snapshots of the operations directly under parent, e.g.
+// "projects/p/locations/l", sorted by name.
+func (r *Registry) List(parent string) []*longrunningpb.Operation {
+	r.settle()
+	prefix := parent + "/operations/"
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ops []*longrunningpb.Operation
+	for _, name := range slices.Sorted(maps.Keys(r.entries)) {
+		if id, ok := strings.CutPrefix(name, prefix); ok && !strings.Contains(id, "/") {
+			ops = append(ops, proto.Clone(r.entries[name].op).(*longrunningpb.Operation))
+		}
+	}
+	return ops
+}
+
+// Wait blocks until the operation name is done, timeout elapses (when
+// positive) or ctx ends, and returns its latest state, which is still
+// pending if it did not finish in time.
+func (r *Registry) Wait(ctx context.Context, name string, timeout time.Duration) (*longrunningpb.Operation, error) {
+	r.mu.Lock()
+	e, ok := r.entries[name]
+	r.mu.Unlock()
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "operation %q not found", name)
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	var poll <-chan time.Time
+	if r.timing.UseClock {
+		ticker := time.NewTicker(clockPollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+	for {
+		r.settle()
+		select {
+		case <-e.done:
+		case <-expired:
+		case <-ctx.Done():
+		case <-poll:
+			continue
+		}
+		// Snapshot e itself: the operation may already have been forgotten.
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return proto.Clone(e.op).(*longrunningpb.Operation), nil
+	}
+}
+
+// Cancel completes a pending operation with a CANCELLED error without running
+// its work. Operations that are done or already running are left as they are.
+func (r *Registry) Cancel(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.entries[name]
+	if !ok {
+		return status.Errorf(codes.NotFound, "operation %q not found", name)
+	}
+	if e.op.GetDone() || e.running {
+		return nil
+	}
+	e.op.Result = &longrunningpb.Operation_Error{Error: status.New(codes.Canceled, "operation was cancelled").Proto()}
+	r.finishLocked(e)
+	return nil
+}
+
+// settle runs the work of every due operation. Each operation's work runs
+// exactly once, in whichever caller claims it first.
+func (r *Registry) settle() {
+	now := r.timeBase()
+	r.mu.Lock()
+	var due []*entry
+	for _, e := range r.entries {
+		if !e.op.GetDone() && !e.running && !now.Before(e.due) {
+			e.running = true
+			due = append(due, e)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, e := range due {
+		response, err := e.run()
+		var packed *anypb.Any
+		if err == nil {
+			packed, err = anypb.New(response)
+		}
+		r.mu.Lock()
+		if err != nil {
+			e.op.Result = &longrunningpb.Operation_Error{Error: status.Convert(err).Proto()}
+		} else {
+			e.op.Result = &longrunningpb.Operation_Response{Response: packed}
+		}
+		e.running = false
+		r.finishLocked(e)
+		r.mu.Unlock()
+	}
+}
+
+// finishLocked marks e done and forgets the oldest finished operations beyond
+// MaxRetained. The caller holds mu and has set e's result.
+func (r *Registry) finishLocked(e *entry) {
+	e.op.Done = true
+	close(e.done)
+	r.finished = append(r.finished, e.op.GetName())
+	for len(r.finished) > MaxRetained {
+		delete(r.entries, r.finished[0])
+		r.finished = r.finished[1:]
+	}
+}
+
+func (r *Registry) timeBase() time.Time {
+	if r.timing.UseClock {
+		return r.clock.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,213 @@
+package operations_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/winor30/fake-cloud-kms/clock"
+	"github.com/winor30/fake-cloud-kms/operations"
+)
+
+const parent = "projects/demo/locations/global"
+
+func TestImmediate(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	r := operations.New(clock.Real(), operations.Timing{})
+
+	op, err := r.Start(ctx, parent+"/operations/ok", &emptypb.Empty{}, respond("done"))
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	requireResponse(t, op, "done")
+
+	op, err = r.Start(ctx, parent+"/operations/failed", &emptypb.Empty{}, func(context.Context) (proto.Message, error) {
+		return nil, status.Error(codes.FailedPrecondition, "not ready")
+	})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if !op.GetDone() || codes.Code(op.GetError().GetCode()) != codes.FailedPrecondition {
+		t.Fatalf("failed operation = %v", op)
+	}
+
+	if _, err := r.Start(ctx, parent+"/operations/ok", &emptypb.Empty{}, respond("again")); err == nil {
+		t.Fatal("starting a duplicate operation succeeded")
+	}
+	_, err = r.Get(parent + "/operations/missing")
+	requireCode(t, err, codes.NotFound)
+
+	listed := r.List(parent)
+	if len(listed) != 2 || listed[0].GetName() != parent+"/operations/failed" || listed[1].GetName() != parent+"/operations/ok" {
+		t.Fatalf("listed operations = %v", listed)
+	}
+	if len(r.List("projects/demo/locations/us")) != 0 {
+		t.Fatal("operations listed under another location")
+	}
+}
+
+func TestDelayed(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	r := operations.New(clock.Real(), operations.Timing{Delay: 50 * time.Millisecond})
+
+	op, err := r.Start(ctx, parent+"/operations/slow", &emptypb.Empty{}, respond("done"))
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if op.GetDone() {
+		t.Fatalf("operation done before its delay: %v", op)
+	}
+	op, err = r.Wait(ctx, op.GetName(), 0)
+	if err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	requireResponse(t, op, "done")
+}
+
+func TestClockTimed(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clk := clock.NewVirtual(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	clk.Freeze()
+	r := operations.New(clk, operations.Timing{Delay: time.Hour, UseClock: true})
+
+	ran := 0
+	op, err := r.Start(ctx, parent+"/operations/pinned", &emptypb.Empty{}, func(context.Context) (proto.Message, error) {
+		ran++
+		return wrapperspb.String("done"), nil
+	})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	cancelled, err := r.Start(ctx, parent+"/operations/cancelled", &emptypb.Empty{}, respond("never"))
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	op, err = r.Wait(ctx, op.GetName(), 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	if op.GetDone() || ran != 0 {
+		t.Fatalf("operation done on a frozen clock: %v", op)
+	}
+	deadlineCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	op, err = r.Wait(deadlineCtx, op.GetName(), 0)
+	if err != nil || op.GetDone() {
+		t.Fatalf("wait until the deadline = %v, %v; want the pending operation", op, err)
+	}
+
+	if err := r.Cancel(cancelled.GetName()); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if err := clk.Advance(time.Hour); err != nil {
+		t.Fatalf("advance: %v", err)
+	}
+	op, err = r.Get(op.GetName())
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	requireResponse(t, op, "done")
+	if ran != 1 {
+		t.Fatalf("work ran %d times", ran)
+	}
+
+	cancelled, err = r.Get(cancelled.GetName())
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if !cancelled.GetDone() || codes.Code(cancelled.GetError().GetCode()) != codes.Canceled {
+		t.Fatalf("cancelled operation = %v", cancelled)
+	}
+	if err := r.Cancel(op.GetName()); err != nil {
+		t.Fatalf("cancel a done operation: %v", err)
+	}
+	requireCode(t, r.Cancel(parent+"/operations/missing"), codes.NotFound)
+}
+
+func TestCloseStopsFollowingTheClock(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clk := clock.NewVirtual(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	clk.Freeze()
+	r := operations.New(clk, operations.Timing{Delay: time.Hour, UseClock: true})
+
+	ran := 0
+	op, err := r.Start(ctx, parent+"/operations/pinned", &emptypb.Empty{}, func(context.Context) (proto.Message, error) {
+		ran++
+		return wrapperspb.String("done"), nil
+	})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	r.Close()
+	if err := clk.Advance(time.Hour); err != nil {
+		t.Fatalf("advance: %v", err)
+	}
+	if ran != 0 {
+		t.Fatal("a closed registry completed an operation when the clock jumped")
+	}
+
+	op, err = r.Get(op.GetName())
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	requireResponse(t, op, "done")
+}
+
+func TestRetention(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	r := operations.New(clock.Real(), operations.Timing{})
+
+	var names []string
+	for i := range operations.MaxRetained + 1 {
+		op, err := r.Start(ctx, fmt.Sprintf("%s/operations/op-%04d", parent, i), &emptypb.Empty{}, respond("done"))
+		if err != nil {
+			t.Fatalf("start: %v", err)
+		}
+		names = append(names, op.GetName())
+	}
+
+	_, err := r.Get(names[0])
+	requireCode(t, err, codes.NotFound)
+	if _, err := r.Get(names[1]); err != nil {
+		t.Fatalf("get a retained operation: %v", err)
+	}
+	if got := len(r.List(parent)); got != operations.MaxRetained {
+		t.Fatalf("listed %d operations, want %d", got, operations.MaxRetained)
+	}
+}
+
+func respond(value string) operations.Work {
+	return func(context.Context) (proto.Message, error) {
+		return wrapperspb.String(value), nil
+	}
+}
+
+func requireResponse(t *testing.T, op *longrunningpb.Operation, want string) {
+	t.Helper()
+	var got wrapperspb.StringValue
+	if !op.GetDone() || op.GetResponse().UnmarshalTo(&got) != nil || got.GetValue() != want {
+		t.Fatalf("operation = %v, want done with %q", op, want)
+	}
+}
+
+func requireCode(t *testing.T, err error, want codes.Code) {
+	t.Helper()
+	if got := status.Code(err); got != want {
+		t.Fatalf("status code = %v (%v), want %v", got, err, want)
+	}
+}
@@ -4,17 +4,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"os"
+	"time"
 
 	"google.golang.org/grpc"
 
+	"github.com/winor30/fake-cloud-kms/clock"
 	"github.com/winor30/fake-cloud-kms/kmscrypto"
+	"github.com/winor30/fake-cloud-kms/operations"
 	"github.com/winor30/fake-cloud-kms/seed"
 	"github.com/winor30/fake-cloud-kms/service"
 	"github.com/winor30/fake-cloud-kms/store"
 	"github.com/winor30/fake-cloud-kms/store/memory"
+	"github.com/winor30/fake-cloud-kms/transport/admin"
 	grpcserver "github.com/winor30/fake-cloud-kms/transport/grpc"
 )
 
@@ -30,13 +35,41 @@ type Options struct {
 	Logger *slog.Logger
 	// GRPCServerOptions allows passing extra grpc.ServerOption values.
 	GRPCServerOptions []grpc.ServerOption
+	// Entropy optionally replaces the source of GenerateRandomBytes output.
+	// Defaults to crypto/rand; a deterministic reader makes the bytes predictable.
+	Entropy io.Reader
+	// Clock optionally supplies the virtual clock behind timestamps, scheduled
+	// destruction and rotation. Defaults to a running clock starting at the
+	// current time.
+	Clock *clock.Virtual
+	// AdminListenAddr enables the HTTP admin API, which controls the clock,
+	// on this address. Empty disables it.
+	AdminListenAddr string
+	// EnforceIAM makes every RPC require the caller's cloudkms.* permission,
+	// as granted by the stored IAM policies. Callers identify themselves with
+	// a bearer token or the grpcserver.PrincipalHeader metadata.
+	EnforceIAM bool
+	// Locations optionally replaces the catalog served by ListLocations and
+	// GetLocation. Defaults to service.DefaultLocations.
+	Locations []service.Location
+	// StrictLocations makes Create RPCs reject locations missing from the
+	// catalog.
+	StrictLocations bool
+	// OperationTiming controls when long-running operations complete.
+	// Defaults to completing them before the RPC that starts them returns.
+	OperationTiming operations.Timing
 }
 
 // Instance represents a running emulator.
 type Instance struct {
 	// Addr is the listen address (host:port).
 	Addr string
-	stop func(context.Context) error
+	// AdminAddr is the admin API listen address, empty unless enabled.
+	AdminAddr string
+	// Clock controls the emulator's notion of time; moving it forward fires
+	// due rotations and destructions.
+	Clock *clock.Virtual
+	stop  func(context.Context) error
 }
 
 // Stop gracefully shuts down the emulator, waiting for in-flight RPCs to finish.
@@ -48,7 +81,7 @@ func (i *Instance) Stop(ctx context.Context) error {
 }
 
 // Start launches the emulator in-process and returns an Instance handle.
-func Start(ctx context.Context, opts Options) (*Instance, error) {
+func Start(ctx context.Context, opts Options) (_ *Instance, err error) {
 	if opts.ListenAddr == "" {
 		opts.ListenAddr = "127.0.0.1:0"
 	}
@@ -63,8 +96,32 @@ func Start(ctx context.Context, opts Options) (*Instance, error) {
 		strg = memory.New()
 	}
 
+	clk := opts.Clock
+	if clk == nil {
+		clk = clock.NewVirtual(time.Now())
+	}
+
 	engine := kmscrypto.NewTinkEngine()
-	svc := service.New(strg, engine)
+	svcOpts := []service.Option{service.WithClock(clk)}
+	if opts.Entropy != nil {
+		svcOpts = append(svcOpts, service.WithEntropy(opts.Entropy))
+	}
+	if opts.Locations != nil {
+		svcOpts = append(svcOpts, service.WithLocations(opts.Locations))
+	}
+	if opts.StrictLocations {
+		svcOpts = append(svcOpts, service.WithStrictLocations())
+	}
+	if opts.OperationTiming != (operations.Timing{}) {
+		svcOpts = append(svcOpts, service.WithOperationTiming(opts.OperationTiming))
+	}
+	svc := service.New(strg, engine, svcOpts...)
+	defer func() {
+		if err != nil {
+			// Detach the service from a caller-supplied clock.
+			svc.Close()
+		}
+	}()
 
 	if opts.SeedFile != "" {
 		if err := seed.Apply(ctx, svc, opts.SeedFile); err != nil {
@@ -78,30 +135,60 @@ func Start(ctx context.Context, opts Options) (*Instance, error) {
 		return nil, fmt.Errorf("listen: %w", err)
 	}
 
-	srv := grpcserver.New(svc, opts.GRPCServerOptions...)
+	var adminLis net.Listener
+	if opts.AdminListenAddr != "" {
+		adminLis, err = lc.Listen(ctx, "tcp", opts.AdminListenAddr)
+		if err != nil {
+			_ = lis.Close()
+			return nil, fmt.Errorf("listen admin: %w", err)
+		}
+	}
+
+	grpcOpts := opts.GRPCServerOptions
+	if opts.EnforceIAM {
+		grpcOpts = append([]grpc.ServerOption{grpc.ChainUnaryInterceptor(grpcserver.AuthorizationInterceptor(svc))}, grpcOpts...)
+	}
+	srv := grpcserver.New(svc, grpcOpts...)
 	runCtx, cancel := context.WithCancel(ctx)
 	errCh := make(chan error, 1)
 	go func() {
 		errCh <- srv.Serve(runCtx, lis)
 	}()
+	adminErrCh := make(chan error, 1)
+	if adminLis != nil {
+		go func() {
+			adminErrCh <- admin.New(clk).Serve(runCtx, adminLis)
+		}()
+	} else {
+		adminErrCh <- nil
+	}
+	go svc.RunRotator(runCtx, service.DefaultRotationInterval)
 
 	stop := func(stopCtx context.Context) error {
 		cancel()
-		select {
-		case err := <-errCh:
-			if err == nil || errors.Is(err, grpc.ErrServerStopped) || errors.Is(err, context.Canceled) {
-				return nil
+		svc.Close()
+		var errs []error
+		for _, ch := range []chan error{errCh, adminErrCh} {
+			select {
+			case err := <-ch:
+				if err != nil && !errors.Is(err, grpc.ErrServerStopped) && !errors.Is(err, context.Canceled) {
+					errs = append(errs, err)
+				}
+			case <-stopCtx.Done():
+				return stopCtx.Err()
 			}
-			return err
-		case <-stopCtx.Done():
-			return stopCtx.Err()
 		}
+		return errors.Join(errs...)
 	}
 
-	logger.InfoContext(ctx, "fake-cloud-kms emulator started", "addr", lis.Addr().String())
-
-	return &Instance{
-		Addr: lis.Addr().String(),
-		stop: stop,
-	}, nil
+	inst := &Instance{
+		Addr:  lis.Addr().String(),
+		Clock: clk,
+		stop:  stop,
+	}
+	if adminLis != nil {
+		inst.AdminAddr = adminLis.Addr().String()
+	}
+	logger.InfoContext(ctx, "fake-cloud-kms emulator started", "addr", inst.Addr, "admin_addr", inst.AdminAddr)
+	return inst, nil
 }
@@ -1,27 +1,49 @@
 package emulator_test
 
 import (
+	"bytes"
 	"context"
 	"crypto/ecdsa"
 	"crypto/sha256"
 	"encoding/asn1"
+	"encoding/base64"
 	"encoding/pem"
+	"errors"
 	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"cloud.google.com/go/iam/apiv1/iampb"
 	kms "cloud.google.com/go/kms/apiv1"
 	"cloud.google.com/go/kms/apiv1/kmspb"
+	lroauto "cloud.google.com/go/longrunning/autogen"
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
 	"github.com/btcsuite/btcd/btcec/v2"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
+	locationpb "google.golang.org/genproto/googleapis/cloud/location"
+	"google.golang.org/genproto/googleapis/type/expr"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 
+	"github.com/winor30/fake-cloud-kms/clock"
 	"github.com/winor30/fake-cloud-kms/crc"
+	"github.com/winor30/fake-cloud-kms/operations"
 	"github.com/winor30/fake-cloud-kms/pkg/api/emulator"
+	"github.com/winor30/fake-cloud-kms/service"
+	"github.com/winor30/fake-cloud-kms/store/memory"
+	grpcserver "github.com/winor30/fake-cloud-kms/transport/grpc"
 )
 
 func TestStartAndEncryptDecrypt(t *testing.T) {
@@ -215,19 +237,660 @@ projects:
 	}
 }
 
+func TestListIteratorPagination(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	inst, err := emulator.Start(ctx, emulator.Options{})
+	if err != nil {
+		t.Fatalf("start emulator: %v", err)
+	}
+	defer stopEmulator(t, inst)
+
+	client := newClient(t, ctx, inst.Addr)
+	defer closeClient(t, client)
+
+	parent := "projects/demo/locations/global"
+	keyRing := parent + "/keyRings/paged"
+	if _, err := client.CreateKeyRing(ctx, &kmspb.CreateKeyRingRequest{Parent: parent, KeyRingId: "paged"}); err != nil {
+		t.Fatalf("create key ring: %v", err)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if _, err := client.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+			Parent:      keyRing,
+			CryptoKeyId: id,
+			CryptoKey:   &kmspb.CryptoKey{Purpose: kmspb.CryptoKey_ENCRYPT_DECRYPT},
+		}); err != nil {
+			t.Fatalf("create crypto key %s: %v", id, err)
+		}
+	}
+
+	it := client.ListCryptoKeys(ctx, &kmspb.ListCryptoKeysRequest{Parent: keyRing, PageSize: 1})
+	var got []string
+	for {
+		ck, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("iterate crypto keys: %v", err)
+		}
+		got = append(got, ck.GetName())
+	}
+	if len(got) != 3 || got[0] != keyRing+"/cryptoKeys/a" || got[2] != keyRing+"/cryptoKeys/c" {
+		t.Fatalf("iterated crypto keys = %v", got)
+	}
+}
+
 // ---- helpers ----
 
+func TestGenerateRandomBytesWithEntropy(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	entropy := bytes.Repeat([]byte{0xab}, 16)
+	inst, err := emulator.Start(ctx, emulator.Options{Entropy: bytes.NewReader(entropy)})
+	if err != nil {
+		t.Fatalf("start emulator: %v", err)
+	}
+	defer stopEmulator(t, inst)
+
+	client := newClient(t, ctx, inst.Addr)
+	defer closeClient(t, client)
+
+	resp, err := client.GenerateRandomBytes(ctx, &kmspb.GenerateRandomBytesRequest{
+		Location:        "projects/demo/locations/global",
+		LengthBytes:     16,
+		ProtectionLevel: kmspb.ProtectionLevel_HSM,
+	})
+	if err != nil {
+		t.Fatalf("generate random bytes: %v", err)
+	}
+	if !bytes.Equal(resp.GetData(), entropy) {
+		t.Fatalf("data = %x, want %x", resp.GetData(), entropy)
+	}
+	if resp.GetDataCrc32C().GetValue() != int64(crc.Compute(entropy)) {
+		t.Fatal("data_crc32c does not match data")
+	}
+}
+
+func TestAdminClockFiresScheduledEvents(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	inst, err := emulator.Start(ctx, emulator.Options{AdminListenAddr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatalf("start emulator: %v", err)
+	}
+	defer stopEmulator(t, inst)
+
+	client := newClient(t, ctx, inst.Addr)
+	defer closeClient(t, client)
+
+	keyRing := "projects/demo/locations/global/keyRings/app"
+	if _, err := client.CreateKeyRing(ctx, &kmspb.CreateKeyRingRequest{Parent: "projects/demo/locations/global", KeyRingId: "app"}); err != nil {
+		t.Fatalf("create key ring: %v", err)
+	}
+	ck, err := client.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+		Parent:      keyRing,
+		CryptoKeyId: "rotating",
+		CryptoKey: &kmspb.CryptoKey{
+			Purpose:          kmspb.CryptoKey_ENCRYPT_DECRYPT,
+			RotationSchedule: &kmspb.CryptoKey_RotationPeriod{RotationPeriod: durationpb.New(24 * time.Hour)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("create crypto key: %v", err)
+	}
+	destroyed, err := client.DestroyCryptoKeyVersion(ctx, &kmspb.DestroyCryptoKeyVersionRequest{Name: ck.GetName() + "/cryptoKeyVersions/1"})
+	if err != nil {
+		t.Fatalf("destroy version: %v", err)
+	}
+
+	postAdmin(t, ctx, "http://"+inst.AdminAddr+"/clock/freeze", "")
+	postAdmin(t, ctx, "http://"+inst.AdminAddr+"/clock/advance", `{"duration": "744h"}`)
+
+	got, err := client.GetCryptoKey(ctx, &kmspb.GetCryptoKeyRequest{Name: ck.GetName()})
+	if err != nil {
+		t.Fatalf("get crypto key: %v", err)
+	}
+	if got.GetPrimary().GetName() != ck.GetName()+"/cryptoKeyVersions/2" {
+		t.Fatalf("primary = %s, want the rotated version 2", got.GetPrimary().GetName())
+	}
+	version, err := client.GetCryptoKeyVersion(ctx, &kmspb.GetCryptoKeyVersionRequest{Name: destroyed.GetName()})
+	if err != nil {
+		t.Fatalf("get version: %v", err)
+	}
+	if version.GetState() != kmspb.CryptoKeyVersion_DESTROYED {
+		t.Fatalf("state = %v, want DESTROYED", version.GetState())
+	}
+	if !version.GetDestroyEventTime().AsTime().Equal(destroyed.GetDestroyTime().AsTime()) {
+		t.Fatalf("destroy_event_time = %v, want %v", version.GetDestroyEventTime().AsTime(), destroyed.GetDestroyTime().AsTime())
+	}
+	if !inst.Clock.Frozen() {
+		t.Fatal("Instance.Clock is not the clock controlled by the admin API")
+	}
+}
+
+func TestResourceIAM(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	inst, err := emulator.Start(ctx, emulator.Options{})
+	if err != nil {
+		t.Fatalf("start emulator: %v", err)
+	}
+	defer stopEmulator(t, inst)
+
+	client := newClient(t, ctx, inst.Addr)
+	defer closeClient(t, client)
+
+	keyRing := "projects/demo/locations/global/keyRings/iam"
+	if _, err := client.CreateKeyRing(ctx, &kmspb.CreateKeyRingRequest{Parent: "projects/demo/locations/global", KeyRingId: "iam"}); err != nil {
+		t.Fatalf("create key ring: %v", err)
+	}
+	ck, err := client.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+		Parent:      keyRing,
+		CryptoKeyId: "guarded",
+		CryptoKey:   &kmspb.CryptoKey{Purpose: kmspb.CryptoKey_ENCRYPT_DECRYPT},
+	})
+	if err != nil {
+		t.Fatalf("create crypto key: %v", err)
+	}
+
+	handle := client.ResourceIAM(ck.GetName())
+	policy, err := handle.Policy(ctx)
+	if err != nil {
+		t.Fatalf("get policy: %v", err)
+	}
+	policy.Add("user:alice@example.com", "roles/cloudkms.cryptoKeyEncrypterDecrypter")
+	if err := handle.SetPolicy(ctx, policy); err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+	got, err := handle.Policy(ctx)
+	if err != nil {
+		t.Fatalf("get updated policy: %v", err)
+	}
+	if !got.HasRole("user:alice@example.com", "roles/cloudkms.cryptoKeyEncrypterDecrypter") {
+		t.Fatalf("policy roles = %v, want the added binding", got.Roles())
+	}
+	if err := handle.SetPolicy(ctx, policy); status.Code(err) != codes.Aborted {
+		t.Fatalf("set policy with a stale etag: got %v, want Aborted", err)
+	}
+
+	v3, err := handle.V3().Policy(ctx)
+	if err != nil {
+		t.Fatalf("get v3 policy: %v", err)
+	}
+	v3.Bindings = append(v3.Bindings, &iampb.Binding{
+		Role:      "roles/cloudkms.viewer",
+		Members:   []string{"group:auditors@example.com"},
+		Condition: &expr.Expr{Title: "before 2030", Expression: `request.time < timestamp("2030-01-01T00:00:00Z")`},
+	})
+	if err := handle.V3().SetPolicy(ctx, v3); err != nil {
+		t.Fatalf("set v3 policy: %v", err)
+	}
+	v3, err = handle.V3().Policy(ctx)
+	if err != nil {
+		t.Fatalf("get v3 policy: %v", err)
+	}
+	if len(v3.Bindings) != 2 || v3.Bindings[1].GetCondition().GetTitle() != "before 2030" {
+		t.Fatalf("v3 bindings = %v, want the conditional binding", v3.Bindings)
+	}
+
+	permissions, err := handle.TestPermissions(ctx, []string{"cloudkms.cryptoKeyVersions.useToEncrypt", "cloudkms.keyRings.get"})
+	if err != nil {
+		t.Fatalf("test permissions: %v", err)
+	}
+	if len(permissions) != 1 || permissions[0] != "cloudkms.cryptoKeyVersions.useToEncrypt" {
+		t.Fatalf("permissions = %v", permissions)
+	}
+}
+
+func TestEnforceIAM(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	seedYAML := `
+projects:
+  demo:
+    iamBindings:
+      roles/owner:
+        - user:owner@example.com
+`
+	seedPath := filepath.Join(t.TempDir(), "seed.yaml")
+	if err := os.WriteFile(seedPath, []byte(seedYAML), 0o600); err != nil {
+		t.Fatalf("write seed file: %v", err)
+	}
+	inst, err := emulator.Start(ctx, emulator.Options{EnforceIAM: true, SeedFile: seedPath})
+	if err != nil {
+		t.Fatalf("start emulator: %v", err)
+	}
+	defer stopEmulator(t, inst)
+
+	client := newClient(t, ctx, inst.Addr)
+	defer closeClient(t, client)
+
+	parent := "projects/demo/locations/global"
+	ownerCtx := metadata.AppendToOutgoingContext(ctx, grpcserver.PrincipalHeader, "user:owner@example.com")
+	adminCtx := metadata.AppendToOutgoingContext(ctx, grpcserver.PrincipalHeader, "user:admin@example.com")
+	aliceCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer user:alice@example.com")
+
+	if _, err := client.CreateKeyRing(ctx, &kmspb.CreateKeyRingRequest{Parent: parent, KeyRingId: "app"}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("create key ring without a principal: got %v, want Unauthenticated", err)
+	}
+	if _, err := client.CreateKeyRing(adminCtx, &kmspb.CreateKeyRingRequest{Parent: parent, KeyRingId: "app"}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("create key ring without a grant: got %v, want PermissionDenied", err)
+	}
+
+	project := client.ResourceIAM("projects/demo")
+	if _, err := project.Policy(adminCtx); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("get project policy without a grant: got %v, want PermissionDenied", err)
+	}
+	projectPolicy, err := project.Policy(ownerCtx)
+	if err != nil {
+		t.Fatalf("get project policy: %v", err)
+	}
+	projectPolicy.Add("user:admin@example.com", "roles/cloudkms.admin")
+	if err := project.SetPolicy(adminCtx, projectPolicy); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("grant oneself a project role: got %v, want PermissionDenied", err)
+	}
+	if err := project.SetPolicy(ownerCtx, projectPolicy); err != nil {
+		t.Fatalf("set project policy: %v", err)
+	}
+	if _, err := project.Policy(adminCtx); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("cloudkms.admin must not read the project policy: got %v", err)
+	}
+	if _, err := client.CreateKeyRing(adminCtx, &kmspb.CreateKeyRingRequest{Parent: parent, KeyRingId: "app"}); err != nil {
+		t.Fatalf("create key ring: %v", err)
+	}
+	ck, err := client.CreateCryptoKey(adminCtx, &kmspb.CreateCryptoKeyRequest{
+		Parent:      parent + "/keyRings/app",
+		CryptoKeyId: "data",
+		CryptoKey:   &kmspb.CryptoKey{Purpose: kmspb.CryptoKey_ENCRYPT_DECRYPT},
+	})
+	if err != nil {
+		t.Fatalf("create crypto key: %v", err)
+	}
+
+	if _, err := client.DeleteCryptoKey(adminCtx, &kmspb.DeleteCryptoKeyRequest{Name: ck.GetName()}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("RPC without an authorization rule: got %v, want PermissionDenied", err)
+	}
+
+	encrypt := &kmspb.EncryptRequest{Name: ck.GetName(), Plaintext: []byte("secret")}
+	if _, err := client.Encrypt(aliceCtx, encrypt); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("encrypt without a grant: got %v, want PermissionDenied", err)
+	}
+	if _, err := client.Encrypt(adminCtx, encrypt); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("cloudkms.admin must not encrypt: got %v", err)
+	}
+
+	key := client.ResourceIAM(ck.GetName())
+	keyPolicy, err := key.Policy(adminCtx)
+	if err != nil {
+		t.Fatalf("get key policy: %v", err)
+	}
+	keyPolicy.Add("user:alice@example.com", "roles/cloudkms.cryptoKeyEncrypter")
+	if err := key.SetPolicy(adminCtx, keyPolicy); err != nil {
+		t.Fatalf("set key policy: %v", err)
+	}
+	encrypted, err := client.Encrypt(aliceCtx, encrypt)
+	if err != nil {
+		t.Fatalf("encrypt with a grant: %v", err)
+	}
+	claims := base64.RawURLEncoding.EncodeToString([]byte(`{"email":"alice@example.com"}`))
+	jwtCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer e30."+claims+".sig")
+	if _, err := client.Encrypt(jwtCtx, encrypt); err != nil {
+		t.Fatalf("encrypt as the JWT's email: %v", err)
+	}
+	if _, err := client.Decrypt(aliceCtx, &kmspb.DecryptRequest{Name: ck.GetName(), Ciphertext: encrypted.GetCiphertext()}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("decrypt with only the encrypter role: got %v, want PermissionDenied", err)
+	}
+	if _, err := key.Policy(aliceCtx); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("get key policy without getIamPolicy: got %v, want PermissionDenied", err)
+	}
+
+	held, err := key.TestPermissions(aliceCtx, []string{"cloudkms.cryptoKeyVersions.useToEncrypt", "cloudkms.cryptoKeyVersions.useToDecrypt"})
+	if err != nil {
+		t.Fatalf("test permissions: %v", err)
+	}
+	if len(held) != 1 || held[0] != "cloudkms.cryptoKeyVersions.useToEncrypt" {
+		t.Fatalf("held permissions = %v, want only useToEncrypt", held)
+	}
+}
+
+func TestLocationCatalog(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	inst, err := emulator.Start(ctx, emulator.Options{
+		Locations: []service.Location{
+			{ID: "us-east1", DisplayName: "South Carolina", HSMAvailable: true},
+			{ID: "europe-west1", DisplayName: "Belgium", HSMAvailable: true, EKMAvailable: true},
+		},
+		StrictLocations: true,
+	})
+	if err != nil {
+		t.Fatalf("start emulator: %v", err)
+	}
+	defer stopEmulator(t, inst)
+
+	client := newClient(t, ctx, inst.Addr)
+	defer closeClient(t, client)
+
+	it := client.ListLocations(ctx, &locationpb.ListLocationsRequest{Name: "projects/demo"})
+	var ids []string
+	for {
+		loc, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("iterate locations: %v", err)
+		}
+		ids = append(ids, loc.GetLocationId())
+	}
+	if len(ids) != 2 || ids[0] != "europe-west1" || ids[1] != "us-east1" {
+		t.Fatalf("locations = %v", ids)
+	}
+
+	loc, err := client.GetLocation(ctx, &locationpb.GetLocationRequest{Name: "projects/demo/locations/europe-west1"})
+	if err != nil {
+		t.Fatalf("get location: %v", err)
+	}
+	var metadata kmspb.LocationMetadata
+	if err := loc.GetMetadata().UnmarshalTo(&metadata); err != nil {
+		t.Fatalf("unpack metadata: %v", err)
+	}
+	if !metadata.GetHsmAvailable() || !metadata.GetEkmAvailable() {
+		t.Fatalf("metadata = %v, want HSM and EKM available", &metadata)
+	}
+
+	if _, err := client.CreateKeyRing(ctx, &kmspb.CreateKeyRingRequest{Parent: "projects/demo/locations/global", KeyRingId: "app"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("create key ring outside the catalog: got %v, want InvalidArgument", err)
+	}
+}
+
+func TestAutokey(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	inst, err := emulator.Start(ctx, emulator.Options{})
+	if err != nil {
+		t.Fatalf("start emulator: %v", err)
+	}
+	defer stopEmulator(t, inst)
+
+	admin, err := kms.NewAutokeyAdminClient(ctx, clientOptions(inst.Addr)...)
+	if err != nil {
+		t.Fatalf("create autokey admin client: %v", err)
+	}
+	defer admin.Close()
+	autokey, err := kms.NewAutokeyClient(ctx, clientOptions(inst.Addr)...)
+	if err != nil {
+		t.Fatalf("create autokey client: %v", err)
+	}
+	defer autokey.Close()
+	client := newClient(t, ctx, inst.Addr)
+	defer closeClient(t, client)
+
+	if _, err := admin.UpdateAutokeyConfig(ctx, &kmspb.UpdateAutokeyConfigRequest{
+		AutokeyConfig: &kmspb.AutokeyConfig{
+			Name:                     "projects/demo/autokeyConfig",
+			KeyProjectResolutionMode: kmspb.AutokeyConfig_RESOURCE_PROJECT,
+		},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"key_project_resolution_mode"}},
+	}); err != nil {
+		t.Fatalf("update autokey config: %v", err)
+	}
+
+	op, err := autokey.CreateKeyHandle(ctx, &kmspb.CreateKeyHandleRequest{
+		Parent:    "projects/demo/locations/global",
+		KeyHandle: &kmspb.KeyHandle{ResourceTypeSelector: "bigquery.googleapis.com/Dataset"},
+	})
+	if err != nil {
+		t.Fatalf("create key handle: %v", err)
+	}
+	handle, err := op.Wait(ctx)
+	if err != nil {
+		t.Fatalf("wait for key handle: %v", err)
+	}
+	if !strings.HasPrefix(handle.GetKmsKey(), "projects/demo/locations/global/keyRings/autokey/cryptoKeys/bigquery-dataset-") {
+		t.Fatalf("key handle = %v", handle)
+	}
+
+	plaintext := []byte("autokey")
+	enc, err := client.Encrypt(ctx, &kmspb.EncryptRequest{Name: handle.GetKmsKey(), Plaintext: plaintext})
+	if err != nil {
+		t.Fatalf("encrypt with the provisioned key: %v", err)
+	}
+	dec, err := client.Decrypt(ctx, &kmspb.DecryptRequest{Name: handle.GetKmsKey(), Ciphertext: enc.GetCiphertext()})
+	if err != nil || !bytes.Equal(dec.GetPlaintext(), plaintext) {
+		t.Fatalf("decrypt with the provisioned key = %q, %v", dec.GetPlaintext(), err)
+	}
+
+	got, err := autokey.GetKeyHandle(ctx, &kmspb.GetKeyHandleRequest{Name: handle.GetName()})
+	if err != nil || got.GetKmsKey() != handle.GetKmsKey() {
+		t.Fatalf("get key handle = %v, %v", got, err)
+	}
+}
+
+func TestDelayedOperations(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	inst, err := emulator.Start(ctx, emulator.Options{OperationTiming: operations.Timing{Delay: 200 * time.Millisecond}})
+	if err != nil {
+		t.Fatalf("start emulator: %v", err)
+	}
+	defer stopEmulator(t, inst)
+
+	admin, err := kms.NewAutokeyAdminClient(ctx, clientOptions(inst.Addr)...)
+	if err != nil {
+		t.Fatalf("create autokey admin client: %v", err)
+	}
+	defer admin.Close()
+	autokey, err := kms.NewAutokeyClient(ctx, clientOptions(inst.Addr)...)
+	if err != nil {
+		t.Fatalf("create autokey client: %v", err)
+	}
+	defer autokey.Close()
+	ops, err := lroauto.NewOperationsClient(ctx, clientOptions(inst.Addr)...)
+	if err != nil {
+		t.Fatalf("create operations client: %v", err)
+	}
+	defer ops.Close()
+
+	if _, err := admin.UpdateAutokeyConfig(ctx, &kmspb.UpdateAutokeyConfigRequest{
+		AutokeyConfig: &kmspb.AutokeyConfig{Name: "projects/demo/autokeyConfig", KeyProject: "projects/keys"},
+		UpdateMask:    &fieldmaskpb.FieldMask{Paths: []string{"key_project"}},
+	}); err != nil {
+		t.Fatalf("update autokey config: %v", err)
+	}
+	op, err := autokey.CreateKeyHandle(ctx, &kmspb.CreateKeyHandleRequest{
+		Parent:    "projects/demo/locations/global",
+		KeyHandle: &kmspb.KeyHandle{ResourceTypeSelector: "storage.googleapis.com/Bucket"},
+	})
+	if err != nil {
+		t.Fatalf("create key handle: %v", err)
+	}
+	if op.Done() {
+		t.Fatal("operation done before its delay")
+	}
+
+	pending, err := ops.GetOperation(ctx, &longrunningpb.GetOperationRequest{Name: op.Name()})
+	if err != nil {
+		t.Fatalf("get operation: %v", err)
+	}
+	if pending.GetDone() {
+		t.Fatalf("operation = %v", pending)
+	}
+	handle, err := op.Wait(ctx)
+	if err != nil {
+		t.Fatalf("wait for key handle: %v", err)
+	}
+	if _, err := autokey.GetKeyHandle(ctx, &kmspb.GetKeyHandleRequest{Name: handle.GetName()}); err != nil {
+		t.Fatalf("get key handle: %v", err)
+	}
+
+	it := ops.ListOperations(ctx, &longrunningpb.ListOperationsRequest{Name: "projects/demo/locations/global"})
+	listed, err := it.Next()
+	if err != nil || listed.GetName() != op.Name() || !listed.GetDone() {
+		t.Fatalf("listed operation = %v, %v", listed, err)
+	}
+}
+
+func TestEkmService(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	inst, err := emulator.Start(ctx, emulator.Options{})
+	if err != nil {
+		t.Fatalf("start emulator: %v", err)
+	}
+	defer stopEmulator(t, inst)
+
+	client, err := kms.NewEkmClient(ctx, clientOptions(inst.Addr)...)
+	if err != nil {
+		t.Fatalf("create ekm client: %v", err)
+	}
+	defer client.Close()
+
+	endpoint := httptest.NewTLSServer(http.NotFoundHandler())
+	defer endpoint.Close()
+	parent := "projects/demo/locations/us-east1"
+	connection, err := client.CreateEkmConnection(ctx, &kmspb.CreateEkmConnectionRequest{
+		Parent:          parent,
+		EkmConnectionId: "vpc",
+		EkmConnection: &kmspb.EkmConnection{
+			ServiceResolvers: []*kmspb.EkmConnection_ServiceResolver{{
+				ServiceDirectoryService: "projects/demo/locations/us-east1/namespaces/ekm/services/vpc",
+				Hostname:                endpoint.Listener.Addr().String(),
+				ServerCertificates:      []*kmspb.Certificate{{RawDer: endpoint.Certificate().Raw}},
+			}},
+			KeyManagementMode: kmspb.EkmConnection_CLOUD_KMS,
+			CryptoSpacePath:   "v0/cryptospaces/space-1",
+		},
+	})
+	if err != nil {
+		t.Fatalf("create ekm connection: %v", err)
+	}
+	if _, err := client.VerifyConnectivity(ctx, &kmspb.VerifyConnectivityRequest{Name: connection.GetName()}); err != nil {
+		t.Fatalf("verify connectivity: %v", err)
+	}
+
+	config, err := client.UpdateEkmConfig(ctx, &kmspb.UpdateEkmConfigRequest{
+		EkmConfig:  &kmspb.EkmConfig{Name: parent + "/ekmConfig", DefaultEkmConnection: connection.GetName()},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"default_ekm_connection"}},
+	})
+	if err != nil || config.GetDefaultEkmConnection() != connection.GetName() {
+		t.Fatalf("update ekm config = %v, %v", config, err)
+	}
+
+	it := client.ListEkmConnections(ctx, &kmspb.ListEkmConnectionsRequest{Parent: parent})
+	listed, err := it.Next()
+	if err != nil || listed.GetName() != connection.GetName() {
+		t.Fatalf("listed ekm connection = %v, %v", listed, err)
+	}
+	if _, err := it.Next(); !errors.Is(err, iterator.Done) {
+		t.Fatalf("second listed ekm connection: %v", err)
+	}
+}
+
+func TestStopDetachesFromSharedClock(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	shared := clock.NewVirtual(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	shared.Freeze()
+	strg := memory.New()
+	inst, err := emulator.Start(ctx, emulator.Options{Store: strg, Clock: shared})
+	if err != nil {
+		t.Fatalf("start emulator: %v", err)
+	}
+
+	client := newClient(t, ctx, inst.Addr)
+	defer closeClient(t, client)
+	if _, err := client.CreateKeyRing(ctx, &kmspb.CreateKeyRingRequest{Parent: "projects/demo/locations/global", KeyRingId: "app"}); err != nil {
+		t.Fatalf("create key ring: %v", err)
+	}
+	ck, err := client.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+		Parent:      "projects/demo/locations/global/keyRings/app",
+		CryptoKeyId: "rotating",
+		CryptoKey: &kmspb.CryptoKey{
+			Purpose:          kmspb.CryptoKey_ENCRYPT_DECRYPT,
+			RotationSchedule: &kmspb.CryptoKey_RotationPeriod{RotationPeriod: durationpb.New(24 * time.Hour)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("create crypto key: %v", err)
+	}
+	stopEmulator(t, inst)
+
+	// Instances that fail to start must not stay attached either.
+	for _, opts := range []emulator.Options{
+		{Store: strg, Clock: shared, SeedFile: filepath.Join(t.TempDir(), "missing.yaml")},
+		{Store: strg, Clock: shared, ListenAddr: "256.0.0.1:0"},
+		{Store: strg, Clock: shared, AdminListenAddr: "256.0.0.1:0"},
+	} {
+		if _, err := emulator.Start(ctx, opts); err == nil {
+			t.Fatalf("start with %+v succeeded", opts)
+		}
+	}
+
+	if err := shared.Advance(48 * time.Hour); err != nil {
+		t.Fatalf("advance: %v", err)
+	}
+	got, err := strg.GetCryptoKey(ctx, ck.GetName())
+	if err != nil {
+		t.Fatalf("get crypto key: %v", err)
+	}
+	if got.GetPrimary().GetName() != ck.GetName()+"/cryptoKeyVersions/1" {
+		t.Fatalf("primary = %s, want version 1: the stopped instance rotated the key", got.GetPrimary().GetName())
+	}
+}
+
 func newClient(t *testing.T, ctx context.Context, addr string) *kms.KeyManagementClient {
 	t.Helper()
-	client, err := kms.NewKeyManagementClient(ctx,
+	client, err := kms.NewKeyManagementClient(ctx, clientOptions(addr)...)
+	if err != nil {
+		t.Fatalf("create kms client: %v", err)
+	}
+	return client
+}
+
+func clientOptions(addr string) []option.ClientOption {
+	return []option.ClientOption{
 		option.WithEndpoint(addr),
 		option.WithoutAuthentication(),
 		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
-	)
+	}
+}
+
+func postAdmin(t *testing.T, ctx context.Context, url, body string) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(body))
 	if err != nil {
-		t.Fatalf("create kms client: %v", err)
+		t.Fatalf("build admin request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("admin request %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("admin request %s: status %d", url, resp.StatusCode)
 	}
-	return client
 }
 
 func closeClient(t *testing.T, client *kms.KeyManagementClient) {
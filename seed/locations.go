@@ -0,0 +1,70 @@
+package seed
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/winor30/fake-cloud-kms/names"
+	"github.com/winor30/fake-cloud-kms/service"
+)
+
+// LoadLocations reads a location catalog from a YAML document of the form
+//
+//	locations:
+//	  - id: us-east1
+//	    displayName: South Carolina
+//	    labels: {tier: primary}
+//	    hsmAvailable: true
+//	    ekmAvailable: true
+func LoadLocations(path string) ([]service.Location, error) {
+	cleanPath := filepath.Clean(path)
+	if err := ensureYAML(cleanPath); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(cleanPath)
+	if err != nil {
+		return nil, fmt.Errorf("read locations file: %w", err)
+	}
+	var doc locationsDocument
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse locations file: %w", err)
+	}
+	if len(doc.Locations) == 0 {
+		return nil, fmt.Errorf("locations file %q lists no locations", path)
+	}
+
+	seen := make(map[string]bool, len(doc.Locations))
+	locations := make([]service.Location, 0, len(doc.Locations))
+	for _, loc := range doc.Locations {
+		if _, err := names.ParseLocation("projects/p/locations/" + loc.ID); err != nil {
+			return nil, fmt.Errorf("invalid location id %q", loc.ID)
+		}
+		if seen[loc.ID] {
+			return nil, fmt.Errorf("duplicate location id %q", loc.ID)
+		}
+		seen[loc.ID] = true
+		locations = append(locations, service.Location{
+			ID:           loc.ID,
+			DisplayName:  loc.DisplayName,
+			Labels:       loc.Labels,
+			HSMAvailable: loc.HSMAvailable,
+			EKMAvailable: loc.EKMAvailable,
+		})
+	}
+	return locations, nil
+}
+
+type locationsDocument struct {
+	Locations []locationSeed `yaml:"locations"`
+}
+
+type locationSeed struct {
+	ID           string            `yaml:"id"`
+	DisplayName  string            `yaml:"displayName"`
+	Labels       map[string]string `yaml:"labels"`
+	HSMAvailable bool              `yaml:"hsmAvailable"`
+	EKMAvailable bool              `yaml:"ekmAvailable"`
+}
@@ -4,10 +4,13 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
+	"cloud.google.com/go/iam/apiv1/iampb"
 	"cloud.google.com/go/kms/apiv1/kmspb"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -19,6 +22,8 @@ type ServiceAPI interface {
 	CreateKeyRing(context.Context, *kmspb.CreateKeyRingRequest) (*kmspb.KeyRing, error)
 	CreateCryptoKey(context.Context, *kmspb.CreateCryptoKeyRequest) (*kmspb.CryptoKey, error)
 	CreateCryptoKeyVersion(context.Context, *kmspb.CreateCryptoKeyVersionRequest) (*kmspb.CryptoKeyVersion, error)
+	GetIamPolicy(context.Context, *iampb.GetIamPolicyRequest) (*iampb.Policy, error)
+	SetIamPolicy(context.Context, *iampb.SetIamPolicyRequest) (*iampb.Policy, error)
 }
 
 // Apply loads the provided YAML document and provisions resources.
@@ -36,6 +41,9 @@ func Apply(ctx context.Context, svc ServiceAPI, path string) error {
 		return fmt.Errorf("parse seed file: %w", err)
 	}
 	for projectID, project := range doc.Projects {
+		if err := grantProjectRoles(ctx, svc, "projects/"+projectID, project.IAMBindings); err != nil {
+			return err
+		}
 		for locationID, location := range project.Locations {
 			parent := fmt.Sprintf("projects/%s/locations/%s", projectID, locationID)
 			for keyRingID, keyRing := range location.KeyRings {
@@ -59,6 +67,37 @@ func Apply(ctx context.Context, svc ServiceAPI, path string) error {
 	return nil
 }
 
+// grantProjectRoles adds members to roles in the policy of a project. Seeding
+// is the way to grant the first roles when the emulator enforces IAM, since
+// changing a project policy over gRPC then needs a role already.
+func grantProjectRoles(ctx context.Context, svc ServiceAPI, projectName string, bindings map[string][]string) error {
+	if len(bindings) == 0 {
+		return nil
+	}
+	policy, err := svc.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{Resource: projectName})
+	if err != nil {
+		return fmt.Errorf("get iam policy of %s: %w", projectName, err)
+	}
+	for _, role := range slices.Sorted(maps.Keys(bindings)) {
+		i := slices.IndexFunc(policy.GetBindings(), func(b *iampb.Binding) bool { return b.GetRole() == role && b.GetCondition() == nil })
+		if i < 0 {
+			policy.Bindings = append(policy.Bindings, &iampb.Binding{Role: role})
+			i = len(policy.Bindings) - 1
+		}
+		binding := policy.Bindings[i]
+		for _, member := range bindings[role] {
+			if !slices.Contains(binding.Members, member) {
+				binding.Members = append(binding.Members, member)
+			}
+		}
+	}
+	if _, err := svc.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{Resource: projectName, Policy: policy}); err != nil {
+		return fmt.Errorf("set iam policy of %s: %w", projectName, err)
+	}
+	slog.InfoContext(ctx, "seeded iam bindings", "project", projectName)
+	return nil
+}
+
 func createKeyRing(ctx context.Context, svc ServiceAPI, parent, id string) error {
 	_, err := svc.CreateKeyRing(ctx, &kmspb.CreateKeyRingRequest{Parent: parent, KeyRingId: id})
 	if err != nil && status.Code(err) != codes.AlreadyExists {
@@ -112,7 +151,9 @@ type document struct {
 }
 
 type project struct {
-	Locations map[string]location `yaml:"locations"`
+	// IAMBindings maps roles to the members granted them on the project.
+	IAMBindings map[string][]string `yaml:"iamBindings"`
+	Locations   map[string]location `yaml:"locations"`
 }
 
 type location struct {
@@ -131,23 +172,72 @@ type CryptoKeySeed struct {
 	Versions  []versionSeed     `yaml:"versions"`
 }
 
-var algorithmMap = map[string]kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm{
-	"EC_SIGN_SECP256K1_SHA256": kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256,
+// algorithmMap lists the algorithms accepted for purposes that require one.
+var algorithmMap = map[kmspb.CryptoKey_CryptoKeyPurpose]map[string]kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm{
+	kmspb.CryptoKey_ASYMMETRIC_SIGN: {
+		"EC_SIGN_SECP256K1_SHA256":   kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256,
+		"EC_SIGN_P256_SHA256":        kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256,
+		"EC_SIGN_P384_SHA384":        kmspb.CryptoKeyVersion_EC_SIGN_P384_SHA384,
+		"EC_SIGN_ED25519":            kmspb.CryptoKeyVersion_EC_SIGN_ED25519,
+		"RSA_SIGN_PSS_2048_SHA256":   kmspb.CryptoKeyVersion_RSA_SIGN_PSS_2048_SHA256,
+		"RSA_SIGN_PSS_3072_SHA256":   kmspb.CryptoKeyVersion_RSA_SIGN_PSS_3072_SHA256,
+		"RSA_SIGN_PSS_4096_SHA256":   kmspb.CryptoKeyVersion_RSA_SIGN_PSS_4096_SHA256,
+		"RSA_SIGN_PSS_4096_SHA512":   kmspb.CryptoKeyVersion_RSA_SIGN_PSS_4096_SHA512,
+		"RSA_SIGN_PKCS1_2048_SHA256": kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_2048_SHA256,
+		"RSA_SIGN_PKCS1_3072_SHA256": kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_3072_SHA256,
+		"RSA_SIGN_PKCS1_4096_SHA256": kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA256,
+		"RSA_SIGN_PKCS1_4096_SHA512": kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA512,
+		"RSA_SIGN_RAW_PKCS1_2048":    kmspb.CryptoKeyVersion_RSA_SIGN_RAW_PKCS1_2048,
+		"RSA_SIGN_RAW_PKCS1_3072":    kmspb.CryptoKeyVersion_RSA_SIGN_RAW_PKCS1_3072,
+		"RSA_SIGN_RAW_PKCS1_4096":    kmspb.CryptoKeyVersion_RSA_SIGN_RAW_PKCS1_4096,
+		"PQ_SIGN_ML_DSA_65":          kmspb.CryptoKeyVersion_PQ_SIGN_ML_DSA_65,
+		"PQ_SIGN_SLH_DSA_SHA2_128S":  kmspb.CryptoKeyVersion_PQ_SIGN_SLH_DSA_SHA2_128S,
+	},
+	kmspb.CryptoKey_ASYMMETRIC_DECRYPT: {
+		"RSA_DECRYPT_OAEP_2048_SHA256": kmspb.CryptoKeyVersion_RSA_DECRYPT_OAEP_2048_SHA256,
+		"RSA_DECRYPT_OAEP_3072_SHA256": kmspb.CryptoKeyVersion_RSA_DECRYPT_OAEP_3072_SHA256,
+		"RSA_DECRYPT_OAEP_4096_SHA256": kmspb.CryptoKeyVersion_RSA_DECRYPT_OAEP_4096_SHA256,
+		"RSA_DECRYPT_OAEP_4096_SHA512": kmspb.CryptoKeyVersion_RSA_DECRYPT_OAEP_4096_SHA512,
+		"RSA_DECRYPT_OAEP_2048_SHA1":   kmspb.CryptoKeyVersion_RSA_DECRYPT_OAEP_2048_SHA1,
+		"RSA_DECRYPT_OAEP_3072_SHA1":   kmspb.CryptoKeyVersion_RSA_DECRYPT_OAEP_3072_SHA1,
+		"RSA_DECRYPT_OAEP_4096_SHA1":   kmspb.CryptoKeyVersion_RSA_DECRYPT_OAEP_4096_SHA1,
+	},
+	kmspb.CryptoKey_MAC: {
+		"HMAC_SHA256": kmspb.CryptoKeyVersion_HMAC_SHA256,
+		"HMAC_SHA1":   kmspb.CryptoKeyVersion_HMAC_SHA1,
+		"HMAC_SHA384": kmspb.CryptoKeyVersion_HMAC_SHA384,
+		"HMAC_SHA512": kmspb.CryptoKeyVersion_HMAC_SHA512,
+		"HMAC_SHA224": kmspb.CryptoKeyVersion_HMAC_SHA224,
+	},
+	kmspb.CryptoKey_RAW_ENCRYPT_DECRYPT: {
+		"AES_128_GCM": kmspb.CryptoKeyVersion_AES_128_GCM,
+		"AES_256_GCM": kmspb.CryptoKeyVersion_AES_256_GCM,
+		"AES_128_CBC": kmspb.CryptoKeyVersion_AES_128_CBC,
+		"AES_256_CBC": kmspb.CryptoKeyVersion_AES_256_CBC,
+		"AES_128_CTR": kmspb.CryptoKeyVersion_AES_128_CTR,
+		"AES_256_CTR": kmspb.CryptoKeyVersion_AES_256_CTR,
+	},
+	kmspb.CryptoKey_KEY_ENCAPSULATION: {
+		"ML_KEM_768":  kmspb.CryptoKeyVersion_ML_KEM_768,
+		"ML_KEM_1024": kmspb.CryptoKeyVersion_ML_KEM_1024,
+		"KEM_XWING":   kmspb.CryptoKeyVersion_KEM_XWING,
+	},
 }
 
 func resolvePurpose(seed CryptoKeySeed) (kmspb.CryptoKey_CryptoKeyPurpose, *kmspb.CryptoKeyVersionTemplate, error) {
-	switch seed.Purpose {
-	case "", "ENCRYPT_DECRYPT":
+	if seed.Purpose == "" || seed.Purpose == "ENCRYPT_DECRYPT" {
 		return kmspb.CryptoKey_ENCRYPT_DECRYPT, nil, nil
-	case "ASYMMETRIC_SIGN":
-		alg, ok := algorithmMap[seed.Algorithm]
-		if !ok {
-			return 0, nil, fmt.Errorf("unsupported algorithm %q for ASYMMETRIC_SIGN", seed.Algorithm)
-		}
-		return kmspb.CryptoKey_ASYMMETRIC_SIGN, &kmspb.CryptoKeyVersionTemplate{Algorithm: alg}, nil
-	default:
+	}
+	purpose := kmspb.CryptoKey_CryptoKeyPurpose(kmspb.CryptoKey_CryptoKeyPurpose_value[seed.Purpose])
+	algorithms, ok := algorithmMap[purpose]
+	if !ok {
 		return 0, nil, fmt.Errorf("unsupported purpose %q", seed.Purpose)
 	}
+	alg, ok := algorithms[seed.Algorithm]
+	if !ok {
+		return 0, nil, fmt.Errorf("unsupported algorithm %q for %s", seed.Algorithm, seed.Purpose)
+	}
+	return purpose, &kmspb.CryptoKeyVersionTemplate{Algorithm: alg}, nil
 }
 
 type versionSeed struct {
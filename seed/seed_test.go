@@ -4,8 +4,10 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 
+	"cloud.google.com/go/iam/apiv1/iampb"
 	"cloud.google.com/go/kms/apiv1/kmspb"
 
 	"github.com/winor30/fake-cloud-kms/kmscrypto"
@@ -92,6 +94,40 @@ projects:
 	}
 }
 
+func TestApplyMacKey(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc := newService()
+
+	seedYAML := `
+projects:
+  demo:
+    locations:
+      global:
+        keyRings:
+          app:
+            cryptoKeys:
+              webhook:
+                purpose: MAC
+                algorithm: HMAC_SHA256
+`
+	path := writeTempYAML(t, seedYAML)
+	if err := seed.Apply(ctx, svc, path); err != nil {
+		t.Fatalf("apply seed: %v", err)
+	}
+
+	resp, err := svc.MacSign(ctx, &kmspb.MacSignRequest{
+		Name: "projects/demo/locations/global/keyRings/app/cryptoKeys/webhook/cryptoKeyVersions/1",
+		Data: []byte("payload"),
+	})
+	if err != nil {
+		t.Fatalf("mac sign: %v", err)
+	}
+	if len(resp.GetMac()) != 32 {
+		t.Fatalf("mac length = %d, want 32", len(resp.GetMac()))
+	}
+}
+
 func TestApplyUnsupportedPurpose(t *testing.T) {
 	t.Parallel()
 	ctx := context.Background()
@@ -106,7 +142,7 @@ projects:
           app:
             cryptoKeys:
               bad:
-                purpose: MAC
+                purpose: NOT_A_PURPOSE
 `
 	path := writeTempYAML(t, seedYAML)
 	if err := seed.Apply(ctx, svc, path); err == nil {
@@ -129,7 +165,7 @@ projects:
             cryptoKeys:
               bad:
                 purpose: ASYMMETRIC_SIGN
-                algorithm: RSA_SIGN_PSS_2048_SHA256
+                algorithm: GOOGLE_SYMMETRIC_ENCRYPTION
 `
 	path := writeTempYAML(t, seedYAML)
 	if err := seed.Apply(ctx, svc, path); err == nil {
@@ -137,6 +173,47 @@ projects:
 	}
 }
 
+func TestApplyIAMBindings(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc := newService()
+
+	seedYAML := `
+projects:
+  demo:
+    iamBindings:
+      roles/owner:
+        - user:owner@example.com
+      roles/cloudkms.viewer:
+        - user:alice@example.com
+        - group:auditors@example.com
+`
+	path := writeTempYAML(t, seedYAML)
+	if err := seed.Apply(ctx, svc, path); err != nil {
+		t.Fatalf("apply seed: %v", err)
+	}
+	// Applying the seed again leaves the bindings as they are.
+	if err := seed.Apply(ctx, svc, path); err != nil {
+		t.Fatalf("reapply seed: %v", err)
+	}
+
+	policy, err := svc.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{Resource: "projects/demo"})
+	if err != nil {
+		t.Fatalf("get iam policy: %v", err)
+	}
+	got := map[string][]string{}
+	for _, binding := range policy.GetBindings() {
+		got[binding.GetRole()] = binding.GetMembers()
+	}
+	want := map[string][]string{
+		"roles/owner":           {"user:owner@example.com"},
+		"roles/cloudkms.viewer": {"user:alice@example.com", "group:auditors@example.com"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("bindings = %v, want %v", got, want)
+	}
+}
+
 func newService() service.KMSService {
 	return service.New(memory.New(), kmscrypto.NewTinkEngine())
 }
@@ -150,3 +227,37 @@ func writeTempYAML(t *testing.T, content string) string {
 	}
 	return path
 }
+
+func TestLoadLocations(t *testing.T) {
+	t.Parallel()
+	path := writeTempYAML(t, `
+locations:
+  - id: us-east1
+    displayName: South Carolina
+    labels: {tier: primary}
+    hsmAvailable: true
+  - id: lab
+    ekmAvailable: true
+`)
+	locations, err := seed.LoadLocations(path)
+	if err != nil {
+		t.Fatalf("load locations: %v", err)
+	}
+	want := []service.Location{
+		{ID: "us-east1", DisplayName: "South Carolina", Labels: map[string]string{"tier": "primary"}, HSMAvailable: true},
+		{ID: "lab", EKMAvailable: true},
+	}
+	if !reflect.DeepEqual(locations, want) {
+		t.Fatalf("locations = %+v, want %+v", locations, want)
+	}
+
+	for name, content := range map[string]string{
+		"empty":     "locations: []\n",
+		"duplicate": "locations:\n  - id: lab\n  - id: lab\n",
+		"bad id":    "locations:\n  - id: not/valid\n",
+	} {
+		if _, err := seed.LoadLocations(writeTempYAML(t, content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
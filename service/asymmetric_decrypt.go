@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/winor30/fake-cloud-kms/crc"
+	"github.com/winor30/fake-cloud-kms/kmscrypto"
+	"github.com/winor30/fake-cloud-kms/names"
+)
+
+func (s *service) AsymmetricDecrypt(ctx context.Context, req *kmspb.AsymmetricDecryptRequest) (*kmspb.AsymmetricDecryptResponse, error) {
+	if _, err := names.ParseCryptoKeyVersion(req.GetName()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
+	}
+	if len(req.GetCiphertext()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "ciphertext is required")
+	}
+
+	version, material, err := s.loadVersion(ctx, req.GetName())
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(supportedAlgorithms[kmspb.CryptoKey_ASYMMETRIC_DECRYPT], version.GetAlgorithm()) {
+		return nil, status.Errorf(codes.FailedPrecondition, "key version algorithm %v does not support AsymmetricDecrypt", version.GetAlgorithm())
+	}
+	if err := requireEnabled(version); err != nil {
+		return nil, err
+	}
+
+	verifiedCiphertext, err := verifyChecksum(req.GetCiphertext(), req.GetCiphertextCrc32C())
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := s.engine.AsymmetricDecrypt(ctx, material, version.GetAlgorithm().String(), req.GetCiphertext())
+	switch {
+	case errors.Is(err, kmscrypto.ErrDecryption):
+		return nil, status.Error(codes.InvalidArgument, "Decryption failed: verify that 'name' refers to the correct CryptoKeyVersion.")
+	case err != nil:
+		return nil, status.Errorf(codes.Internal, "asymmetric decrypt failed: %v", err)
+	}
+
+	return &kmspb.AsymmetricDecryptResponse{
+		Plaintext:                plaintext,
+		PlaintextCrc32C:          wrapperspb.Int64(int64(crc.Compute(plaintext))),
+		VerifiedCiphertextCrc32C: verifiedCiphertext,
+		ProtectionLevel:          version.GetProtectionLevel(),
+	}, nil
+}
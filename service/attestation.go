@@ -0,0 +1,52 @@
+package service
+
+import (
+	"crypto/rand"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// resolveProtectionLevel validates the protection level requested in a
+// version template. Unspecified defaults to SOFTWARE; HSM is emulated in
+// software but reported as HSM, with a fake attestation.
+func resolveProtectionLevel(level kmspb.ProtectionLevel) (kmspb.ProtectionLevel, error) {
+	switch level {
+	case kmspb.ProtectionLevel_PROTECTION_LEVEL_UNSPECIFIED:
+		return kmspb.ProtectionLevel_SOFTWARE, nil
+	case kmspb.ProtectionLevel_SOFTWARE, kmspb.ProtectionLevel_HSM:
+		return level, nil
+	default:
+		return 0, status.Errorf(codes.InvalidArgument, "unsupported protection_level: %v", level)
+	}
+}
+
+// newAttestation returns the attestation recorded for a version or import job
+// created at the given protection level, or nil when the level carries none.
+// The content is an opaque placeholder of random bytes, not a parseable
+// Cavium bundle: it carries no information about the key and cannot be
+// verified against Google's certificate chains.
+func newAttestation(level kmspb.ProtectionLevel) *kmspb.KeyOperationAttestation {
+	if level != kmspb.ProtectionLevel_HSM {
+		return nil
+	}
+	content := make([]byte, 32)
+	_, _ = rand.Read(content)
+	return &kmspb.KeyOperationAttestation{
+		Format:  kmspb.KeyOperationAttestation_CAVIUM_V2_COMPRESSED,
+		Content: content,
+	}
+}
+
+// applyVersionView shapes a version for the requested view: BASIC (the
+// default) omits the attestation, FULL keeps it.
+func applyVersionView(version *kmspb.CryptoKeyVersion, view kmspb.CryptoKeyVersion_CryptoKeyVersionView) *kmspb.CryptoKeyVersion {
+	if version == nil || view == kmspb.CryptoKeyVersion_FULL || version.GetAttestation() == nil {
+		return version
+	}
+	out := proto.Clone(version).(*kmspb.CryptoKeyVersion)
+	out.Attestation = nil
+	return out
+}
@@ -0,0 +1,345 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/winor30/fake-cloud-kms/names"
+	"github.com/winor30/fake-cloud-kms/store"
+)
+
+const (
+	// autokeyKeyRingID is the key ring Autokey provisions keys into, in the
+	// key project and the key handle's location.
+	autokeyKeyRingID      = "autokey"
+	autokeyRotationPeriod = 365 * 24 * time.Hour
+)
+
+// resourceTypeSelectorPattern matches {SERVICE}.googleapis.com/{TYPE}.
+var resourceTypeSelectorPattern = regexp.MustCompile(`^([a-z][a-z0-9-]*)\.googleapis\.com/([A-Za-z][A-Za-z0-9]*)$`)
+
+// UpdateAutokeyConfig updates the fields named by update_mask (key_project,
+// key_project_resolution_mode) of a folder or project Autokey configuration.
+// A non-empty etag must match the stored configuration's.
+func (s *service) UpdateAutokeyConfig(ctx context.Context, req *kmspb.UpdateAutokeyConfigRequest) (*kmspb.AutokeyConfig, error) {
+	update := req.GetAutokeyConfig()
+	if update == nil {
+		return nil, status.Error(codes.InvalidArgument, "autokey_config is required")
+	}
+	if _, err := names.ParseAutokeyConfig(update.GetName()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
+	}
+	if len(req.GetUpdateMask().GetPaths()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "update_mask is required")
+	}
+
+	s.autokeyMu.Lock()
+	defer s.autokeyMu.Unlock()
+	current, err := s.loadAutokeyConfig(ctx, update.GetName())
+	if err != nil {
+		return nil, err
+	}
+	if update.GetEtag() != "" && update.GetEtag() != current.GetEtag() {
+		return nil, status.Error(codes.Aborted, "the autokey config was modified concurrently; re-read it and retry")
+	}
+
+	updated := proto.Clone(current).(*kmspb.AutokeyConfig)
+	for _, path := range req.GetUpdateMask().GetPaths() {
+		switch path {
+		case "key_project", "keyProject":
+			updated.KeyProject = update.GetKeyProject()
+		case "key_project_resolution_mode", "keyProjectResolutionMode":
+			updated.KeyProjectResolutionMode = update.GetKeyProjectResolutionMode()
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "unsupported update_mask path %q", path)
+		}
+	}
+	if err := validateAutokeyConfig(updated); err != nil {
+		return nil, err
+	}
+	updated.State = kmspb.AutokeyConfig_ACTIVE
+	if !autokeyConfigured(updated) {
+		updated.State = kmspb.AutokeyConfig_UNINITIALIZED
+	}
+	updated.Etag = contentEtag(updated)
+	if err := s.store.SetAutokeyConfig(ctx, updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// GetAutokeyConfig returns a folder or project Autokey configuration, which
+// is UNINITIALIZED until updated.
+func (s *service) GetAutokeyConfig(ctx context.Context, req *kmspb.GetAutokeyConfigRequest) (*kmspb.AutokeyConfig, error) {
+	if _, err := names.ParseAutokeyConfig(req.GetName()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
+	}
+	return s.loadAutokeyConfig(ctx, req.GetName())
+}
+
+// ShowEffectiveAutokeyConfig returns the key project Autokey uses for a
+// resource project. The emulator does not model folder ancestry, so only the
+// project's own configuration applies; key_project is empty when Autokey is
+// not configured or is DISABLED.
+func (s *service) ShowEffectiveAutokeyConfig(ctx context.Context, req *kmspb.ShowEffectiveAutokeyConfigRequest) (*kmspb.ShowEffectiveAutokeyConfigResponse, error) {
+	if _, err := names.ParseProject(req.GetParent()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid parent: %v", err)
+	}
+	keyProject, err := s.effectiveKeyProject(ctx, req.GetParent())
+	if err != nil {
+		return nil, err
+	}
+	return &kmspb.ShowEffectiveAutokeyConfigResponse{KeyProject: keyProject}, nil
+}
+
+// CreateKeyHandle provisions an HSM-protected ENCRYPT_DECRYPT key for the
+// requested resource type in the "autokey" key ring of the effective key
+// project and the handle's location, and records the handle. The returned
+// operation's response is the KeyHandle; the key and handle exist once it is
+// done.
+func (s *service) CreateKeyHandle(ctx context.Context, req *kmspb.CreateKeyHandleRequest) (*longrunningpb.Operation, error) {
+	parent, err := names.ParseLocation(req.GetParent())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid parent: %v", err)
+	}
+	if err := s.checkLocation(parent); err != nil {
+		return nil, err
+	}
+	selector := req.GetKeyHandle().GetResourceTypeSelector()
+	match := resourceTypeSelectorPattern.FindStringSubmatch(selector)
+	if match == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "resource_type_selector %q must look like {SERVICE}.googleapis.com/{TYPE}", selector)
+	}
+	id := req.GetKeyHandleId()
+	if id == "" {
+		id = newUUID()
+	}
+	handle, err := names.ParseKeyHandle(names.KeyHandle{Location: parent, KeyHandle: id}.ResourceName())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid key_handle_id: %v", err)
+	}
+	project := "projects/" + parent.Project
+	keyProject, err := s.effectiveKeyProject(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	if keyProject == "" {
+		return nil, status.Errorf(codes.FailedPrecondition, "Autokey is not configured for %s; set its key project with UpdateAutokeyConfig", project)
+	}
+	keyProjectID, _ := names.ParseProject(keyProject)
+	keyLocation := names.Location{Project: keyProjectID, Location: parent.Location}
+
+	opName := newOperationName(parent)
+	if err := s.reserveKeyHandle(ctx, handle.ResourceName(), opName); err != nil {
+		return nil, err
+	}
+	op, err := s.startOperation(ctx, opName, &kmspb.CreateKeyHandleMetadata{}, func(ctx context.Context) (proto.Message, error) {
+		defer s.releaseKeyHandle(handle.ResourceName(), opName)
+		if _, err := s.CreateKeyRing(ctx, &kmspb.CreateKeyRingRequest{Parent: keyLocation.ParentName(), KeyRingId: autokeyKeyRingID}); err != nil && status.Code(err) != codes.AlreadyExists {
+			return nil, err
+		}
+		cryptoKey, err := s.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+			Parent:      names.KeyRing{Location: keyLocation, KeyRing: autokeyKeyRingID}.ResourceName(),
+			CryptoKeyId: fmt.Sprintf("%s-%s-%s", match[1], strings.ToLower(match[2]), randomSuffix()),
+			CryptoKey: &kmspb.CryptoKey{
+				Purpose: kmspb.CryptoKey_ENCRYPT_DECRYPT,
+				VersionTemplate: &kmspb.CryptoKeyVersionTemplate{
+					ProtectionLevel: kmspb.ProtectionLevel_HSM,
+					Algorithm:       kmspb.CryptoKeyVersion_GOOGLE_SYMMETRIC_ENCRYPTION,
+				},
+				RotationSchedule: &kmspb.CryptoKey_RotationPeriod{RotationPeriod: durationpb.New(autokeyRotationPeriod)},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		keyHandle := &kmspb.KeyHandle{
+			Name:                 handle.ResourceName(),
+			KmsKey:               cryptoKey.GetName(),
+			ResourceTypeSelector: selector,
+		}
+		if err := s.store.CreateKeyHandle(ctx, keyHandle); err != nil {
+			// Do not leave behind a key that no handle refers to.
+			if deleteErr := s.store.DeleteCryptoKey(ctx, cryptoKey.GetName()); deleteErr != nil {
+				return nil, errors.Join(err, deleteErr)
+			}
+			return nil, err
+		}
+		return keyHandle, nil
+	})
+	if err != nil {
+		s.releaseKeyHandle(handle.ResourceName(), opName)
+		return nil, err
+	}
+	return op, nil
+}
+
+// reserveKeyHandle claims the key handle name for the operation opName, so
+// that a concurrent CreateKeyHandle for the same name fails instead of
+// provisioning a second key.
+func (s *service) reserveKeyHandle(ctx context.Context, name, opName string) error {
+	s.keyHandleMu.Lock()
+	defer s.keyHandleMu.Unlock()
+	if _, err := s.store.GetKeyHandle(ctx, name); err == nil {
+		return status.Errorf(codes.AlreadyExists, "key handle %q already exists", name)
+	}
+	if pending, ok := s.pendingKeyHandles[name]; ok {
+		return status.Errorf(codes.AlreadyExists, "key handle %q is already being created by %s", name, pending)
+	}
+	s.pendingKeyHandles[name] = opName
+	return nil
+}
+
+// releaseKeyHandle drops the reservation opName holds on the key handle name.
+func (s *service) releaseKeyHandle(name, opName string) {
+	s.keyHandleMu.Lock()
+	defer s.keyHandleMu.Unlock()
+	if s.pendingKeyHandles[name] == opName {
+		delete(s.pendingKeyHandles, name)
+	}
+}
+
+// releaseCancelledKeyHandles drops the reservations held by the operation
+// opName once it is done. A pending operation that is cancelled never runs
+// the work that would release them itself.
+func (s *service) releaseCancelledKeyHandles(opName string) {
+	if !s.operations.Done(opName) {
+		return
+	}
+	s.keyHandleMu.Lock()
+	defer s.keyHandleMu.Unlock()
+	for name, pending := range s.pendingKeyHandles {
+		if pending == opName {
+			delete(s.pendingKeyHandles, name)
+		}
+	}
+}
+
+// GetKeyHandle returns a key handle.
+func (s *service) GetKeyHandle(ctx context.Context, req *kmspb.GetKeyHandleRequest) (*kmspb.KeyHandle, error) {
+	if _, err := names.ParseKeyHandle(req.GetName()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
+	}
+	return s.store.GetKeyHandle(ctx, req.GetName())
+}
+
+// ListKeyHandles lists the key handles of a project and location. filter is
+// typically resource_type_selector="{SERVICE}.googleapis.com/{TYPE}".
+func (s *service) ListKeyHandles(ctx context.Context, req *kmspb.ListKeyHandlesRequest) (*kmspb.ListKeyHandlesResponse, error) {
+	parent, err := names.ParseLocation(req.GetParent())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid parent: %v", err)
+	}
+
+	query, err := parseListQuery((&kmspb.KeyHandle{}).ProtoReflect().Descriptor(), req.GetFilter(), "")
+	if err != nil {
+		return nil, err
+	}
+	page, err := s.parsePageRequest(pageToken{Parent: parent.ParentName(), Filter: req.GetFilter()}, req.GetPageSize(), req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+
+	items, next, _, err := listPage(s.pageTokens, page, query,
+		func(opts store.ListOptions) ([]*kmspb.KeyHandle, int, error) {
+			return s.store.ListKeyHandles(ctx, parent.ParentName(), opts)
+		},
+		func(kh *kmspb.KeyHandle) (*kmspb.KeyHandle, error) { return kh, nil },
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &kmspb.ListKeyHandlesResponse{KeyHandles: items, NextPageToken: next}, nil
+}
+
+// loadAutokeyConfig reads a stored configuration, or the UNINITIALIZED
+// default when none has been set.
+func (s *service) loadAutokeyConfig(ctx context.Context, name string) (*kmspb.AutokeyConfig, error) {
+	config, err := s.store.GetAutokeyConfig(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &kmspb.AutokeyConfig{Name: name, State: kmspb.AutokeyConfig_UNINITIALIZED}
+		config.Etag = contentEtag(config)
+	}
+	return config, nil
+}
+
+// effectiveKeyProject resolves the key project for resource project from its
+// Autokey configuration, returning "" when Autokey does not apply.
+func (s *service) effectiveKeyProject(ctx context.Context, project string) (string, error) {
+	config, err := s.store.GetAutokeyConfig(ctx, project+"/autokeyConfig")
+	if err != nil {
+		return "", err
+	}
+	switch config.GetKeyProjectResolutionMode() {
+	case kmspb.AutokeyConfig_RESOURCE_PROJECT:
+		return project, nil
+	case kmspb.AutokeyConfig_DISABLED:
+		return "", nil
+	default:
+		return config.GetKeyProject(), nil
+	}
+}
+
+func validateAutokeyConfig(config *kmspb.AutokeyConfig) error {
+	mode := config.GetKeyProjectResolutionMode()
+	if config.GetKeyProject() != "" {
+		if _, err := names.ParseProject(config.GetKeyProject()); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid key_project: %v", err)
+		}
+		if mode == kmspb.AutokeyConfig_RESOURCE_PROJECT || mode == kmspb.AutokeyConfig_DISABLED {
+			return status.Errorf(codes.InvalidArgument, "key_project must not be set when key_project_resolution_mode is %s", mode)
+		}
+	}
+	if mode == kmspb.AutokeyConfig_DEDICATED_KEY_PROJECT && config.GetKeyProject() == "" {
+		return status.Error(codes.InvalidArgument, "key_project is required when key_project_resolution_mode is DEDICATED_KEY_PROJECT")
+	}
+	return nil
+}
+
+// autokeyConfigured reports whether config sets anything beyond the defaults;
+// clearing key_project without choosing a mode resets it to UNINITIALIZED.
+func autokeyConfigured(config *kmspb.AutokeyConfig) bool {
+	return config.GetKeyProject() != "" || config.GetKeyProjectResolutionMode() != kmspb.AutokeyConfig_KEY_PROJECT_RESOLUTION_MODE_UNSPECIFIED
+}
+
+// contentEtag derives the etag of m from its content, ignoring any etag
+// field it has.
+func contentEtag(m proto.Message) string {
+	content := proto.Clone(m)
+	if field := content.ProtoReflect().Descriptor().Fields().ByName("etag"); field != nil {
+		content.ProtoReflect().Clear(field)
+	}
+	raw, err := proto.MarshalOptions{Deterministic: true}.Marshal(content)
+	if err != nil {
+		// Marshaling a well-formed resource cannot fail.
+		panic(fmt.Sprintf("marshal %s: %v", content.ProtoReflect().Descriptor().FullName(), err))
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:8])
+}
+
+// randomSuffix returns a short random suffix that keeps Autokey key IDs
+// unique within their key ring.
+func randomSuffix() string {
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
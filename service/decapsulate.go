@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/winor30/fake-cloud-kms/crc"
+	"github.com/winor30/fake-cloud-kms/kmscrypto"
+	"github.com/winor30/fake-cloud-kms/names"
+)
+
+func (s *service) Decapsulate(ctx context.Context, req *kmspb.DecapsulateRequest) (*kmspb.DecapsulateResponse, error) {
+	if _, err := names.ParseCryptoKeyVersion(req.GetName()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
+	}
+	if len(req.GetCiphertext()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "ciphertext is required")
+	}
+
+	version, material, err := s.loadVersion(ctx, req.GetName())
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(supportedAlgorithms[kmspb.CryptoKey_KEY_ENCAPSULATION], version.GetAlgorithm()) {
+		return nil, status.Errorf(codes.FailedPrecondition, "key version algorithm %v does not support Decapsulate", version.GetAlgorithm())
+	}
+	if err := requireEnabled(version); err != nil {
+		return nil, err
+	}
+
+	verifiedCiphertext, err := verifyChecksum(req.GetCiphertext(), req.GetCiphertextCrc32C())
+	if err != nil {
+		return nil, err
+	}
+
+	sharedSecret, err := s.engine.Decapsulate(ctx, material, version.GetAlgorithm().String(), req.GetCiphertext())
+	switch {
+	case errors.Is(err, kmscrypto.ErrDecryption):
+		return nil, status.Errorf(codes.InvalidArgument, "invalid ciphertext for algorithm %v: %v", version.GetAlgorithm(), err)
+	case err != nil:
+		return nil, status.Errorf(codes.Internal, "decapsulate failed: %v", err)
+	}
+
+	return &kmspb.DecapsulateResponse{
+		Name:                     version.GetName(),
+		SharedSecret:             sharedSecret,
+		SharedSecretCrc32C:       proto.Int64(int64(crc.Compute(sharedSecret))),
+		VerifiedCiphertextCrc32C: verifiedCiphertext,
+		ProtectionLevel:          version.GetProtectionLevel(),
+	}, nil
+}
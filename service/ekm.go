@@ -0,0 +1,384 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/winor30/fake-cloud-kms/names"
+	"github.com/winor30/fake-cloud-kms/store"
+)
+
+const (
+	// maxServerCertificates is the Cloud KMS limit on certificates per
+	// service resolver.
+	maxServerCertificates = 10
+	// ekmProbeTimeout bounds each VerifyConnectivity handshake.
+	ekmProbeTimeout = 10 * time.Second
+)
+
+var (
+	serviceDirectoryServicePattern = regexp.MustCompile(`^projects/[^/]+/locations/[^/]+/namespaces/[^/]+/services/[^/]+$`)
+	// cryptoSpacePathPattern matches a relative path such as v0/cryptospaces/space-1.
+	cryptoSpacePathPattern = regexp.MustCompile(`^[A-Za-z0-9._~-]+(/[A-Za-z0-9._~-]+)*$`)
+)
+
+// CreateEkmConnection stores a new EKM connection. key_management_mode
+// defaults to MANUAL; CLOUD_KMS requires a crypto_space_path.
+func (s *service) CreateEkmConnection(ctx context.Context, req *kmspb.CreateEkmConnectionRequest) (*kmspb.EkmConnection, error) {
+	parent, err := names.ParseLocation(req.GetParent())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid parent: %v", err)
+	}
+	if err := s.checkEkmLocation(parent); err != nil {
+		return nil, err
+	}
+	if req.GetEkmConnectionId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "ekm_connection_id is required")
+	}
+	name, err := names.ParseEkmConnection(names.EkmConnection{Location: parent, EkmConnection: req.GetEkmConnectionId()}.ResourceName())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid ekm_connection_id: %v", err)
+	}
+
+	connection := &kmspb.EkmConnection{
+		Name:              name.ResourceName(),
+		CreateTime:        timestamppb.New(s.now()),
+		KeyManagementMode: req.GetEkmConnection().GetKeyManagementMode(),
+		CryptoSpacePath:   req.GetEkmConnection().GetCryptoSpacePath(),
+	}
+	for _, resolver := range req.GetEkmConnection().GetServiceResolvers() {
+		connection.ServiceResolvers = append(connection.ServiceResolvers, proto.Clone(resolver).(*kmspb.EkmConnection_ServiceResolver))
+	}
+	if err := normalizeEkmConnection(connection); err != nil {
+		return nil, err
+	}
+	connection.Etag = contentEtag(connection)
+	if err := s.store.CreateEkmConnection(ctx, connection); err != nil {
+		return nil, err
+	}
+	return connection, nil
+}
+
+func (s *service) GetEkmConnection(ctx context.Context, req *kmspb.GetEkmConnectionRequest) (*kmspb.EkmConnection, error) {
+	if _, err := names.ParseEkmConnection(req.GetName()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
+	}
+	return s.store.GetEkmConnection(ctx, req.GetName())
+}
+
+func (s *service) ListEkmConnections(ctx context.Context, req *kmspb.ListEkmConnectionsRequest) (*kmspb.ListEkmConnectionsResponse, error) {
+	parent, err := names.ParseLocation(req.GetParent())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid parent: %v", err)
+	}
+
+	query, err := parseListQuery((&kmspb.EkmConnection{}).ProtoReflect().Descriptor(), req.GetFilter(), req.GetOrderBy())
+	if err != nil {
+		return nil, err
+	}
+	page, err := s.parsePageRequest(pageToken{Parent: parent.ParentName(), Filter: req.GetFilter(), OrderBy: req.GetOrderBy()}, req.GetPageSize(), req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+
+	items, next, total, err := listPage(s.pageTokens, page, query,
+		func(opts store.ListOptions) ([]*kmspb.EkmConnection, int, error) {
+			return s.store.ListEkmConnections(ctx, parent.ParentName(), opts)
+		},
+		func(c *kmspb.EkmConnection) (*kmspb.EkmConnection, error) { return c, nil },
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &kmspb.ListEkmConnectionsResponse{EkmConnections: items, NextPageToken: next, TotalSize: total}, nil
+}
+
+// UpdateEkmConnection updates the fields named by update_mask. A non-empty
+// etag must match the stored connection's.
+func (s *service) UpdateEkmConnection(ctx context.Context, req *kmspb.UpdateEkmConnectionRequest) (*kmspb.EkmConnection, error) {
+	if req.GetEkmConnection() == nil {
+		return nil, status.Error(codes.InvalidArgument, "ekm_connection is required")
+	}
+	update := proto.Clone(req.GetEkmConnection()).(*kmspb.EkmConnection)
+	if _, err := names.ParseEkmConnection(update.GetName()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
+	}
+	paths := req.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "update_mask is required")
+	}
+
+	s.ekmMu.Lock()
+	defer s.ekmMu.Unlock()
+	connection, err := s.store.GetEkmConnection(ctx, update.GetName())
+	if err != nil {
+		return nil, err
+	}
+	if update.GetEtag() != "" && update.GetEtag() != connection.GetEtag() {
+		return nil, status.Error(codes.Aborted, "the ekm connection was modified concurrently; re-read it and retry")
+	}
+
+	for _, path := range paths {
+		switch path {
+		case "service_resolvers":
+			connection.ServiceResolvers = update.GetServiceResolvers()
+		case "key_management_mode":
+			connection.KeyManagementMode = update.GetKeyManagementMode()
+		case "crypto_space_path":
+			connection.CryptoSpacePath = update.GetCryptoSpacePath()
+		case "name", "create_time", "etag":
+			return nil, status.Errorf(codes.InvalidArgument, "update_mask path %q refers to an immutable field", path)
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "update_mask path %q is not a valid EkmConnection field", path)
+		}
+	}
+	if err := normalizeEkmConnection(connection); err != nil {
+		return nil, err
+	}
+	connection.Etag = contentEtag(connection)
+	if err := s.store.UpdateEkmConnection(ctx, connection); err != nil {
+		return nil, err
+	}
+	return connection, nil
+}
+
+// GetEkmConfig returns the EkmConfig singleton of a project and location,
+// which has no default connection until updated.
+func (s *service) GetEkmConfig(ctx context.Context, req *kmspb.GetEkmConfigRequest) (*kmspb.EkmConfig, error) {
+	if _, err := names.ParseEkmConfig(req.GetName()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
+	}
+	return s.loadEkmConfig(ctx, req.GetName())
+}
+
+// UpdateEkmConfig sets or clears default_ekm_connection, which must name an
+// existing connection in the config's project and location.
+func (s *service) UpdateEkmConfig(ctx context.Context, req *kmspb.UpdateEkmConfigRequest) (*kmspb.EkmConfig, error) {
+	update := req.GetEkmConfig()
+	if update == nil {
+		return nil, status.Error(codes.InvalidArgument, "ekm_config is required")
+	}
+	loc, err := names.ParseEkmConfig(update.GetName())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
+	}
+	paths := req.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "update_mask is required")
+	}
+
+	s.ekmMu.Lock()
+	defer s.ekmMu.Unlock()
+	config, err := s.loadEkmConfig(ctx, update.GetName())
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		switch path {
+		case "default_ekm_connection":
+			config.DefaultEkmConnection = update.GetDefaultEkmConnection()
+		case "name":
+			return nil, status.Errorf(codes.InvalidArgument, "update_mask path %q refers to an immutable field", path)
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "update_mask path %q is not a valid EkmConfig field", path)
+		}
+	}
+
+	if def := config.GetDefaultEkmConnection(); def != "" {
+		connection, err := names.ParseEkmConnection(def)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid default_ekm_connection: %v", err)
+		}
+		if connection.Location != loc {
+			return nil, status.Errorf(codes.InvalidArgument, "default_ekm_connection %q must be in %s", def, loc.ParentName())
+		}
+		if _, err := s.store.GetEkmConnection(ctx, def); err != nil {
+			if status.Code(err) == codes.NotFound {
+				return nil, status.Errorf(codes.InvalidArgument, "default_ekm_connection %q does not exist", def)
+			}
+			return nil, err
+		}
+	}
+	if err := s.store.SetEkmConfig(ctx, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// VerifyConnectivity opens a TLS connection to every service resolver of an
+// EKM connection and checks that the endpoint presents one of the resolver's
+// server certificates, valid for its hostname. Service Directory is not
+// modeled: the emulator dials the hostname itself, on port 443 unless the
+// hostname carries a port. An unreachable or mismatched endpoint fails with
+// FailedPrecondition.
+func (s *service) VerifyConnectivity(ctx context.Context, req *kmspb.VerifyConnectivityRequest) (*kmspb.VerifyConnectivityResponse, error) {
+	if _, err := names.ParseEkmConnection(req.GetName()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
+	}
+	connection, err := s.store.GetEkmConnection(ctx, req.GetName())
+	if err != nil {
+		return nil, err
+	}
+	if len(connection.GetServiceResolvers()) == 0 {
+		return nil, status.Errorf(codes.FailedPrecondition, "ekm connection %q has no service resolvers", req.GetName())
+	}
+	for _, resolver := range connection.GetServiceResolvers() {
+		if err := probeEkm(ctx, resolver); err != nil {
+			return nil, status.Errorf(codes.FailedPrecondition, "ekm connection %q cannot reach %s: %v", req.GetName(), resolver.GetHostname(), err)
+		}
+	}
+	return &kmspb.VerifyConnectivityResponse{}, nil
+}
+
+// checkEkmLocation applies checkLocation and, in strict mode, also rejects
+// catalog locations without EKM support.
+func (s *service) checkEkmLocation(loc names.Location) error {
+	if err := s.checkLocation(loc); err != nil {
+		return err
+	}
+	if catalogued, ok := s.findLocation(loc.Location); s.strictLocations && ok && !catalogued.EKMAvailable {
+		return status.Errorf(codes.InvalidArgument, "location %q does not support EKM connections", loc.Location)
+	}
+	return nil
+}
+
+func (s *service) loadEkmConfig(ctx context.Context, name string) (*kmspb.EkmConfig, error) {
+	config, err := s.store.GetEkmConfig(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &kmspb.EkmConfig{Name: name}
+	}
+	return config, nil
+}
+
+// normalizeEkmConnection validates connection, defaults its
+// key_management_mode to MANUAL and fills in the parsed details of its
+// server certificates.
+func normalizeEkmConnection(connection *kmspb.EkmConnection) error {
+	if connection.GetKeyManagementMode() == kmspb.EkmConnection_KEY_MANAGEMENT_MODE_UNSPECIFIED {
+		connection.KeyManagementMode = kmspb.EkmConnection_MANUAL
+	}
+	path := connection.GetCryptoSpacePath()
+	if connection.GetKeyManagementMode() == kmspb.EkmConnection_CLOUD_KMS && path == "" {
+		return status.Error(codes.InvalidArgument, "crypto_space_path is required when key_management_mode is CLOUD_KMS")
+	}
+	if path != "" && !cryptoSpacePathPattern.MatchString(path) {
+		return status.Errorf(codes.InvalidArgument, "crypto_space_path %q must be a relative path such as v0/cryptospaces/<id>", path)
+	}
+
+	if len(connection.GetServiceResolvers()) > 1 {
+		return status.Error(codes.InvalidArgument, "at most one service resolver is supported")
+	}
+	for _, resolver := range connection.GetServiceResolvers() {
+		if !serviceDirectoryServicePattern.MatchString(resolver.GetServiceDirectoryService()) {
+			return status.Errorf(codes.InvalidArgument, "service_directory_service %q must look like projects/*/locations/*/namespaces/*/services/*", resolver.GetServiceDirectoryService())
+		}
+		if err := validateEkmHostname(resolver.GetHostname()); err != nil {
+			return err
+		}
+		certificates := resolver.GetServerCertificates()
+		if len(certificates) == 0 || len(certificates) > maxServerCertificates {
+			return status.Errorf(codes.InvalidArgument, "server_certificates must hold between 1 and %d certificates", maxServerCertificates)
+		}
+		for i, certificate := range certificates {
+			if len(certificate.GetRawDer()) == 0 {
+				return status.Errorf(codes.InvalidArgument, "server_certificates[%d].raw_der is required", i)
+			}
+			certificates[i] = describeCertificate(certificate.GetRawDer())
+		}
+	}
+	return nil
+}
+
+func validateEkmHostname(hostname string) error {
+	host := hostname
+	if h, _, err := net.SplitHostPort(hostname); err == nil {
+		host = h
+	}
+	if host == "" || strings.ContainsAny(host, "/@?# ") {
+		return status.Errorf(codes.InvalidArgument, "hostname %q must be a host name, optionally with a port", hostname)
+	}
+	return nil
+}
+
+// describeCertificate returns the Certificate for rawDER with its output-only
+// fields populated. Unparseable certificates keep parsed unset.
+func describeCertificate(rawDER []byte) *kmspb.Certificate {
+	fingerprint := sha256.Sum256(rawDER)
+	certificate := &kmspb.Certificate{RawDer: rawDER, Sha256Fingerprint: hex.EncodeToString(fingerprint[:])}
+	parsed, err := x509.ParseCertificate(rawDER)
+	if err != nil {
+		return certificate
+	}
+	certificate.Parsed = true
+	certificate.Issuer = parsed.Issuer.String()
+	certificate.Subject = parsed.Subject.String()
+	certificate.SubjectAlternativeDnsNames = parsed.DNSNames
+	certificate.NotBeforeTime = timestamppb.New(parsed.NotBefore)
+	certificate.NotAfterTime = timestamppb.New(parsed.NotAfter)
+	certificate.SerialNumber = parsed.SerialNumber.Text(16)
+	return certificate
+}
+
+// probeEkm completes a TLS handshake with the endpoint of resolver and checks
+// that it presents one of the resolver's server certificates.
+func probeEkm(ctx context.Context, resolver *kmspb.EkmConnection_ServiceResolver) error {
+	addr := resolver.GetHostname()
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "443")
+	}
+	host, _, _ := net.SplitHostPort(addr)
+
+	dialer := &tls.Dialer{Config: &tls.Config{
+		ServerName: host,
+		MinVersion: tls.VersionTLS12,
+		// The resolver pins leaf certificates rather than naming a CA, so
+		// chain verification is replaced by VerifyPeerCertificate.
+		InsecureSkipVerify: true, //nolint:gosec // the leaf is pinned below
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyPinnedLeaf(rawCerts, host, resolver.GetServerCertificates())
+		},
+	}}
+	ctx, cancel := context.WithTimeout(ctx, ekmProbeTimeout)
+	defer cancel()
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func verifyPinnedLeaf(rawCerts [][]byte, host string, pinned []*kmspb.Certificate) error {
+	if len(rawCerts) == 0 {
+		return errors.New("endpoint presented no certificate")
+	}
+	for _, certificate := range pinned {
+		if !bytes.Equal(certificate.GetRawDer(), rawCerts[0]) {
+			continue
+		}
+		leaf, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return fmt.Errorf("parse server certificate: %w", err)
+		}
+		return leaf.VerifyHostname(host)
+	}
+	return errors.New("endpoint presented a certificate missing from server_certificates")
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"slices"
+	"strings"
+
+	"cloud.google.com/go/iam/apiv1/iampb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/winor30/fake-cloud-kms/iampolicy"
+)
+
+// policyMemberKinds lists the prefixes a policy member may carry before ":".
+var policyMemberKinds = []string{
+	"user", "serviceAccount", "group", "domain", "principal", "principalSet", "deleted",
+	"projectOwner", "projectEditor", "projectViewer",
+}
+
+// GetIamPolicy returns the policy of a project, key ring, crypto key or
+// import job. Project policies exist only in the emulator, to grant access
+// across a whole project when authorization is enforced. Conditional
+// bindings are served only at requested_policy_version 3; older versions see
+// them as unconditional bindings of a "_withcond_" role, as in Cloud IAM.
+func (s *service) GetIamPolicy(ctx context.Context, req *iampb.GetIamPolicyRequest) (*iampb.Policy, error) {
+	if _, err := iamPermissions(req.GetResource()); err != nil {
+		return nil, err
+	}
+	requested := req.GetOptions().GetRequestedPolicyVersion()
+	switch requested {
+	case 0, 1, 3:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "requested_policy_version must be 1 or 3, got %d", requested)
+	}
+
+	policy, err := s.loadIamPolicy(ctx, req.GetResource())
+	if err != nil {
+		return nil, err
+	}
+	etag := policyEtag(policy)
+	if requested < 3 {
+		policy = downgradePolicy(policy)
+	}
+	policy.Etag = etag
+	return policy, nil
+}
+
+// SetIamPolicy replaces the policy of a project, key ring, crypto key or
+// import job.
+// A non-empty etag must match the current policy's, or the call fails with
+// Aborted. audit_configs are replaced only when named in update_mask.
+func (s *service) SetIamPolicy(ctx context.Context, req *iampb.SetIamPolicyRequest) (*iampb.Policy, error) {
+	if _, err := iamPermissions(req.GetResource()); err != nil {
+		return nil, err
+	}
+	if req.GetPolicy() == nil {
+		return nil, status.Error(codes.InvalidArgument, "policy is required")
+	}
+	updateAuditConfigs := false
+	for _, path := range req.GetUpdateMask().GetPaths() {
+		switch path {
+		case "bindings", "etag", "version":
+		case "audit_configs":
+			updateAuditConfigs = true
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "update_mask path %q is not a valid Policy field", path)
+		}
+	}
+	if err := validatePolicy(req.GetPolicy()); err != nil {
+		return nil, err
+	}
+
+	s.iamMu.Lock()
+	defer s.iamMu.Unlock()
+	current, err := s.loadIamPolicy(ctx, req.GetResource())
+	if err != nil {
+		return nil, err
+	}
+	if etag := req.GetPolicy().GetEtag(); len(etag) > 0 && !bytes.Equal(etag, policyEtag(current)) {
+		return nil, status.Error(codes.Aborted, "there were concurrent policy changes; re-read the policy and retry")
+	}
+
+	updated := proto.Clone(req.GetPolicy()).(*iampb.Policy)
+	updated.Etag = nil
+	if updated.GetVersion() == 0 {
+		updated.Version = 1
+	}
+	if !updateAuditConfigs {
+		updated.AuditConfigs = current.GetAuditConfigs()
+	}
+	if err := s.store.SetIamPolicy(ctx, req.GetResource(), updated); err != nil {
+		return nil, err
+	}
+	updated.Etag = policyEtag(updated)
+	return updated, nil
+}
+
+// TestIamPermissions returns the requested permissions that apply to the
+// resource. The service does not know the caller, so every applicable
+// permission is reported as held; with authorization enforced, the gRPC
+// layer narrows the result to the caller's grants.
+func (s *service) TestIamPermissions(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+	applicable, err := iamPermissions(req.GetResource())
+	if err != nil {
+		return nil, err
+	}
+	for _, permission := range req.GetPermissions() {
+		if strings.Contains(permission, "*") {
+			return nil, status.Errorf(codes.InvalidArgument, "permissions with wildcards are not allowed: %q", permission)
+		}
+	}
+	if _, err := s.store.GetIamPolicy(ctx, req.GetResource()); err != nil {
+		return nil, err
+	}
+
+	var held []string
+	for _, permission := range req.GetPermissions() {
+		if slices.Contains(applicable, permission) && !slices.Contains(held, permission) {
+			held = append(held, permission)
+		}
+	}
+	return &iampb.TestIamPermissionsResponse{Permissions: held}, nil
+}
+
+// loadIamPolicy reads the stored policy of resource, which is empty until set.
+func (s *service) loadIamPolicy(ctx context.Context, resource string) (*iampb.Policy, error) {
+	policy, err := s.store.GetIamPolicy(ctx, resource)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		policy = &iampb.Policy{}
+	}
+	return policy, nil
+}
+
+// iamPermissions returns the permissions that can be tested on resource,
+// which must name a project, key ring, crypto key or import job.
+func iamPermissions(resource string) ([]string, error) {
+	permissions, ok := iampolicy.Applicable(resource)
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "resource %q does not support IAM policies; use a project, key ring, crypto key or import job", resource)
+	}
+	return permissions, nil
+}
+
+func validatePolicy(policy *iampb.Policy) error {
+	version := policy.GetVersion()
+	switch version {
+	case 0, 1, 3:
+	default:
+		return status.Errorf(codes.InvalidArgument, "policy version must be 1 or 3, got %d", version)
+	}
+	for _, binding := range policy.GetBindings() {
+		role := binding.GetRole()
+		if !strings.HasPrefix(role, "roles/") && !strings.Contains(role, "/roles/") {
+			return status.Errorf(codes.InvalidArgument, "invalid role %q", role)
+		}
+		if strings.Contains(role, "_withcond_") {
+			return status.Errorf(codes.InvalidArgument, "role %q stands for a conditional binding; set the policy with version 3 and its condition", role)
+		}
+		if len(binding.GetMembers()) == 0 {
+			return status.Errorf(codes.InvalidArgument, "binding for %s has no members", role)
+		}
+		for _, member := range binding.GetMembers() {
+			if err := validatePolicyMember(member); err != nil {
+				return err
+			}
+		}
+		if condition := binding.GetCondition(); condition != nil {
+			if version != 3 {
+				return status.Errorf(codes.InvalidArgument, "policy with a condition on %s must be version 3", role)
+			}
+			if condition.GetExpression() == "" || condition.GetTitle() == "" {
+				return status.Errorf(codes.InvalidArgument, "condition on %s requires an expression and a title", role)
+			}
+		}
+	}
+	return nil
+}
+
+func validatePolicyMember(member string) error {
+	if member == "allUsers" || member == "allAuthenticatedUsers" {
+		return nil
+	}
+	kind, value, ok := strings.Cut(member, ":")
+	if !ok || value == "" || !slices.Contains(policyMemberKinds, kind) {
+		return status.Errorf(codes.InvalidArgument, "invalid policy member %q", member)
+	}
+	return nil
+}
+
+// policyEtag derives the etag of policy from its content.
+func policyEtag(policy *iampb.Policy) []byte {
+	content := proto.Clone(policy).(*iampb.Policy)
+	content.Etag = nil
+	raw, err := proto.MarshalOptions{Deterministic: true}.Marshal(content)
+	if err != nil {
+		// Marshaling a well-formed Policy cannot fail.
+		panic(fmt.Sprintf("marshal policy: %v", err))
+	}
+	sum := sha256.Sum256(raw)
+	return sum[:8]
+}
+
+// downgradePolicy renders policy for clients that asked for version 1.
+func downgradePolicy(policy *iampb.Policy) *iampb.Policy {
+	out := proto.Clone(policy).(*iampb.Policy)
+	if out.GetVersion() == 3 {
+		out.Version = 1
+	}
+	for _, binding := range out.GetBindings() {
+		if binding.GetCondition() == nil {
+			continue
+		}
+		sum := sha256.Sum256([]byte(binding.GetCondition().GetExpression()))
+		binding.Role = fmt.Sprintf("%s_withcond_%x", binding.GetRole(), sum[:10])
+		binding.Condition = nil
+	}
+	return out
+}
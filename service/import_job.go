@@ -0,0 +1,301 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/winor30/fake-cloud-kms/kmscrypto"
+	"github.com/winor30/fake-cloud-kms/names"
+	"github.com/winor30/fake-cloud-kms/store"
+)
+
+// importJobLifetime is how long an import job accepts wrapped keys after its
+// creation, as in Cloud KMS.
+const importJobLifetime = 3 * 24 * time.Hour
+
+// supportedImportMethods lists the import methods the emulator can unwrap.
+var supportedImportMethods = []kmspb.ImportJob_ImportMethod{
+	kmspb.ImportJob_RSA_OAEP_3072_SHA1_AES_256,
+	kmspb.ImportJob_RSA_OAEP_4096_SHA1_AES_256,
+	kmspb.ImportJob_RSA_OAEP_3072_SHA256_AES_256,
+	kmspb.ImportJob_RSA_OAEP_4096_SHA256_AES_256,
+	kmspb.ImportJob_RSA_OAEP_3072_SHA256,
+	kmspb.ImportJob_RSA_OAEP_4096_SHA256,
+}
+
+// CreateImportJob creates an import job in PENDING_GENERATION. Its RSA
+// wrapping key comes from a pre-generated pool, so the job is ACTIVE, with
+// public_key set, from the first time it is read back.
+func (s *service) CreateImportJob(ctx context.Context, req *kmspb.CreateImportJobRequest) (*kmspb.ImportJob, error) {
+	keyRing, err := names.ParseKeyRing(req.GetParent())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid parent: %v", err)
+	}
+	if req.GetImportJobId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "import_job_id is required")
+	}
+	if req.GetImportJob() == nil {
+		return nil, status.Error(codes.InvalidArgument, "import_job is required")
+	}
+
+	name := fmt.Sprintf("%s/importJobs/%s", keyRing.ResourceName(), req.GetImportJobId())
+	if _, err := names.ParseImportJob(name); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid import_job_id: %v", err)
+	}
+	method := req.GetImportJob().GetImportMethod()
+	if !slices.Contains(supportedImportMethods, method) {
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported import_method: %v", method)
+	}
+	level := req.GetImportJob().GetProtectionLevel()
+	if level != kmspb.ProtectionLevel_SOFTWARE && level != kmspb.ProtectionLevel_HSM {
+		return nil, status.Errorf(codes.InvalidArgument, "protection_level must be SOFTWARE or HSM, got %v", level)
+	}
+
+	material, err := s.engine.GenerateImportJobKeyMaterial(ctx, method.String())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to generate wrapping key: %v", err)
+	}
+
+	now := s.now()
+	job := &kmspb.ImportJob{
+		Name:            name,
+		ImportMethod:    method,
+		ProtectionLevel: level,
+		CreateTime:      timestamppb.New(now),
+		ExpireTime:      timestamppb.New(now.Add(importJobLifetime)),
+		State:           kmspb.ImportJob_PENDING_GENERATION,
+	}
+	if err := s.store.CreateImportJob(ctx, keyRing.ResourceName(), job, material); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (s *service) GetImportJob(ctx context.Context, req *kmspb.GetImportJobRequest) (*kmspb.ImportJob, error) {
+	if _, err := names.ParseImportJob(req.GetName()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
+	}
+	job, _, err := s.loadImportJob(ctx, req.GetName())
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (s *service) ListImportJobs(ctx context.Context, req *kmspb.ListImportJobsRequest) (*kmspb.ListImportJobsResponse, error) {
+	if _, err := names.ParseKeyRing(req.GetParent()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid parent: %v", err)
+	}
+
+	query, err := parseListQuery((&kmspb.ImportJob{}).ProtoReflect().Descriptor(), req.GetFilter(), req.GetOrderBy())
+	if err != nil {
+		return nil, err
+	}
+	page, err := s.parsePageRequest(pageToken{Parent: req.GetParent(), Filter: req.GetFilter(), OrderBy: req.GetOrderBy()}, req.GetPageSize(), req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+
+	jobs, next, total, err := listPage(s.pageTokens, page, query,
+		func(opts store.ListOptions) ([]*kmspb.ImportJob, int, error) {
+			return s.store.ListImportJobs(ctx, req.GetParent(), opts)
+		},
+		func(job *kmspb.ImportJob) (*kmspb.ImportJob, error) { return s.settleImportJob(ctx, job, nil) },
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &kmspb.ListImportJobsResponse{ImportJobs: jobs, NextPageToken: next, TotalSize: total}, nil
+}
+
+// ImportCryptoKeyVersion unwraps key material with an ACTIVE import job and
+// stores it as a new version of the parent key, or, when crypto_key_version
+// is set, back into a previously imported version that is DESTROYED or
+// IMPORT_FAILED. A symmetric encryption key without a primary version gets
+// the imported version as its primary.
+func (s *service) ImportCryptoKeyVersion(ctx context.Context, req *kmspb.ImportCryptoKeyVersionRequest) (*kmspb.CryptoKeyVersion, error) {
+	if _, err := names.ParseCryptoKey(req.GetParent()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid parent: %v", err)
+	}
+	if _, err := names.ParseImportJob(req.GetImportJob()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid import_job: %v", err)
+	}
+	wrappedKey := req.GetWrappedKey()
+	if len(wrappedKey) == 0 {
+		wrappedKey = req.GetRsaAesWrappedKey()
+	}
+	if len(wrappedKey) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "wrapped_key is required")
+	}
+
+	ck, err := s.store.GetCryptoKey(ctx, req.GetParent())
+	if err != nil {
+		return nil, err
+	}
+	algorithm := req.GetAlgorithm()
+	if !slices.Contains(supportedAlgorithms[ck.GetPurpose()], algorithm) {
+		return nil, status.Errorf(codes.InvalidArgument, "algorithm %v is not supported for %v keys", algorithm, ck.GetPurpose())
+	}
+
+	job, jobMaterial, err := s.loadImportJob(ctx, req.GetImportJob())
+	if err != nil {
+		return nil, err
+	}
+	if job.GetState() != kmspb.ImportJob_ACTIVE {
+		return nil, status.Errorf(codes.FailedPrecondition, "%s cannot be used for import, current state is: %s.", job.GetName(), job.GetState())
+	}
+	if job.GetProtectionLevel() != ck.GetVersionTemplate().GetProtectionLevel() {
+		return nil, status.Errorf(codes.FailedPrecondition, "import job protection level %v does not match crypto key protection level %v", job.GetProtectionLevel(), ck.GetVersionTemplate().GetProtectionLevel())
+	}
+
+	var target *kmspb.CryptoKeyVersion
+	if req.GetCryptoKeyVersion() != "" {
+		if target, err = s.reimportTarget(ctx, req.GetParent(), req.GetCryptoKeyVersion(), algorithm); err != nil {
+			return nil, err
+		}
+	}
+
+	formatted, err := s.engine.UnwrapImportedKey(ctx, jobMaterial, job.GetImportMethod().String(), wrappedKey)
+	switch {
+	case errors.Is(err, kmscrypto.ErrDecryption):
+		return nil, status.Errorf(codes.InvalidArgument, "wrapped_key could not be unwrapped with %s: %v", job.GetName(), err)
+	case err != nil:
+		return nil, status.Errorf(codes.Internal, "unwrap failed: %v", err)
+	}
+	material, err := s.engine.ImportKeyMaterial(ctx, algorithm.String(), formatted)
+	clear(formatted)
+	switch {
+	case errors.Is(err, kmscrypto.ErrInvalidKeyMaterial):
+		return nil, status.Errorf(codes.InvalidArgument, "key material cannot be imported as %v: %v", algorithm, err)
+	case err != nil:
+		return nil, status.Errorf(codes.Internal, "import failed: %v", err)
+	}
+
+	now := timestamppb.New(s.now())
+	if target != nil {
+		target.State = kmspb.CryptoKeyVersion_ENABLED
+		target.DestroyTime = nil
+		target.DestroyEventTime = nil
+		target.ImportJob = job.GetName()
+		target.ImportTime = now
+		target.ImportFailureReason = ""
+		target.Attestation = newAttestation(target.GetProtectionLevel())
+		if err := s.store.ReimportCryptoKeyVersion(ctx, target, material); err != nil {
+			return nil, err
+		}
+		return target, nil
+	}
+
+	versionName, err := s.nextVersionName(ctx, ck.GetName())
+	if err != nil {
+		return nil, err
+	}
+	version := &kmspb.CryptoKeyVersion{
+		Name:             versionName,
+		State:            kmspb.CryptoKeyVersion_ENABLED,
+		ProtectionLevel:  job.GetProtectionLevel(),
+		Algorithm:        algorithm,
+		CreateTime:       now,
+		ImportJob:        job.GetName(),
+		ImportTime:       now,
+		ReimportEligible: true,
+		Attestation:      newAttestation(job.GetProtectionLevel()),
+	}
+	if err := s.store.CreateCryptoKeyVersion(ctx, ck.GetName(), version, material); err != nil {
+		return nil, err
+	}
+	if ck.GetPurpose() == kmspb.CryptoKey_ENCRYPT_DECRYPT && ck.GetPrimary() == nil {
+		if _, err := s.store.SetPrimaryVersion(ctx, ck.GetName(), versionName); err != nil {
+			return nil, err
+		}
+	}
+	return version, nil
+}
+
+// reimportTarget loads the version named by an ImportCryptoKeyVersion
+// request and checks that key material can be imported into it again.
+// Destruction wipes key material, so the emulator cannot check that the
+// re-imported key is the one previously held.
+func (s *service) reimportTarget(ctx context.Context, parent, name string, algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm) (*kmspb.CryptoKeyVersion, error) {
+	versionResource, err := names.ParseCryptoKeyVersion(name)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid crypto_key_version: %v", err)
+	}
+	if versionResource.CryptoKey.ResourceName() != parent {
+		return nil, status.Errorf(codes.InvalidArgument, "crypto_key_version %s is not a version of %s", name, parent)
+	}
+	version, _, err := s.loadVersion(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if !version.GetReimportEligible() {
+		return nil, status.Errorf(codes.FailedPrecondition, "%s was not imported and cannot be re-imported.", name)
+	}
+	switch version.GetState() {
+	case kmspb.CryptoKeyVersion_DESTROYED, kmspb.CryptoKeyVersion_IMPORT_FAILED:
+	default:
+		return nil, status.Errorf(codes.FailedPrecondition, "%s cannot be re-imported, current state is: %s.", name, version.GetState())
+	}
+	if version.GetAlgorithm() != algorithm {
+		return nil, status.Errorf(codes.InvalidArgument, "algorithm %v does not match the algorithm of %s (%v)", algorithm, name, version.GetAlgorithm())
+	}
+	return version, nil
+}
+
+// loadImportJob reads an import job and its wrapping key, advancing its state.
+func (s *service) loadImportJob(ctx context.Context, name string) (*kmspb.ImportJob, kmscrypto.KeyMaterial, error) {
+	job, material, err := s.store.GetImportJob(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	settled, err := s.settleImportJob(ctx, job, material)
+	if err != nil {
+		return nil, nil, err
+	}
+	return settled, material, nil
+}
+
+// settleImportJob activates a PENDING_GENERATION job, publishing its wrapping
+// key, and expires an ACTIVE job once its expire_time has passed. material
+// is the job's wrapping key, read from the store when nil and needed.
+func (s *service) settleImportJob(ctx context.Context, job *kmspb.ImportJob, material kmscrypto.KeyMaterial) (*kmspb.ImportJob, error) {
+	now := s.now()
+	changed := false
+	if job.GetState() == kmspb.ImportJob_PENDING_GENERATION {
+		if material == nil {
+			var err error
+			if _, material, err = s.store.GetImportJob(ctx, job.GetName()); err != nil {
+				return nil, err
+			}
+		}
+		pemBytes, err := s.engine.GetPublicKeyPEM(ctx, material, job.GetImportMethod().String())
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to get wrapping key: %v", err)
+		}
+		job.State = kmspb.ImportJob_ACTIVE
+		job.GenerateTime = timestamppb.New(now)
+		job.PublicKey = &kmspb.ImportJob_WrappingPublicKey{Pem: string(pemBytes)}
+		job.Attestation = newAttestation(job.GetProtectionLevel())
+		changed = true
+	}
+	if job.GetState() == kmspb.ImportJob_ACTIVE && !now.Before(job.GetExpireTime().AsTime()) {
+		job.State = kmspb.ImportJob_EXPIRED
+		job.ExpireEventTime = job.GetExpireTime()
+		changed = true
+	}
+	if !changed {
+		return job, nil
+	}
+	if err := s.store.UpdateImportJob(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
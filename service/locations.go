@@ -0,0 +1,161 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"slices"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"google.golang.org/genproto/googleapis/cloud/location"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/winor30/fake-cloud-kms/names"
+	"github.com/winor30/fake-cloud-kms/store"
+)
+
+// Location is an entry of the location catalog served by ListLocations and
+// GetLocation.
+type Location struct {
+	// ID is the location ID, e.g. "us-east1".
+	ID           string
+	DisplayName  string
+	Labels       map[string]string
+	HSMAvailable bool
+	EKMAvailable bool
+}
+
+// DefaultLocations returns the catalog used unless WithLocations replaces it:
+// the global location and a selection of Cloud KMS multi-regions and regions.
+func DefaultLocations() []Location {
+	return []Location{
+		{ID: "global", DisplayName: "Global", HSMAvailable: true},
+		{ID: "us", DisplayName: "United States", HSMAvailable: true, EKMAvailable: true},
+		{ID: "europe", DisplayName: "Europe", HSMAvailable: true, EKMAvailable: true},
+		{ID: "asia", DisplayName: "Asia", HSMAvailable: true, EKMAvailable: true},
+		{ID: "us-central1", DisplayName: "Iowa", HSMAvailable: true, EKMAvailable: true},
+		{ID: "us-east1", DisplayName: "South Carolina", HSMAvailable: true, EKMAvailable: true},
+		{ID: "us-east4", DisplayName: "Northern Virginia", HSMAvailable: true, EKMAvailable: true},
+		{ID: "us-west1", DisplayName: "Oregon", HSMAvailable: true, EKMAvailable: true},
+		{ID: "northamerica-northeast1", DisplayName: "Montréal", HSMAvailable: true, EKMAvailable: true},
+		{ID: "southamerica-east1", DisplayName: "São Paulo", HSMAvailable: true, EKMAvailable: true},
+		{ID: "europe-west1", DisplayName: "Belgium", HSMAvailable: true, EKMAvailable: true},
+		{ID: "europe-west2", DisplayName: "London", HSMAvailable: true, EKMAvailable: true},
+		{ID: "europe-west3", DisplayName: "Frankfurt", HSMAvailable: true, EKMAvailable: true},
+		{ID: "asia-east1", DisplayName: "Taiwan", HSMAvailable: true, EKMAvailable: true},
+		{ID: "asia-northeast1", DisplayName: "Tokyo", HSMAvailable: true, EKMAvailable: true},
+		{ID: "asia-southeast1", DisplayName: "Singapore", HSMAvailable: true, EKMAvailable: true},
+		{ID: "australia-southeast1", DisplayName: "Sydney", HSMAvailable: true, EKMAvailable: true},
+	}
+}
+
+// WithLocations replaces the location catalog.
+func WithLocations(locations []Location) Option {
+	return func(s *service) {
+		s.locations = sortedLocations(locations)
+	}
+}
+
+// WithStrictLocations makes Create RPCs reject locations missing from the
+// catalog. By default any well-formed location ID is accepted.
+func WithStrictLocations() Option {
+	return func(s *service) {
+		s.strictLocations = true
+	}
+}
+
+// ListLocations lists the catalog for the project named by req.name.
+func (s *service) ListLocations(_ context.Context, req *location.ListLocationsRequest) (*location.ListLocationsResponse, error) {
+	project, err := names.ParseProject(req.GetName())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
+	}
+
+	query, err := parseListQuery((&location.Location{}).ProtoReflect().Descriptor(), req.GetFilter(), "")
+	if err != nil {
+		return nil, err
+	}
+	page, err := s.parsePageRequest(pageToken{Parent: req.GetName(), Filter: req.GetFilter()}, req.GetPageSize(), req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+
+	items, next, _, err := listPage(s.pageTokens, page, query,
+		func(opts store.ListOptions) ([]*location.Location, int, error) {
+			var items []*location.Location
+			for _, loc := range s.locations {
+				name := names.Location{Project: project, Location: loc.ID}.ParentName()
+				if opts.StartAfter != "" && name <= opts.StartAfter {
+					continue
+				}
+				if opts.Limit > 0 && len(items) == opts.Limit {
+					break
+				}
+				items = append(items, loc.proto(name))
+			}
+			return items, len(s.locations), nil
+		},
+		func(loc *location.Location) (*location.Location, error) { return loc, nil },
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &location.ListLocationsResponse{Locations: items, NextPageToken: next}, nil
+}
+
+// GetLocation returns a location from the catalog.
+func (s *service) GetLocation(_ context.Context, req *location.GetLocationRequest) (*location.Location, error) {
+	parsed, err := names.ParseLocation(req.GetName())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
+	}
+	loc, ok := s.findLocation(parsed.Location)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "location %q not found", req.GetName())
+	}
+	return loc.proto(req.GetName()), nil
+}
+
+// checkLocation rejects, in strict mode, a location missing from the catalog.
+func (s *service) checkLocation(loc names.Location) error {
+	if !s.strictLocations {
+		return nil
+	}
+	if _, ok := s.findLocation(loc.Location); !ok {
+		return status.Errorf(codes.InvalidArgument, "location %q is not supported; ListLocations returns the supported locations", loc.Location)
+	}
+	return nil
+}
+
+func (s *service) findLocation(id string) (Location, bool) {
+	i, ok := slices.BinarySearchFunc(s.locations, id, func(loc Location, id string) int { return cmp.Compare(loc.ID, id) })
+	if !ok {
+		return Location{}, false
+	}
+	return s.locations[i], true
+}
+
+func (l Location) proto(name string) *location.Location {
+	metadata, err := anypb.New(&kmspb.LocationMetadata{HsmAvailable: l.HSMAvailable, EkmAvailable: l.EKMAvailable})
+	if err != nil {
+		// Packing a well-formed LocationMetadata cannot fail.
+		panic(err)
+	}
+	return &location.Location{
+		Name:        name,
+		LocationId:  l.ID,
+		DisplayName: l.DisplayName,
+		Labels:      maps.Clone(l.Labels),
+		Metadata:    metadata,
+	}
+}
+
+// sortedLocations copies locations in ID order, which is also the order of
+// their resource names within a project.
+func sortedLocations(locations []Location) []Location {
+	sorted := slices.Clone(locations)
+	slices.SortFunc(sorted, func(a, b Location) int { return cmp.Compare(a.ID, b.ID) })
+	return sorted
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"slices"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/winor30/fake-cloud-kms/crc"
+	"github.com/winor30/fake-cloud-kms/kmscrypto"
+	"github.com/winor30/fake-cloud-kms/names"
+)
+
+// maxMacDataSize is the Cloud KMS limit on MacSignRequest.data and MacVerifyRequest.data.
+const maxMacDataSize = 64 * 1024
+
+func (s *service) MacSign(ctx context.Context, req *kmspb.MacSignRequest) (*kmspb.MacSignResponse, error) {
+	version, material, err := s.loadMacVersion(ctx, req.GetName(), req.GetData())
+	if err != nil {
+		return nil, err
+	}
+
+	verifiedData, err := verifyChecksum(req.GetData(), req.GetDataCrc32C())
+	if err != nil {
+		return nil, err
+	}
+
+	mac, err := s.engine.MacSign(ctx, material, version.GetAlgorithm().String(), req.GetData())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "mac sign failed: %v", err)
+	}
+
+	checksum := crc.Compute(mac)
+	return &kmspb.MacSignResponse{
+		Name:               version.GetName(),
+		Mac:                mac,
+		MacCrc32C:          wrapperspb.Int64(int64(checksum)),
+		VerifiedDataCrc32C: verifiedData,
+		ProtectionLevel:    version.GetProtectionLevel(),
+	}, nil
+}
+
+func (s *service) MacVerify(ctx context.Context, req *kmspb.MacVerifyRequest) (*kmspb.MacVerifyResponse, error) {
+	version, material, err := s.loadMacVersion(ctx, req.GetName(), req.GetData())
+	if err != nil {
+		return nil, err
+	}
+	if len(req.GetMac()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "mac is required")
+	}
+
+	verifiedData, err := verifyChecksum(req.GetData(), req.GetDataCrc32C())
+	if err != nil {
+		return nil, err
+	}
+	verifiedMac, err := verifyChecksum(req.GetMac(), req.GetMacCrc32C())
+	if err != nil {
+		return nil, err
+	}
+
+	success, err := s.engine.MacVerify(ctx, material, version.GetAlgorithm().String(), req.GetData(), req.GetMac())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "mac verify failed: %v", err)
+	}
+
+	return &kmspb.MacVerifyResponse{
+		Name:                     version.GetName(),
+		Success:                  success,
+		VerifiedDataCrc32C:       verifiedData,
+		VerifiedMacCrc32C:        verifiedMac,
+		VerifiedSuccessIntegrity: true,
+		ProtectionLevel:          version.GetProtectionLevel(),
+	}, nil
+}
+
+// loadMacVersion validates a MacSign/MacVerify request and returns the
+// enabled MAC version it names.
+func (s *service) loadMacVersion(ctx context.Context, name string, data []byte) (*kmspb.CryptoKeyVersion, kmscrypto.KeyMaterial, error) {
+	if _, err := names.ParseCryptoKeyVersion(name); err != nil {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
+	}
+	if len(data) > maxMacDataSize {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "data must be at most %d bytes", maxMacDataSize)
+	}
+
+	version, material, err := s.loadVersion(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !slices.Contains(supportedAlgorithms[kmspb.CryptoKey_MAC], version.GetAlgorithm()) {
+		return nil, nil, status.Errorf(codes.FailedPrecondition, "key version algorithm %v does not support MAC operations", version.GetAlgorithm())
+	}
+	if err := requireEnabled(version); err != nil {
+		return nil, nil, err
+	}
+	return version, material, nil
+}
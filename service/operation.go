@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/winor30/fake-cloud-kms/names"
+	"github.com/winor30/fake-cloud-kms/operations"
+	"github.com/winor30/fake-cloud-kms/store"
+)
+
+// WithOperationTiming controls when long-running operations complete. By
+// default they complete before the RPC that starts them returns.
+func WithOperationTiming(timing operations.Timing) Option {
+	return func(s *service) {
+		s.operationTiming = timing
+	}
+}
+
+// GetOperation returns the latest state of a long-running operation.
+func (s *service) GetOperation(_ context.Context, req *longrunningpb.GetOperationRequest) (*longrunningpb.Operation, error) {
+	if _, err := names.ParseOperation(req.GetName()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
+	}
+	return s.operations.Get(req.GetName())
+}
+
+// ListOperations lists the operations of a project and location, which
+// req.name names.
+func (s *service) ListOperations(_ context.Context, req *longrunningpb.ListOperationsRequest) (*longrunningpb.ListOperationsResponse, error) {
+	parent, err := names.ParseLocation(req.GetName())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
+	}
+
+	query, err := parseListQuery((&longrunningpb.Operation{}).ProtoReflect().Descriptor(), req.GetFilter(), "")
+	if err != nil {
+		return nil, err
+	}
+	page, err := s.parsePageRequest(pageToken{Parent: parent.ParentName(), Filter: req.GetFilter()}, req.GetPageSize(), req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+
+	items, next, _, err := listPage(s.pageTokens, page, query,
+		func(opts store.ListOptions) ([]*longrunningpb.Operation, int, error) {
+			all := s.operations.List(parent.ParentName())
+			var items []*longrunningpb.Operation
+			for _, op := range all {
+				if opts.StartAfter != "" && op.GetName() <= opts.StartAfter {
+					continue
+				}
+				if opts.Limit > 0 && len(items) == opts.Limit {
+					break
+				}
+				items = append(items, op)
+			}
+			return items, len(all), nil
+		},
+		func(op *longrunningpb.Operation) (*longrunningpb.Operation, error) { return op, nil },
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &longrunningpb.ListOperationsResponse{Operations: items, NextPageToken: next}, nil
+}
+
+// WaitOperation waits until an operation is done or req.timeout elapses and
+// returns its latest state. Without a timeout it waits for the RPC deadline.
+func (s *service) WaitOperation(ctx context.Context, req *longrunningpb.WaitOperationRequest) (*longrunningpb.Operation, error) {
+	if _, err := names.ParseOperation(req.GetName()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
+	}
+	if req.GetTimeout() != nil && req.GetTimeout().AsDuration() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "timeout must not be negative")
+	}
+	return s.operations.Wait(ctx, req.GetName(), req.GetTimeout().AsDuration())
+}
+
+// CancelOperation completes a pending operation with a CANCELLED error. It
+// has no effect on an operation that is done or already executing.
+func (s *service) CancelOperation(_ context.Context, req *longrunningpb.CancelOperationRequest) (*emptypb.Empty, error) {
+	if _, err := names.ParseOperation(req.GetName()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
+	}
+	if err := s.operations.Cancel(req.GetName()); err != nil {
+		return nil, err
+	}
+	s.releaseCancelledKeyHandles(req.GetName())
+	return &emptypb.Empty{}, nil
+}
+
+// newOperationName returns a fresh operation name under location.
+func newOperationName(location names.Location) string {
+	return names.Operation{Location: location, Operation: newUUID()}.ResourceName()
+}
+
+// startOperation starts the operation name whose response is the result of
+// work, completing it according to the configured timing.
+func (s *service) startOperation(ctx context.Context, name string, metadata proto.Message, work operations.Work) (*longrunningpb.Operation, error) {
+	op, err := s.operations.Start(ctx, name, metadata, work)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "start operation: %v", err)
+	}
+	return op, nil
+}
+
+// newUUID returns a random version 4 UUID.
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
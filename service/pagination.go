@@ -0,0 +1,120 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultPageSize applies when page_size is unset.
+	defaultPageSize = 1000
+	// maxPageSize caps page_size; larger values are coerced down as the API does.
+	maxPageSize = 1000
+)
+
+// pageToken is the payload carried by next_page_token. Tokens are bound to
+// the request parent, filter and order_by so they cannot be replayed against
+// a different query.
+type pageToken struct {
+	Parent  string `json:"p"`
+	Filter  string `json:"f,omitempty"`
+	OrderBy string `json:"o,omitempty"`
+	Cursor  string `json:"c"`
+}
+
+// pageRequest is the validated page_size/page_token pair of a List RPC.
+type pageRequest struct {
+	// scope holds the query the token is bound to; its Cursor is unset.
+	scope  pageToken
+	size   int
+	cursor string
+}
+
+// pageTokenCodec signs page tokens so clients cannot forge cursors.
+type pageTokenCodec struct {
+	key []byte
+}
+
+func newPageTokenCodec() *pageTokenCodec {
+	key := make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return &pageTokenCodec{key: key}
+}
+
+func (c *pageTokenCodec) encode(tok pageToken) string {
+	payload, _ := json.Marshal(tok)
+	return base64.RawURLEncoding.EncodeToString(append(payload, c.sign(payload)...))
+}
+
+func (c *pageTokenCodec) decode(raw string) (pageToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil || len(data) < sha256.Size {
+		return pageToken{}, errors.New("malformed token")
+	}
+	payload, mac := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+	if !hmac.Equal(mac, c.sign(payload)) {
+		return pageToken{}, errors.New("token signature mismatch")
+	}
+	var tok pageToken
+	if err := json.Unmarshal(payload, &tok); err != nil {
+		return pageToken{}, errors.New("malformed token")
+	}
+	return tok, nil
+}
+
+func (c *pageTokenCodec) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// parsePageRequest validates page_size and page_token for the query described by scope.
+func (s *service) parsePageRequest(scope pageToken, pageSize int32, rawToken string) (pageRequest, error) {
+	if pageSize < 0 {
+		return pageRequest{}, status.Error(codes.InvalidArgument, "page_size must not be negative")
+	}
+	page := pageRequest{scope: scope, size: int(pageSize)}
+	switch {
+	case page.size == 0:
+		page.size = defaultPageSize
+	case page.size > maxPageSize:
+		page.size = maxPageSize
+	}
+
+	if rawToken == "" {
+		return page, nil
+	}
+	tok, err := s.pageTokens.decode(rawToken)
+	if err != nil {
+		return pageRequest{}, status.Errorf(codes.InvalidArgument, "invalid page_token: %v", err)
+	}
+	if tok.Parent != scope.Parent {
+		return pageRequest{}, status.Error(codes.InvalidArgument, "invalid page_token: token was issued for a different parent")
+	}
+	if tok.Filter != scope.Filter || tok.OrderBy != scope.OrderBy {
+		return pageRequest{}, status.Error(codes.InvalidArgument, "invalid page_token: filter and order_by must match the request that returned the token")
+	}
+	page.cursor = tok.Cursor
+	return page, nil
+}
+
+// finishPage trims items, which were fetched with one extra element, to the
+// page size and returns the token for the following page.
+func finishPage[T namedMessage](codec *pageTokenCodec, page pageRequest, items []T) ([]T, string) {
+	if len(items) <= page.size {
+		return items, ""
+	}
+	items = items[:page.size]
+	tok := page.scope
+	tok.Cursor = items[len(items)-1].GetName()
+	return items, codec.encode(tok)
+}
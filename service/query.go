@@ -0,0 +1,134 @@
+package service
+
+import (
+	"slices"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/winor30/fake-cloud-kms/filter"
+	"github.com/winor30/fake-cloud-kms/store"
+)
+
+// namedMessage is a KMS resource message identified by its name.
+type namedMessage interface {
+	proto.Message
+	GetName() string
+}
+
+// listQuery is the parsed filter/order_by pair of a List RPC.
+type listQuery struct {
+	filter  *filter.Filter
+	orderBy *filter.OrderBy
+}
+
+func parseListQuery(md protoreflect.MessageDescriptor, filterExpr, orderByExpr string) (listQuery, error) {
+	var q listQuery
+	if filterExpr != "" {
+		f, err := filter.Parse(filterExpr, md)
+		if err != nil {
+			return listQuery{}, status.Errorf(codes.InvalidArgument, "invalid filter: %v", err)
+		}
+		q.filter = f
+	}
+	if orderByExpr != "" {
+		ob, err := filter.ParseOrderBy(orderByExpr, md)
+		if err != nil {
+			return listQuery{}, status.Errorf(codes.InvalidArgument, "invalid order_by: %v", err)
+		}
+		q.orderBy = ob
+	}
+	return q, nil
+}
+
+// listPage produces one page of a List RPC. settle brings each resource up
+// to date before it is matched. total_size is left unset when a filter is
+// applied, as Cloud KMS does.
+//
+// Without order_by, results follow the store order, so the page is read from
+// the store cursor in batches, skipping resources the filter rejects. With
+// order_by there is no index to seek into: every page scans, settles and
+// sorts the whole collection, with the store order breaking ties, and finds
+// the cursor linearly, costing O(n log n) per page. That is acceptable for
+// the collection sizes an emulator holds.
+func listPage[T namedMessage](
+	codec *pageTokenCodec,
+	page pageRequest,
+	query listQuery,
+	fetch func(store.ListOptions) ([]T, int, error),
+	settle func(T) (T, error),
+) ([]T, string, int32, error) {
+	if query.orderBy == nil {
+		var items []T
+		var total int
+		opts := store.ListOptions{StartAfter: page.cursor, Limit: page.size + 1}
+		// Fetch one item beyond the page so finishPage can tell whether
+		// another page follows.
+		for len(items) <= page.size {
+			batch, n, err := fetch(opts)
+			if err != nil {
+				return nil, "", 0, err
+			}
+			total = n
+			for _, item := range batch {
+				if item, err = settle(item); err != nil {
+					return nil, "", 0, err
+				}
+				if query.filter != nil && !query.filter.Matches(item) {
+					continue
+				}
+				items = append(items, item)
+				if len(items) > page.size {
+					break
+				}
+			}
+			if len(batch) < opts.Limit {
+				break
+			}
+			opts.StartAfter = batch[len(batch)-1].GetName()
+		}
+		items, next := finishPage(codec, page, items)
+		if query.filter != nil {
+			total = 0
+		}
+		return items, next, int32(total), nil
+	}
+
+	all, total, err := fetch(store.ListOptions{})
+	if err != nil {
+		return nil, "", 0, err
+	}
+	for i, item := range all {
+		if all[i], err = settle(item); err != nil {
+			return nil, "", 0, err
+		}
+	}
+	slices.SortStableFunc(all, func(a, b T) int { return query.orderBy.Compare(a, b) })
+
+	start := 0
+	if page.cursor != "" {
+		idx := slices.IndexFunc(all, func(item T) bool { return item.GetName() == page.cursor })
+		if idx < 0 {
+			return nil, "", 0, status.Error(codes.InvalidArgument, "invalid page_token: cursor resource no longer exists")
+		}
+		start = idx + 1
+	}
+
+	var items []T
+	for _, item := range all[start:] {
+		if query.filter != nil && !query.filter.Matches(item) {
+			continue
+		}
+		items = append(items, item)
+		if len(items) > page.size {
+			break
+		}
+	}
+	items, next := finishPage(codec, page, items)
+	if query.filter != nil {
+		total = 0
+	}
+	return items, next, int32(total), nil
+}
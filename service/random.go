@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"io"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/winor30/fake-cloud-kms/crc"
+	"github.com/winor30/fake-cloud-kms/names"
+)
+
+const (
+	minRandomBytes = 1
+	maxRandomBytes = 1024
+)
+
+func (s *service) GenerateRandomBytes(ctx context.Context, req *kmspb.GenerateRandomBytesRequest) (*kmspb.GenerateRandomBytesResponse, error) {
+	if _, err := names.ParseLocation(req.GetLocation()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid location: %v", err)
+	}
+	if n := req.GetLengthBytes(); n < minRandomBytes || n > maxRandomBytes {
+		return nil, status.Errorf(codes.InvalidArgument, "length_bytes must be between %d and %d, got %d", minRandomBytes, maxRandomBytes, n)
+	}
+	// Cloud KMS only generates random bytes at the HSM protection level.
+	if req.GetProtectionLevel() != kmspb.ProtectionLevel_HSM {
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported protection_level: %v; only HSM is supported", req.GetProtectionLevel())
+	}
+
+	data := make([]byte, req.GetLengthBytes())
+	s.entropyMu.Lock()
+	_, err := io.ReadFull(s.entropy, data)
+	s.entropyMu.Unlock()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to read entropy: %v", err)
+	}
+
+	return &kmspb.GenerateRandomBytesResponse{
+		Data:       data,
+		DataCrc32C: wrapperspb.Int64(int64(crc.Compute(data))),
+	}, nil
+}
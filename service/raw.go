@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"crypto/aes"
+	"slices"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/winor30/fake-cloud-kms/crc"
+	"github.com/winor30/fake-cloud-kms/kmscrypto"
+	"github.com/winor30/fake-cloud-kms/names"
+)
+
+const (
+	// maxRawPlaintextSize is the Cloud KMS limit on RawEncryptRequest.plaintext.
+	maxRawPlaintextSize = 64 * 1024
+	// maxRawAADSize is the Cloud KMS limit on additional_authenticated_data.
+	maxRawAADSize = 64 * 1024
+	// minGCMTagLength is the shortest AES-GCM tag accepted by RawDecrypt.
+	minGCMTagLength = 12
+)
+
+func isGCM(algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm) bool {
+	return algorithm == kmspb.CryptoKeyVersion_AES_128_GCM || algorithm == kmspb.CryptoKeyVersion_AES_256_GCM
+}
+
+func isCBC(algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm) bool {
+	return algorithm == kmspb.CryptoKeyVersion_AES_128_CBC || algorithm == kmspb.CryptoKeyVersion_AES_256_CBC
+}
+
+func (s *service) RawEncrypt(ctx context.Context, req *kmspb.RawEncryptRequest) (*kmspb.RawEncryptResponse, error) {
+	if len(req.GetPlaintext()) > maxRawPlaintextSize {
+		return nil, status.Errorf(codes.InvalidArgument, "plaintext must be at most %d bytes", maxRawPlaintextSize)
+	}
+	version, material, err := s.loadRawVersion(ctx, req.GetName(), req.GetAdditionalAuthenticatedData())
+	if err != nil {
+		return nil, err
+	}
+	algorithm := version.GetAlgorithm()
+
+	iv := req.GetInitializationVector()
+	switch {
+	case len(iv) == 0:
+	case isGCM(algorithm):
+		return nil, status.Errorf(codes.InvalidArgument, "initialization_vector must not be set for %v; it is generated by the service", algorithm)
+	case len(iv) != aes.BlockSize:
+		return nil, status.Errorf(codes.InvalidArgument, "initialization_vector must be %d bytes for %v", aes.BlockSize, algorithm)
+	}
+	if isCBC(algorithm) && len(req.GetPlaintext())%aes.BlockSize != 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "plaintext length must be a multiple of %d bytes for %v", aes.BlockSize, algorithm)
+	}
+
+	verifiedPlaintext, err := verifyChecksum(req.GetPlaintext(), req.GetPlaintextCrc32C())
+	if err != nil {
+		return nil, err
+	}
+	verifiedAAD, err := verifyChecksum(req.GetAdditionalAuthenticatedData(), req.GetAdditionalAuthenticatedDataCrc32C())
+	if err != nil {
+		return nil, err
+	}
+	verifiedIV, err := verifyChecksum(iv, req.GetInitializationVectorCrc32C())
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, iv, err := s.engine.RawEncrypt(ctx, material, algorithm.String(), req.GetPlaintext(), req.GetAdditionalAuthenticatedData(), iv)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "raw encrypt failed: %v", err)
+	}
+
+	var tagLength int32
+	if isGCM(algorithm) {
+		tagLength = kmscrypto.GCMTagSize
+	}
+	return &kmspb.RawEncryptResponse{
+		Ciphertext:                 ciphertext,
+		InitializationVector:       iv,
+		TagLength:                  tagLength,
+		CiphertextCrc32C:           wrapperspb.Int64(int64(crc.Compute(ciphertext))),
+		InitializationVectorCrc32C: wrapperspb.Int64(int64(crc.Compute(iv))),
+		VerifiedPlaintextCrc32C:    verifiedPlaintext,
+		VerifiedAdditionalAuthenticatedDataCrc32C: verifiedAAD,
+		VerifiedInitializationVectorCrc32C:        verifiedIV,
+		Name:                                      version.GetName(),
+		ProtectionLevel:                           version.GetProtectionLevel(),
+	}, nil
+}
+
+func (s *service) RawDecrypt(ctx context.Context, req *kmspb.RawDecryptRequest) (*kmspb.RawDecryptResponse, error) {
+	version, material, err := s.loadRawVersion(ctx, req.GetName(), req.GetAdditionalAuthenticatedData())
+	if err != nil {
+		return nil, err
+	}
+	algorithm := version.GetAlgorithm()
+
+	ivSize := aes.BlockSize
+	if isGCM(algorithm) {
+		ivSize = kmscrypto.GCMIVSize
+	}
+	if len(req.GetInitializationVector()) != ivSize {
+		return nil, status.Errorf(codes.InvalidArgument, "initialization_vector must be %d bytes for %v", ivSize, algorithm)
+	}
+
+	tagLength := int(req.GetTagLength())
+	switch {
+	case !isGCM(algorithm):
+		if tagLength != 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "tag_length must not be set for %v", algorithm)
+		}
+	case tagLength == 0:
+		tagLength = kmscrypto.GCMTagSize
+	case tagLength < minGCMTagLength || tagLength > kmscrypto.GCMTagSize:
+		return nil, status.Errorf(codes.InvalidArgument, "tag_length must be between %d and %d for %v", minGCMTagLength, kmscrypto.GCMTagSize, algorithm)
+	}
+	if isGCM(algorithm) && len(req.GetCiphertext()) < tagLength {
+		return nil, status.Error(codes.InvalidArgument, "ciphertext is shorter than tag_length")
+	}
+	if isCBC(algorithm) && len(req.GetCiphertext())%aes.BlockSize != 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "ciphertext length must be a multiple of %d bytes for %v", aes.BlockSize, algorithm)
+	}
+
+	verifiedCiphertext, err := verifyChecksum(req.GetCiphertext(), req.GetCiphertextCrc32C())
+	if err != nil {
+		return nil, err
+	}
+	verifiedAAD, err := verifyChecksum(req.GetAdditionalAuthenticatedData(), req.GetAdditionalAuthenticatedDataCrc32C())
+	if err != nil {
+		return nil, err
+	}
+	verifiedIV, err := verifyChecksum(req.GetInitializationVector(), req.GetInitializationVectorCrc32C())
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := s.engine.RawDecrypt(ctx, material, algorithm.String(), req.GetCiphertext(), req.GetAdditionalAuthenticatedData(), req.GetInitializationVector(), tagLength)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "raw decrypt failed: %v", err)
+	}
+
+	return &kmspb.RawDecryptResponse{
+		Plaintext:                plaintext,
+		PlaintextCrc32C:          wrapperspb.Int64(int64(crc.Compute(plaintext))),
+		ProtectionLevel:          version.GetProtectionLevel(),
+		VerifiedCiphertextCrc32C: verifiedCiphertext,
+		VerifiedAdditionalAuthenticatedDataCrc32C: verifiedAAD,
+		VerifiedInitializationVectorCrc32C:        verifiedIV,
+	}, nil
+}
+
+// loadRawVersion validates the fields shared by RawEncrypt and RawDecrypt and
+// returns the enabled RAW_ENCRYPT_DECRYPT version they name.
+func (s *service) loadRawVersion(ctx context.Context, name string, aad []byte) (*kmspb.CryptoKeyVersion, kmscrypto.KeyMaterial, error) {
+	if _, err := names.ParseCryptoKeyVersion(name); err != nil {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
+	}
+	if len(aad) > maxRawAADSize {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "additional_authenticated_data must be at most %d bytes", maxRawAADSize)
+	}
+
+	version, material, err := s.loadVersion(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !slices.Contains(supportedAlgorithms[kmspb.CryptoKey_RAW_ENCRYPT_DECRYPT], version.GetAlgorithm()) {
+		return nil, nil, status.Errorf(codes.FailedPrecondition, "key version algorithm %v does not support raw encryption", version.GetAlgorithm())
+	}
+	if err := requireEnabled(version); err != nil {
+		return nil, nil, err
+	}
+	if len(aad) > 0 && !isGCM(version.GetAlgorithm()) {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "additional_authenticated_data is not supported for %v", version.GetAlgorithm())
+	}
+	return version, material, nil
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	minRotationPeriod = 24 * time.Hour
+	// maxRotationPeriod is 100 years, the longest period Cloud KMS accepts.
+	maxRotationPeriod = 876000 * time.Hour
+
+	// DefaultRotationInterval is how often RunRotator looks for keys due for rotation.
+	DefaultRotationInterval = 10 * time.Second
+)
+
+// validateRotationSchedule checks the rotation_period and next_rotation_time
+// of ck. Only symmetric encryption keys that generate their own versions
+// rotate automatically.
+func validateRotationSchedule(ck *kmspb.CryptoKey) error {
+	period, next := ck.GetRotationPeriod(), ck.GetNextRotationTime()
+	if period == nil && next == nil {
+		return nil
+	}
+	if ck.GetPurpose() != kmspb.CryptoKey_ENCRYPT_DECRYPT {
+		return status.Errorf(codes.InvalidArgument, "automatic rotation is only supported for ENCRYPT_DECRYPT keys, not %v", ck.GetPurpose())
+	}
+	if ck.GetImportOnly() {
+		return status.Error(codes.InvalidArgument, "import_only keys cannot rotate automatically")
+	}
+	if period != nil {
+		if err := period.CheckValid(); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid rotation_period: %v", err)
+		}
+		if d := period.AsDuration(); d < minRotationPeriod || d > maxRotationPeriod {
+			return status.Errorf(codes.InvalidArgument, "rotation_period must be between %s and %s", minRotationPeriod, maxRotationPeriod)
+		}
+	}
+	if next != nil {
+		if err := next.CheckValid(); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid next_rotation_time: %v", err)
+		}
+	}
+	return nil
+}
+
+// RotateDueKeys rotates every key whose next_rotation_time is not after the
+// service clock: it creates a version from the key's template, makes it the
+// primary and schedules the next rotation one rotation_period later. Periods
+// skipped by a clock jump collapse into a single new version. Due keys are
+// found in the store, so keys it already held when the service started rotate
+// too.
+func (s *service) RotateDueKeys(ctx context.Context) error {
+	s.rotateMu.Lock()
+	defer s.rotateMu.Unlock()
+
+	scheduled, err := s.store.ListScheduledCryptoKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("list scheduled keys: %w", err)
+	}
+	now := s.now()
+	var errs []error
+	for _, ck := range scheduled {
+		if now.Before(ck.GetNextRotationTime().AsTime()) {
+			continue
+		}
+		if err := s.rotate(ctx, ck, now); err != nil {
+			errs = append(errs, fmt.Errorf("rotate %s: %w", ck.GetName(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RunRotator calls RotateDueKeys every interval until ctx is done.
+func (s *service) RunRotator(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.RotateDueKeys(ctx); err != nil {
+				slog.WarnContext(ctx, "automatic key rotation failed", "error", err)
+			}
+		}
+	}
+}
+
+// afterClockChange runs due rotations and destructions as soon as the clock
+// jumps.
+func (s *service) afterClockChange() {
+	ctx := context.Background()
+	if err := s.RotateDueKeys(ctx); err != nil {
+		slog.WarnContext(ctx, "automatic key rotation failed", "error", err)
+	}
+	if err := s.destroyDueVersions(ctx); err != nil {
+		slog.WarnContext(ctx, "scheduled version destruction failed", "error", err)
+	}
+}
+
+// rotate makes a new version of ck its primary and advances its
+// next_rotation_time past now. The caller holds rotateMu.
+func (s *service) rotate(ctx context.Context, ck *kmspb.CryptoKey, now time.Time) error {
+	version, err := s.createVersion(ctx, ck)
+	if err != nil {
+		return err
+	}
+	rotated, err := s.store.SetPrimaryVersion(ctx, ck.GetName(), version.GetName())
+	if err != nil {
+		return err
+	}
+	rotated.NextRotationTime = nil
+	if period := rotated.GetRotationPeriod(); period != nil {
+		nextTime := ck.GetNextRotationTime().AsTime()
+		for !nextTime.After(now) {
+			nextTime = nextTime.Add(period.AsDuration())
+		}
+		rotated.NextRotationTime = timestamppb.New(nextTime)
+	}
+	return s.store.UpdateCryptoKey(ctx, rotated)
+}
@@ -2,21 +2,36 @@ package service
 
 import (
 	"context"
+	"crypto"
+	"crypto/rand"
 	"encoding/binary"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"io"
 	"maps"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"cloud.google.com/go/iam/apiv1/iampb"
 	"cloud.google.com/go/kms/apiv1/kmspb"
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"google.golang.org/genproto/googleapis/cloud/location"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 
+	"github.com/winor30/fake-cloud-kms/clock"
 	"github.com/winor30/fake-cloud-kms/crc"
 	"github.com/winor30/fake-cloud-kms/kmscrypto"
 	"github.com/winor30/fake-cloud-kms/names"
+	"github.com/winor30/fake-cloud-kms/operations"
 	"github.com/winor30/fake-cloud-kms/store"
 )
 
@@ -29,28 +44,213 @@ type KMSService interface {
 	CreateCryptoKey(ctx context.Context, req *kmspb.CreateCryptoKeyRequest) (*kmspb.CryptoKey, error)
 	GetCryptoKey(ctx context.Context, req *kmspb.GetCryptoKeyRequest) (*kmspb.CryptoKey, error)
 	ListCryptoKeys(ctx context.Context, req *kmspb.ListCryptoKeysRequest) (*kmspb.ListCryptoKeysResponse, error)
+	UpdateCryptoKey(ctx context.Context, req *kmspb.UpdateCryptoKeyRequest) (*kmspb.CryptoKey, error)
 
 	CreateCryptoKeyVersion(ctx context.Context, req *kmspb.CreateCryptoKeyVersionRequest) (*kmspb.CryptoKeyVersion, error)
 	GetCryptoKeyVersion(ctx context.Context, req *kmspb.GetCryptoKeyVersionRequest) (*kmspb.CryptoKeyVersion, error)
 	ListCryptoKeyVersions(ctx context.Context, req *kmspb.ListCryptoKeyVersionsRequest) (*kmspb.ListCryptoKeyVersionsResponse, error)
 
 	UpdateCryptoKeyPrimaryVersion(ctx context.Context, req *kmspb.UpdateCryptoKeyPrimaryVersionRequest) (*kmspb.CryptoKey, error)
+	UpdateCryptoKeyVersion(ctx context.Context, req *kmspb.UpdateCryptoKeyVersionRequest) (*kmspb.CryptoKeyVersion, error)
+	DestroyCryptoKeyVersion(ctx context.Context, req *kmspb.DestroyCryptoKeyVersionRequest) (*kmspb.CryptoKeyVersion, error)
+	RestoreCryptoKeyVersion(ctx context.Context, req *kmspb.RestoreCryptoKeyVersionRequest) (*kmspb.CryptoKeyVersion, error)
+
+	CreateImportJob(ctx context.Context, req *kmspb.CreateImportJobRequest) (*kmspb.ImportJob, error)
+	GetImportJob(ctx context.Context, req *kmspb.GetImportJobRequest) (*kmspb.ImportJob, error)
+	ListImportJobs(ctx context.Context, req *kmspb.ListImportJobsRequest) (*kmspb.ListImportJobsResponse, error)
+	ImportCryptoKeyVersion(ctx context.Context, req *kmspb.ImportCryptoKeyVersionRequest) (*kmspb.CryptoKeyVersion, error)
+
 	Encrypt(ctx context.Context, req *kmspb.EncryptRequest) (*kmspb.EncryptResponse, error)
 	Decrypt(ctx context.Context, req *kmspb.DecryptRequest) (*kmspb.DecryptResponse, error)
 
 	GetPublicKey(ctx context.Context, req *kmspb.GetPublicKeyRequest) (*kmspb.PublicKey, error)
 	AsymmetricSign(ctx context.Context, req *kmspb.AsymmetricSignRequest) (*kmspb.AsymmetricSignResponse, error)
+	AsymmetricDecrypt(ctx context.Context, req *kmspb.AsymmetricDecryptRequest) (*kmspb.AsymmetricDecryptResponse, error)
+	Decapsulate(ctx context.Context, req *kmspb.DecapsulateRequest) (*kmspb.DecapsulateResponse, error)
+
+	MacSign(ctx context.Context, req *kmspb.MacSignRequest) (*kmspb.MacSignResponse, error)
+	MacVerify(ctx context.Context, req *kmspb.MacVerifyRequest) (*kmspb.MacVerifyResponse, error)
+
+	RawEncrypt(ctx context.Context, req *kmspb.RawEncryptRequest) (*kmspb.RawEncryptResponse, error)
+	RawDecrypt(ctx context.Context, req *kmspb.RawDecryptRequest) (*kmspb.RawDecryptResponse, error)
+
+	GenerateRandomBytes(ctx context.Context, req *kmspb.GenerateRandomBytesRequest) (*kmspb.GenerateRandomBytesResponse, error)
+
+	GetIamPolicy(ctx context.Context, req *iampb.GetIamPolicyRequest) (*iampb.Policy, error)
+	SetIamPolicy(ctx context.Context, req *iampb.SetIamPolicyRequest) (*iampb.Policy, error)
+	TestIamPermissions(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error)
+
+	ListLocations(ctx context.Context, req *location.ListLocationsRequest) (*location.ListLocationsResponse, error)
+	GetLocation(ctx context.Context, req *location.GetLocationRequest) (*location.Location, error)
+
+	UpdateAutokeyConfig(ctx context.Context, req *kmspb.UpdateAutokeyConfigRequest) (*kmspb.AutokeyConfig, error)
+	GetAutokeyConfig(ctx context.Context, req *kmspb.GetAutokeyConfigRequest) (*kmspb.AutokeyConfig, error)
+	ShowEffectiveAutokeyConfig(ctx context.Context, req *kmspb.ShowEffectiveAutokeyConfigRequest) (*kmspb.ShowEffectiveAutokeyConfigResponse, error)
+
+	CreateKeyHandle(ctx context.Context, req *kmspb.CreateKeyHandleRequest) (*longrunningpb.Operation, error)
+	GetKeyHandle(ctx context.Context, req *kmspb.GetKeyHandleRequest) (*kmspb.KeyHandle, error)
+	ListKeyHandles(ctx context.Context, req *kmspb.ListKeyHandlesRequest) (*kmspb.ListKeyHandlesResponse, error)
+
+	CreateEkmConnection(ctx context.Context, req *kmspb.CreateEkmConnectionRequest) (*kmspb.EkmConnection, error)
+	GetEkmConnection(ctx context.Context, req *kmspb.GetEkmConnectionRequest) (*kmspb.EkmConnection, error)
+	ListEkmConnections(ctx context.Context, req *kmspb.ListEkmConnectionsRequest) (*kmspb.ListEkmConnectionsResponse, error)
+	UpdateEkmConnection(ctx context.Context, req *kmspb.UpdateEkmConnectionRequest) (*kmspb.EkmConnection, error)
+	GetEkmConfig(ctx context.Context, req *kmspb.GetEkmConfigRequest) (*kmspb.EkmConfig, error)
+	UpdateEkmConfig(ctx context.Context, req *kmspb.UpdateEkmConfigRequest) (*kmspb.EkmConfig, error)
+	VerifyConnectivity(ctx context.Context, req *kmspb.VerifyConnectivityRequest) (*kmspb.VerifyConnectivityResponse, error)
+
+	GetOperation(ctx context.Context, req *longrunningpb.GetOperationRequest) (*longrunningpb.Operation, error)
+	ListOperations(ctx context.Context, req *longrunningpb.ListOperationsRequest) (*longrunningpb.ListOperationsResponse, error)
+	WaitOperation(ctx context.Context, req *longrunningpb.WaitOperationRequest) (*longrunningpb.Operation, error)
+	CancelOperation(ctx context.Context, req *longrunningpb.CancelOperationRequest) (*emptypb.Empty, error)
+}
+
+const (
+	// defaultDestroyScheduledDuration matches the Cloud KMS default when
+	// CryptoKey.destroy_scheduled_duration is not set at creation time.
+	defaultDestroyScheduledDuration = 30 * 24 * time.Hour
+	minDestroyScheduledDuration     = 24 * time.Hour
+	maxDestroyScheduledDuration     = 120 * 24 * time.Hour
+)
+
+// supportedAlgorithms lists the algorithms the emulator can generate for each purpose.
+var supportedAlgorithms = map[kmspb.CryptoKey_CryptoKeyPurpose][]kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm{
+	kmspb.CryptoKey_ENCRYPT_DECRYPT: {kmspb.CryptoKeyVersion_GOOGLE_SYMMETRIC_ENCRYPTION},
+	kmspb.CryptoKey_ASYMMETRIC_SIGN: {
+		kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256,
+		kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256,
+		kmspb.CryptoKeyVersion_EC_SIGN_P384_SHA384,
+		kmspb.CryptoKeyVersion_EC_SIGN_ED25519,
+		kmspb.CryptoKeyVersion_RSA_SIGN_PSS_2048_SHA256,
+		kmspb.CryptoKeyVersion_RSA_SIGN_PSS_3072_SHA256,
+		kmspb.CryptoKeyVersion_RSA_SIGN_PSS_4096_SHA256,
+		kmspb.CryptoKeyVersion_RSA_SIGN_PSS_4096_SHA512,
+		kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_2048_SHA256,
+		kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_3072_SHA256,
+		kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA256,
+		kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA512,
+		kmspb.CryptoKeyVersion_RSA_SIGN_RAW_PKCS1_2048,
+		kmspb.CryptoKeyVersion_RSA_SIGN_RAW_PKCS1_3072,
+		kmspb.CryptoKeyVersion_RSA_SIGN_RAW_PKCS1_4096,
+		kmspb.CryptoKeyVersion_PQ_SIGN_ML_DSA_65,
+		kmspb.CryptoKeyVersion_PQ_SIGN_SLH_DSA_SHA2_128S,
+	},
+	kmspb.CryptoKey_ASYMMETRIC_DECRYPT: {
+		kmspb.CryptoKeyVersion_RSA_DECRYPT_OAEP_2048_SHA256,
+		kmspb.CryptoKeyVersion_RSA_DECRYPT_OAEP_3072_SHA256,
+		kmspb.CryptoKeyVersion_RSA_DECRYPT_OAEP_4096_SHA256,
+		kmspb.CryptoKeyVersion_RSA_DECRYPT_OAEP_4096_SHA512,
+		kmspb.CryptoKeyVersion_RSA_DECRYPT_OAEP_2048_SHA1,
+		kmspb.CryptoKeyVersion_RSA_DECRYPT_OAEP_3072_SHA1,
+		kmspb.CryptoKeyVersion_RSA_DECRYPT_OAEP_4096_SHA1,
+	},
+	kmspb.CryptoKey_MAC: {
+		kmspb.CryptoKeyVersion_HMAC_SHA256,
+		kmspb.CryptoKeyVersion_HMAC_SHA1,
+		kmspb.CryptoKeyVersion_HMAC_SHA384,
+		kmspb.CryptoKeyVersion_HMAC_SHA512,
+		kmspb.CryptoKeyVersion_HMAC_SHA224,
+	},
+	kmspb.CryptoKey_RAW_ENCRYPT_DECRYPT: {
+		kmspb.CryptoKeyVersion_AES_128_GCM,
+		kmspb.CryptoKeyVersion_AES_256_GCM,
+		kmspb.CryptoKeyVersion_AES_128_CBC,
+		kmspb.CryptoKeyVersion_AES_256_CBC,
+		kmspb.CryptoKeyVersion_AES_128_CTR,
+		kmspb.CryptoKeyVersion_AES_256_CTR,
+	},
+	kmspb.CryptoKey_KEY_ENCAPSULATION: {
+		kmspb.CryptoKeyVersion_ML_KEM_768,
+		kmspb.CryptoKeyVersion_ML_KEM_1024,
+		kmspb.CryptoKeyVersion_KEM_XWING,
+	},
 }
 
 type service struct {
-	store  store.Store
-	engine kmscrypto.Engine
+	store      store.Store
+	engine     kmscrypto.Engine
+	clock      clock.Clock
+	pageTokens *pageTokenCodec
+
+	// entropyMu serializes reads from entropy, which need not be safe for concurrent use.
+	entropyMu sync.Mutex
+	entropy   io.Reader
+
+	// rotateMu serializes RotateDueKeys and UpdateCryptoKey so a key is never
+	// rotated twice for one due time.
+	rotateMu sync.Mutex
+	// versionMu serializes version state transitions. Each re-reads the
+	// version under it, so none is applied to a state another has replaced.
+	versionMu sync.Mutex
+
+	// iamMu serializes SetIamPolicy so etag checks and writes are atomic.
+	iamMu sync.Mutex
+	// autokeyMu serializes UpdateAutokeyConfig so etag checks and writes are atomic.
+	autokeyMu sync.Mutex
+	// keyHandleMu guards pendingKeyHandles, the names of key handles being
+	// provisioned mapped to the operation provisioning each.
+	keyHandleMu       sync.Mutex
+	pendingKeyHandles map[string]string
+	// ekmMu serializes EKM connection and config updates so etag checks and writes are atomic.
+	ekmMu sync.Mutex
+
+	// locations is the location catalog, sorted by ID.
+	locations       []Location
+	strictLocations bool
+
+	operations      *operations.Registry
+	operationTiming operations.Timing
+	// unwatchClock stops rotating keys when the clock jumps.
+	unwatchClock func()
 }
 
 var _ KMSService = (*service)(nil)
 
-func New(store store.Store, engine kmscrypto.Engine) *service {
-	return &service{store: store, engine: engine}
+// Option customizes the service returned by New.
+type Option func(*service)
+
+// WithClock overrides the time source used for timestamps, scheduled
+// destruction and automatic rotation. Due rotations run as soon as an
+// Observable clock jumps.
+func WithClock(c clock.Clock) Option {
+	return func(s *service) {
+		s.clock = c
+	}
+}
+
+// WithEntropy overrides the source of GenerateRandomBytes output, which
+// defaults to crypto/rand. A deterministic reader lets tests assert exact bytes.
+func WithEntropy(r io.Reader) Option {
+	return func(s *service) {
+		s.entropy = r
+	}
+}
+
+func New(store store.Store, engine kmscrypto.Engine, opts ...Option) *service {
+	s := &service{store: store, engine: engine, clock: clock.Real(), pageTokens: newPageTokenCodec(), entropy: rand.Reader, pendingKeyHandles: map[string]string{}, locations: sortedLocations(DefaultLocations())}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.operations = operations.New(s.clock, s.operationTiming)
+	s.unwatchClock = func() {}
+	if observable, ok := s.clock.(clock.Observable); ok {
+		s.unwatchClock = observable.OnChange(func(time.Time) {
+			s.afterClockChange()
+		})
+	}
+	return s
+}
+
+// Close detaches the service from an Observable clock: jumps no longer rotate
+// its keys or complete its operations. Call it once the service stops serving
+// so a clock that outlives it does not keep it reachable.
+func (s *service) Close() {
+	s.unwatchClock()
+	s.operations.Close()
+}
+
+func (s *service) now() time.Time {
+	return s.clock.Now()
 }
 
 func (s *service) CreateKeyRing(ctx context.Context, req *kmspb.CreateKeyRingRequest) (*kmspb.KeyRing, error) {
@@ -58,6 +258,9 @@ func (s *service) CreateKeyRing(ctx context.Context, req *kmspb.CreateKeyRingReq
 	if err != nil {
 		return nil, status.Errorf(codes.InvalidArgument, "invalid parent: %v", err)
 	}
+	if err := s.checkLocation(parent); err != nil {
+		return nil, err
+	}
 
 	if req.GetKeyRingId() == "" {
 		return nil, status.Error(codes.InvalidArgument, "key_ring_id is required")
@@ -66,7 +269,7 @@ func (s *service) CreateKeyRing(ctx context.Context, req *kmspb.CreateKeyRingReq
 	name := fmt.Sprintf("%s/keyRings/%s", parent.ParentName(), req.GetKeyRingId())
 	kr := &kmspb.KeyRing{
 		Name:       name,
-		CreateTime: timestamppb.Now(),
+		CreateTime: timestamppb.New(s.now()),
 	}
 
 	if err := s.store.CreateKeyRing(ctx, kr); err != nil {
@@ -92,15 +295,25 @@ func (s *service) ListKeyRings(ctx context.Context, req *kmspb.ListKeyRingsReque
 		return nil, status.Errorf(codes.InvalidArgument, "invalid parent: %v", err)
 	}
 
-	if req.GetPageToken() != "" {
-		return nil, status.Error(codes.Unimplemented, "pagination is not supported")
+	query, err := parseListQuery((&kmspb.KeyRing{}).ProtoReflect().Descriptor(), req.GetFilter(), req.GetOrderBy())
+	if err != nil {
+		return nil, err
+	}
+	page, err := s.parsePageRequest(pageToken{Parent: parent.ParentName(), Filter: req.GetFilter(), OrderBy: req.GetOrderBy()}, req.GetPageSize(), req.GetPageToken())
+	if err != nil {
+		return nil, err
 	}
 
-	items, err := s.store.ListKeyRings(ctx, parent.ParentName())
+	items, next, total, err := listPage(s.pageTokens, page, query,
+		func(opts store.ListOptions) ([]*kmspb.KeyRing, int, error) {
+			return s.store.ListKeyRings(ctx, parent.ParentName(), opts)
+		},
+		func(kr *kmspb.KeyRing) (*kmspb.KeyRing, error) { return kr, nil },
+	)
 	if err != nil {
 		return nil, err
 	}
-	return &kmspb.ListKeyRingsResponse{KeyRings: items}, nil
+	return &kmspb.ListKeyRingsResponse{KeyRings: items, NextPageToken: next, TotalSize: total}, nil
 }
 
 func (s *service) CreateCryptoKey(ctx context.Context, req *kmspb.CreateCryptoKeyRequest) (*kmspb.CryptoKey, error) {
@@ -117,72 +330,71 @@ func (s *service) CreateCryptoKey(ctx context.Context, req *kmspb.CreateCryptoKe
 		return nil, status.Error(codes.InvalidArgument, "crypto_key is required")
 	}
 
+	destroyScheduledDuration, err := resolveDestroyScheduledDuration(req.GetCryptoKey().GetDestroyScheduledDuration())
+	if err != nil {
+		return nil, err
+	}
+
+	protectionLevel, err := resolveProtectionLevel(req.GetCryptoKey().GetVersionTemplate().GetProtectionLevel())
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetCryptoKey().GetImportOnly() && !req.GetSkipInitialVersionCreation() {
+		return nil, status.Error(codes.InvalidArgument, "import_only keys must be created with skip_initial_version_creation")
+	}
+
 	purpose := req.GetCryptoKey().GetPurpose()
 	cryptoKeyName := fmt.Sprintf("%s/cryptoKeys/%s", keyRing.ResourceName(), req.GetCryptoKeyId())
 	primaryVersionName := names.FormatCryptoKeyVersion(cryptoKeyName, "1")
 
-	var (
-		material  kmscrypto.KeyMaterial
-		algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm
-		version   *kmspb.CryptoKeyVersion
-		ck        *kmspb.CryptoKey
-	)
+	algorithm, err := resolveAlgorithm(purpose, req.GetCryptoKey().GetVersionTemplate().GetAlgorithm())
+	if err != nil {
+		return nil, err
+	}
 
-	switch purpose {
-	case kmspb.CryptoKey_ENCRYPT_DECRYPT:
-		algorithm = kmspb.CryptoKeyVersion_GOOGLE_SYMMETRIC_ENCRYPTION
-		material, err = s.engine.GenerateKeyMaterial(ctx)
-		if err != nil {
-			return nil, status.Errorf(codes.Internal, "failed to generate key material: %v", err)
-		}
-		version = &kmspb.CryptoKeyVersion{
-			Name:            primaryVersionName,
-			State:           kmspb.CryptoKeyVersion_ENABLED,
-			ProtectionLevel: kmspb.ProtectionLevel_SOFTWARE,
+	now := timestamppb.New(s.now())
+	ck := &kmspb.CryptoKey{
+		Name:       cryptoKeyName,
+		CreateTime: now,
+		Labels:     mapsCopy(req.GetCryptoKey().GetLabels()),
+		Purpose:    purpose,
+		VersionTemplate: &kmspb.CryptoKeyVersionTemplate{
+			ProtectionLevel: protectionLevel,
 			Algorithm:       algorithm,
-			CreateTime:      timestamppb.Now(),
-		}
-		ck = &kmspb.CryptoKey{
-			Name:       cryptoKeyName,
-			CreateTime: timestamppb.Now(),
-			Labels:     mapsCopy(req.GetCryptoKey().GetLabels()),
-			Purpose:    purpose,
-			VersionTemplate: &kmspb.CryptoKeyVersionTemplate{
-				ProtectionLevel: kmspb.ProtectionLevel_SOFTWARE,
-				Algorithm:       algorithm,
-			},
-			Primary: version,
-		}
+		},
+		DestroyScheduledDuration: durationpb.New(destroyScheduledDuration),
+		RotationSchedule:         req.GetCryptoKey().GetRotationSchedule(),
+		NextRotationTime:         req.GetCryptoKey().GetNextRotationTime(),
+		ImportOnly:               req.GetCryptoKey().GetImportOnly(),
+	}
+	if period := ck.GetRotationPeriod(); period != nil && ck.GetNextRotationTime() == nil {
+		ck.NextRotationTime = timestamppb.New(s.now().Add(period.AsDuration()))
+	}
+	if err := validateRotationSchedule(ck); err != nil {
+		return nil, err
+	}
 
-	case kmspb.CryptoKey_ASYMMETRIC_SIGN:
-		algorithm = req.GetCryptoKey().GetVersionTemplate().GetAlgorithm()
-		if algorithm != kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256 {
-			return nil, status.Errorf(codes.InvalidArgument, "unsupported algorithm for ASYMMETRIC_SIGN: %v", algorithm)
-		}
-		material, err = s.engine.GenerateAsymmetricKeyMaterial(ctx, algorithm.String())
-		if err != nil {
-			return nil, status.Errorf(codes.Internal, "failed to generate asymmetric key material: %v", err)
+	var (
+		version  *kmspb.CryptoKeyVersion
+		material kmscrypto.KeyMaterial
+	)
+	if !req.GetSkipInitialVersionCreation() {
+		if material, err = s.generateKeyMaterial(ctx, purpose, algorithm); err != nil {
+			return nil, err
 		}
 		version = &kmspb.CryptoKeyVersion{
 			Name:            primaryVersionName,
 			State:           kmspb.CryptoKeyVersion_ENABLED,
-			ProtectionLevel: kmspb.ProtectionLevel_SOFTWARE,
+			ProtectionLevel: protectionLevel,
 			Algorithm:       algorithm,
-			CreateTime:      timestamppb.Now(),
+			CreateTime:      now,
+			Attestation:     newAttestation(protectionLevel),
 		}
-		ck = &kmspb.CryptoKey{
-			Name:       cryptoKeyName,
-			CreateTime: timestamppb.Now(),
-			Labels:     mapsCopy(req.GetCryptoKey().GetLabels()),
-			Purpose:    purpose,
-			VersionTemplate: &kmspb.CryptoKeyVersionTemplate{
-				ProtectionLevel: kmspb.ProtectionLevel_SOFTWARE,
-				Algorithm:       algorithm,
-			},
+		// Only symmetric encryption keys have a primary version.
+		if purpose == kmspb.CryptoKey_ENCRYPT_DECRYPT {
+			ck.Primary = version
 		}
-
-	default:
-		return nil, status.Errorf(codes.InvalidArgument, "unsupported purpose: %v", purpose)
 	}
 
 	if err := s.store.CreateCryptoKey(ctx, keyRing.ResourceName(), ck, version, material); err != nil {
@@ -199,6 +411,9 @@ func (s *service) GetCryptoKey(ctx context.Context, req *kmspb.GetCryptoKeyReque
 	if err != nil {
 		return nil, err
 	}
+	if err := s.settlePrimary(ctx, ck); err != nil {
+		return nil, err
+	}
 	return ck, nil
 }
 
@@ -207,14 +422,85 @@ func (s *service) ListCryptoKeys(ctx context.Context, req *kmspb.ListCryptoKeysR
 		return nil, status.Errorf(codes.InvalidArgument, "invalid parent: %v", err)
 	}
 
-	if req.GetPageToken() != "" {
-		return nil, status.Error(codes.Unimplemented, "pagination is not supported")
+	query, err := parseListQuery((&kmspb.CryptoKey{}).ProtoReflect().Descriptor(), req.GetFilter(), req.GetOrderBy())
+	if err != nil {
+		return nil, err
+	}
+	page, err := s.parsePageRequest(pageToken{Parent: req.GetParent(), Filter: req.GetFilter(), OrderBy: req.GetOrderBy()}, req.GetPageSize(), req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+
+	items, next, total, err := listPage(s.pageTokens, page, query,
+		func(opts store.ListOptions) ([]*kmspb.CryptoKey, int, error) {
+			return s.store.ListCryptoKeys(ctx, req.GetParent(), opts)
+		},
+		func(ck *kmspb.CryptoKey) (*kmspb.CryptoKey, error) { return ck, s.settlePrimary(ctx, ck) },
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, ck := range items {
+		ck.Primary = applyVersionView(ck.GetPrimary(), req.GetVersionView())
+	}
+	return &kmspb.ListCryptoKeysResponse{CryptoKeys: items, NextPageToken: next, TotalSize: total}, nil
+}
+
+func (s *service) UpdateCryptoKey(ctx context.Context, req *kmspb.UpdateCryptoKeyRequest) (*kmspb.CryptoKey, error) {
+	update := req.GetCryptoKey()
+	if update == nil {
+		return nil, status.Error(codes.InvalidArgument, "crypto_key is required")
 	}
-	items, err := s.store.ListCryptoKeys(ctx, req.GetParent())
+	if _, err := names.ParseCryptoKey(update.GetName()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
+	}
+	paths := req.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "update_mask is required")
+	}
+
+	// Hold off the rotator so it cannot advance next_rotation_time between
+	// this read and the write below.
+	s.rotateMu.Lock()
+	defer s.rotateMu.Unlock()
+	ck, err := s.store.GetCryptoKey(ctx, update.GetName())
 	if err != nil {
 		return nil, err
 	}
-	return &kmspb.ListCryptoKeysResponse{CryptoKeys: items}, nil
+
+	for _, path := range paths {
+		switch path {
+		case "labels":
+			ck.Labels = mapsCopy(update.GetLabels())
+		case "rotation_period":
+			ck.RotationSchedule = update.GetRotationSchedule()
+		case "next_rotation_time":
+			ck.NextRotationTime = update.GetNextRotationTime()
+		case "version_template.algorithm":
+			algorithm := update.GetVersionTemplate().GetAlgorithm()
+			if !slices.Contains(supportedAlgorithms[ck.GetPurpose()], algorithm) {
+				return nil, status.Errorf(codes.InvalidArgument, "unsupported algorithm for %v: %v", ck.GetPurpose(), algorithm)
+			}
+			ck.VersionTemplate.Algorithm = algorithm
+		case "name", "primary", "purpose", "create_time", "version_template.protection_level",
+			"import_only", "destroy_scheduled_duration", "crypto_key_backend":
+			return nil, status.Errorf(codes.InvalidArgument, "update_mask path %q refers to an immutable field", path)
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "update_mask path %q is not a valid CryptoKey field", path)
+		}
+	}
+
+	if err := validateRotationSchedule(ck); err != nil {
+		return nil, err
+	}
+
+	if err := s.store.UpdateCryptoKey(ctx, ck); err != nil {
+		return nil, err
+	}
+	if err := s.settlePrimary(ctx, ck); err != nil {
+		return nil, err
+	}
+	return ck, nil
 }
 
 func (s *service) CreateCryptoKeyVersion(ctx context.Context, req *kmspb.CreateCryptoKeyVersionRequest) (*kmspb.CryptoKeyVersion, error) {
@@ -228,34 +514,36 @@ func (s *service) CreateCryptoKeyVersion(ctx context.Context, req *kmspb.CreateC
 	if err != nil {
 		return nil, err
 	}
+	if ck.GetImportOnly() {
+		return nil, status.Errorf(codes.FailedPrecondition, "%s is import-only; use ImportCryptoKeyVersion to add versions", cryptoKeyName)
+	}
+	return s.createVersion(ctx, ck)
+}
 
+// createVersion adds an ENABLED version to ck using its version template.
+func (s *service) createVersion(ctx context.Context, ck *kmspb.CryptoKey) (*kmspb.CryptoKeyVersion, error) {
+	cryptoKeyName := ck.GetName()
 	algorithm := ck.GetVersionTemplate().GetAlgorithm()
-	var material kmscrypto.KeyMaterial
-	switch ck.GetPurpose() {
-	case kmspb.CryptoKey_ENCRYPT_DECRYPT:
-		material, err = s.engine.GenerateKeyMaterial(ctx)
-	case kmspb.CryptoKey_ASYMMETRIC_SIGN:
-		material, err = s.engine.GenerateAsymmetricKeyMaterial(ctx, algorithm.String())
-	default:
-		return nil, status.Errorf(codes.Internal, "unexpected purpose: %v", ck.GetPurpose())
-	}
+	material, err := s.generateKeyMaterial(ctx, ck.GetPurpose(), algorithm)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to generate key material: %v", err)
+		return nil, err
 	}
 
-	existing, err := s.store.ListCryptoKeyVersions(ctx, cryptoKeyName)
+	versionName, err := s.nextVersionName(ctx, cryptoKeyName)
 	if err != nil {
 		return nil, err
 	}
-
-	nextID := nextVersionID(existing)
-	versionName := names.FormatCryptoKeyVersion(cryptoKeyName, strconv.Itoa(nextID))
+	protectionLevel, err := resolveProtectionLevel(ck.GetVersionTemplate().GetProtectionLevel())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected protection level: %v", ck.GetVersionTemplate().GetProtectionLevel())
+	}
 	version := &kmspb.CryptoKeyVersion{
 		Name:            versionName,
 		State:           kmspb.CryptoKeyVersion_ENABLED,
 		Algorithm:       algorithm,
-		ProtectionLevel: kmspb.ProtectionLevel_SOFTWARE,
-		CreateTime:      timestamppb.Now(),
+		ProtectionLevel: protectionLevel,
+		CreateTime:      timestamppb.New(s.now()),
+		Attestation:     newAttestation(protectionLevel),
 	}
 
 	if err := s.store.CreateCryptoKeyVersion(ctx, cryptoKeyName, version, material); err != nil {
@@ -264,11 +552,20 @@ func (s *service) CreateCryptoKeyVersion(ctx context.Context, req *kmspb.CreateC
 	return version, nil
 }
 
+// nextVersionName returns the name of the next version of the named key.
+func (s *service) nextVersionName(ctx context.Context, cryptoKeyName string) (string, error) {
+	existing, _, err := s.store.ListCryptoKeyVersions(ctx, cryptoKeyName, store.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	return names.FormatCryptoKeyVersion(cryptoKeyName, strconv.Itoa(nextVersionID(existing))), nil
+}
+
 func (s *service) GetCryptoKeyVersion(ctx context.Context, req *kmspb.GetCryptoKeyVersionRequest) (*kmspb.CryptoKeyVersion, error) {
 	if _, err := names.ParseCryptoKeyVersion(req.GetName()); err != nil {
 		return nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
 	}
-	version, _, err := s.store.GetCryptoKeyVersion(ctx, req.GetName())
+	version, _, err := s.loadVersion(ctx, req.GetName())
 	if err != nil {
 		return nil, err
 	}
@@ -280,15 +577,29 @@ func (s *service) ListCryptoKeyVersions(ctx context.Context, req *kmspb.ListCryp
 		return nil, status.Errorf(codes.InvalidArgument, "invalid parent: %v", err)
 	}
 
-	if req.GetPageToken() != "" {
-		return nil, status.Error(codes.Unimplemented, "pagination is not supported")
+	query, err := parseListQuery((&kmspb.CryptoKeyVersion{}).ProtoReflect().Descriptor(), req.GetFilter(), req.GetOrderBy())
+	if err != nil {
+		return nil, err
+	}
+	page, err := s.parsePageRequest(pageToken{Parent: req.GetParent(), Filter: req.GetFilter(), OrderBy: req.GetOrderBy()}, req.GetPageSize(), req.GetPageToken())
+	if err != nil {
+		return nil, err
 	}
 
-	versions, err := s.store.ListCryptoKeyVersions(ctx, req.GetParent())
+	versions, next, total, err := listPage(s.pageTokens, page, query,
+		func(opts store.ListOptions) ([]*kmspb.CryptoKeyVersion, int, error) {
+			return s.store.ListCryptoKeyVersions(ctx, req.GetParent(), opts)
+		},
+		func(v *kmspb.CryptoKeyVersion) (*kmspb.CryptoKeyVersion, error) { return s.settleVersion(ctx, v) },
+	)
 	if err != nil {
 		return nil, err
 	}
-	return &kmspb.ListCryptoKeyVersionsResponse{CryptoKeyVersions: versions}, nil
+	// DESTROYED versions stay listed, as in Cloud KMS; use a state filter to hide them.
+	for i, v := range versions {
+		versions[i] = applyVersionView(v, req.GetView())
+	}
+	return &kmspb.ListCryptoKeyVersionsResponse{CryptoKeyVersions: versions, NextPageToken: next, TotalSize: total}, nil
 }
 
 func (s *service) UpdateCryptoKeyPrimaryVersion(ctx context.Context, req *kmspb.UpdateCryptoKeyPrimaryVersionRequest) (*kmspb.CryptoKey, error) {
@@ -300,13 +611,130 @@ func (s *service) UpdateCryptoKeyPrimaryVersion(ctx context.Context, req *kmspb.
 		return nil, status.Error(codes.InvalidArgument, "crypto_key_version_id is required")
 	}
 
+	ck, err := s.store.GetCryptoKey(ctx, req.GetName())
+	if err != nil {
+		return nil, err
+	}
+	if ck.GetPurpose() != kmspb.CryptoKey_ENCRYPT_DECRYPT {
+		return nil, status.Errorf(codes.FailedPrecondition, "%s has purpose %v; only ENCRYPT_DECRYPT keys have a primary version", ck.GetName(), ck.GetPurpose())
+	}
+
+	// Hold versionMu so the version cannot be disabled or destroyed between
+	// the check and the primary update.
+	s.versionMu.Lock()
+	defer s.versionMu.Unlock()
 	versionName := names.FormatCryptoKeyVersion(req.GetName(), req.GetCryptoKeyVersionId())
-	ck, err := s.store.SetPrimaryVersion(ctx, req.GetName(), versionName)
+	version, err := s.loadVersionLocked(ctx, versionName)
 	if err != nil {
 		return nil, err
 	}
+	if err := requireEnabled(version); err != nil {
+		return nil, err
+	}
 
-	return ck, nil
+	return s.store.SetPrimaryVersion(ctx, req.GetName(), versionName)
+}
+
+func (s *service) UpdateCryptoKeyVersion(ctx context.Context, req *kmspb.UpdateCryptoKeyVersionRequest) (*kmspb.CryptoKeyVersion, error) {
+	update := req.GetCryptoKeyVersion()
+	if update == nil {
+		return nil, status.Error(codes.InvalidArgument, "crypto_key_version is required")
+	}
+	if _, err := names.ParseCryptoKeyVersion(update.GetName()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
+	}
+	if len(req.GetUpdateMask().GetPaths()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "update_mask is required")
+	}
+	for _, path := range req.GetUpdateMask().GetPaths() {
+		if path != "state" {
+			return nil, status.Errorf(codes.InvalidArgument, "update_mask path %q is not supported", path)
+		}
+	}
+
+	switch update.GetState() {
+	case kmspb.CryptoKeyVersion_ENABLED, kmspb.CryptoKeyVersion_DISABLED:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "state must be ENABLED or DISABLED, got %s", update.GetState())
+	}
+
+	s.versionMu.Lock()
+	defer s.versionMu.Unlock()
+	version, err := s.loadVersionLocked(ctx, update.GetName())
+	if err != nil {
+		return nil, err
+	}
+	switch version.GetState() {
+	case kmspb.CryptoKeyVersion_ENABLED, kmspb.CryptoKeyVersion_DISABLED:
+	default:
+		return nil, status.Errorf(codes.FailedPrecondition, "%s cannot change state, current state is: %s.", version.GetName(), version.GetState())
+	}
+
+	version.State = update.GetState()
+	if err := s.store.UpdateCryptoKeyVersion(ctx, version); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+func (s *service) DestroyCryptoKeyVersion(ctx context.Context, req *kmspb.DestroyCryptoKeyVersionRequest) (*kmspb.CryptoKeyVersion, error) {
+	versionResource, err := names.ParseCryptoKeyVersion(req.GetName())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
+	}
+
+	ck, err := s.store.GetCryptoKey(ctx, versionResource.CryptoKey.ResourceName())
+	if err != nil {
+		return nil, err
+	}
+	s.versionMu.Lock()
+	defer s.versionMu.Unlock()
+	version, err := s.loadVersionLocked(ctx, req.GetName())
+	if err != nil {
+		return nil, err
+	}
+
+	switch version.GetState() {
+	case kmspb.CryptoKeyVersion_ENABLED, kmspb.CryptoKeyVersion_DISABLED:
+	default:
+		return nil, status.Errorf(codes.FailedPrecondition, "%s cannot be destroyed, current state is: %s.", version.GetName(), version.GetState())
+	}
+
+	duration := defaultDestroyScheduledDuration
+	if ck.GetDestroyScheduledDuration() != nil {
+		duration = ck.GetDestroyScheduledDuration().AsDuration()
+	}
+	version.State = kmspb.CryptoKeyVersion_DESTROY_SCHEDULED
+	version.DestroyTime = timestamppb.New(s.now().Add(duration))
+
+	if err := s.store.UpdateCryptoKeyVersion(ctx, version); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+func (s *service) RestoreCryptoKeyVersion(ctx context.Context, req *kmspb.RestoreCryptoKeyVersionRequest) (*kmspb.CryptoKeyVersion, error) {
+	if _, err := names.ParseCryptoKeyVersion(req.GetName()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
+	}
+
+	s.versionMu.Lock()
+	defer s.versionMu.Unlock()
+	version, err := s.loadVersionLocked(ctx, req.GetName())
+	if err != nil {
+		return nil, err
+	}
+	if version.GetState() != kmspb.CryptoKeyVersion_DESTROY_SCHEDULED {
+		return nil, status.Errorf(codes.FailedPrecondition, "%s cannot be restored, current state is: %s.", version.GetName(), version.GetState())
+	}
+
+	version.State = kmspb.CryptoKeyVersion_DISABLED
+	version.DestroyTime = nil
+
+	if err := s.store.UpdateCryptoKeyVersion(ctx, version); err != nil {
+		return nil, err
+	}
+	return version, nil
 }
 
 func (s *service) Encrypt(ctx context.Context, req *kmspb.EncryptRequest) (*kmspb.EncryptResponse, error) {
@@ -333,10 +761,13 @@ func (s *service) Encrypt(ctx context.Context, req *kmspb.EncryptRequest) (*kmsp
 	}
 
 	versionName := ck.GetPrimary().GetName()
-	version, material, err := s.store.GetCryptoKeyVersion(ctx, versionName)
+	version, material, err := s.loadVersion(ctx, versionName)
 	if err != nil {
 		return nil, err
 	}
+	if err := requireEnabled(version); err != nil {
+		return nil, err
+	}
 
 	ciphertextOnly, err := s.engine.Encrypt(ctx, material, req.GetPlaintext(), req.GetAdditionalAuthenticatedData())
 	if err != nil {
@@ -376,7 +807,7 @@ func (s *service) Decrypt(ctx context.Context, req *kmspb.DecryptRequest) (*kmsp
 		return nil, status.Errorf(codes.InvalidArgument, "invalid ciphertext payload: %v", err)
 	}
 
-	versionInfo, material, err := s.store.GetCryptoKeyVersion(ctx, versionName)
+	versionInfo, material, err := s.loadVersion(ctx, versionName)
 	if err != nil {
 		return nil, err
 	}
@@ -388,6 +819,9 @@ func (s *service) Decrypt(ctx context.Context, req *kmspb.DecryptRequest) (*kmsp
 	if versionResource.CryptoKey.ResourceName() != req.GetName() {
 		return nil, status.Error(codes.FailedPrecondition, "ciphertext was encrypted with a different crypto key")
 	}
+	if err := requireEnabled(versionInfo); err != nil {
+		return nil, err
+	}
 
 	plaintext, err := s.engine.Decrypt(ctx, material, ciphertextOnly, req.GetAdditionalAuthenticatedData())
 	if err != nil {
@@ -403,30 +837,86 @@ func (s *service) Decrypt(ctx context.Context, req *kmspb.DecryptRequest) (*kmsp
 	}, nil
 }
 
+// GetPublicKey serves classic keys as PEM or DER according to
+// public_key_format, always populating pem as well, and post-quantum keys only
+// in their raw format.
 func (s *service) GetPublicKey(ctx context.Context, req *kmspb.GetPublicKeyRequest) (*kmspb.PublicKey, error) {
 	if _, err := names.ParseCryptoKeyVersion(req.GetName()); err != nil {
 		return nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
 	}
 
-	version, material, err := s.store.GetCryptoKeyVersion(ctx, req.GetName())
+	version, material, err := s.loadVersion(ctx, req.GetName())
 	if err != nil {
 		return nil, err
 	}
 
-	if version.GetAlgorithm() != kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256 {
+	if !isAsymmetric(version.GetAlgorithm()) {
 		return nil, status.Errorf(codes.FailedPrecondition, "key version algorithm %v does not support GetPublicKey", version.GetAlgorithm())
 	}
+	if err := requireEnabled(version); err != nil {
+		return nil, err
+	}
+
+	if _, ok := rawPublicKeyFormats[version.GetAlgorithm()]; ok {
+		return s.getRawPublicKey(ctx, version, material, req.GetPublicKeyFormat())
+	}
+	format := req.GetPublicKeyFormat()
+	switch format {
+	case kmspb.PublicKey_PUBLIC_KEY_FORMAT_UNSPECIFIED:
+		format = kmspb.PublicKey_PEM
+	case kmspb.PublicKey_PEM, kmspb.PublicKey_DER:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "public_key_format %v is not supported for algorithm %v", format, version.GetAlgorithm())
+	}
 
-	pemBytes, err := s.engine.GetPublicKeyPEM(ctx, material)
+	pemBytes, err := s.engine.GetPublicKeyPEM(ctx, material, version.GetAlgorithm().String())
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to get public key: %v", err)
 	}
+	publicKey := pemBytes
+	if format == kmspb.PublicKey_DER {
+		block, _ := pem.Decode(pemBytes)
+		if block == nil {
+			return nil, status.Error(codes.Internal, "failed to decode public key PEM")
+		}
+		publicKey = block.Bytes
+	}
 
 	checksum := crc.Compute(pemBytes)
 	return &kmspb.PublicKey{
-		Pem:             string(pemBytes),
-		Algorithm:       version.GetAlgorithm(),
-		PemCrc32C:       wrapperspb.Int64(int64(checksum)),
+		Pem:       string(pemBytes),
+		Algorithm: version.GetAlgorithm(),
+		PemCrc32C: wrapperspb.Int64(int64(checksum)),
+		PublicKey: &kmspb.ChecksummedData{
+			Data:           publicKey,
+			Crc32CChecksum: wrapperspb.Int64(int64(crc.Compute(publicKey))),
+		},
+		PublicKeyFormat: format,
+		Name:            version.GetName(),
+		ProtectionLevel: version.GetProtectionLevel(),
+	}, nil
+}
+
+// getRawPublicKey serves the public key of a post-quantum version in its
+// algorithm's raw format.
+func (s *service) getRawPublicKey(ctx context.Context, version *kmspb.CryptoKeyVersion, material kmscrypto.KeyMaterial, format kmspb.PublicKey_PublicKeyFormat) (*kmspb.PublicKey, error) {
+	want := rawPublicKeyFormats[version.GetAlgorithm()]
+	if format != want {
+		return nil, status.Errorf(codes.InvalidArgument, "public_key_format must be %v for algorithm %v", want, version.GetAlgorithm())
+	}
+
+	publicKey, err := s.engine.GetRawPublicKey(ctx, material, version.GetAlgorithm().String())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get public key: %v", err)
+	}
+
+	return &kmspb.PublicKey{
+		Algorithm: version.GetAlgorithm(),
+		PublicKey: &kmspb.ChecksummedData{
+			Data:           publicKey,
+			Crc32CChecksum: wrapperspb.Int64(int64(crc.Compute(publicKey))),
+		},
+		PublicKeyFormat: format,
 		Name:            version.GetName(),
 		ProtectionLevel: version.GetProtectionLevel(),
 	}, nil
@@ -437,30 +927,49 @@ func (s *service) AsymmetricSign(ctx context.Context, req *kmspb.AsymmetricSignR
 		return nil, status.Errorf(codes.InvalidArgument, "invalid name: %v", err)
 	}
 
-	version, material, err := s.store.GetCryptoKeyVersion(ctx, req.GetName())
+	version, material, err := s.loadVersion(ctx, req.GetName())
 	if err != nil {
 		return nil, err
 	}
 
-	if version.GetAlgorithm() != kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256 {
+	if !slices.Contains(supportedAlgorithms[kmspb.CryptoKey_ASYMMETRIC_SIGN], version.GetAlgorithm()) {
 		return nil, status.Errorf(codes.FailedPrecondition, "key version algorithm %v does not support AsymmetricSign", version.GetAlgorithm())
 	}
-
-	digest := req.GetDigest()
-	if digest == nil {
-		return nil, status.Error(codes.InvalidArgument, "digest is required")
-	}
-	sha256Digest := digest.GetSha256()
-	if len(sha256Digest) == 0 {
-		return nil, status.Error(codes.InvalidArgument, "sha256 digest is required for EC_SIGN_SECP256K1_SHA256")
+	if err := requireEnabled(version); err != nil {
+		return nil, err
 	}
 
-	verifiedDigest, err := verifyChecksum(sha256Digest, req.GetDigestCrc32C())
-	if err != nil {
-		return nil, err
+	var (
+		input                        []byte
+		verifiedDigest, verifiedData bool
+	)
+	if limit, ok := dataSigningLimits[version.GetAlgorithm()]; ok {
+		if req.GetDigest() != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "AsymmetricSignRequest.digest cannot be used with algorithm %v, which signs AsymmetricSignRequest.data", version.GetAlgorithm())
+		}
+		if len(req.GetData()) == 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "AsymmetricSignRequest.data is required for algorithm %v", version.GetAlgorithm())
+		}
+		if len(req.GetData()) > limit {
+			return nil, status.Errorf(codes.InvalidArgument, "AsymmetricSignRequest.data must be at most %d bytes for algorithm %v", limit, version.GetAlgorithm())
+		}
+		if verifiedData, err = verifyChecksum(req.GetData(), req.GetDataCrc32C()); err != nil {
+			return nil, err
+		}
+		input = req.GetData()
+	} else {
+		if len(req.GetData()) > 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "AsymmetricSignRequest.data cannot be used with algorithm %v, which signs AsymmetricSignRequest.digest", version.GetAlgorithm())
+		}
+		if input, err = signingDigest(version.GetAlgorithm(), req.GetDigest()); err != nil {
+			return nil, err
+		}
+		if verifiedDigest, err = verifyChecksum(input, req.GetDigestCrc32C()); err != nil {
+			return nil, err
+		}
 	}
 
-	sig, err := s.engine.Sign(ctx, material, sha256Digest)
+	sig, err := s.engine.Sign(ctx, material, version.GetAlgorithm().String(), input)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "sign failed: %v", err)
 	}
@@ -470,11 +979,236 @@ func (s *service) AsymmetricSign(ctx context.Context, req *kmspb.AsymmetricSignR
 		Signature:            sig,
 		SignatureCrc32C:      wrapperspb.Int64(int64(checksum)),
 		VerifiedDigestCrc32C: verifiedDigest,
+		VerifiedDataCrc32C:   verifiedData,
 		Name:                 version.GetName(),
 		ProtectionLevel:      version.GetProtectionLevel(),
 	}, nil
 }
 
+// rawPublicKeyFormats maps each post-quantum algorithm to the only
+// public_key_format Cloud KMS serves it in; these keys have no PEM encoding.
+var rawPublicKeyFormats = map[kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm]kmspb.PublicKey_PublicKeyFormat{
+	kmspb.CryptoKeyVersion_ML_KEM_768:                kmspb.PublicKey_NIST_PQC,
+	kmspb.CryptoKeyVersion_ML_KEM_1024:               kmspb.PublicKey_NIST_PQC,
+	kmspb.CryptoKeyVersion_KEM_XWING:                 kmspb.PublicKey_XWING_RAW_BYTES,
+	kmspb.CryptoKeyVersion_PQ_SIGN_ML_DSA_65:         kmspb.PublicKey_NIST_PQC,
+	kmspb.CryptoKeyVersion_PQ_SIGN_SLH_DSA_SHA2_128S: kmspb.PublicKey_NIST_PQC,
+}
+
+// signingDigests maps each digest-based signing algorithm to the digest it signs.
+var signingDigests = map[kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm]crypto.Hash{
+	kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256:   crypto.SHA256,
+	kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256:        crypto.SHA256,
+	kmspb.CryptoKeyVersion_EC_SIGN_P384_SHA384:        crypto.SHA384,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PSS_2048_SHA256:   crypto.SHA256,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PSS_3072_SHA256:   crypto.SHA256,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PSS_4096_SHA256:   crypto.SHA256,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PSS_4096_SHA512:   crypto.SHA512,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_2048_SHA256: crypto.SHA256,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_3072_SHA256: crypto.SHA256,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA256: crypto.SHA256,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA512: crypto.SHA512,
+}
+
+// dataSigningLimits maps each algorithm that signs AsymmetricSignRequest.data
+// rather than a digest to the maximum data size it accepts. RAW_PKCS1 input
+// must leave room for the 11 bytes of PKCS#1 v1.5 padding.
+var dataSigningLimits = map[kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm]int{
+	kmspb.CryptoKeyVersion_EC_SIGN_ED25519:           64 * 1024,
+	kmspb.CryptoKeyVersion_PQ_SIGN_ML_DSA_65:         64 * 1024,
+	kmspb.CryptoKeyVersion_PQ_SIGN_SLH_DSA_SHA2_128S: 64 * 1024,
+	kmspb.CryptoKeyVersion_RSA_SIGN_RAW_PKCS1_2048:   2048/8 - 11,
+	kmspb.CryptoKeyVersion_RSA_SIGN_RAW_PKCS1_3072:   3072/8 - 11,
+	kmspb.CryptoKeyVersion_RSA_SIGN_RAW_PKCS1_4096:   4096/8 - 11,
+}
+
+// signingDigest extracts the digest of an AsymmetricSign request, checking
+// that its type and length match what algorithm signs.
+func signingDigest(algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm, digest *kmspb.Digest) ([]byte, error) {
+	var (
+		got   crypto.Hash
+		value []byte
+	)
+	switch d := digest.GetDigest().(type) {
+	case *kmspb.Digest_Sha256:
+		got, value = crypto.SHA256, d.Sha256
+	case *kmspb.Digest_Sha384:
+		got, value = crypto.SHA384, d.Sha384
+	case *kmspb.Digest_Sha512:
+		got, value = crypto.SHA512, d.Sha512
+	}
+	if len(value) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "digest is required")
+	}
+	want := signingDigests[algorithm]
+	if got != want {
+		return nil, status.Errorf(codes.InvalidArgument, "the requested digest type (%v) is not compatible with the key algorithm (%v)", got, algorithm)
+	}
+	if len(value) != want.Size() {
+		return nil, status.Errorf(codes.InvalidArgument, "digest must be %d bytes for %v, got %d", want.Size(), algorithm, len(value))
+	}
+	return value, nil
+}
+
+// resolveAlgorithm validates the version template algorithm requested for a
+// new key. Symmetric encryption keys default to GOOGLE_SYMMETRIC_ENCRYPTION.
+func resolveAlgorithm(purpose kmspb.CryptoKey_CryptoKeyPurpose, algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm) (kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm, error) {
+	algorithms, ok := supportedAlgorithms[purpose]
+	if !ok {
+		return 0, status.Errorf(codes.InvalidArgument, "unsupported purpose: %v", purpose)
+	}
+	if purpose == kmspb.CryptoKey_ENCRYPT_DECRYPT && algorithm == kmspb.CryptoKeyVersion_CRYPTO_KEY_VERSION_ALGORITHM_UNSPECIFIED {
+		algorithm = kmspb.CryptoKeyVersion_GOOGLE_SYMMETRIC_ENCRYPTION
+	}
+	if !slices.Contains(algorithms, algorithm) {
+		return 0, status.Errorf(codes.InvalidArgument, "unsupported algorithm for %v: %v", purpose, algorithm)
+	}
+	return algorithm, nil
+}
+
+// isAsymmetric reports whether algorithm belongs to a key pair with a public key.
+func isAsymmetric(algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm) bool {
+	return slices.Contains(supportedAlgorithms[kmspb.CryptoKey_ASYMMETRIC_SIGN], algorithm) ||
+		slices.Contains(supportedAlgorithms[kmspb.CryptoKey_ASYMMETRIC_DECRYPT], algorithm) ||
+		slices.Contains(supportedAlgorithms[kmspb.CryptoKey_KEY_ENCAPSULATION], algorithm)
+}
+
+// generateKeyMaterial creates key material for a new version of a key with the given purpose.
+func (s *service) generateKeyMaterial(ctx context.Context, purpose kmspb.CryptoKey_CryptoKeyPurpose, algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm) (kmscrypto.KeyMaterial, error) {
+	var (
+		material kmscrypto.KeyMaterial
+		err      error
+	)
+	switch purpose {
+	case kmspb.CryptoKey_ENCRYPT_DECRYPT:
+		material, err = s.engine.GenerateKeyMaterial(ctx)
+	case kmspb.CryptoKey_ASYMMETRIC_SIGN, kmspb.CryptoKey_ASYMMETRIC_DECRYPT, kmspb.CryptoKey_KEY_ENCAPSULATION:
+		material, err = s.engine.GenerateAsymmetricKeyMaterial(ctx, algorithm.String())
+	case kmspb.CryptoKey_MAC:
+		material, err = s.engine.GenerateMacKeyMaterial(ctx, algorithm.String())
+	case kmspb.CryptoKey_RAW_ENCRYPT_DECRYPT:
+		material, err = s.engine.GenerateRawKeyMaterial(ctx, algorithm.String())
+	default:
+		return nil, status.Errorf(codes.Internal, "unexpected purpose: %v", purpose)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to generate key material: %v", err)
+	}
+	return material, nil
+}
+
+// loadVersion reads a version and its key material, completing any destruction
+// whose scheduled time has passed.
+func (s *service) loadVersion(ctx context.Context, name string) (*kmspb.CryptoKeyVersion, kmscrypto.KeyMaterial, error) {
+	version, material, err := s.store.GetCryptoKeyVersion(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	settled, err := s.settleVersion(ctx, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	if settled.GetState() == kmspb.CryptoKeyVersion_DESTROYED {
+		material = nil
+	}
+	return settled, material, nil
+}
+
+// loadVersionLocked reads a version like loadVersion, without its key
+// material. The caller holds versionMu.
+func (s *service) loadVersionLocked(ctx context.Context, name string) (*kmspb.CryptoKeyVersion, error) {
+	version, _, err := s.store.GetCryptoKeyVersion(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return s.settleVersionLocked(ctx, version)
+}
+
+// destroyDueVersions settles every DESTROY_SCHEDULED version whose
+// destroy_time has passed, so clock jumps take effect before the versions
+// are next read.
+func (s *service) destroyDueVersions(ctx context.Context) error {
+	scheduled, err := s.store.ListDestroyScheduledCryptoKeyVersions(ctx)
+	if err != nil {
+		return fmt.Errorf("list destroy-scheduled versions: %w", err)
+	}
+	var errs []error
+	for _, version := range scheduled {
+		if _, err := s.settleVersion(ctx, version); err != nil {
+			errs = append(errs, fmt.Errorf("destroy %s: %w", version.GetName(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// settleVersion moves a DESTROY_SCHEDULED version to DESTROYED once its
+// destroy_time has passed, wiping the stored key material. version may be
+// stale, so a due destruction re-reads it first and returns its current state.
+func (s *service) settleVersion(ctx context.Context, version *kmspb.CryptoKeyVersion) (*kmspb.CryptoKeyVersion, error) {
+	if !s.destructionDue(version) {
+		return version, nil
+	}
+	s.versionMu.Lock()
+	defer s.versionMu.Unlock()
+	return s.loadVersionLocked(ctx, version.GetName())
+}
+
+// settleVersionLocked is settleVersion for a version read under versionMu.
+func (s *service) settleVersionLocked(ctx context.Context, version *kmspb.CryptoKeyVersion) (*kmspb.CryptoKeyVersion, error) {
+	if !s.destructionDue(version) {
+		return version, nil
+	}
+	version.State = kmspb.CryptoKeyVersion_DESTROYED
+	version.DestroyEventTime = timestamppb.New(version.GetDestroyTime().AsTime())
+	// There is no key material left to attest to.
+	version.Attestation = nil
+	if err := s.store.DestroyCryptoKeyVersion(ctx, version); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// destructionDue reports whether version is scheduled for destruction at a
+// time that has passed.
+func (s *service) destructionDue(version *kmspb.CryptoKeyVersion) bool {
+	return version.GetState() == kmspb.CryptoKeyVersion_DESTROY_SCHEDULED && !s.now().Before(version.GetDestroyTime().AsTime())
+}
+
+// settlePrimary refreshes the primary version embedded in ck.
+func (s *service) settlePrimary(ctx context.Context, ck *kmspb.CryptoKey) error {
+	if ck.GetPrimary() == nil {
+		return nil
+	}
+	primary, err := s.settleVersion(ctx, ck.GetPrimary())
+	if err != nil {
+		return err
+	}
+	ck.Primary = primary
+	return nil
+}
+
+// requireEnabled rejects versions that cannot be used for cryptographic operations.
+func requireEnabled(version *kmspb.CryptoKeyVersion) error {
+	if version.GetState() != kmspb.CryptoKeyVersion_ENABLED {
+		return status.Errorf(codes.FailedPrecondition, "%s is not enabled, current state is: %s.", version.GetName(), version.GetState())
+	}
+	return nil
+}
+
+func resolveDestroyScheduledDuration(in *durationpb.Duration) (time.Duration, error) {
+	if in == nil {
+		return defaultDestroyScheduledDuration, nil
+	}
+	if err := in.CheckValid(); err != nil {
+		return 0, status.Errorf(codes.InvalidArgument, "invalid destroy_scheduled_duration: %v", err)
+	}
+	d := in.AsDuration()
+	if d < minDestroyScheduledDuration || d > maxDestroyScheduledDuration {
+		return 0, status.Errorf(codes.InvalidArgument, "destroy_scheduled_duration must be between %s and %s", minDestroyScheduledDuration, maxDestroyScheduledDuration)
+	}
+	return d, nil
+}
+
 func verifyChecksum(data []byte, checksum *wrapperspb.Int64Value) (bool, error) {
 	if checksum == nil || checksum.GetValue() == 0 {
 		return false, nil
@@ -1,24 +1,58 @@
 package service_test
 
 import (
+	"bytes"
 	"context"
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/mlkem"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
 	"encoding/asn1"
 	"encoding/pem"
+	"fmt"
+	"hash"
 	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"cloud.google.com/go/iam/apiv1/iampb"
 	"cloud.google.com/go/kms/apiv1/kmspb"
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
 	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/tink-crypto/tink-go/v2/key"
+	"github.com/tink-crypto/tink-go/v2/keyset"
+	"github.com/tink-crypto/tink-go/v2/signature"
+	"github.com/tink-crypto/tink-go/v2/signature/mldsa"
+	"github.com/tink-crypto/tink-go/v2/signature/slhdsa"
+	"google.golang.org/genproto/googleapis/cloud/location"
+	"google.golang.org/genproto/googleapis/type/expr"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 
+	"github.com/winor30/fake-cloud-kms/clock"
 	"github.com/winor30/fake-cloud-kms/crc"
 	"github.com/winor30/fake-cloud-kms/kmscrypto"
+	"github.com/winor30/fake-cloud-kms/operations"
 	"github.com/winor30/fake-cloud-kms/service"
+	"github.com/winor30/fake-cloud-kms/store"
 	"github.com/winor30/fake-cloud-kms/store/memory"
 )
 
@@ -127,12 +161,183 @@ func TestListResources(t *testing.T) {
 		}
 	})
 
-	t.Run("pagination is not implemented", func(t *testing.T) {
+	t.Run("rejects foreign and tampered page tokens", func(t *testing.T) {
 		_, err := svc.ListKeyRings(ctx, &kmspb.ListKeyRingsRequest{Parent: parent, PageToken: "next"})
-		requireStatusCode(t, err, codes.Unimplemented)
+		requireStatusCode(t, err, codes.InvalidArgument)
+
+		first, err := svc.ListCryptoKeys(ctx, &kmspb.ListCryptoKeysRequest{Parent: keyRing, PageSize: 1})
+		if err != nil {
+			t.Fatalf("list crypto keys: %v", err)
+		}
+		token := first.GetNextPageToken()
+		_, err = svc.ListCryptoKeyVersions(ctx, &kmspb.ListCryptoKeyVersionsRequest{Parent: keyA, PageToken: token})
+		requireStatusCode(t, err, codes.InvalidArgument)
+
+		tampered := token[:len(token)-1] + string(token[len(token)-1]^1)
+		_, err = svc.ListCryptoKeys(ctx, &kmspb.ListCryptoKeysRequest{Parent: keyRing, PageToken: tampered})
+		requireStatusCode(t, err, codes.InvalidArgument)
+
+		_, err = svc.ListCryptoKeys(ctx, &kmspb.ListCryptoKeysRequest{Parent: keyRing, PageSize: -1})
+		requireStatusCode(t, err, codes.InvalidArgument)
+	})
+}
+
+func TestListPagination(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc, cryptoKeyName := setupKey(t)
+
+	for range 4 {
+		if _, err := svc.CreateCryptoKeyVersion(ctx, &kmspb.CreateCryptoKeyVersionRequest{Parent: cryptoKeyName}); err != nil {
+			t.Fatalf("create crypto key version: %v", err)
+		}
+	}
+
+	first, err := svc.ListCryptoKeyVersions(ctx, &kmspb.ListCryptoKeyVersionsRequest{Parent: cryptoKeyName, PageSize: 2})
+	if err != nil {
+		t.Fatalf("list first page: %v", err)
+	}
+	if len(first.GetCryptoKeyVersions()) != 2 || first.GetNextPageToken() == "" || first.GetTotalSize() != 5 {
+		t.Fatalf("first page = %d versions, token %q, total %d", len(first.GetCryptoKeyVersions()), first.GetNextPageToken(), first.GetTotalSize())
+	}
+
+	// A version created between pages must not shift the cursor.
+	if _, err := svc.CreateCryptoKeyVersion(ctx, &kmspb.CreateCryptoKeyVersionRequest{Parent: cryptoKeyName}); err != nil {
+		t.Fatalf("create crypto key version: %v", err)
+	}
+
+	var got []string
+	for _, v := range first.GetCryptoKeyVersions() {
+		got = append(got, v.GetName())
+	}
+	token := first.GetNextPageToken()
+	for token != "" {
+		page, err := svc.ListCryptoKeyVersions(ctx, &kmspb.ListCryptoKeyVersionsRequest{Parent: cryptoKeyName, PageSize: 2, PageToken: token})
+		if err != nil {
+			t.Fatalf("list page: %v", err)
+		}
+		for _, v := range page.GetCryptoKeyVersions() {
+			got = append(got, v.GetName())
+		}
+		token = page.GetNextPageToken()
+	}
+
+	if len(got) != 6 {
+		t.Fatalf("paged through %d versions, want 6: %v", len(got), got)
+	}
+	for i, name := range got {
+		if want := cryptoKeyName + "/cryptoKeyVersions/" + strconv.Itoa(i+1); name != want {
+			t.Fatalf("version[%d] = %s, want %s", i, name, want)
+		}
+	}
+}
+
+func TestListFilterAndOrderBy(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc := newTestService()
+	keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "inventory")
+
+	for _, id := range []string{"alpha", "beta", "gamma"} {
+		labels := map[string]string{"env": "dev"}
+		if id != "beta" {
+			labels["env"] = "prod"
+		}
+		if _, err := svc.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+			Parent:      keyRing,
+			CryptoKeyId: id,
+			CryptoKey:   &kmspb.CryptoKey{Purpose: kmspb.CryptoKey_ENCRYPT_DECRYPT, Labels: labels},
+		}); err != nil {
+			t.Fatalf("create crypto key %s: %v", id, err)
+		}
+	}
+	createAsymmetricCryptoKey(t, svc, keyRing, "signer")
+
+	listNames := func(t *testing.T, req *kmspb.ListCryptoKeysRequest) ([]string, *kmspb.ListCryptoKeysResponse) {
+		t.Helper()
+		resp, err := svc.ListCryptoKeys(ctx, req)
+		if err != nil {
+			t.Fatalf("list crypto keys: %v", err)
+		}
+		var got []string
+		for _, ck := range resp.GetCryptoKeys() {
+			got = append(got, ck.GetName()[len(keyRing+"/cryptoKeys/"):])
+		}
+		return got, resp
+	}
+
+	t.Run("filters by label and purpose", func(t *testing.T) {
+		got, resp := listNames(t, &kmspb.ListCryptoKeysRequest{Parent: keyRing, Filter: "labels.env=prod"})
+		if strings.Join(got, ",") != "alpha,gamma" {
+			t.Fatalf("labels filter returned %v", got)
+		}
+		if resp.GetTotalSize() != 0 {
+			t.Fatalf("total_size must be unset with a filter, got %d", resp.GetTotalSize())
+		}
+
+		got, _ = listNames(t, &kmspb.ListCryptoKeysRequest{Parent: keyRing, Filter: "purpose=ASYMMETRIC_SIGN"})
+		if strings.Join(got, ",") != "signer" {
+			t.Fatalf("purpose filter returned %v", got)
+		}
+	})
+
+	t.Run("pages a filter across store batches", func(t *testing.T) {
+		req := &kmspb.ListCryptoKeysRequest{Parent: keyRing, Filter: "labels.env=prod", PageSize: 1}
+		first, resp := listNames(t, req)
+		if strings.Join(first, ",") != "alpha" || resp.GetNextPageToken() == "" {
+			t.Fatalf("first page = %v, token %q", first, resp.GetNextPageToken())
+		}
+		req.PageToken = resp.GetNextPageToken()
+		second, resp := listNames(t, req)
+		if strings.Join(second, ",") != "gamma" || resp.GetNextPageToken() != "" {
+			t.Fatalf("second page = %v, token %q", second, resp.GetNextPageToken())
+		}
+	})
+
+	t.Run("orders and pages descending", func(t *testing.T) {
+		req := &kmspb.ListCryptoKeysRequest{Parent: keyRing, OrderBy: "name desc", PageSize: 3}
+		first, resp := listNames(t, req)
+		if strings.Join(first, ",") != "signer,gamma,beta" || resp.GetTotalSize() != 4 {
+			t.Fatalf("first page = %v, total %d", first, resp.GetTotalSize())
+		}
+		req.PageToken = resp.GetNextPageToken()
+		second, resp := listNames(t, req)
+		if strings.Join(second, ",") != "alpha" || resp.GetNextPageToken() != "" {
+			t.Fatalf("second page = %v, token %q", second, resp.GetNextPageToken())
+		}
+
+		_, err := svc.ListCryptoKeys(ctx, &kmspb.ListCryptoKeysRequest{Parent: keyRing, PageToken: req.GetPageToken()})
+		requireStatusCode(t, err, codes.InvalidArgument)
+	})
+
+	t.Run("filters versions by state", func(t *testing.T) {
+		cryptoKeyName := keyRing + "/cryptoKeys/alpha"
+		if _, err := svc.CreateCryptoKeyVersion(ctx, &kmspb.CreateCryptoKeyVersionRequest{Parent: cryptoKeyName}); err != nil {
+			t.Fatalf("create version: %v", err)
+		}
+		if _, err := svc.DestroyCryptoKeyVersion(ctx, &kmspb.DestroyCryptoKeyVersionRequest{Name: cryptoKeyName + "/cryptoKeyVersions/1"}); err != nil {
+			t.Fatalf("destroy version: %v", err)
+		}
+		resp, err := svc.ListCryptoKeyVersions(ctx, &kmspb.ListCryptoKeyVersionsRequest{Parent: cryptoKeyName, Filter: "state=ENABLED"})
+		if err != nil {
+			t.Fatalf("list versions: %v", err)
+		}
+		if len(resp.GetCryptoKeyVersions()) != 1 || !strings.HasSuffix(resp.GetCryptoKeyVersions()[0].GetName(), "/2") {
+			t.Fatalf("state filter returned %v", resp.GetCryptoKeyVersions())
+		}
+	})
 
-		_, err = svc.ListCryptoKeyVersions(ctx, &kmspb.ListCryptoKeyVersionsRequest{Parent: keyA, PageToken: "token"})
-		requireStatusCode(t, err, codes.Unimplemented)
+	t.Run("rejects invalid expressions", func(t *testing.T) {
+		for _, req := range []*kmspb.ListCryptoKeysRequest{
+			{Parent: keyRing, Filter: "labels.env="},
+			{Parent: keyRing, Filter: "purpose=SIGN"},
+			{Parent: keyRing, OrderBy: "name upward"},
+		} {
+			_, err := svc.ListCryptoKeys(ctx, req)
+			requireStatusCode(t, err, codes.InvalidArgument)
+		}
+		_, err := svc.ListKeyRings(ctx, &kmspb.ListKeyRingsRequest{Parent: "projects/demo/locations/global", Filter: "bogus=1"})
+		requireStatusCode(t, err, codes.InvalidArgument)
 	})
 }
 
@@ -178,6 +383,48 @@ func TestCreateVersionAndUpdatePrimary(t *testing.T) {
 		_, err := svc.UpdateCryptoKeyPrimaryVersion(ctx, &kmspb.UpdateCryptoKeyPrimaryVersionRequest{Name: cryptoKeyName})
 		requireStatusCode(t, err, codes.InvalidArgument)
 	})
+
+	t.Run("rejects a version that is not enabled", func(t *testing.T) {
+		ctx := context.Background()
+		svc, cryptoKeyName := setupKey(t)
+
+		version, err := svc.CreateCryptoKeyVersion(ctx, &kmspb.CreateCryptoKeyVersionRequest{Parent: cryptoKeyName})
+		if err != nil {
+			t.Fatalf("create crypto key version: %v", err)
+		}
+		if _, err := svc.DestroyCryptoKeyVersion(ctx, &kmspb.DestroyCryptoKeyVersionRequest{Name: version.GetName()}); err != nil {
+			t.Fatalf("destroy: %v", err)
+		}
+
+		_, err = svc.UpdateCryptoKeyPrimaryVersion(ctx, &kmspb.UpdateCryptoKeyPrimaryVersionRequest{
+			Name:               cryptoKeyName,
+			CryptoKeyVersionId: "2",
+		})
+		requireStatusCode(t, err, codes.FailedPrecondition)
+	})
+
+	t.Run("rejects keys without a primary version", func(t *testing.T) {
+		ctx := context.Background()
+		svc := newTestService()
+		keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "app")
+		ck, err := svc.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+			Parent:      keyRing,
+			CryptoKeyId: "signer",
+			CryptoKey: &kmspb.CryptoKey{
+				Purpose:         kmspb.CryptoKey_ASYMMETRIC_SIGN,
+				VersionTemplate: &kmspb.CryptoKeyVersionTemplate{Algorithm: kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256},
+			},
+		})
+		if err != nil {
+			t.Fatalf("create crypto key: %v", err)
+		}
+
+		_, err = svc.UpdateCryptoKeyPrimaryVersion(ctx, &kmspb.UpdateCryptoKeyPrimaryVersionRequest{
+			Name:               ck.GetName(),
+			CryptoKeyVersionId: "1",
+		})
+		requireStatusCode(t, err, codes.FailedPrecondition)
+	})
 }
 
 func TestDecryptRejectsCrossKeyCiphertext(t *testing.T) {
@@ -306,7 +553,7 @@ func TestCreateCryptoKeyValidations(t *testing.T) {
 			req: &kmspb.CreateCryptoKeyRequest{
 				Parent:      keyRing,
 				CryptoKeyId: "id",
-				CryptoKey:   &kmspb.CryptoKey{Purpose: kmspb.CryptoKey_ASYMMETRIC_DECRYPT},
+				CryptoKey:   &kmspb.CryptoKey{Purpose: kmspb.CryptoKey_CRYPTO_KEY_PURPOSE_UNSPECIFIED},
 			},
 		},
 		{
@@ -317,7 +564,7 @@ func TestCreateCryptoKeyValidations(t *testing.T) {
 				CryptoKey: &kmspb.CryptoKey{
 					Purpose: kmspb.CryptoKey_ASYMMETRIC_SIGN,
 					VersionTemplate: &kmspb.CryptoKeyVersionTemplate{
-						Algorithm: kmspb.CryptoKeyVersion_RSA_SIGN_PSS_2048_SHA256,
+						Algorithm: kmspb.CryptoKeyVersion_RSA_DECRYPT_OAEP_2048_SHA256,
 					},
 				},
 			},
@@ -520,84 +767,2778 @@ func TestCreateAsymmetricCryptoKeyVersion(t *testing.T) {
 	}
 }
 
-// ---- helpers ----
+func TestDestroyAndRestoreCryptoKeyVersion(t *testing.T) {
+	t.Parallel()
 
-func mustEncrypt(t *testing.T, ctx context.Context, svc service.KMSService, req *kmspb.EncryptRequest) *kmspb.EncryptResponse {
-	t.Helper()
-	resp, err := svc.Encrypt(ctx, req)
-	if err != nil {
-		t.Fatalf("encrypt: %v", err)
-	}
-	return resp
-}
+	t.Run("schedules destruction using the key duration", func(t *testing.T) {
+		ctx := context.Background()
+		clock := newFakeClock()
+		svc := service.New(memory.New(), kmscrypto.NewTinkEngine(), service.WithClock(clock))
+		keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "app")
+		ck, err := svc.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+			Parent:      keyRing,
+			CryptoKeyId: "short",
+			CryptoKey: &kmspb.CryptoKey{
+				Purpose:                  kmspb.CryptoKey_ENCRYPT_DECRYPT,
+				DestroyScheduledDuration: durationpb.New(48 * time.Hour),
+			},
+		})
+		if err != nil {
+			t.Fatalf("create crypto key: %v", err)
+		}
+		versionName := ck.GetName() + "/cryptoKeyVersions/1"
 
-func mustDecrypt(t *testing.T, ctx context.Context, svc service.KMSService, req *kmspb.DecryptRequest) *kmspb.DecryptResponse {
-	t.Helper()
-	resp, err := svc.Decrypt(ctx, req)
-	if err != nil {
-		t.Fatalf("decrypt: %v", err)
-	}
-	return resp
-}
+		destroyed, err := svc.DestroyCryptoKeyVersion(ctx, &kmspb.DestroyCryptoKeyVersionRequest{Name: versionName})
+		if err != nil {
+			t.Fatalf("destroy: %v", err)
+		}
+		if destroyed.GetState() != kmspb.CryptoKeyVersion_DESTROY_SCHEDULED {
+			t.Fatalf("state = %v, want DESTROY_SCHEDULED", destroyed.GetState())
+		}
+		if want := clock.Now().Add(48 * time.Hour); !destroyed.GetDestroyTime().AsTime().Equal(want) {
+			t.Fatalf("destroy_time = %v, want %v", destroyed.GetDestroyTime().AsTime(), want)
+		}
+	})
 
-func requireStatusCode(t *testing.T, err error, code codes.Code) {
-	t.Helper()
-	if status.Code(err) != code {
-		t.Fatalf("status code = %v, want %v", status.Code(err), code)
-	}
-}
+	t.Run("destroys after the deadline", func(t *testing.T) {
+		ctx := context.Background()
+		clock := newFakeClock()
+		svc := service.New(memory.New(), kmscrypto.NewTinkEngine(), service.WithClock(clock))
+		keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "app")
+		cryptoKeyName := createCryptoKey(t, svc, keyRing, "pair")
+		versionName := cryptoKeyName + "/cryptoKeyVersions/1"
+
+		enc := mustEncrypt(t, ctx, svc, &kmspb.EncryptRequest{Name: cryptoKeyName, Plaintext: []byte("secret")})
+		if _, err := svc.DestroyCryptoKeyVersion(ctx, &kmspb.DestroyCryptoKeyVersionRequest{Name: versionName}); err != nil {
+			t.Fatalf("destroy: %v", err)
+		}
 
-func setupKey(t *testing.T) (service.KMSService, string) {
-	t.Helper()
-	svc := newTestService()
-	keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "app")
-	cryptoKey := createCryptoKey(t, svc, keyRing, "pair")
-	return svc, cryptoKey
-}
+		_, err := svc.Encrypt(ctx, &kmspb.EncryptRequest{Name: cryptoKeyName, Plaintext: []byte("secret")})
+		requireStatusCode(t, err, codes.FailedPrecondition)
 
-func setupAsymmetricKey(t *testing.T) (service.KMSService, string) {
-	t.Helper()
-	svc := newTestService()
-	keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "asym")
-	cryptoKeyName := createAsymmetricCryptoKey(t, svc, keyRing, "signer")
-	return svc, cryptoKeyName + "/cryptoKeyVersions/1"
-}
+		clock.Advance(30*24*time.Hour + time.Second)
 
-func newTestService() service.KMSService {
-	return service.New(memory.New(), kmscrypto.NewTinkEngine())
-}
+		version, err := svc.GetCryptoKeyVersion(ctx, &kmspb.GetCryptoKeyVersionRequest{Name: versionName})
+		if err != nil {
+			t.Fatalf("get version: %v", err)
+		}
+		if version.GetState() != kmspb.CryptoKeyVersion_DESTROYED {
+			t.Fatalf("state = %v, want DESTROYED", version.GetState())
+		}
+		if version.GetDestroyEventTime() == nil {
+			t.Fatal("destroy_event_time must be set")
+		}
 
-func createKeyRing(t *testing.T, svc service.KMSService, parent, id string) string {
-	t.Helper()
-	name := parent + "/keyRings/" + id
-	if _, err := svc.CreateKeyRing(context.Background(), &kmspb.CreateKeyRingRequest{Parent: parent, KeyRingId: id}); err != nil {
-		t.Fatalf("create key ring %s: %v", name, err)
-	}
-	return name
+		_, err = svc.Decrypt(ctx, &kmspb.DecryptRequest{Name: cryptoKeyName, Ciphertext: enc.GetCiphertext()})
+		requireStatusCode(t, err, codes.FailedPrecondition)
+
+		_, err = svc.RestoreCryptoKeyVersion(ctx, &kmspb.RestoreCryptoKeyVersionRequest{Name: versionName})
+		requireStatusCode(t, err, codes.FailedPrecondition)
+	})
+
+	t.Run("destroys as soon as a virtual clock jumps", func(t *testing.T) {
+		ctx := context.Background()
+		virtual := clock.NewVirtual(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		virtual.Freeze()
+		st := memory.New()
+		svc := service.New(st, kmscrypto.NewTinkEngine(), service.WithClock(virtual))
+		defer svc.Close()
+		keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "app")
+		cryptoKeyName := createCryptoKey(t, svc, keyRing, "pair")
+		versionName := cryptoKeyName + "/cryptoKeyVersions/1"
+		if _, err := svc.DestroyCryptoKeyVersion(ctx, &kmspb.DestroyCryptoKeyVersionRequest{Name: versionName}); err != nil {
+			t.Fatalf("destroy: %v", err)
+		}
+
+		if err := virtual.Advance(30*24*time.Hour + time.Second); err != nil {
+			t.Fatalf("advance: %v", err)
+		}
+		// The store is read directly, so nothing settles the version lazily.
+		stored, material, err := st.GetCryptoKeyVersion(ctx, versionName)
+		if err != nil {
+			t.Fatalf("get stored version: %v", err)
+		}
+		if stored.GetState() != kmspb.CryptoKeyVersion_DESTROYED || len(material) != 0 {
+			t.Fatalf("stored version is %v with %d bytes of key material, want DESTROYED without material", stored.GetState(), len(material))
+		}
+
+		listed, err := svc.ListCryptoKeyVersions(ctx, &kmspb.ListCryptoKeyVersionsRequest{Parent: cryptoKeyName})
+		if err != nil {
+			t.Fatalf("list versions: %v", err)
+		}
+		if len(listed.GetCryptoKeyVersions()) != 1 || listed.GetCryptoKeyVersions()[0].GetState() != kmspb.CryptoKeyVersion_DESTROYED {
+			t.Fatalf("listed versions = %v, want version 1 DESTROYED", listed.GetCryptoKeyVersions())
+		}
+	})
+
+	t.Run("restore returns version to DISABLED", func(t *testing.T) {
+		ctx := context.Background()
+		svc, versionName := setupAsymmetricKey(t)
+
+		if _, err := svc.DestroyCryptoKeyVersion(ctx, &kmspb.DestroyCryptoKeyVersionRequest{Name: versionName}); err != nil {
+			t.Fatalf("destroy: %v", err)
+		}
+		_, err := svc.DestroyCryptoKeyVersion(ctx, &kmspb.DestroyCryptoKeyVersionRequest{Name: versionName})
+		requireStatusCode(t, err, codes.FailedPrecondition)
+
+		restored, err := svc.RestoreCryptoKeyVersion(ctx, &kmspb.RestoreCryptoKeyVersionRequest{Name: versionName})
+		if err != nil {
+			t.Fatalf("restore: %v", err)
+		}
+		if restored.GetState() != kmspb.CryptoKeyVersion_DISABLED || restored.GetDestroyTime() != nil {
+			t.Fatalf("restored version = %v", restored)
+		}
+
+		digest := sha256.Sum256([]byte("disabled"))
+		_, err = svc.AsymmetricSign(ctx, &kmspb.AsymmetricSignRequest{
+			Name:   versionName,
+			Digest: &kmspb.Digest{Digest: &kmspb.Digest_Sha256{Sha256: digest[:]}},
+		})
+		requireStatusCode(t, err, codes.FailedPrecondition)
+	})
+
+	t.Run("rejects out of range destroy_scheduled_duration", func(t *testing.T) {
+		ctx := context.Background()
+		svc := newTestService()
+		keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "app")
+		_, err := svc.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+			Parent:      keyRing,
+			CryptoKeyId: "bad",
+			CryptoKey: &kmspb.CryptoKey{
+				Purpose:                  kmspb.CryptoKey_ENCRYPT_DECRYPT,
+				DestroyScheduledDuration: durationpb.New(time.Hour),
+			},
+		})
+		requireStatusCode(t, err, codes.InvalidArgument)
+	})
 }
 
-func createCryptoKey(t *testing.T, svc service.KMSService, keyRingName, id string) string {
-	t.Helper()
-	name := keyRingName + "/cryptoKeys/" + id
-	if _, err := svc.CreateCryptoKey(context.Background(), &kmspb.CreateCryptoKeyRequest{
-		Parent:      keyRingName,
-		CryptoKeyId: id,
-		CryptoKey: &kmspb.CryptoKey{
-			Purpose: kmspb.CryptoKey_ENCRYPT_DECRYPT,
-		},
-	}); err != nil {
-		t.Fatalf("create crypto key %s: %v", name, err)
-	}
-	return name
+func TestConcurrentVersionStateChanges(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	stateMask := &fieldmaskpb.FieldMask{Paths: []string{"state"}}
+
+	t.Run("restore racing a due destruction", func(t *testing.T) {
+		clock := newFakeClock()
+		st := &hookedStore{Store: memory.New()}
+		svc := service.New(st, kmscrypto.NewTinkEngine(), service.WithClock(clock))
+		keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "app")
+		versionName := createCryptoKey(t, svc, keyRing, "pair") + "/cryptoKeyVersions/1"
+		if _, err := svc.DestroyCryptoKeyVersion(ctx, &kmspb.DestroyCryptoKeyVersionRequest{Name: versionName}); err != nil {
+			t.Fatalf("destroy: %v", err)
+		}
+
+		// Once Restore has checked the version, let the destruction fall due and
+		// give a concurrent read the chance to complete it before the write.
+		var once sync.Once
+		st.beforeUpdateCryptoKeyVersion = func() {
+			once.Do(func() {
+				clock.Advance(31 * 24 * time.Hour)
+				read := make(chan struct{})
+				go func() {
+					defer close(read)
+					_, _ = svc.GetCryptoKeyVersion(ctx, &kmspb.GetCryptoKeyVersionRequest{Name: versionName})
+				}()
+				select {
+				case <-read:
+				case <-time.After(100 * time.Millisecond):
+				}
+			})
+		}
+		restored, err := svc.RestoreCryptoKeyVersion(ctx, &kmspb.RestoreCryptoKeyVersionRequest{Name: versionName})
+		if err != nil {
+			t.Fatalf("restore: %v", err)
+		}
+		if restored.GetState() != kmspb.CryptoKeyVersion_DISABLED {
+			t.Fatalf("state = %v, want DISABLED", restored.GetState())
+		}
+		requireConsistentVersion(t, st, versionName)
+	})
+
+	t.Run("state update racing a destroy", func(t *testing.T) {
+		st := &hookedStore{Store: memory.New()}
+		svc := service.New(st, kmscrypto.NewTinkEngine())
+		keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "app")
+		versionName := createCryptoKey(t, svc, keyRing, "pair") + "/cryptoKeyVersions/1"
+
+		// Give a destroy the chance to run between the update's check and its write.
+		destroyed := make(chan error, 1)
+		var hooked atomic.Bool
+		st.beforeUpdateCryptoKeyVersion = func() {
+			if hooked.Swap(true) {
+				return
+			}
+			go func() {
+				_, err := svc.DestroyCryptoKeyVersion(ctx, &kmspb.DestroyCryptoKeyVersionRequest{Name: versionName})
+				destroyed <- err
+			}()
+			select {
+			case err := <-destroyed:
+				destroyed <- err
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+		if _, err := svc.UpdateCryptoKeyVersion(ctx, &kmspb.UpdateCryptoKeyVersionRequest{
+			CryptoKeyVersion: &kmspb.CryptoKeyVersion{Name: versionName, State: kmspb.CryptoKeyVersion_DISABLED},
+			UpdateMask:       stateMask,
+		}); err != nil {
+			t.Fatalf("disable: %v", err)
+		}
+		if err := <-destroyed; err != nil {
+			t.Fatalf("destroy: %v", err)
+		}
+		got, err := svc.GetCryptoKeyVersion(ctx, &kmspb.GetCryptoKeyVersionRequest{Name: versionName})
+		if err != nil {
+			t.Fatalf("get version: %v", err)
+		}
+		if got.GetState() != kmspb.CryptoKeyVersion_DESTROY_SCHEDULED {
+			t.Fatalf("state = %v, want the destroy to stick", got.GetState())
+		}
+		requireConsistentVersion(t, st, versionName)
+	})
+
+	t.Run("destroy, restore, update and get", func(t *testing.T) {
+		clock := newFakeClock()
+		st := memory.New()
+		svc := service.New(st, kmscrypto.NewTinkEngine(), service.WithClock(clock))
+		keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "app")
+		for i := range 20 {
+			versionName := createCryptoKey(t, svc, keyRing, fmt.Sprintf("key-%d", i)) + "/cryptoKeyVersions/1"
+			if _, err := svc.DestroyCryptoKeyVersion(ctx, &kmspb.DestroyCryptoKeyVersionRequest{Name: versionName}); err != nil {
+				t.Fatalf("destroy: %v", err)
+			}
+			var wg sync.WaitGroup
+			for _, call := range []func(){
+				func() { clock.Advance(31 * 24 * time.Hour) },
+				func() {
+					_, _ = svc.RestoreCryptoKeyVersion(ctx, &kmspb.RestoreCryptoKeyVersionRequest{Name: versionName})
+				},
+				func() { _, _ = svc.GetCryptoKeyVersion(ctx, &kmspb.GetCryptoKeyVersionRequest{Name: versionName}) },
+				func() {
+					_, _ = svc.DestroyCryptoKeyVersion(ctx, &kmspb.DestroyCryptoKeyVersionRequest{Name: versionName})
+				},
+				func() {
+					_, _ = svc.UpdateCryptoKeyVersion(ctx, &kmspb.UpdateCryptoKeyVersionRequest{
+						CryptoKeyVersion: &kmspb.CryptoKeyVersion{Name: versionName, State: kmspb.CryptoKeyVersion_ENABLED},
+						UpdateMask:       stateMask,
+					})
+				},
+			} {
+				wg.Go(call)
+			}
+			wg.Wait()
+			requireConsistentVersion(t, st, versionName)
+		}
+	})
 }
 
-func createAsymmetricCryptoKey(t *testing.T, svc service.KMSService, keyRingName, id string) string {
-	t.Helper()
-	name := keyRingName + "/cryptoKeys/" + id
-	if _, err := svc.CreateCryptoKey(context.Background(), &kmspb.CreateCryptoKeyRequest{
-		Parent:      keyRingName,
-		CryptoKeyId: id,
-		CryptoKey: &kmspb.CryptoKey{
+func TestUpdateCryptoKeyVersionState(t *testing.T) {
+	t.Parallel()
+	stateMask := &fieldmaskpb.FieldMask{Paths: []string{"state"}}
+
+	t.Run("disabled primary rejects encrypt until re-enabled", func(t *testing.T) {
+		ctx := context.Background()
+		svc, cryptoKeyName := setupKey(t)
+		versionName := cryptoKeyName + "/cryptoKeyVersions/1"
+
+		updated, err := svc.UpdateCryptoKeyVersion(ctx, &kmspb.UpdateCryptoKeyVersionRequest{
+			CryptoKeyVersion: &kmspb.CryptoKeyVersion{Name: versionName, State: kmspb.CryptoKeyVersion_DISABLED},
+			UpdateMask:       stateMask,
+		})
+		if err != nil {
+			t.Fatalf("disable: %v", err)
+		}
+		if updated.GetState() != kmspb.CryptoKeyVersion_DISABLED {
+			t.Fatalf("state = %v, want DISABLED", updated.GetState())
+		}
+
+		ck, err := svc.GetCryptoKey(ctx, &kmspb.GetCryptoKeyRequest{Name: cryptoKeyName})
+		if err != nil {
+			t.Fatalf("get crypto key: %v", err)
+		}
+		if ck.GetPrimary().GetState() != kmspb.CryptoKeyVersion_DISABLED {
+			t.Fatalf("primary state = %v, want DISABLED", ck.GetPrimary().GetState())
+		}
+
+		_, err = svc.Encrypt(ctx, &kmspb.EncryptRequest{Name: cryptoKeyName, Plaintext: []byte("x")})
+		requireStatusCode(t, err, codes.FailedPrecondition)
+
+		if _, err := svc.UpdateCryptoKeyVersion(ctx, &kmspb.UpdateCryptoKeyVersionRequest{
+			CryptoKeyVersion: &kmspb.CryptoKeyVersion{Name: versionName, State: kmspb.CryptoKeyVersion_ENABLED},
+			UpdateMask:       stateMask,
+		}); err != nil {
+			t.Fatalf("enable: %v", err)
+		}
+		mustEncrypt(t, ctx, svc, &kmspb.EncryptRequest{Name: cryptoKeyName, Plaintext: []byte("x")})
+	})
+
+	t.Run("disabled version rejects GetPublicKey", func(t *testing.T) {
+		ctx := context.Background()
+		svc, versionName := setupAsymmetricKey(t)
+
+		if _, err := svc.UpdateCryptoKeyVersion(ctx, &kmspb.UpdateCryptoKeyVersionRequest{
+			CryptoKeyVersion: &kmspb.CryptoKeyVersion{Name: versionName, State: kmspb.CryptoKeyVersion_DISABLED},
+			UpdateMask:       stateMask,
+		}); err != nil {
+			t.Fatalf("disable: %v", err)
+		}
+		_, err := svc.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: versionName})
+		requireStatusCode(t, err, codes.FailedPrecondition)
+	})
+
+	t.Run("validates mask and transitions", func(t *testing.T) {
+		ctx := context.Background()
+		svc, cryptoKeyName := setupKey(t)
+		versionName := cryptoKeyName + "/cryptoKeyVersions/1"
+
+		for _, tc := range []struct {
+			name string
+			req  *kmspb.UpdateCryptoKeyVersionRequest
+			want codes.Code
+		}{
+			{
+				name: "missing mask",
+				req: &kmspb.UpdateCryptoKeyVersionRequest{
+					CryptoKeyVersion: &kmspb.CryptoKeyVersion{Name: versionName, State: kmspb.CryptoKeyVersion_DISABLED},
+				},
+				want: codes.InvalidArgument,
+			},
+			{
+				name: "unsupported path",
+				req: &kmspb.UpdateCryptoKeyVersionRequest{
+					CryptoKeyVersion: &kmspb.CryptoKeyVersion{Name: versionName},
+					UpdateMask:       &fieldmaskpb.FieldMask{Paths: []string{"algorithm"}},
+				},
+				want: codes.InvalidArgument,
+			},
+			{
+				name: "target state not allowed",
+				req: &kmspb.UpdateCryptoKeyVersionRequest{
+					CryptoKeyVersion: &kmspb.CryptoKeyVersion{Name: versionName, State: kmspb.CryptoKeyVersion_DESTROYED},
+					UpdateMask:       stateMask,
+				},
+				want: codes.InvalidArgument,
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				_, err := svc.UpdateCryptoKeyVersion(ctx, tc.req)
+				requireStatusCode(t, err, tc.want)
+			})
+		}
+
+		if _, err := svc.DestroyCryptoKeyVersion(ctx, &kmspb.DestroyCryptoKeyVersionRequest{Name: versionName}); err != nil {
+			t.Fatalf("destroy: %v", err)
+		}
+		_, err := svc.UpdateCryptoKeyVersion(ctx, &kmspb.UpdateCryptoKeyVersionRequest{
+			CryptoKeyVersion: &kmspb.CryptoKeyVersion{Name: versionName, State: kmspb.CryptoKeyVersion_ENABLED},
+			UpdateMask:       stateMask,
+		})
+		requireStatusCode(t, err, codes.FailedPrecondition)
+	})
+}
+
+func TestUpdateCryptoKey(t *testing.T) {
+	t.Parallel()
+
+	t.Run("applies masked fields only", func(t *testing.T) {
+		ctx := context.Background()
+		svc, cryptoKeyName := setupKey(t)
+		nextRotation := timestamppb.New(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+
+		updated, err := svc.UpdateCryptoKey(ctx, &kmspb.UpdateCryptoKeyRequest{
+			CryptoKey: &kmspb.CryptoKey{
+				Name:             cryptoKeyName,
+				Labels:           map[string]string{"env": "prod"},
+				RotationSchedule: &kmspb.CryptoKey_RotationPeriod{RotationPeriod: durationpb.New(90 * 24 * time.Hour)},
+				NextRotationTime: nextRotation,
+				Purpose:          kmspb.CryptoKey_ASYMMETRIC_SIGN,
+			},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"labels", "rotation_period", "next_rotation_time"}},
+		})
+		if err != nil {
+			t.Fatalf("update crypto key: %v", err)
+		}
+
+		stored, err := svc.GetCryptoKey(ctx, &kmspb.GetCryptoKeyRequest{Name: cryptoKeyName})
+		if err != nil {
+			t.Fatalf("get crypto key: %v", err)
+		}
+		for _, ck := range []*kmspb.CryptoKey{updated, stored} {
+			if ck.GetLabels()["env"] != "prod" {
+				t.Fatalf("labels = %v, want env=prod", ck.GetLabels())
+			}
+			if ck.GetRotationPeriod().AsDuration() != 90*24*time.Hour {
+				t.Fatalf("rotation_period = %v", ck.GetRotationPeriod())
+			}
+			if !ck.GetNextRotationTime().AsTime().Equal(nextRotation.AsTime()) {
+				t.Fatalf("next_rotation_time = %v", ck.GetNextRotationTime())
+			}
+			if ck.GetPurpose() != kmspb.CryptoKey_ENCRYPT_DECRYPT {
+				t.Fatalf("purpose changed outside the mask: %v", ck.GetPurpose())
+			}
+			if ck.GetPrimary().GetName() != cryptoKeyName+"/cryptoKeyVersions/1" {
+				t.Fatalf("primary lost after update: %v", ck.GetPrimary())
+			}
+		}
+	})
+
+	t.Run("rejects algorithm incompatible with purpose", func(t *testing.T) {
+		ctx := context.Background()
+		svc, cryptoKeyName := setupKey(t)
+
+		_, err := svc.UpdateCryptoKey(ctx, &kmspb.UpdateCryptoKeyRequest{
+			CryptoKey: &kmspb.CryptoKey{
+				Name:            cryptoKeyName,
+				VersionTemplate: &kmspb.CryptoKeyVersionTemplate{Algorithm: kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256},
+			},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"version_template.algorithm"}},
+		})
+		requireStatusCode(t, err, codes.InvalidArgument)
+	})
+
+	t.Run("rejects invalid masks", func(t *testing.T) {
+		ctx := context.Background()
+		svc, cryptoKeyName := setupKey(t)
+
+		for _, paths := range [][]string{nil, {"purpose"}, {"destroy_scheduled_duration"}, {"unknown_field"}} {
+			_, err := svc.UpdateCryptoKey(ctx, &kmspb.UpdateCryptoKeyRequest{
+				CryptoKey:  &kmspb.CryptoKey{Name: cryptoKeyName},
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: paths},
+			})
+			requireStatusCode(t, err, codes.InvalidArgument)
+		}
+	})
+}
+
+func TestAutomaticRotation(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const period = 30 * 24 * time.Hour
+
+	t.Run("rotates when next_rotation_time passes", func(t *testing.T) {
+		clock := newFakeClock()
+		start := clock.Now()
+		svc := service.New(memory.New(), kmscrypto.NewTinkEngine(), service.WithClock(clock))
+		keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "app")
+
+		ck, err := svc.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+			Parent:      keyRing,
+			CryptoKeyId: "rotating",
+			CryptoKey: &kmspb.CryptoKey{
+				Purpose:          kmspb.CryptoKey_ENCRYPT_DECRYPT,
+				RotationSchedule: &kmspb.CryptoKey_RotationPeriod{RotationPeriod: durationpb.New(period)},
+			},
+		})
+		if err != nil {
+			t.Fatalf("create crypto key: %v", err)
+		}
+		if !ck.GetNextRotationTime().AsTime().Equal(start.Add(period)) {
+			t.Fatalf("next_rotation_time = %v, want %v", ck.GetNextRotationTime().AsTime(), start.Add(period))
+		}
+
+		requirePrimary := func(t *testing.T, wantVersion string, wantNext time.Time) {
+			t.Helper()
+			got, err := svc.GetCryptoKey(ctx, &kmspb.GetCryptoKeyRequest{Name: ck.GetName()})
+			if err != nil {
+				t.Fatalf("get crypto key: %v", err)
+			}
+			if got.GetPrimary().GetName() != ck.GetName()+"/cryptoKeyVersions/"+wantVersion {
+				t.Fatalf("primary = %s, want version %s", got.GetPrimary().GetName(), wantVersion)
+			}
+			if !got.GetNextRotationTime().AsTime().Equal(wantNext) {
+				t.Fatalf("next_rotation_time = %v, want %v", got.GetNextRotationTime().AsTime(), wantNext)
+			}
+		}
+
+		clock.Advance(period - time.Second)
+		if err := svc.RotateDueKeys(ctx); err != nil {
+			t.Fatalf("rotate: %v", err)
+		}
+		requirePrimary(t, "1", start.Add(period))
+
+		clock.Advance(time.Second)
+		if err := svc.RotateDueKeys(ctx); err != nil {
+			t.Fatalf("rotate: %v", err)
+		}
+		requirePrimary(t, "2", start.Add(2*period))
+		resp, err := svc.Encrypt(ctx, &kmspb.EncryptRequest{Name: ck.GetName(), Plaintext: []byte("secret")})
+		if err != nil {
+			t.Fatalf("encrypt: %v", err)
+		}
+		if resp.GetName() != ck.GetName()+"/cryptoKeyVersions/2" {
+			t.Fatalf("encrypted with %s, want the rotated version", resp.GetName())
+		}
+
+		// Several missed periods yield one new version.
+		clock.Advance(3 * period)
+		if err := svc.RotateDueKeys(ctx); err != nil {
+			t.Fatalf("rotate: %v", err)
+		}
+		requirePrimary(t, "3", start.Add(5*period))
+	})
+
+	t.Run("rotates as soon as a virtual clock jumps", func(t *testing.T) {
+		virtual := clock.NewVirtual(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		virtual.Freeze()
+		svc := service.New(memory.New(), kmscrypto.NewTinkEngine(), service.WithClock(virtual))
+		keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "app")
+		ck, err := svc.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+			Parent:      keyRing,
+			CryptoKeyId: "rotating",
+			CryptoKey: &kmspb.CryptoKey{
+				Purpose:          kmspb.CryptoKey_ENCRYPT_DECRYPT,
+				RotationSchedule: &kmspb.CryptoKey_RotationPeriod{RotationPeriod: durationpb.New(period)},
+			},
+		})
+		if err != nil {
+			t.Fatalf("create crypto key: %v", err)
+		}
+
+		if err := virtual.Advance(period); err != nil {
+			t.Fatalf("advance: %v", err)
+		}
+		got, err := svc.GetCryptoKey(ctx, &kmspb.GetCryptoKeyRequest{Name: ck.GetName()})
+		if err != nil {
+			t.Fatalf("get crypto key: %v", err)
+		}
+		if got.GetPrimary().GetName() != ck.GetName()+"/cryptoKeyVersions/2" {
+			t.Fatalf("primary = %s, want version 2", got.GetPrimary().GetName())
+		}
+		if !got.GetPrimary().GetCreateTime().AsTime().Equal(virtual.Now()) {
+			t.Fatalf("create_time = %v, want the virtual time %v", got.GetPrimary().GetCreateTime().AsTime(), virtual.Now())
+		}
+	})
+
+	t.Run("one-off next_rotation_time without a period", func(t *testing.T) {
+		clock := newFakeClock()
+		svc := service.New(memory.New(), kmscrypto.NewTinkEngine(), service.WithClock(clock))
+		keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "app")
+		cryptoKeyName := createCryptoKey(t, svc, keyRing, "once")
+
+		if _, err := svc.UpdateCryptoKey(ctx, &kmspb.UpdateCryptoKeyRequest{
+			CryptoKey:  &kmspb.CryptoKey{Name: cryptoKeyName, NextRotationTime: timestamppb.New(clock.Now().Add(time.Hour))},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"next_rotation_time"}},
+		}); err != nil {
+			t.Fatalf("update crypto key: %v", err)
+		}
+		clock.Advance(time.Hour)
+		if err := svc.RotateDueKeys(ctx); err != nil {
+			t.Fatalf("rotate: %v", err)
+		}
+		got, err := svc.GetCryptoKey(ctx, &kmspb.GetCryptoKeyRequest{Name: cryptoKeyName})
+		if err != nil {
+			t.Fatalf("get crypto key: %v", err)
+		}
+		if got.GetPrimary().GetName() != cryptoKeyName+"/cryptoKeyVersions/2" || got.GetNextRotationTime() != nil {
+			t.Fatalf("primary = %s, next_rotation_time = %v; want version 2 and no further rotation", got.GetPrimary().GetName(), got.GetNextRotationTime())
+		}
+	})
+
+	t.Run("rotates keys already in the store", func(t *testing.T) {
+		clock := newFakeClock()
+		st := memory.New()
+		writer := service.New(st, kmscrypto.NewTinkEngine(), service.WithClock(clock))
+		keyRing := createKeyRing(t, writer, "projects/demo/locations/global", "app")
+		ck, err := writer.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+			Parent:      keyRing,
+			CryptoKeyId: "rotating",
+			CryptoKey: &kmspb.CryptoKey{
+				Purpose:          kmspb.CryptoKey_ENCRYPT_DECRYPT,
+				RotationSchedule: &kmspb.CryptoKey_RotationPeriod{RotationPeriod: durationpb.New(period)},
+			},
+		})
+		if err != nil {
+			t.Fatalf("create crypto key: %v", err)
+		}
+
+		svc := service.New(st, kmscrypto.NewTinkEngine(), service.WithClock(clock))
+		clock.Advance(period)
+		if err := svc.RotateDueKeys(ctx); err != nil {
+			t.Fatalf("rotate: %v", err)
+		}
+		got, err := svc.GetCryptoKey(ctx, &kmspb.GetCryptoKeyRequest{Name: ck.GetName()})
+		if err != nil {
+			t.Fatalf("get crypto key: %v", err)
+		}
+		if got.GetPrimary().GetName() != ck.GetName()+"/cryptoKeyVersions/2" {
+			t.Fatalf("primary = %s, want version 2", got.GetPrimary().GetName())
+		}
+	})
+
+	t.Run("label update while a rotation is due", func(t *testing.T) {
+		clock := newFakeClock()
+		start := clock.Now()
+		st := &hookedStore{Store: memory.New()}
+		svc := service.New(st, kmscrypto.NewTinkEngine(), service.WithClock(clock))
+		keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "app")
+		ck, err := svc.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+			Parent:      keyRing,
+			CryptoKeyId: "rotating",
+			CryptoKey: &kmspb.CryptoKey{
+				Purpose:          kmspb.CryptoKey_ENCRYPT_DECRYPT,
+				RotationSchedule: &kmspb.CryptoKey_RotationPeriod{RotationPeriod: durationpb.New(period)},
+			},
+		})
+		if err != nil {
+			t.Fatalf("create crypto key: %v", err)
+		}
+		clock.Advance(period)
+
+		// Start the rotation after UpdateCryptoKey has read the key and give it
+		// the chance to finish before the update writes the key back.
+		rotated := make(chan error, 1)
+		var once sync.Once
+		st.afterGetCryptoKey = func() {
+			once.Do(func() {
+				go func() { rotated <- svc.RotateDueKeys(ctx) }()
+				select {
+				case err := <-rotated:
+					rotated <- err
+				case <-time.After(100 * time.Millisecond):
+				}
+			})
+		}
+		if _, err := svc.UpdateCryptoKey(ctx, &kmspb.UpdateCryptoKeyRequest{
+			CryptoKey:  &kmspb.CryptoKey{Name: ck.GetName(), Labels: map[string]string{"team": "payments"}},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"labels"}},
+		}); err != nil {
+			t.Fatalf("update crypto key: %v", err)
+		}
+		if err := <-rotated; err != nil {
+			t.Fatalf("rotate: %v", err)
+		}
+		if err := svc.RotateDueKeys(ctx); err != nil {
+			t.Fatalf("rotate: %v", err)
+		}
+
+		got, err := svc.GetCryptoKey(ctx, &kmspb.GetCryptoKeyRequest{Name: ck.GetName()})
+		if err != nil {
+			t.Fatalf("get crypto key: %v", err)
+		}
+		if got.GetPrimary().GetName() != ck.GetName()+"/cryptoKeyVersions/2" {
+			t.Fatalf("primary = %s, want a single rotation to version 2", got.GetPrimary().GetName())
+		}
+		if !got.GetNextRotationTime().AsTime().Equal(start.Add(2 * period)) {
+			t.Fatalf("next_rotation_time = %v, want %v", got.GetNextRotationTime().AsTime(), start.Add(2*period))
+		}
+		if got.GetLabels()["team"] != "payments" {
+			t.Fatalf("labels = %v, want the update applied", got.GetLabels())
+		}
+	})
+
+	t.Run("validates the schedule", func(t *testing.T) {
+		svc := newTestService()
+		keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "app")
+		cases := map[string]*kmspb.CryptoKey{
+			"period under a day": {
+				Purpose:          kmspb.CryptoKey_ENCRYPT_DECRYPT,
+				RotationSchedule: &kmspb.CryptoKey_RotationPeriod{RotationPeriod: durationpb.New(time.Hour)},
+			},
+			"period over 100 years": {
+				Purpose:          kmspb.CryptoKey_ENCRYPT_DECRYPT,
+				RotationSchedule: &kmspb.CryptoKey_RotationPeriod{RotationPeriod: durationpb.New(876001 * time.Hour)},
+			},
+			"asymmetric key": {
+				Purpose:          kmspb.CryptoKey_ASYMMETRIC_SIGN,
+				VersionTemplate:  &kmspb.CryptoKeyVersionTemplate{Algorithm: kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256},
+				RotationSchedule: &kmspb.CryptoKey_RotationPeriod{RotationPeriod: durationpb.New(period)},
+			},
+		}
+		for name, ck := range cases {
+			_, err := svc.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{Parent: keyRing, CryptoKeyId: "bad", CryptoKey: ck})
+			if status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("%s: code = %v, want InvalidArgument", name, status.Code(err))
+			}
+		}
+
+		signer := createSigningKey(t, svc, keyRing, "signer", kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256)
+		_, err := svc.UpdateCryptoKey(ctx, &kmspb.UpdateCryptoKeyRequest{
+			CryptoKey: &kmspb.CryptoKey{
+				Name:             strings.TrimSuffix(signer, "/cryptoKeyVersions/1"),
+				RotationSchedule: &kmspb.CryptoKey_RotationPeriod{RotationPeriod: durationpb.New(period)},
+			},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"rotation_period"}},
+		})
+		requireStatusCode(t, err, codes.InvalidArgument)
+	})
+}
+
+func TestVersionViewAndAttestation(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clock := newFakeClock()
+	svc := service.New(memory.New(), kmscrypto.NewTinkEngine(), service.WithClock(clock))
+	keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "app")
+
+	ck, err := svc.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+		Parent:      keyRing,
+		CryptoKeyId: "hsm",
+		CryptoKey: &kmspb.CryptoKey{
+			Purpose: kmspb.CryptoKey_ENCRYPT_DECRYPT,
+			VersionTemplate: &kmspb.CryptoKeyVersionTemplate{
+				ProtectionLevel: kmspb.ProtectionLevel_HSM,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("create HSM crypto key: %v", err)
+	}
+	if ck.GetPrimary().GetProtectionLevel() != kmspb.ProtectionLevel_HSM {
+		t.Fatalf("protection level = %v, want HSM", ck.GetPrimary().GetProtectionLevel())
+	}
+	if _, err := svc.CreateCryptoKeyVersion(ctx, &kmspb.CreateCryptoKeyVersionRequest{Parent: ck.GetName()}); err != nil {
+		t.Fatalf("create version: %v", err)
+	}
+	softwareKey := createCryptoKey(t, svc, keyRing, "software")
+
+	version, err := svc.GetCryptoKeyVersion(ctx, &kmspb.GetCryptoKeyVersionRequest{Name: ck.GetName() + "/cryptoKeyVersions/2"})
+	if err != nil {
+		t.Fatalf("get version: %v", err)
+	}
+	if version.GetAttestation().GetFormat() != kmspb.KeyOperationAttestation_CAVIUM_V2_COMPRESSED || len(version.GetAttestation().GetContent()) == 0 {
+		t.Fatalf("attestation = %v, want CAVIUM_V2_COMPRESSED content", version.GetAttestation())
+	}
+
+	listVersions := func(parent string, view kmspb.CryptoKeyVersion_CryptoKeyVersionView) []*kmspb.CryptoKeyVersion {
+		t.Helper()
+		resp, err := svc.ListCryptoKeyVersions(ctx, &kmspb.ListCryptoKeyVersionsRequest{Parent: parent, View: view})
+		if err != nil {
+			t.Fatalf("list versions: %v", err)
+		}
+		return resp.GetCryptoKeyVersions()
+	}
+	full := listVersions(ck.GetName(), kmspb.CryptoKeyVersion_FULL)
+	for _, v := range full {
+		if v.GetAttestation() == nil {
+			t.Fatalf("FULL view omitted attestation of %s", v.GetName())
+		}
+	}
+	// The placeholder content is recorded once per version and differs between versions.
+	if !bytes.Equal(full[1].GetAttestation().GetContent(), version.GetAttestation().GetContent()) {
+		t.Fatal("attestation content changed between reads")
+	}
+	if bytes.Equal(full[0].GetAttestation().GetContent(), full[1].GetAttestation().GetContent()) {
+		t.Fatal("versions share attestation content")
+	}
+	for _, v := range listVersions(ck.GetName(), kmspb.CryptoKeyVersion_CRYPTO_KEY_VERSION_VIEW_UNSPECIFIED) {
+		if v.GetAttestation() != nil {
+			t.Fatalf("BASIC view included attestation of %s", v.GetName())
+		}
+	}
+	for _, v := range listVersions(softwareKey, kmspb.CryptoKeyVersion_FULL) {
+		if v.GetAttestation() != nil {
+			t.Fatalf("software version %s has an attestation", v.GetName())
+		}
+	}
+
+	keys, err := svc.ListCryptoKeys(ctx, &kmspb.ListCryptoKeysRequest{Parent: keyRing, VersionView: kmspb.CryptoKeyVersion_FULL})
+	if err != nil {
+		t.Fatalf("list keys: %v", err)
+	}
+	if keys.GetCryptoKeys()[0].GetPrimary().GetAttestation() == nil {
+		t.Fatal("FULL version_view omitted primary attestation")
+	}
+	keys, err = svc.ListCryptoKeys(ctx, &kmspb.ListCryptoKeysRequest{Parent: keyRing})
+	if err != nil {
+		t.Fatalf("list keys: %v", err)
+	}
+	if keys.GetCryptoKeys()[0].GetPrimary().GetAttestation() != nil {
+		t.Fatal("BASIC version_view included primary attestation")
+	}
+
+	// Destroyed versions remain listed but no longer carry an attestation.
+	if _, err := svc.DestroyCryptoKeyVersion(ctx, &kmspb.DestroyCryptoKeyVersionRequest{Name: version.GetName()}); err != nil {
+		t.Fatalf("destroy: %v", err)
+	}
+	clock.Advance(31 * 24 * time.Hour)
+	versions := listVersions(ck.GetName(), kmspb.CryptoKeyVersion_FULL)
+	if len(versions) != 2 {
+		t.Fatalf("listed %d versions, want 2", len(versions))
+	}
+	if versions[1].GetState() != kmspb.CryptoKeyVersion_DESTROYED || versions[1].GetAttestation() != nil {
+		t.Fatalf("destroyed version = %v", versions[1])
+	}
+
+	_, err = svc.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+		Parent:      keyRing,
+		CryptoKeyId: "external",
+		CryptoKey: &kmspb.CryptoKey{
+			Purpose: kmspb.CryptoKey_ENCRYPT_DECRYPT,
+			VersionTemplate: &kmspb.CryptoKeyVersionTemplate{
+				ProtectionLevel: kmspb.ProtectionLevel_EXTERNAL,
+			},
+		},
+	})
+	requireStatusCode(t, err, codes.InvalidArgument)
+}
+
+func TestMacSignAndVerify(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc := newTestService()
+	keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "app")
+
+	for _, algorithm := range []kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm{
+		kmspb.CryptoKeyVersion_HMAC_SHA1,
+		kmspb.CryptoKeyVersion_HMAC_SHA224,
+		kmspb.CryptoKeyVersion_HMAC_SHA256,
+		kmspb.CryptoKeyVersion_HMAC_SHA384,
+		kmspb.CryptoKeyVersion_HMAC_SHA512,
+	} {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			ck, err := svc.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+				Parent:      keyRing,
+				CryptoKeyId: strings.ToLower(algorithm.String()),
+				CryptoKey: &kmspb.CryptoKey{
+					Purpose:         kmspb.CryptoKey_MAC,
+					VersionTemplate: &kmspb.CryptoKeyVersionTemplate{Algorithm: algorithm},
+				},
+			})
+			if err != nil {
+				t.Fatalf("create MAC key: %v", err)
+			}
+			if ck.GetPrimary() != nil {
+				t.Fatal("MAC keys must not have a primary version")
+			}
+			versionName := ck.GetName() + "/cryptoKeyVersions/1"
+			data := []byte("webhook body")
+
+			signed, err := svc.MacSign(ctx, &kmspb.MacSignRequest{
+				Name:       versionName,
+				Data:       data,
+				DataCrc32C: wrapperspb.Int64(int64(crc.Compute(data))),
+			})
+			if err != nil {
+				t.Fatalf("mac sign: %v", err)
+			}
+			if !signed.GetVerifiedDataCrc32C() {
+				t.Fatal("verified_data_crc32c = false, want true")
+			}
+			if signed.GetMacCrc32C().GetValue() != int64(crc.Compute(signed.GetMac())) {
+				t.Fatal("mac_crc32c does not match mac")
+			}
+			if signed.GetName() != versionName || signed.GetProtectionLevel() != kmspb.ProtectionLevel_SOFTWARE {
+				t.Fatalf("unexpected response metadata: %v", signed)
+			}
+
+			verified, err := svc.MacVerify(ctx, &kmspb.MacVerifyRequest{
+				Name:       versionName,
+				Data:       data,
+				DataCrc32C: wrapperspb.Int64(int64(crc.Compute(data))),
+				Mac:        signed.GetMac(),
+				MacCrc32C:  signed.GetMacCrc32C(),
+			})
+			if err != nil {
+				t.Fatalf("mac verify: %v", err)
+			}
+			if !verified.GetSuccess() || !verified.GetVerifiedDataCrc32C() || !verified.GetVerifiedMacCrc32C() || !verified.GetVerifiedSuccessIntegrity() {
+				t.Fatalf("unexpected verify response: %v", verified)
+			}
+
+			tampered, err := svc.MacVerify(ctx, &kmspb.MacVerifyRequest{Name: versionName, Data: []byte("forged body"), Mac: signed.GetMac()})
+			if err != nil {
+				t.Fatalf("mac verify tampered: %v", err)
+			}
+			if tampered.GetSuccess() {
+				t.Fatal("tampered data verified successfully")
+			}
+		})
+	}
+
+	t.Run("rejects invalid requests", func(t *testing.T) {
+		ck, err := svc.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+			Parent:      keyRing,
+			CryptoKeyId: "checks",
+			CryptoKey: &kmspb.CryptoKey{
+				Purpose:         kmspb.CryptoKey_MAC,
+				VersionTemplate: &kmspb.CryptoKeyVersionTemplate{Algorithm: kmspb.CryptoKeyVersion_HMAC_SHA256},
+			},
+		})
+		if err != nil {
+			t.Fatalf("create MAC key: %v", err)
+		}
+		versionName := ck.GetName() + "/cryptoKeyVersions/1"
+
+		_, err = svc.MacSign(ctx, &kmspb.MacSignRequest{Name: versionName, Data: []byte("data"), DataCrc32C: wrapperspb.Int64(1)})
+		requireStatusCode(t, err, codes.InvalidArgument)
+		_, err = svc.MacVerify(ctx, &kmspb.MacVerifyRequest{Name: versionName, Data: []byte("data"), Mac: []byte("mac"), MacCrc32C: wrapperspb.Int64(1)})
+		requireStatusCode(t, err, codes.InvalidArgument)
+		_, err = svc.MacSign(ctx, &kmspb.MacSignRequest{Name: versionName, Data: make([]byte, 64*1024+1)})
+		requireStatusCode(t, err, codes.InvalidArgument)
+
+		symmetricKey := createCryptoKey(t, svc, keyRing, "symmetric")
+		_, err = svc.MacSign(ctx, &kmspb.MacSignRequest{Name: symmetricKey + "/cryptoKeyVersions/1", Data: []byte("data")})
+		requireStatusCode(t, err, codes.FailedPrecondition)
+
+		_, err = svc.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+			Parent:      keyRing,
+			CryptoKeyId: "no-algorithm",
+			CryptoKey:   &kmspb.CryptoKey{Purpose: kmspb.CryptoKey_MAC},
+		})
+		requireStatusCode(t, err, codes.InvalidArgument)
+	})
+}
+
+func TestRawEncryptDecrypt(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc := newTestService()
+	keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "raw")
+	plaintext := []byte("0123456789abcdef")
+
+	for _, algorithm := range []kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm{
+		kmspb.CryptoKeyVersion_AES_128_GCM,
+		kmspb.CryptoKeyVersion_AES_256_GCM,
+		kmspb.CryptoKeyVersion_AES_128_CBC,
+		kmspb.CryptoKeyVersion_AES_256_CBC,
+		kmspb.CryptoKeyVersion_AES_128_CTR,
+		kmspb.CryptoKeyVersion_AES_256_CTR,
+	} {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			versionName := createRawCryptoKey(t, svc, keyRing, strings.ToLower(algorithm.String()), algorithm) + "/cryptoKeyVersions/1"
+			gcm := strings.HasSuffix(algorithm.String(), "_GCM")
+
+			encReq := &kmspb.RawEncryptRequest{
+				Name:            versionName,
+				Plaintext:       plaintext,
+				PlaintextCrc32C: wrapperspb.Int64(int64(crc.Compute(plaintext))),
+			}
+			if gcm {
+				encReq.AdditionalAuthenticatedData = []byte("aad")
+				encReq.AdditionalAuthenticatedDataCrc32C = wrapperspb.Int64(int64(crc.Compute([]byte("aad"))))
+			}
+			enc, err := svc.RawEncrypt(ctx, encReq)
+			if err != nil {
+				t.Fatalf("raw encrypt: %v", err)
+			}
+			if !enc.GetVerifiedPlaintextCrc32C() || enc.GetVerifiedAdditionalAuthenticatedDataCrc32C() != gcm || enc.GetVerifiedInitializationVectorCrc32C() {
+				t.Fatalf("unexpected verified flags: %v", enc)
+			}
+			wantIV, wantTag := 16, int32(0)
+			if gcm {
+				wantIV, wantTag = 12, 16
+			}
+			if len(enc.GetInitializationVector()) != wantIV || enc.GetTagLength() != wantTag {
+				t.Fatalf("iv length = %d, tag_length = %d; want %d, %d", len(enc.GetInitializationVector()), enc.GetTagLength(), wantIV, wantTag)
+			}
+			if enc.GetCiphertextCrc32C().GetValue() != int64(crc.Compute(enc.GetCiphertext())) ||
+				enc.GetInitializationVectorCrc32C().GetValue() != int64(crc.Compute(enc.GetInitializationVector())) {
+				t.Fatal("response checksums do not match")
+			}
+
+			dec, err := svc.RawDecrypt(ctx, &kmspb.RawDecryptRequest{
+				Name:                        versionName,
+				Ciphertext:                  enc.GetCiphertext(),
+				CiphertextCrc32C:            enc.GetCiphertextCrc32C(),
+				AdditionalAuthenticatedData: encReq.GetAdditionalAuthenticatedData(),
+				InitializationVector:        enc.GetInitializationVector(),
+				InitializationVectorCrc32C:  enc.GetInitializationVectorCrc32C(),
+				TagLength:                   enc.GetTagLength(),
+			})
+			if err != nil {
+				t.Fatalf("raw decrypt: %v", err)
+			}
+			if string(dec.GetPlaintext()) != string(plaintext) {
+				t.Fatalf("plaintext = %q, want %q", dec.GetPlaintext(), plaintext)
+			}
+			if !dec.GetVerifiedCiphertextCrc32C() || !dec.GetVerifiedInitializationVectorCrc32C() {
+				t.Fatalf("unexpected verified flags: %v", dec)
+			}
+			if dec.GetPlaintextCrc32C().GetValue() != int64(crc.Compute(plaintext)) {
+				t.Fatal("plaintext_crc32c does not match plaintext")
+			}
+		})
+	}
+
+	t.Run("uses a customer-supplied iv", func(t *testing.T) {
+		versionName := createRawCryptoKey(t, svc, keyRing, "cbc-iv", kmspb.CryptoKeyVersion_AES_256_CBC) + "/cryptoKeyVersions/1"
+		iv := []byte("fedcba9876543210")
+		enc, err := svc.RawEncrypt(ctx, &kmspb.RawEncryptRequest{
+			Name:                       versionName,
+			Plaintext:                  plaintext,
+			InitializationVector:       iv,
+			InitializationVectorCrc32C: wrapperspb.Int64(int64(crc.Compute(iv))),
+		})
+		if err != nil {
+			t.Fatalf("raw encrypt: %v", err)
+		}
+		if string(enc.GetInitializationVector()) != string(iv) || !enc.GetVerifiedInitializationVectorCrc32C() {
+			t.Fatalf("iv = %q, verified = %v", enc.GetInitializationVector(), enc.GetVerifiedInitializationVectorCrc32C())
+		}
+	})
+
+	t.Run("rejects invalid requests", func(t *testing.T) {
+		gcmVersion := createRawCryptoKey(t, svc, keyRing, "gcm-checks", kmspb.CryptoKeyVersion_AES_256_GCM) + "/cryptoKeyVersions/1"
+		cbcVersion := createRawCryptoKey(t, svc, keyRing, "cbc-checks", kmspb.CryptoKeyVersion_AES_128_CBC) + "/cryptoKeyVersions/1"
+		ctrVersion := createRawCryptoKey(t, svc, keyRing, "ctr-checks", kmspb.CryptoKeyVersion_AES_128_CTR) + "/cryptoKeyVersions/1"
+		enc, err := svc.RawEncrypt(ctx, &kmspb.RawEncryptRequest{Name: gcmVersion, Plaintext: plaintext})
+		if err != nil {
+			t.Fatalf("raw encrypt: %v", err)
+		}
+
+		invalid := []struct {
+			name string
+			call func() error
+		}{
+			{"gcm with customer iv", func() error {
+				_, err := svc.RawEncrypt(ctx, &kmspb.RawEncryptRequest{Name: gcmVersion, Plaintext: plaintext, InitializationVector: make([]byte, 12)})
+				return err
+			}},
+			{"ctr with short iv", func() error {
+				_, err := svc.RawEncrypt(ctx, &kmspb.RawEncryptRequest{Name: ctrVersion, Plaintext: plaintext, InitializationVector: make([]byte, 8)})
+				return err
+			}},
+			{"cbc with partial block", func() error {
+				_, err := svc.RawEncrypt(ctx, &kmspb.RawEncryptRequest{Name: cbcVersion, Plaintext: []byte("short")})
+				return err
+			}},
+			{"aad without gcm", func() error {
+				_, err := svc.RawEncrypt(ctx, &kmspb.RawEncryptRequest{Name: ctrVersion, Plaintext: plaintext, AdditionalAuthenticatedData: []byte("aad")})
+				return err
+			}},
+			{"plaintext checksum mismatch", func() error {
+				_, err := svc.RawEncrypt(ctx, &kmspb.RawEncryptRequest{Name: gcmVersion, Plaintext: plaintext, PlaintextCrc32C: wrapperspb.Int64(1)})
+				return err
+			}},
+			{"decrypt without iv", func() error {
+				_, err := svc.RawDecrypt(ctx, &kmspb.RawDecryptRequest{Name: gcmVersion, Ciphertext: enc.GetCiphertext()})
+				return err
+			}},
+			{"decrypt with block-sized iv for gcm", func() error {
+				_, err := svc.RawDecrypt(ctx, &kmspb.RawDecryptRequest{Name: gcmVersion, Ciphertext: enc.GetCiphertext(), InitializationVector: make([]byte, 16)})
+				return err
+			}},
+			{"decrypt with invalid tag_length", func() error {
+				_, err := svc.RawDecrypt(ctx, &kmspb.RawDecryptRequest{Name: gcmVersion, Ciphertext: enc.GetCiphertext(), InitializationVector: enc.GetInitializationVector(), TagLength: 8})
+				return err
+			}},
+			{"decrypt with tag_length for ctr", func() error {
+				_, err := svc.RawDecrypt(ctx, &kmspb.RawDecryptRequest{Name: ctrVersion, Ciphertext: plaintext, InitializationVector: make([]byte, 16), TagLength: 16})
+				return err
+			}},
+			{"decrypt with wrong aad", func() error {
+				_, err := svc.RawDecrypt(ctx, &kmspb.RawDecryptRequest{Name: gcmVersion, Ciphertext: enc.GetCiphertext(), InitializationVector: enc.GetInitializationVector(), AdditionalAuthenticatedData: []byte("aad")})
+				return err
+			}},
+			{"decrypt iv checksum mismatch", func() error {
+				_, err := svc.RawDecrypt(ctx, &kmspb.RawDecryptRequest{Name: gcmVersion, Ciphertext: enc.GetCiphertext(), InitializationVector: enc.GetInitializationVector(), InitializationVectorCrc32C: wrapperspb.Int64(1)})
+				return err
+			}},
+		}
+		for _, tt := range invalid {
+			t.Run(tt.name, func(t *testing.T) {
+				requireStatusCode(t, tt.call(), codes.InvalidArgument)
+			})
+		}
+
+		symmetricKey := createCryptoKey(t, svc, keyRing, "symmetric")
+		_, err = svc.RawEncrypt(ctx, &kmspb.RawEncryptRequest{Name: symmetricKey + "/cryptoKeyVersions/1", Plaintext: plaintext})
+		requireStatusCode(t, err, codes.FailedPrecondition)
+	})
+}
+
+func TestAsymmetricDecrypt(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc := newTestService()
+	keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "rsa")
+
+	for _, tt := range []struct {
+		algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm
+		hash      func() hash.Hash
+	}{
+		{kmspb.CryptoKeyVersion_RSA_DECRYPT_OAEP_2048_SHA256, sha256.New},
+		{kmspb.CryptoKeyVersion_RSA_DECRYPT_OAEP_2048_SHA1, sha1.New},
+	} {
+		t.Run(tt.algorithm.String(), func(t *testing.T) {
+			ck, err := svc.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+				Parent:      keyRing,
+				CryptoKeyId: strings.ToLower(tt.algorithm.String()),
+				CryptoKey: &kmspb.CryptoKey{
+					Purpose:         kmspb.CryptoKey_ASYMMETRIC_DECRYPT,
+					VersionTemplate: &kmspb.CryptoKeyVersionTemplate{Algorithm: tt.algorithm},
+				},
+			})
+			if err != nil {
+				t.Fatalf("create decrypt key: %v", err)
+			}
+			versionName := ck.GetName() + "/cryptoKeyVersions/1"
+
+			pub, err := svc.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: versionName})
+			if err != nil {
+				t.Fatalf("get public key: %v", err)
+			}
+			if pub.GetAlgorithm() != tt.algorithm {
+				t.Fatalf("algorithm = %v, want %v", pub.GetAlgorithm(), tt.algorithm)
+			}
+			block, _ := pem.Decode([]byte(pub.GetPem()))
+			if block == nil {
+				t.Fatal("failed to decode PEM")
+			}
+			parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				t.Fatalf("parse public key: %v", err)
+			}
+			rsaPub, ok := parsed.(*rsa.PublicKey)
+			if !ok {
+				t.Fatalf("public key is %T, want *rsa.PublicKey", parsed)
+			}
+
+			ciphertext, err := rsa.EncryptOAEP(tt.hash(), rand.Reader, rsaPub, []byte("card number"), nil)
+			if err != nil {
+				t.Fatalf("encrypt locally: %v", err)
+			}
+			resp, err := svc.AsymmetricDecrypt(ctx, &kmspb.AsymmetricDecryptRequest{
+				Name:             versionName,
+				Ciphertext:       ciphertext,
+				CiphertextCrc32C: wrapperspb.Int64(int64(crc.Compute(ciphertext))),
+			})
+			if err != nil {
+				t.Fatalf("asymmetric decrypt: %v", err)
+			}
+			if string(resp.GetPlaintext()) != "card number" {
+				t.Fatalf("plaintext = %q, want %q", resp.GetPlaintext(), "card number")
+			}
+			if !resp.GetVerifiedCiphertextCrc32C() || resp.GetPlaintextCrc32C().GetValue() != int64(crc.Compute(resp.GetPlaintext())) {
+				t.Fatalf("unexpected checksums: %v", resp)
+			}
+
+			_, err = svc.AsymmetricDecrypt(ctx, &kmspb.AsymmetricDecryptRequest{Name: versionName, Ciphertext: ciphertext, CiphertextCrc32C: wrapperspb.Int64(1)})
+			requireStatusCode(t, err, codes.InvalidArgument)
+
+			tampered := slices.Clone(ciphertext)
+			tampered[0] ^= 0xff
+			_, err = svc.AsymmetricDecrypt(ctx, &kmspb.AsymmetricDecryptRequest{Name: versionName, Ciphertext: tampered})
+			requireStatusCode(t, err, codes.InvalidArgument)
+			_, err = svc.AsymmetricDecrypt(ctx, &kmspb.AsymmetricDecryptRequest{Name: versionName, Ciphertext: ciphertext[:32]})
+			requireStatusCode(t, err, codes.InvalidArgument)
+
+			_, err = svc.AsymmetricSign(ctx, &kmspb.AsymmetricSignRequest{
+				Name:   versionName,
+				Digest: &kmspb.Digest{Digest: &kmspb.Digest_Sha256{Sha256: make([]byte, 32)}},
+			})
+			requireStatusCode(t, err, codes.FailedPrecondition)
+		})
+	}
+
+	t.Run("rejects non-decryption keys", func(t *testing.T) {
+		svc, versionName := setupAsymmetricKey(t)
+		_, err := svc.AsymmetricDecrypt(ctx, &kmspb.AsymmetricDecryptRequest{Name: versionName, Ciphertext: []byte("ciphertext")})
+		requireStatusCode(t, err, codes.FailedPrecondition)
+	})
+}
+
+func TestNISTCurveSigning(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc := newTestService()
+	keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "nist")
+	message := []byte("eyJhbGciOiJFUzI1NiJ9.eyJzdWIiOiJkZW1vIn0")
+	sum256 := sha256.Sum256(message)
+	sum384 := sha512.Sum384(message)
+	digest256 := &kmspb.Digest{Digest: &kmspb.Digest_Sha256{Sha256: sum256[:]}}
+	digest384 := &kmspb.Digest{Digest: &kmspb.Digest_Sha384{Sha384: sum384[:]}}
+
+	for _, tt := range []struct {
+		algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm
+		digest    *kmspb.Digest
+		hashed    []byte
+		wrong     *kmspb.Digest
+		short     *kmspb.Digest
+	}{
+		{
+			algorithm: kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256,
+			digest:    digest256,
+			hashed:    sum256[:],
+			wrong:     digest384,
+			short:     &kmspb.Digest{Digest: &kmspb.Digest_Sha256{Sha256: sum256[:20]}},
+		},
+		{
+			algorithm: kmspb.CryptoKeyVersion_EC_SIGN_P384_SHA384,
+			digest:    digest384,
+			hashed:    sum384[:],
+			wrong:     digest256,
+			short:     &kmspb.Digest{Digest: &kmspb.Digest_Sha384{Sha384: sum384[:32]}},
+		},
+	} {
+		t.Run(tt.algorithm.String(), func(t *testing.T) {
+			ck, err := svc.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+				Parent:      keyRing,
+				CryptoKeyId: strings.ToLower(tt.algorithm.String()),
+				CryptoKey: &kmspb.CryptoKey{
+					Purpose:         kmspb.CryptoKey_ASYMMETRIC_SIGN,
+					VersionTemplate: &kmspb.CryptoKeyVersionTemplate{Algorithm: tt.algorithm},
+				},
+			})
+			if err != nil {
+				t.Fatalf("create signing key: %v", err)
+			}
+			versionName := ck.GetName() + "/cryptoKeyVersions/1"
+
+			signResp, err := svc.AsymmetricSign(ctx, &kmspb.AsymmetricSignRequest{Name: versionName, Digest: tt.digest})
+			if err != nil {
+				t.Fatalf("asymmetric sign: %v", err)
+			}
+			pubResp, err := svc.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: versionName})
+			if err != nil {
+				t.Fatalf("get public key: %v", err)
+			}
+			if pubResp.GetAlgorithm() != tt.algorithm {
+				t.Fatalf("algorithm = %v, want %v", pubResp.GetAlgorithm(), tt.algorithm)
+			}
+			block, _ := pem.Decode([]byte(pubResp.GetPem()))
+			if block == nil {
+				t.Fatal("failed to decode PEM")
+			}
+			parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				t.Fatalf("parse public key: %v", err)
+			}
+			pub, ok := parsed.(*ecdsa.PublicKey)
+			if !ok {
+				t.Fatalf("public key is %T, want *ecdsa.PublicKey", parsed)
+			}
+			if !ecdsa.VerifyASN1(pub, tt.hashed, signResp.GetSignature()) {
+				t.Fatal("signature verification failed")
+			}
+
+			_, err = svc.AsymmetricSign(ctx, &kmspb.AsymmetricSignRequest{Name: versionName, Digest: tt.wrong})
+			requireStatusCode(t, err, codes.InvalidArgument)
+			_, err = svc.AsymmetricSign(ctx, &kmspb.AsymmetricSignRequest{Name: versionName, Digest: tt.short})
+			requireStatusCode(t, err, codes.InvalidArgument)
+		})
+	}
+}
+
+func TestRSASigning(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc := newTestService()
+	keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "rsa-sign")
+	data := []byte("<saml:Assertion/>")
+	sum256 := sha256.Sum256(data)
+	sum512 := sha512.Sum512(data)
+
+	for _, tt := range []struct {
+		algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm
+		req       *kmspb.AsymmetricSignRequest
+		verify    func(pub *rsa.PublicKey, sig []byte) error
+	}{
+		{
+			algorithm: kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_2048_SHA256,
+			req:       &kmspb.AsymmetricSignRequest{Digest: &kmspb.Digest{Digest: &kmspb.Digest_Sha256{Sha256: sum256[:]}}},
+			verify: func(pub *rsa.PublicKey, sig []byte) error {
+				return rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum256[:], sig)
+			},
+		},
+		{
+			algorithm: kmspb.CryptoKeyVersion_RSA_SIGN_PSS_3072_SHA256,
+			req:       &kmspb.AsymmetricSignRequest{Digest: &kmspb.Digest{Digest: &kmspb.Digest_Sha256{Sha256: sum256[:]}}},
+			verify: func(pub *rsa.PublicKey, sig []byte) error {
+				return rsa.VerifyPSS(pub, crypto.SHA256, sum256[:], sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+			},
+		},
+		{
+			algorithm: kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA512,
+			req:       &kmspb.AsymmetricSignRequest{Digest: &kmspb.Digest{Digest: &kmspb.Digest_Sha512{Sha512: sum512[:]}}},
+			verify: func(pub *rsa.PublicKey, sig []byte) error {
+				return rsa.VerifyPKCS1v15(pub, crypto.SHA512, sum512[:], sig)
+			},
+		},
+		{
+			algorithm: kmspb.CryptoKeyVersion_RSA_SIGN_RAW_PKCS1_2048,
+			req:       &kmspb.AsymmetricSignRequest{Data: data, DataCrc32C: wrapperspb.Int64(int64(crc.Compute(data)))},
+			verify: func(pub *rsa.PublicKey, sig []byte) error {
+				return rsa.VerifyPKCS1v15(pub, 0, data, sig)
+			},
+		},
+	} {
+		t.Run(tt.algorithm.String(), func(t *testing.T) {
+			t.Parallel()
+			ck, err := svc.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+				Parent:      keyRing,
+				CryptoKeyId: strings.ToLower(tt.algorithm.String()),
+				CryptoKey: &kmspb.CryptoKey{
+					Purpose:         kmspb.CryptoKey_ASYMMETRIC_SIGN,
+					VersionTemplate: &kmspb.CryptoKeyVersionTemplate{Algorithm: tt.algorithm},
+				},
+			})
+			if err != nil {
+				t.Fatalf("create signing key: %v", err)
+			}
+			tt.req.Name = ck.GetName() + "/cryptoKeyVersions/1"
+
+			signResp, err := svc.AsymmetricSign(ctx, tt.req)
+			if err != nil {
+				t.Fatalf("asymmetric sign: %v", err)
+			}
+			if tt.req.GetDataCrc32C() != nil && !signResp.GetVerifiedDataCrc32C() {
+				t.Fatal("verified_data_crc32c = false, want true")
+			}
+			pubResp, err := svc.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: tt.req.GetName()})
+			if err != nil {
+				t.Fatalf("get public key: %v", err)
+			}
+			block, _ := pem.Decode([]byte(pubResp.GetPem()))
+			if block == nil {
+				t.Fatal("failed to decode PEM")
+			}
+			parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				t.Fatalf("parse public key: %v", err)
+			}
+			pub, ok := parsed.(*rsa.PublicKey)
+			if !ok {
+				t.Fatalf("public key is %T, want *rsa.PublicKey", parsed)
+			}
+			if err := tt.verify(pub, signResp.GetSignature()); err != nil {
+				t.Fatalf("verify signature: %v", err)
+			}
+		})
+	}
+
+	t.Run("validates input", func(t *testing.T) {
+		t.Parallel()
+		pkcs1 := createSigningKey(t, svc, keyRing, "pkcs1-checks", kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_2048_SHA256)
+		raw := createSigningKey(t, svc, keyRing, "raw-checks", kmspb.CryptoKeyVersion_RSA_SIGN_RAW_PKCS1_2048)
+
+		for _, req := range []*kmspb.AsymmetricSignRequest{
+			{Name: pkcs1, Digest: &kmspb.Digest{Digest: &kmspb.Digest_Sha512{Sha512: sum512[:]}}},
+			{Name: pkcs1, Data: data},
+			{Name: raw, Digest: &kmspb.Digest{Digest: &kmspb.Digest_Sha256{Sha256: sum256[:]}}},
+			{Name: raw},
+			{Name: raw, Data: make([]byte, 2048/8-10)},
+			{Name: raw, Data: data, DataCrc32C: wrapperspb.Int64(1)},
+		} {
+			_, err := svc.AsymmetricSign(ctx, req)
+			requireStatusCode(t, err, codes.InvalidArgument)
+		}
+	})
+}
+
+func TestEd25519Signing(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc := newTestService()
+	keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "ssh")
+	versionName := createSigningKey(t, svc, keyRing, "ca", kmspb.CryptoKeyVersion_EC_SIGN_ED25519)
+	data := []byte("certificate to sign")
+
+	signResp, err := svc.AsymmetricSign(ctx, &kmspb.AsymmetricSignRequest{
+		Name:       versionName,
+		Data:       data,
+		DataCrc32C: wrapperspb.Int64(int64(crc.Compute(data))),
+	})
+	if err != nil {
+		t.Fatalf("asymmetric sign: %v", err)
+	}
+	if !signResp.GetVerifiedDataCrc32C() || signResp.GetVerifiedDigestCrc32C() {
+		t.Fatalf("verified_data_crc32c = %v, verified_digest_crc32c = %v; want true, false",
+			signResp.GetVerifiedDataCrc32C(), signResp.GetVerifiedDigestCrc32C())
+	}
+
+	pubResp, err := svc.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: versionName})
+	if err != nil {
+		t.Fatalf("get public key: %v", err)
+	}
+	block, _ := pem.Decode([]byte(pubResp.GetPem()))
+	if block == nil {
+		t.Fatal("failed to decode PEM")
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("parse public key: %v", err)
+	}
+	pub, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		t.Fatalf("public key is %T, want ed25519.PublicKey", parsed)
+	}
+	if !ed25519.Verify(pub, data, signResp.GetSignature()) {
+		t.Fatal("signature verification failed")
+	}
+
+	t.Run("rejects digest input", func(t *testing.T) {
+		digest := sha256.Sum256(data)
+		_, err := svc.AsymmetricSign(ctx, &kmspb.AsymmetricSignRequest{
+			Name:   versionName,
+			Digest: &kmspb.Digest{Digest: &kmspb.Digest_Sha256{Sha256: digest[:]}},
+		})
+		requireStatusCode(t, err, codes.InvalidArgument)
+		if !strings.Contains(status.Convert(err).Message(), "AsymmetricSignRequest.digest") {
+			t.Fatalf("message = %q, want it to name the digest field", status.Convert(err).Message())
+		}
+	})
+
+	t.Run("rejects data for digest algorithms", func(t *testing.T) {
+		svc, secpVersion := setupAsymmetricKey(t)
+		_, err := svc.AsymmetricSign(ctx, &kmspb.AsymmetricSignRequest{Name: secpVersion, Data: data})
+		requireStatusCode(t, err, codes.InvalidArgument)
+		if !strings.Contains(status.Convert(err).Message(), "AsymmetricSignRequest.data") {
+			t.Fatalf("message = %q, want it to name the data field", status.Convert(err).Message())
+		}
+	})
+
+	t.Run("rejects data checksum mismatch", func(t *testing.T) {
+		_, err := svc.AsymmetricSign(ctx, &kmspb.AsymmetricSignRequest{Name: versionName, Data: data, DataCrc32C: wrapperspb.Int64(1)})
+		requireStatusCode(t, err, codes.InvalidArgument)
+	})
+}
+
+func TestGetPublicKeyFormats(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc := newTestService()
+	keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "formats")
+	versionName := createSigningKey(t, svc, keyRing, "p256", kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256)
+
+	for _, format := range []kmspb.PublicKey_PublicKeyFormat{kmspb.PublicKey_PUBLIC_KEY_FORMAT_UNSPECIFIED, kmspb.PublicKey_PEM} {
+		pub, err := svc.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: versionName, PublicKeyFormat: format})
+		if err != nil {
+			t.Fatalf("get public key %v: %v", format, err)
+		}
+		if pub.GetPublicKeyFormat() != kmspb.PublicKey_PEM {
+			t.Fatalf("public_key_format = %v, want PEM", pub.GetPublicKeyFormat())
+		}
+		if string(pub.GetPublicKey().GetData()) != pub.GetPem() {
+			t.Fatalf("public_key.data = %q, want the PEM", pub.GetPublicKey().GetData())
+		}
+		if pub.GetPublicKey().GetCrc32CChecksum().GetValue() != pub.GetPemCrc32C().GetValue() {
+			t.Fatal("public_key checksum does not match pem_crc32c")
+		}
+	}
+
+	pub, err := svc.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: versionName, PublicKeyFormat: kmspb.PublicKey_DER})
+	if err != nil {
+		t.Fatalf("get public key DER: %v", err)
+	}
+	der := pub.GetPublicKey().GetData()
+	if pub.GetPublicKeyFormat() != kmspb.PublicKey_DER || pub.GetPem() == "" {
+		t.Fatalf("unexpected public key: %v", pub)
+	}
+	if pub.GetPublicKey().GetCrc32CChecksum().GetValue() != int64(crc.Compute(der)) {
+		t.Fatal("public_key checksum mismatch")
+	}
+	parsed, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		t.Fatalf("parse DER public key: %v", err)
+	}
+	if _, ok := parsed.(*ecdsa.PublicKey); !ok {
+		t.Fatalf("public key is %T, want *ecdsa.PublicKey", parsed)
+	}
+	block, _ := pem.Decode([]byte(pub.GetPem()))
+	if block == nil || !bytes.Equal(block.Bytes, der) {
+		t.Fatal("DER does not match the PEM body")
+	}
+
+	for _, format := range []kmspb.PublicKey_PublicKeyFormat{kmspb.PublicKey_NIST_PQC, kmspb.PublicKey_XWING_RAW_BYTES} {
+		_, err := svc.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: versionName, PublicKeyFormat: format})
+		requireStatusCode(t, err, codes.InvalidArgument)
+	}
+}
+
+func TestPostQuantumSigning(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc := newTestService()
+	keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "pq")
+	data := []byte("hybrid signature payload")
+
+	for _, tt := range []struct {
+		algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm
+		publicKey func(raw []byte) (key.Key, error)
+	}{
+		{kmspb.CryptoKeyVersion_PQ_SIGN_ML_DSA_65, func(raw []byte) (key.Key, error) {
+			params, err := mldsa.NewParameters(mldsa.MLDSA65, mldsa.VariantNoPrefix)
+			if err != nil {
+				return nil, err
+			}
+			return mldsa.NewPublicKey(raw, 0, params)
+		}},
+		{kmspb.CryptoKeyVersion_PQ_SIGN_SLH_DSA_SHA2_128S, func(raw []byte) (key.Key, error) {
+			params, err := slhdsa.NewParameters(slhdsa.SHA2, 64, slhdsa.SmallSignature, slhdsa.VariantNoPrefix)
+			if err != nil {
+				return nil, err
+			}
+			return slhdsa.NewPublicKey(raw, 0, params)
+		}},
+	} {
+		t.Run(tt.algorithm.String(), func(t *testing.T) {
+			t.Parallel()
+			versionName := createSigningKey(t, svc, keyRing, strings.ToLower(tt.algorithm.String()), tt.algorithm)
+
+			signResp, err := svc.AsymmetricSign(ctx, &kmspb.AsymmetricSignRequest{
+				Name:       versionName,
+				Data:       data,
+				DataCrc32C: wrapperspb.Int64(int64(crc.Compute(data))),
+			})
+			if err != nil {
+				t.Fatalf("asymmetric sign: %v", err)
+			}
+			if !signResp.GetVerifiedDataCrc32C() {
+				t.Fatal("verified_data_crc32c = false, want true")
+			}
+
+			_, err = svc.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: versionName})
+			requireStatusCode(t, err, codes.InvalidArgument)
+			pubResp, err := svc.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: versionName, PublicKeyFormat: kmspb.PublicKey_NIST_PQC})
+			if err != nil {
+				t.Fatalf("get public key: %v", err)
+			}
+			if pubResp.GetPublicKeyFormat() != kmspb.PublicKey_NIST_PQC || pubResp.GetAlgorithm() != tt.algorithm {
+				t.Fatalf("unexpected public key: %v", pubResp)
+			}
+			pub, err := tt.publicKey(pubResp.GetPublicKey().GetData())
+			if err != nil {
+				t.Fatalf("parse public key: %v", err)
+			}
+			manager := keyset.NewManager()
+			id, err := manager.AddKey(pub)
+			if err != nil {
+				t.Fatalf("add public key: %v", err)
+			}
+			if err := manager.SetPrimary(id); err != nil {
+				t.Fatalf("set primary: %v", err)
+			}
+			handle, err := manager.Handle()
+			if err != nil {
+				t.Fatalf("handle: %v", err)
+			}
+			verifier, err := signature.NewVerifier(handle)
+			if err != nil {
+				t.Fatalf("new verifier: %v", err)
+			}
+			if err := verifier.Verify(signResp.GetSignature(), data); err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+
+			digest := sha256.Sum256(data)
+			_, err = svc.AsymmetricSign(ctx, &kmspb.AsymmetricSignRequest{
+				Name:   versionName,
+				Digest: &kmspb.Digest{Digest: &kmspb.Digest_Sha256{Sha256: digest[:]}},
+			})
+			requireStatusCode(t, err, codes.InvalidArgument)
+		})
+	}
+}
+
+func TestGenerateRandomBytes(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	location := "projects/demo/locations/global"
+
+	t.Run("reads from the entropy source", func(t *testing.T) {
+		entropy := []byte("0123456789abcdefghijklmnopqrstuv")
+		svc := service.New(memory.New(), kmscrypto.NewTinkEngine(), service.WithEntropy(bytes.NewReader(entropy)))
+
+		first, err := svc.GenerateRandomBytes(ctx, &kmspb.GenerateRandomBytesRequest{Location: location, LengthBytes: 10, ProtectionLevel: kmspb.ProtectionLevel_HSM})
+		if err != nil {
+			t.Fatalf("generate random bytes: %v", err)
+		}
+		second, err := svc.GenerateRandomBytes(ctx, &kmspb.GenerateRandomBytesRequest{Location: location, LengthBytes: 22, ProtectionLevel: kmspb.ProtectionLevel_HSM})
+		if err != nil {
+			t.Fatalf("generate random bytes: %v", err)
+		}
+		if string(first.GetData()) != "0123456789" || string(second.GetData()) != "abcdefghijklmnopqrstuv" {
+			t.Fatalf("data = %q, %q", first.GetData(), second.GetData())
+		}
+		if first.GetDataCrc32C().GetValue() != int64(crc.Compute(first.GetData())) {
+			t.Fatal("data_crc32c does not match data")
+		}
+
+		// The source is exhausted.
+		_, err = svc.GenerateRandomBytes(ctx, &kmspb.GenerateRandomBytesRequest{Location: location, LengthBytes: 1, ProtectionLevel: kmspb.ProtectionLevel_HSM})
+		requireStatusCode(t, err, codes.Internal)
+	})
+
+	t.Run("defaults to crypto/rand", func(t *testing.T) {
+		svc := newTestService()
+		resp, err := svc.GenerateRandomBytes(ctx, &kmspb.GenerateRandomBytesRequest{Location: location, LengthBytes: 1024, ProtectionLevel: kmspb.ProtectionLevel_HSM})
+		if err != nil {
+			t.Fatalf("generate random bytes: %v", err)
+		}
+		if len(resp.GetData()) != 1024 {
+			t.Fatalf("len(data) = %d, want 1024", len(resp.GetData()))
+		}
+	})
+
+	t.Run("validates the request", func(t *testing.T) {
+		svc := newTestService()
+		for _, req := range []*kmspb.GenerateRandomBytesRequest{
+			{Location: "projects/demo", LengthBytes: 8, ProtectionLevel: kmspb.ProtectionLevel_HSM},
+			{Location: location, LengthBytes: 0, ProtectionLevel: kmspb.ProtectionLevel_HSM},
+			{Location: location, LengthBytes: 1025, ProtectionLevel: kmspb.ProtectionLevel_HSM},
+			{Location: location, LengthBytes: 8, ProtectionLevel: kmspb.ProtectionLevel_SOFTWARE},
+			{Location: location, LengthBytes: 8},
+		} {
+			_, err := svc.GenerateRandomBytes(ctx, req)
+			requireStatusCode(t, err, codes.InvalidArgument)
+		}
+	})
+}
+
+func TestDecapsulate(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc := newTestService()
+	keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "kem")
+
+	for _, tt := range []struct {
+		algorithm   kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm
+		format      kmspb.PublicKey_PublicKeyFormat
+		encapsulate func(publicKey []byte) (sharedSecret, ciphertext []byte, err error)
+	}{
+		{kmspb.CryptoKeyVersion_ML_KEM_768, kmspb.PublicKey_NIST_PQC, func(publicKey []byte) ([]byte, []byte, error) {
+			ek, err := mlkem.NewEncapsulationKey768(publicKey)
+			if err != nil {
+				return nil, nil, err
+			}
+			sharedSecret, ciphertext := ek.Encapsulate()
+			return sharedSecret, ciphertext, nil
+		}},
+		{kmspb.CryptoKeyVersion_ML_KEM_1024, kmspb.PublicKey_NIST_PQC, func(publicKey []byte) ([]byte, []byte, error) {
+			ek, err := mlkem.NewEncapsulationKey1024(publicKey)
+			if err != nil {
+				return nil, nil, err
+			}
+			sharedSecret, ciphertext := ek.Encapsulate()
+			return sharedSecret, ciphertext, nil
+		}},
+		{kmspb.CryptoKeyVersion_KEM_XWING, kmspb.PublicKey_XWING_RAW_BYTES, kmscrypto.EncapsulateXWing},
+	} {
+		t.Run(tt.algorithm.String(), func(t *testing.T) {
+			ck, err := svc.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+				Parent:      keyRing,
+				CryptoKeyId: strings.ToLower(tt.algorithm.String()),
+				CryptoKey: &kmspb.CryptoKey{
+					Purpose:         kmspb.CryptoKey_KEY_ENCAPSULATION,
+					VersionTemplate: &kmspb.CryptoKeyVersionTemplate{Algorithm: tt.algorithm},
+				},
+			})
+			if err != nil {
+				t.Fatalf("create kem key: %v", err)
+			}
+			versionName := ck.GetName() + "/cryptoKeyVersions/1"
+
+			_, err = svc.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: versionName})
+			requireStatusCode(t, err, codes.InvalidArgument)
+			_, err = svc.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: versionName, PublicKeyFormat: kmspb.PublicKey_PEM})
+			requireStatusCode(t, err, codes.InvalidArgument)
+
+			pub, err := svc.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: versionName, PublicKeyFormat: tt.format})
+			if err != nil {
+				t.Fatalf("get public key: %v", err)
+			}
+			if pub.GetPublicKeyFormat() != tt.format || pub.GetPem() != "" {
+				t.Fatalf("unexpected public key: %v", pub)
+			}
+			publicKey := pub.GetPublicKey().GetData()
+			if pub.GetPublicKey().GetCrc32CChecksum().GetValue() != int64(crc.Compute(publicKey)) {
+				t.Fatal("public key checksum mismatch")
+			}
+
+			sharedSecret, ciphertext, err := tt.encapsulate(publicKey)
+			if err != nil {
+				t.Fatalf("encapsulate locally: %v", err)
+			}
+			resp, err := svc.Decapsulate(ctx, &kmspb.DecapsulateRequest{
+				Name:             versionName,
+				Ciphertext:       ciphertext,
+				CiphertextCrc32C: wrapperspb.Int64(int64(crc.Compute(ciphertext))),
+			})
+			if err != nil {
+				t.Fatalf("decapsulate: %v", err)
+			}
+			if !bytes.Equal(resp.GetSharedSecret(), sharedSecret) {
+				t.Fatal("shared secret mismatch")
+			}
+			if !resp.GetVerifiedCiphertextCrc32C() || resp.GetSharedSecretCrc32C() != int64(crc.Compute(sharedSecret)) {
+				t.Fatalf("unexpected checksums: %v", resp)
+			}
+			if resp.GetName() != versionName || resp.GetProtectionLevel() != kmspb.ProtectionLevel_SOFTWARE {
+				t.Fatalf("unexpected response: %v", resp)
+			}
+
+			_, err = svc.Decapsulate(ctx, &kmspb.DecapsulateRequest{Name: versionName, Ciphertext: ciphertext, CiphertextCrc32C: wrapperspb.Int64(1)})
+			requireStatusCode(t, err, codes.InvalidArgument)
+			_, err = svc.Decapsulate(ctx, &kmspb.DecapsulateRequest{Name: versionName, Ciphertext: ciphertext[:32]})
+			requireStatusCode(t, err, codes.InvalidArgument)
+		})
+	}
+
+	t.Run("rejects non-kem keys", func(t *testing.T) {
+		svc, versionName := setupAsymmetricKey(t)
+		_, err := svc.Decapsulate(ctx, &kmspb.DecapsulateRequest{Name: versionName, Ciphertext: []byte("ciphertext")})
+		requireStatusCode(t, err, codes.FailedPrecondition)
+		_, err = svc.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: versionName, PublicKeyFormat: kmspb.PublicKey_NIST_PQC})
+		requireStatusCode(t, err, codes.InvalidArgument)
+	})
+}
+
+func TestImportJobLifecycle(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clock := newFakeClock()
+	svc := service.New(memory.New(), kmscrypto.NewTinkEngine(), service.WithClock(clock))
+	keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "byok")
+
+	created, err := svc.CreateImportJob(ctx, &kmspb.CreateImportJobRequest{
+		Parent:      keyRing,
+		ImportJobId: "job",
+		ImportJob: &kmspb.ImportJob{
+			ImportMethod:    kmspb.ImportJob_RSA_OAEP_3072_SHA1_AES_256,
+			ProtectionLevel: kmspb.ProtectionLevel_SOFTWARE,
+		},
+	})
+	if err != nil {
+		t.Fatalf("create import job: %v", err)
+	}
+	if created.GetState() != kmspb.ImportJob_PENDING_GENERATION || created.GetPublicKey() != nil {
+		t.Fatalf("created import job = %v, want PENDING_GENERATION without a public key", created)
+	}
+	if got, want := created.GetExpireTime().AsTime(), clock.Now().Add(72*time.Hour); !got.Equal(want) {
+		t.Fatalf("expire_time = %v, want %v", got, want)
+	}
+
+	job, err := svc.GetImportJob(ctx, &kmspb.GetImportJobRequest{Name: created.GetName()})
+	if err != nil {
+		t.Fatalf("get import job: %v", err)
+	}
+	if job.GetState() != kmspb.ImportJob_ACTIVE || job.GetGenerateTime() == nil {
+		t.Fatalf("import job = %v, want ACTIVE", job)
+	}
+	block, _ := pem.Decode([]byte(job.GetPublicKey().GetPem()))
+	if block == nil {
+		t.Fatalf("public key is not PEM: %q", job.GetPublicKey().GetPem())
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("parse public key: %v", err)
+	}
+	if pub, ok := parsed.(*rsa.PublicKey); !ok || pub.N.BitLen() != 3072 {
+		t.Fatalf("public key = %T, want 3072-bit RSA", parsed)
+	}
+
+	list, err := svc.ListImportJobs(ctx, &kmspb.ListImportJobsRequest{Parent: keyRing, Filter: "state=ACTIVE"})
+	if err != nil {
+		t.Fatalf("list import jobs: %v", err)
+	}
+	if len(list.GetImportJobs()) != 1 || list.GetImportJobs()[0].GetName() != created.GetName() {
+		t.Fatalf("list import jobs = %v", list.GetImportJobs())
+	}
+
+	clock.Advance(72 * time.Hour)
+	expired, err := svc.GetImportJob(ctx, &kmspb.GetImportJobRequest{Name: created.GetName()})
+	if err != nil {
+		t.Fatalf("get expired import job: %v", err)
+	}
+	if expired.GetState() != kmspb.ImportJob_EXPIRED || !expired.GetExpireEventTime().AsTime().Equal(created.GetExpireTime().AsTime()) {
+		t.Fatalf("import job = %v, want EXPIRED at expire_time", expired)
+	}
+
+	for _, tc := range []struct {
+		name string
+		req  *kmspb.CreateImportJobRequest
+		code codes.Code
+	}{
+		{"duplicate", &kmspb.CreateImportJobRequest{Parent: keyRing, ImportJobId: "job", ImportJob: created}, codes.AlreadyExists},
+		{"missing method", &kmspb.CreateImportJobRequest{Parent: keyRing, ImportJobId: "other", ImportJob: &kmspb.ImportJob{ProtectionLevel: kmspb.ProtectionLevel_SOFTWARE}}, codes.InvalidArgument},
+		{"missing protection level", &kmspb.CreateImportJobRequest{Parent: keyRing, ImportJobId: "other", ImportJob: &kmspb.ImportJob{ImportMethod: kmspb.ImportJob_RSA_OAEP_3072_SHA256}}, codes.InvalidArgument},
+		{"invalid id", &kmspb.CreateImportJobRequest{Parent: keyRing, ImportJobId: "bad id", ImportJob: created}, codes.InvalidArgument},
+		{"missing key ring", &kmspb.CreateImportJobRequest{Parent: "projects/demo/locations/global/keyRings/missing", ImportJobId: "other", ImportJob: created}, codes.NotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := svc.CreateImportJob(ctx, tc.req)
+			requireStatusCode(t, err, tc.code)
+		})
+	}
+}
+
+func TestImportCryptoKeyVersion(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clock := newFakeClock()
+	svc := service.New(memory.New(), kmscrypto.NewTinkEngine(), service.WithClock(clock))
+	keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "byok")
+	job := createImportJob(t, svc, keyRing, "job", kmspb.ImportJob_RSA_OAEP_3072_SHA256_AES_256, kmspb.ProtectionLevel_SOFTWARE)
+
+	t.Run("import_only keys", func(t *testing.T) {
+		_, err := svc.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+			Parent:      keyRing,
+			CryptoKeyId: "needs-skip",
+			CryptoKey:   &kmspb.CryptoKey{Purpose: kmspb.CryptoKey_ENCRYPT_DECRYPT, ImportOnly: true},
+		})
+		requireStatusCode(t, err, codes.InvalidArgument)
+
+		ck, err := svc.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+			Parent:                     keyRing,
+			CryptoKeyId:                "imported",
+			CryptoKey:                  &kmspb.CryptoKey{Purpose: kmspb.CryptoKey_ENCRYPT_DECRYPT, ImportOnly: true},
+			SkipInitialVersionCreation: true,
+		})
+		if err != nil {
+			t.Fatalf("create import-only key: %v", err)
+		}
+		if ck.GetPrimary() != nil || !ck.GetImportOnly() {
+			t.Fatalf("import-only key = %v, want no primary", ck)
+		}
+		_, err = svc.CreateCryptoKeyVersion(ctx, &kmspb.CreateCryptoKeyVersionRequest{Parent: ck.GetName()})
+		requireStatusCode(t, err, codes.FailedPrecondition)
+		_, err = svc.Encrypt(ctx, &kmspb.EncryptRequest{Name: ck.GetName(), Plaintext: []byte("hello")})
+		requireStatusCode(t, err, codes.FailedPrecondition)
+
+		version, err := svc.ImportCryptoKeyVersion(ctx, &kmspb.ImportCryptoKeyVersionRequest{
+			Parent:     ck.GetName(),
+			Algorithm:  kmspb.CryptoKeyVersion_GOOGLE_SYMMETRIC_ENCRYPTION,
+			ImportJob:  job.GetName(),
+			WrappedKey: wrapKeyForImport(t, job, bytes.Repeat([]byte{0x42}, 32)),
+		})
+		if err != nil {
+			t.Fatalf("import symmetric key: %v", err)
+		}
+		if version.GetName() != ck.GetName()+"/cryptoKeyVersions/1" || version.GetState() != kmspb.CryptoKeyVersion_ENABLED {
+			t.Fatalf("imported version = %v", version)
+		}
+		if version.GetImportJob() != job.GetName() || version.GetImportTime() == nil || !version.GetReimportEligible() {
+			t.Fatalf("imported version lacks import metadata: %v", version)
+		}
+
+		enc := mustEncrypt(t, ctx, svc, &kmspb.EncryptRequest{Name: ck.GetName(), Plaintext: []byte("hello")})
+		if enc.GetName() != version.GetName() {
+			t.Fatalf("encrypt used %s, want the imported version as primary", enc.GetName())
+		}
+		dec := mustDecrypt(t, ctx, svc, &kmspb.DecryptRequest{Name: ck.GetName(), Ciphertext: enc.GetCiphertext()})
+		if string(dec.GetPlaintext()) != "hello" {
+			t.Fatalf("plaintext = %q, want hello", dec.GetPlaintext())
+		}
+	})
+
+	t.Run("asymmetric key keeps the imported key pair", func(t *testing.T) {
+		directJob := createImportJob(t, svc, keyRing, "direct", kmspb.ImportJob_RSA_OAEP_4096_SHA256, kmspb.ProtectionLevel_SOFTWARE)
+		ck, err := svc.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+			Parent:      keyRing,
+			CryptoKeyId: "signer",
+			CryptoKey: &kmspb.CryptoKey{
+				Purpose:         kmspb.CryptoKey_ASYMMETRIC_SIGN,
+				VersionTemplate: &kmspb.CryptoKeyVersionTemplate{Algorithm: kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256},
+			},
+		})
+		if err != nil {
+			t.Fatalf("create signing key: %v", err)
+		}
+
+		local, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("generate p256 key: %v", err)
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(local)
+		if err != nil {
+			t.Fatalf("marshal p256 key: %v", err)
+		}
+		version, err := svc.ImportCryptoKeyVersion(ctx, &kmspb.ImportCryptoKeyVersionRequest{
+			Parent:     ck.GetName(),
+			Algorithm:  kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256,
+			ImportJob:  directJob.GetName(),
+			WrappedKey: wrapKeyForImport(t, directJob, der),
+		})
+		if err != nil {
+			t.Fatalf("import p256 key: %v", err)
+		}
+		if version.GetName() != ck.GetName()+"/cryptoKeyVersions/2" {
+			t.Fatalf("imported version name = %s, want version 2", version.GetName())
+		}
+
+		digest := sha256.Sum256([]byte("payload"))
+		sig, err := svc.AsymmetricSign(ctx, &kmspb.AsymmetricSignRequest{
+			Name:   version.GetName(),
+			Digest: &kmspb.Digest{Digest: &kmspb.Digest_Sha256{Sha256: digest[:]}},
+		})
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		if !ecdsa.VerifyASN1(&local.PublicKey, digest[:], sig.GetSignature()) {
+			t.Fatal("signature does not verify with the imported key")
+		}
+
+		for _, tc := range []struct {
+			name string
+			req  *kmspb.ImportCryptoKeyVersionRequest
+			code codes.Code
+		}{
+			{"algorithm of another purpose", &kmspb.ImportCryptoKeyVersionRequest{Parent: ck.GetName(), Algorithm: kmspb.CryptoKeyVersion_GOOGLE_SYMMETRIC_ENCRYPTION, ImportJob: directJob.GetName(), WrappedKey: wrapKeyForImport(t, directJob, bytes.Repeat([]byte{1}, 32))}, codes.InvalidArgument},
+			{"key of another curve", &kmspb.ImportCryptoKeyVersionRequest{Parent: ck.GetName(), Algorithm: kmspb.CryptoKeyVersion_EC_SIGN_P384_SHA384, ImportJob: directJob.GetName(), WrappedKey: wrapKeyForImport(t, directJob, der)}, codes.InvalidArgument},
+			{"wrapped for another job", &kmspb.ImportCryptoKeyVersionRequest{Parent: ck.GetName(), Algorithm: kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256, ImportJob: directJob.GetName(), WrappedKey: wrapKeyForImport(t, job, der)}, codes.InvalidArgument},
+			{"missing wrapped key", &kmspb.ImportCryptoKeyVersionRequest{Parent: ck.GetName(), Algorithm: kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256, ImportJob: directJob.GetName()}, codes.InvalidArgument},
+			{"missing import job", &kmspb.ImportCryptoKeyVersionRequest{Parent: ck.GetName(), Algorithm: kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256, ImportJob: keyRing + "/importJobs/missing", WrappedKey: []byte("x")}, codes.NotFound},
+			{"reimport into generated version", &kmspb.ImportCryptoKeyVersionRequest{Parent: ck.GetName(), CryptoKeyVersion: ck.GetName() + "/cryptoKeyVersions/1", Algorithm: kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256, ImportJob: directJob.GetName(), WrappedKey: wrapKeyForImport(t, directJob, der)}, codes.FailedPrecondition},
+			{"reimport into enabled version", &kmspb.ImportCryptoKeyVersionRequest{Parent: ck.GetName(), CryptoKeyVersion: version.GetName(), Algorithm: kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256, ImportJob: directJob.GetName(), WrappedKey: wrapKeyForImport(t, directJob, der)}, codes.FailedPrecondition},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				_, err := svc.ImportCryptoKeyVersion(ctx, tc.req)
+				requireStatusCode(t, err, tc.code)
+			})
+		}
+	})
+
+	t.Run("protection level must match", func(t *testing.T) {
+		hsmJob := createImportJob(t, svc, keyRing, "hsm", kmspb.ImportJob_RSA_OAEP_3072_SHA256, kmspb.ProtectionLevel_HSM)
+		if hsmJob.GetAttestation() == nil {
+			t.Fatal("HSM import job must carry an attestation")
+		}
+		cryptoKey := createCryptoKey(t, svc, keyRing, "software")
+		_, err := svc.ImportCryptoKeyVersion(ctx, &kmspb.ImportCryptoKeyVersionRequest{
+			Parent:     cryptoKey,
+			Algorithm:  kmspb.CryptoKeyVersion_GOOGLE_SYMMETRIC_ENCRYPTION,
+			ImportJob:  hsmJob.GetName(),
+			WrappedKey: wrapKeyForImport(t, hsmJob, bytes.Repeat([]byte{1}, 32)),
+		})
+		requireStatusCode(t, err, codes.FailedPrecondition)
+	})
+
+	t.Run("reimport into destroyed version", func(t *testing.T) {
+		cryptoKey := keyRing + "/cryptoKeys/imported"
+		versionName := cryptoKey + "/cryptoKeyVersions/1"
+		if _, err := svc.DestroyCryptoKeyVersion(ctx, &kmspb.DestroyCryptoKeyVersionRequest{Name: versionName}); err != nil {
+			t.Fatalf("destroy version: %v", err)
+		}
+		clock.Advance(31 * 24 * time.Hour)
+
+		_, err := svc.ImportCryptoKeyVersion(ctx, &kmspb.ImportCryptoKeyVersionRequest{
+			Parent:           cryptoKey,
+			CryptoKeyVersion: versionName,
+			Algorithm:        kmspb.CryptoKeyVersion_GOOGLE_SYMMETRIC_ENCRYPTION,
+			ImportJob:        job.GetName(),
+			WrappedKey:       wrapKeyForImport(t, job, bytes.Repeat([]byte{0x42}, 32)),
+		})
+		requireStatusCode(t, err, codes.FailedPrecondition) // the import job has expired
+
+		freshJob := createImportJob(t, svc, keyRing, "fresh", kmspb.ImportJob_RSA_OAEP_4096_SHA1_AES_256, kmspb.ProtectionLevel_SOFTWARE)
+		version, err := svc.ImportCryptoKeyVersion(ctx, &kmspb.ImportCryptoKeyVersionRequest{
+			Parent:           cryptoKey,
+			CryptoKeyVersion: versionName,
+			Algorithm:        kmspb.CryptoKeyVersion_GOOGLE_SYMMETRIC_ENCRYPTION,
+			ImportJob:        freshJob.GetName(),
+			WrappedKey:       wrapKeyForImport(t, freshJob, bytes.Repeat([]byte{0x42}, 32)),
+		})
+		if err != nil {
+			t.Fatalf("reimport: %v", err)
+		}
+		if version.GetState() != kmspb.CryptoKeyVersion_ENABLED || version.GetImportJob() != freshJob.GetName() || version.GetDestroyEventTime() != nil {
+			t.Fatalf("reimported version = %v", version)
+		}
+		enc := mustEncrypt(t, ctx, svc, &kmspb.EncryptRequest{Name: cryptoKey, Plaintext: []byte("again")})
+		dec := mustDecrypt(t, ctx, svc, &kmspb.DecryptRequest{Name: cryptoKey, Ciphertext: enc.GetCiphertext()})
+		if string(dec.GetPlaintext()) != "again" {
+			t.Fatalf("plaintext = %q, want again", dec.GetPlaintext())
+		}
+	})
+}
+
+func TestIamPolicies(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc, cryptoKey := setupKey(t)
+	keyRing := "projects/demo/locations/global/keyRings/app"
+
+	empty, err := svc.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{Resource: cryptoKey})
+	if err != nil {
+		t.Fatalf("get empty policy: %v", err)
+	}
+	if len(empty.GetBindings()) != 0 || len(empty.GetEtag()) == 0 {
+		t.Fatalf("empty policy = %v, want no bindings and an etag", empty)
+	}
+
+	conditional := &iampb.Policy{
+		Version: 3,
+		Etag:    empty.GetEtag(),
+		Bindings: []*iampb.Binding{
+			{Role: "roles/cloudkms.cryptoKeyEncrypterDecrypter", Members: []string{"user:alice@example.com"}},
+			{
+				Role:      "roles/cloudkms.viewer",
+				Members:   []string{"serviceAccount:ci@demo.iam.gserviceaccount.com"},
+				Condition: &expr.Expr{Title: "until 2030", Expression: `request.time < timestamp("2030-01-01T00:00:00Z")`},
+			},
+		},
+	}
+	set, err := svc.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{Resource: cryptoKey, Policy: conditional})
+	if err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+	if bytes.Equal(set.GetEtag(), empty.GetEtag()) {
+		t.Fatal("etag did not change after SetIamPolicy")
+	}
+	_, err = svc.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{Resource: cryptoKey, Policy: conditional})
+	requireStatusCode(t, err, codes.Aborted)
+
+	v3, err := svc.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
+		Resource: cryptoKey,
+		Options:  &iampb.GetPolicyOptions{RequestedPolicyVersion: 3},
+	})
+	if err != nil {
+		t.Fatalf("get v3 policy: %v", err)
+	}
+	if v3.GetVersion() != 3 || !bytes.Equal(v3.GetEtag(), set.GetEtag()) || v3.GetBindings()[1].GetCondition().GetTitle() != "until 2030" {
+		t.Fatalf("v3 policy = %v", v3)
+	}
+	v1, err := svc.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{Resource: cryptoKey})
+	if err != nil {
+		t.Fatalf("get v1 policy: %v", err)
+	}
+	if role := v1.GetBindings()[1].GetRole(); v1.GetVersion() != 1 || !strings.HasPrefix(role, "roles/cloudkms.viewer_withcond_") || v1.GetBindings()[1].GetCondition() != nil {
+		t.Fatalf("v1 policy = %v, want the conditional binding under a _withcond_ role", v1)
+	}
+	_, err = svc.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{Resource: cryptoKey, Policy: v1})
+	requireStatusCode(t, err, codes.InvalidArgument)
+
+	ringPolicy, err := svc.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{Resource: keyRing})
+	if err != nil {
+		t.Fatalf("get key ring policy: %v", err)
+	}
+	if len(ringPolicy.GetBindings()) != 0 {
+		t.Fatalf("key ring policy = %v, want its own empty policy", ringPolicy)
+	}
+
+	t.Run("audit configs survive unless masked", func(t *testing.T) {
+		withAudit, err := svc.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{
+			Resource: keyRing,
+			Policy: &iampb.Policy{AuditConfigs: []*iampb.AuditConfig{{
+				Service:         "cloudkms.googleapis.com",
+				AuditLogConfigs: []*iampb.AuditLogConfig{{LogType: iampb.AuditLogConfig_DATA_READ}},
+			}}},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"audit_configs"}},
+		})
+		if err != nil {
+			t.Fatalf("set audit configs: %v", err)
+		}
+		updated, err := svc.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{
+			Resource: keyRing,
+			Policy: &iampb.Policy{
+				Etag:     withAudit.GetEtag(),
+				Bindings: []*iampb.Binding{{Role: "roles/cloudkms.admin", Members: []string{"group:ops@example.com"}}},
+			},
+		})
+		if err != nil {
+			t.Fatalf("set bindings: %v", err)
+		}
+		if len(updated.GetAuditConfigs()) != 1 || len(updated.GetBindings()) != 1 {
+			t.Fatalf("policy = %v, want the binding and the earlier audit config", updated)
+		}
+	})
+
+	t.Run("test permissions", func(t *testing.T) {
+		resp, err := svc.TestIamPermissions(ctx, &iampb.TestIamPermissionsRequest{
+			Resource: cryptoKey,
+			Permissions: []string{
+				"cloudkms.cryptoKeyVersions.useToEncrypt",
+				"cloudkms.keyRings.get",
+				"cloudkms.cryptoKeys.get",
+				"storage.objects.get",
+			},
+		})
+		if err != nil {
+			t.Fatalf("test permissions: %v", err)
+		}
+		want := []string{"cloudkms.cryptoKeyVersions.useToEncrypt", "cloudkms.cryptoKeys.get"}
+		if !slices.Equal(resp.GetPermissions(), want) {
+			t.Fatalf("permissions = %v, want %v", resp.GetPermissions(), want)
+		}
+		resp, err = svc.TestIamPermissions(ctx, &iampb.TestIamPermissionsRequest{
+			Resource:    keyRing,
+			Permissions: []string{"cloudkms.keyRings.get", "cloudkms.cryptoKeyVersions.useToDecrypt"},
+		})
+		if err != nil || len(resp.GetPermissions()) != 2 {
+			t.Fatalf("key ring permissions = %v, %v", resp.GetPermissions(), err)
+		}
+		resp, err = svc.TestIamPermissions(ctx, &iampb.TestIamPermissionsRequest{
+			Resource:    "projects/demo",
+			Permissions: []string{"cloudkms.keyRings.create", "cloudkms.locations.generateRandomBytes"},
+		})
+		if err != nil || len(resp.GetPermissions()) != 2 {
+			t.Fatalf("project permissions = %v, %v", resp.GetPermissions(), err)
+		}
+		_, err = svc.TestIamPermissions(ctx, &iampb.TestIamPermissionsRequest{Resource: cryptoKey, Permissions: []string{"cloudkms.*"}})
+		requireStatusCode(t, err, codes.InvalidArgument)
+	})
+
+	for _, tc := range []struct {
+		name     string
+		resource string
+		policy   *iampb.Policy
+		code     codes.Code
+	}{
+		{"version resource", cryptoKey + "/cryptoKeyVersions/1", &iampb.Policy{}, codes.InvalidArgument},
+		{"missing resource", keyRing + "/cryptoKeys/missing", &iampb.Policy{}, codes.NotFound},
+		{"bad version", cryptoKey, &iampb.Policy{Version: 2}, codes.InvalidArgument},
+		{"condition without version 3", cryptoKey, &iampb.Policy{Bindings: []*iampb.Binding{
+			{Role: "roles/cloudkms.viewer", Members: []string{"user:a@example.com"}, Condition: &expr.Expr{Title: "t", Expression: "true"}},
+		}}, codes.InvalidArgument},
+		{"condition without title", cryptoKey, &iampb.Policy{Version: 3, Bindings: []*iampb.Binding{
+			{Role: "roles/cloudkms.viewer", Members: []string{"user:a@example.com"}, Condition: &expr.Expr{Expression: "true"}},
+		}}, codes.InvalidArgument},
+		{"bad role", cryptoKey, &iampb.Policy{Bindings: []*iampb.Binding{{Role: "viewer", Members: []string{"user:a@example.com"}}}}, codes.InvalidArgument},
+		{"bad member", cryptoKey, &iampb.Policy{Bindings: []*iampb.Binding{{Role: "roles/cloudkms.viewer", Members: []string{"alice"}}}}, codes.InvalidArgument},
+		{"no members", cryptoKey, &iampb.Policy{Bindings: []*iampb.Binding{{Role: "roles/cloudkms.viewer"}}}, codes.InvalidArgument},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := svc.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{Resource: tc.resource, Policy: tc.policy})
+			requireStatusCode(t, err, tc.code)
+		})
+	}
+}
+
+func TestLocations(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	t.Run("default catalog", func(t *testing.T) {
+		svc := newTestService()
+		loc, err := svc.GetLocation(ctx, &location.GetLocationRequest{Name: "projects/demo/locations/us-east1"})
+		if err != nil {
+			t.Fatalf("get location: %v", err)
+		}
+		var metadata kmspb.LocationMetadata
+		if err := loc.GetMetadata().UnmarshalTo(&metadata); err != nil {
+			t.Fatalf("unpack metadata: %v", err)
+		}
+		if loc.GetLocationId() != "us-east1" || loc.GetDisplayName() != "South Carolina" || !metadata.GetHsmAvailable() || !metadata.GetEkmAvailable() {
+			t.Fatalf("location = %v, metadata = %v", loc, &metadata)
+		}
+
+		var ids []string
+		req := &location.ListLocationsRequest{Name: "projects/demo", PageSize: 5}
+		for {
+			resp, err := svc.ListLocations(ctx, req)
+			if err != nil {
+				t.Fatalf("list locations: %v", err)
+			}
+			for _, loc := range resp.GetLocations() {
+				ids = append(ids, loc.GetLocationId())
+			}
+			if resp.GetNextPageToken() == "" {
+				break
+			}
+			req.PageToken = resp.GetNextPageToken()
+		}
+		if len(ids) != len(service.DefaultLocations()) || !slices.IsSorted(ids) || !slices.Contains(ids, "global") {
+			t.Fatalf("listed locations = %v", ids)
+		}
+
+		if _, err := svc.CreateKeyRing(ctx, &kmspb.CreateKeyRingRequest{Parent: "projects/demo/locations/moon", KeyRingId: "app"}); err != nil {
+			t.Fatalf("create key ring outside the catalog without strict mode: %v", err)
+		}
+		_, err = svc.GetLocation(ctx, &location.GetLocationRequest{Name: "projects/demo/locations/moon"})
+		requireStatusCode(t, err, codes.NotFound)
+		_, err = svc.ListLocations(ctx, &location.ListLocationsRequest{Name: "projects/demo/locations/global"})
+		requireStatusCode(t, err, codes.InvalidArgument)
+	})
+
+	t.Run("custom strict catalog", func(t *testing.T) {
+		svc := service.New(memory.New(), kmscrypto.NewTinkEngine(),
+			service.WithLocations([]service.Location{
+				{ID: "lab-b", Labels: map[string]string{"tier": "backup"}},
+				{ID: "lab-a", DisplayName: "Lab A", Labels: map[string]string{"tier": "primary"}, EKMAvailable: true},
+			}),
+			service.WithStrictLocations(),
+		)
+		resp, err := svc.ListLocations(ctx, &location.ListLocationsRequest{Name: "projects/demo", Filter: "labels.tier=primary"})
+		if err != nil {
+			t.Fatalf("list locations: %v", err)
+		}
+		if len(resp.GetLocations()) != 1 || resp.GetLocations()[0].GetName() != "projects/demo/locations/lab-a" {
+			t.Fatalf("filtered locations = %v", resp.GetLocations())
+		}
+
+		if _, err := svc.CreateKeyRing(ctx, &kmspb.CreateKeyRingRequest{Parent: "projects/demo/locations/lab-b", KeyRingId: "app"}); err != nil {
+			t.Fatalf("create key ring in the catalog: %v", err)
+		}
+		_, err = svc.CreateKeyRing(ctx, &kmspb.CreateKeyRingRequest{Parent: "projects/demo/locations/global", KeyRingId: "app"})
+		requireStatusCode(t, err, codes.InvalidArgument)
+	})
+}
+
+func TestAutokey(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc := newTestService()
+	const configName = "projects/demo/autokeyConfig"
+	keyProjectMask := &fieldmaskpb.FieldMask{Paths: []string{"key_project"}}
+
+	initial, err := svc.GetAutokeyConfig(ctx, &kmspb.GetAutokeyConfigRequest{Name: configName})
+	if err != nil {
+		t.Fatalf("get autokey config: %v", err)
+	}
+	if initial.GetState() != kmspb.AutokeyConfig_UNINITIALIZED || initial.GetEtag() == "" {
+		t.Fatalf("initial config = %v", initial)
+	}
+
+	parent := "projects/demo/locations/us-east1"
+	_, err = svc.CreateKeyHandle(ctx, &kmspb.CreateKeyHandleRequest{
+		Parent:    parent,
+		KeyHandle: &kmspb.KeyHandle{ResourceTypeSelector: "storage.googleapis.com/Bucket"},
+	})
+	requireStatusCode(t, err, codes.FailedPrecondition)
+
+	config, err := svc.UpdateAutokeyConfig(ctx, &kmspb.UpdateAutokeyConfigRequest{
+		AutokeyConfig: &kmspb.AutokeyConfig{Name: configName, KeyProject: "projects/keys", Etag: initial.GetEtag()},
+		UpdateMask:    keyProjectMask,
+	})
+	if err != nil {
+		t.Fatalf("update autokey config: %v", err)
+	}
+	if config.GetState() != kmspb.AutokeyConfig_ACTIVE || config.GetEtag() == initial.GetEtag() {
+		t.Fatalf("updated config = %v", config)
+	}
+	_, err = svc.UpdateAutokeyConfig(ctx, &kmspb.UpdateAutokeyConfigRequest{
+		AutokeyConfig: &kmspb.AutokeyConfig{Name: configName, KeyProject: "projects/other", Etag: initial.GetEtag()},
+		UpdateMask:    keyProjectMask,
+	})
+	requireStatusCode(t, err, codes.Aborted)
+	_, err = svc.UpdateAutokeyConfig(ctx, &kmspb.UpdateAutokeyConfigRequest{
+		AutokeyConfig: &kmspb.AutokeyConfig{Name: configName, KeyProject: "keys"},
+		UpdateMask:    keyProjectMask,
+	})
+	requireStatusCode(t, err, codes.InvalidArgument)
+
+	effective, err := svc.ShowEffectiveAutokeyConfig(ctx, &kmspb.ShowEffectiveAutokeyConfigRequest{Parent: "projects/demo"})
+	if err != nil {
+		t.Fatalf("show effective autokey config: %v", err)
+	}
+	if effective.GetKeyProject() != "projects/keys" {
+		t.Fatalf("effective key project = %q", effective.GetKeyProject())
+	}
+
+	op, err := svc.CreateKeyHandle(ctx, &kmspb.CreateKeyHandleRequest{
+		Parent:      parent,
+		KeyHandleId: "bucket",
+		KeyHandle:   &kmspb.KeyHandle{ResourceTypeSelector: "storage.googleapis.com/Bucket"},
+	})
+	if err != nil {
+		t.Fatalf("create key handle: %v", err)
+	}
+	var handle kmspb.KeyHandle
+	if !op.GetDone() || op.GetResponse().UnmarshalTo(&handle) != nil {
+		t.Fatalf("operation = %v", op)
+	}
+	if handle.GetName() != parent+"/keyHandles/bucket" || !strings.HasPrefix(handle.GetKmsKey(), "projects/keys/locations/us-east1/keyRings/autokey/cryptoKeys/storage-bucket-") {
+		t.Fatalf("key handle = %v", &handle)
+	}
+	key, err := svc.GetCryptoKey(ctx, &kmspb.GetCryptoKeyRequest{Name: handle.GetKmsKey()})
+	if err != nil {
+		t.Fatalf("get provisioned key: %v", err)
+	}
+	if key.GetPurpose() != kmspb.CryptoKey_ENCRYPT_DECRYPT || key.GetVersionTemplate().GetProtectionLevel() != kmspb.ProtectionLevel_HSM ||
+		key.GetRotationPeriod().AsDuration() != 365*24*time.Hour {
+		t.Fatalf("provisioned key = %v", key)
+	}
+	_, err = svc.CreateKeyHandle(ctx, &kmspb.CreateKeyHandleRequest{
+		Parent:      parent,
+		KeyHandleId: "bucket",
+		KeyHandle:   &kmspb.KeyHandle{ResourceTypeSelector: "storage.googleapis.com/Bucket"},
+	})
+	requireStatusCode(t, err, codes.AlreadyExists)
+	_, err = svc.CreateKeyHandle(ctx, &kmspb.CreateKeyHandleRequest{
+		Parent:    parent,
+		KeyHandle: &kmspb.KeyHandle{ResourceTypeSelector: "bucket"},
+	})
+	requireStatusCode(t, err, codes.InvalidArgument)
+
+	if _, err := svc.CreateKeyHandle(ctx, &kmspb.CreateKeyHandleRequest{
+		Parent:    parent,
+		KeyHandle: &kmspb.KeyHandle{ResourceTypeSelector: "compute.googleapis.com/Disk"},
+	}); err != nil {
+		t.Fatalf("create key handle with a generated id: %v", err)
+	}
+	resp, err := svc.ListKeyHandles(ctx, &kmspb.ListKeyHandlesRequest{
+		Parent: parent,
+		Filter: `resource_type_selector="storage.googleapis.com/Bucket"`,
+	})
+	if err != nil {
+		t.Fatalf("list key handles: %v", err)
+	}
+	if len(resp.GetKeyHandles()) != 1 || resp.GetKeyHandles()[0].GetName() != handle.GetName() {
+		t.Fatalf("filtered key handles = %v", resp.GetKeyHandles())
+	}
+	got, err := svc.GetKeyHandle(ctx, &kmspb.GetKeyHandleRequest{Name: handle.GetName()})
+	if err != nil || got.GetKmsKey() != handle.GetKmsKey() {
+		t.Fatalf("get key handle = %v, %v", got, err)
+	}
+}
+
+func TestOperations(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clk := clock.NewVirtual(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	clk.Freeze()
+	svc := service.New(memory.New(), kmscrypto.NewTinkEngine(),
+		service.WithClock(clk),
+		service.WithOperationTiming(operations.Timing{Delay: time.Minute, UseClock: true}),
+	)
+	if _, err := svc.UpdateAutokeyConfig(ctx, &kmspb.UpdateAutokeyConfigRequest{
+		AutokeyConfig: &kmspb.AutokeyConfig{Name: "projects/demo/autokeyConfig", KeyProject: "projects/keys"},
+		UpdateMask:    &fieldmaskpb.FieldMask{Paths: []string{"key_project"}},
+	}); err != nil {
+		t.Fatalf("update autokey config: %v", err)
+	}
+
+	parent := "projects/demo/locations/global"
+	createHandle := func(id string) *longrunningpb.Operation {
+		t.Helper()
+		op, err := svc.CreateKeyHandle(ctx, &kmspb.CreateKeyHandleRequest{
+			Parent:      parent,
+			KeyHandleId: id,
+			KeyHandle:   &kmspb.KeyHandle{ResourceTypeSelector: "storage.googleapis.com/Bucket"},
+		})
+		if err != nil {
+			t.Fatalf("create key handle %s: %v", id, err)
+		}
+		return op
+	}
+	pending := createHandle("pending")
+	cancelled := createHandle("cancelled")
+	if pending.GetDone() || !strings.HasPrefix(pending.GetName(), parent+"/operations/") {
+		t.Fatalf("operation = %v", pending)
+	}
+	_, err := svc.GetKeyHandle(ctx, &kmspb.GetKeyHandleRequest{Name: parent + "/keyHandles/pending"})
+	requireStatusCode(t, err, codes.NotFound)
+
+	waited, err := svc.WaitOperation(ctx, &longrunningpb.WaitOperationRequest{Name: pending.GetName(), Timeout: durationpb.New(10 * time.Millisecond)})
+	if err != nil || waited.GetDone() {
+		t.Fatalf("wait on a frozen clock = %v, %v", waited, err)
+	}
+	if _, err := svc.CancelOperation(ctx, &longrunningpb.CancelOperationRequest{Name: cancelled.GetName()}); err != nil {
+		t.Fatalf("cancel operation: %v", err)
+	}
+
+	if err := clk.Advance(time.Minute); err != nil {
+		t.Fatalf("advance clock: %v", err)
+	}
+	done, err := svc.GetOperation(ctx, &longrunningpb.GetOperationRequest{Name: pending.GetName()})
+	if err != nil {
+		t.Fatalf("get operation: %v", err)
+	}
+	var handle kmspb.KeyHandle
+	if !done.GetDone() || done.GetResponse().UnmarshalTo(&handle) != nil || handle.GetName() != parent+"/keyHandles/pending" {
+		t.Fatalf("completed operation = %v", done)
+	}
+	_, err = svc.GetKeyHandle(ctx, &kmspb.GetKeyHandleRequest{Name: parent + "/keyHandles/cancelled"})
+	requireStatusCode(t, err, codes.NotFound)
+
+	resp, err := svc.ListOperations(ctx, &longrunningpb.ListOperationsRequest{Name: parent, Filter: "done=true", PageSize: 1})
+	if err != nil {
+		t.Fatalf("list operations: %v", err)
+	}
+	if len(resp.GetOperations()) != 1 || resp.GetNextPageToken() == "" {
+		t.Fatalf("first page = %v", resp)
+	}
+	_, err = svc.GetOperation(ctx, &longrunningpb.GetOperationRequest{Name: parent + "/operations/missing"})
+	requireStatusCode(t, err, codes.NotFound)
+	_, err = svc.GetOperation(ctx, &longrunningpb.GetOperationRequest{Name: "operations/missing"})
+	requireStatusCode(t, err, codes.InvalidArgument)
+}
+
+func TestCreateKeyHandleWhilePending(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clk := clock.NewVirtual(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	clk.Freeze()
+	svc := service.New(memory.New(), kmscrypto.NewTinkEngine(),
+		service.WithClock(clk),
+		service.WithOperationTiming(operations.Timing{Delay: time.Minute, UseClock: true}),
+	)
+	if _, err := svc.UpdateAutokeyConfig(ctx, &kmspb.UpdateAutokeyConfigRequest{
+		AutokeyConfig: &kmspb.AutokeyConfig{Name: "projects/demo/autokeyConfig", KeyProject: "projects/keys"},
+		UpdateMask:    &fieldmaskpb.FieldMask{Paths: []string{"key_project"}},
+	}); err != nil {
+		t.Fatalf("update autokey config: %v", err)
+	}
+
+	req := &kmspb.CreateKeyHandleRequest{
+		Parent:      "projects/demo/locations/global",
+		KeyHandleId: "bucket",
+		KeyHandle:   &kmspb.KeyHandle{ResourceTypeSelector: "storage.googleapis.com/Bucket"},
+	}
+	first, err := svc.CreateKeyHandle(ctx, req)
+	if err != nil {
+		t.Fatalf("create key handle: %v", err)
+	}
+	_, err = svc.CreateKeyHandle(ctx, req)
+	requireStatusCode(t, err, codes.AlreadyExists)
+
+	// Cancelling the pending operation frees the name for a retry.
+	if _, err := svc.CancelOperation(ctx, &longrunningpb.CancelOperationRequest{Name: first.GetName()}); err != nil {
+		t.Fatalf("cancel operation: %v", err)
+	}
+	retry, err := svc.CreateKeyHandle(ctx, req)
+	if err != nil {
+		t.Fatalf("retry key handle: %v", err)
+	}
+	_, err = svc.CreateKeyHandle(ctx, req)
+	requireStatusCode(t, err, codes.AlreadyExists)
+
+	if err := clk.Advance(time.Minute); err != nil {
+		t.Fatalf("advance clock: %v", err)
+	}
+	done, err := svc.GetOperation(ctx, &longrunningpb.GetOperationRequest{Name: retry.GetName()})
+	if err != nil {
+		t.Fatalf("get operation: %v", err)
+	}
+	if !done.GetDone() || done.GetError() != nil {
+		t.Fatalf("retried operation = %v", done)
+	}
+	keys, err := svc.ListCryptoKeys(ctx, &kmspb.ListCryptoKeysRequest{Parent: "projects/keys/locations/global/keyRings/autokey"})
+	if err != nil {
+		t.Fatalf("list autokey keys: %v", err)
+	}
+	if len(keys.GetCryptoKeys()) != 1 {
+		t.Fatalf("autokey keys = %v, want exactly one", keys.GetCryptoKeys())
+	}
+	_, err = svc.CreateKeyHandle(ctx, req)
+	requireStatusCode(t, err, codes.AlreadyExists)
+}
+
+func TestCreateKeyHandleRollsBackItsKey(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	st := &hookedStore{Store: memory.New(), createKeyHandleErr: status.Error(codes.Internal, "store unavailable")}
+	svc := service.New(st, kmscrypto.NewTinkEngine())
+	if _, err := svc.UpdateAutokeyConfig(ctx, &kmspb.UpdateAutokeyConfigRequest{
+		AutokeyConfig: &kmspb.AutokeyConfig{Name: "projects/demo/autokeyConfig", KeyProject: "projects/keys"},
+		UpdateMask:    &fieldmaskpb.FieldMask{Paths: []string{"key_project"}},
+	}); err != nil {
+		t.Fatalf("update autokey config: %v", err)
+	}
+
+	op, err := svc.CreateKeyHandle(ctx, &kmspb.CreateKeyHandleRequest{
+		Parent:      "projects/demo/locations/global",
+		KeyHandleId: "bucket",
+		KeyHandle:   &kmspb.KeyHandle{ResourceTypeSelector: "storage.googleapis.com/Bucket"},
+	})
+	if err != nil {
+		t.Fatalf("create key handle: %v", err)
+	}
+	if !op.GetDone() || codes.Code(op.GetError().GetCode()) != codes.Internal {
+		t.Fatalf("operation = %v, want the store error", op)
+	}
+	keys, err := svc.ListCryptoKeys(ctx, &kmspb.ListCryptoKeysRequest{Parent: "projects/keys/locations/global/keyRings/autokey"})
+	if err != nil {
+		t.Fatalf("list autokey keys: %v", err)
+	}
+	if len(keys.GetCryptoKeys()) != 0 {
+		t.Fatalf("autokey keys = %v, want the failed request's key removed", keys.GetCryptoKeys())
+	}
+}
+
+func TestEkmConnections(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc := newTestService()
+
+	endpoint := httptest.NewTLSServer(http.NotFoundHandler())
+	defer endpoint.Close()
+	parent := "projects/demo/locations/us-east1"
+	resolver := func(hostname string) *kmspb.EkmConnection_ServiceResolver {
+		return &kmspb.EkmConnection_ServiceResolver{
+			ServiceDirectoryService: "projects/demo/locations/us-east1/namespaces/ekm/services/vpc",
+			Hostname:                hostname,
+			ServerCertificates:      []*kmspb.Certificate{{RawDer: endpoint.Certificate().Raw}},
+		}
+	}
+	create := func(id string, connection *kmspb.EkmConnection) (*kmspb.EkmConnection, error) {
+		return svc.CreateEkmConnection(ctx, &kmspb.CreateEkmConnectionRequest{Parent: parent, EkmConnectionId: id, EkmConnection: connection})
+	}
+
+	for name, invalid := range map[string]*kmspb.EkmConnection{
+		"cloud kms mode without crypto space path": {KeyManagementMode: kmspb.EkmConnection_CLOUD_KMS},
+		"absolute crypto space path":               {CryptoSpacePath: "/v0/cryptospaces/a"},
+		"two resolvers":                            {ServiceResolvers: []*kmspb.EkmConnection_ServiceResolver{resolver("a.example.com"), resolver("b.example.com")}},
+		"malformed service directory service":      {ServiceResolvers: []*kmspb.EkmConnection_ServiceResolver{{ServiceDirectoryService: "vpc", Hostname: "ekm.example.com", ServerCertificates: []*kmspb.Certificate{{RawDer: []byte{1}}}}}},
+		"resolver without certificates":            {ServiceResolvers: []*kmspb.EkmConnection_ServiceResolver{{ServiceDirectoryService: resolver("").GetServiceDirectoryService(), Hostname: "ekm.example.com"}}},
+		"resolver without hostname":                {ServiceResolvers: []*kmspb.EkmConnection_ServiceResolver{resolver("")}},
+	} {
+		_, err := create("invalid", invalid)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("%s: code = %v, want InvalidArgument", name, status.Code(err))
+		}
+	}
+
+	connection, err := create("vpc", &kmspb.EkmConnection{ServiceResolvers: []*kmspb.EkmConnection_ServiceResolver{resolver(endpoint.Listener.Addr().String())}})
+	if err != nil {
+		t.Fatalf("create ekm connection: %v", err)
+	}
+	certificate := connection.GetServiceResolvers()[0].GetServerCertificates()[0]
+	if connection.GetKeyManagementMode() != kmspb.EkmConnection_MANUAL || connection.GetEtag() == "" || connection.GetCreateTime() == nil ||
+		!certificate.GetParsed() || certificate.GetSha256Fingerprint() == "" || !slices.Contains(certificate.GetSubjectAlternativeDnsNames(), "example.com") {
+		t.Fatalf("created connection = %v", connection)
+	}
+	_, err = create("vpc", &kmspb.EkmConnection{})
+	requireStatusCode(t, err, codes.AlreadyExists)
+	list, err := svc.ListEkmConnections(ctx, &kmspb.ListEkmConnectionsRequest{Parent: parent})
+	if err != nil || list.GetTotalSize() != 1 || list.GetEkmConnections()[0].GetName() != parent+"/ekmConnections/vpc" {
+		t.Fatalf("list ekm connections = %v, %v", list, err)
+	}
+
+	if _, err := svc.VerifyConnectivity(ctx, &kmspb.VerifyConnectivityRequest{Name: connection.GetName()}); err != nil {
+		t.Fatalf("verify connectivity: %v", err)
+	}
+
+	stale := connection.GetEtag()
+	connection, err = svc.UpdateEkmConnection(ctx, &kmspb.UpdateEkmConnectionRequest{
+		EkmConnection: &kmspb.EkmConnection{Name: connection.GetName(), KeyManagementMode: kmspb.EkmConnection_CLOUD_KMS, CryptoSpacePath: "v0/cryptospaces/space-1", Etag: stale},
+		UpdateMask:    &fieldmaskpb.FieldMask{Paths: []string{"key_management_mode", "crypto_space_path"}},
+	})
+	if err != nil {
+		t.Fatalf("update ekm connection: %v", err)
+	}
+	if connection.GetKeyManagementMode() != kmspb.EkmConnection_CLOUD_KMS || connection.GetEtag() == stale {
+		t.Fatalf("updated connection = %v", connection)
+	}
+	_, err = svc.UpdateEkmConnection(ctx, &kmspb.UpdateEkmConnectionRequest{
+		EkmConnection: &kmspb.EkmConnection{Name: connection.GetName(), Etag: stale},
+		UpdateMask:    &fieldmaskpb.FieldMask{Paths: []string{"crypto_space_path"}},
+	})
+	requireStatusCode(t, err, codes.Aborted)
+	_, err = svc.UpdateEkmConnection(ctx, &kmspb.UpdateEkmConnectionRequest{
+		EkmConnection: &kmspb.EkmConnection{Name: connection.GetName()},
+		UpdateMask:    &fieldmaskpb.FieldMask{Paths: []string{"crypto_space_path"}},
+	})
+	requireStatusCode(t, err, codes.InvalidArgument)
+
+	wrongHost, err := create("wrong-host", &kmspb.EkmConnection{ServiceResolvers: []*kmspb.EkmConnection_ServiceResolver{
+		resolver(strings.Replace(endpoint.Listener.Addr().String(), "127.0.0.1", "localhost", 1)),
+	}})
+	if err != nil {
+		t.Fatalf("create ekm connection: %v", err)
+	}
+	_, err = svc.VerifyConnectivity(ctx, &kmspb.VerifyConnectivityRequest{Name: wrongHost.GetName()})
+	requireStatusCode(t, err, codes.FailedPrecondition)
+
+	unpinned := resolver(endpoint.Listener.Addr().String())
+	unpinned.ServerCertificates = []*kmspb.Certificate{{RawDer: []byte("not a certificate")}}
+	wrongCertificate, err := create("wrong-certificate", &kmspb.EkmConnection{ServiceResolvers: []*kmspb.EkmConnection_ServiceResolver{unpinned}})
+	if err != nil {
+		t.Fatalf("create ekm connection: %v", err)
+	}
+	if wrongCertificate.GetServiceResolvers()[0].GetServerCertificates()[0].GetParsed() {
+		t.Fatal("unparseable certificate reported as parsed")
+	}
+	_, err = svc.VerifyConnectivity(ctx, &kmspb.VerifyConnectivityRequest{Name: wrongCertificate.GetName()})
+	requireStatusCode(t, err, codes.FailedPrecondition)
+
+	endpoint.Close()
+	_, err = svc.VerifyConnectivity(ctx, &kmspb.VerifyConnectivityRequest{Name: connection.GetName()})
+	requireStatusCode(t, err, codes.FailedPrecondition)
+}
+
+func TestEkmConfig(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc := newTestService()
+	const configName = "projects/demo/locations/us-east1/ekmConfig"
+	mask := &fieldmaskpb.FieldMask{Paths: []string{"default_ekm_connection"}}
+
+	config, err := svc.GetEkmConfig(ctx, &kmspb.GetEkmConfigRequest{Name: configName})
+	if err != nil || config.GetName() != configName || config.GetDefaultEkmConnection() != "" {
+		t.Fatalf("initial ekm config = %v, %v", config, err)
+	}
+
+	connection := "projects/demo/locations/us-east1/ekmConnections/vpc"
+	_, err = svc.UpdateEkmConfig(ctx, &kmspb.UpdateEkmConfigRequest{EkmConfig: &kmspb.EkmConfig{Name: configName, DefaultEkmConnection: connection}, UpdateMask: mask})
+	requireStatusCode(t, err, codes.InvalidArgument)
+	if _, err := svc.CreateEkmConnection(ctx, &kmspb.CreateEkmConnectionRequest{Parent: "projects/demo/locations/us-east1", EkmConnectionId: "vpc"}); err != nil {
+		t.Fatalf("create ekm connection: %v", err)
+	}
+	config, err = svc.UpdateEkmConfig(ctx, &kmspb.UpdateEkmConfigRequest{EkmConfig: &kmspb.EkmConfig{Name: configName, DefaultEkmConnection: connection}, UpdateMask: mask})
+	if err != nil || config.GetDefaultEkmConnection() != connection {
+		t.Fatalf("update ekm config = %v, %v", config, err)
+	}
+	_, err = svc.UpdateEkmConfig(ctx, &kmspb.UpdateEkmConfigRequest{
+		EkmConfig:  &kmspb.EkmConfig{Name: "projects/demo/locations/europe-west1/ekmConfig", DefaultEkmConnection: connection},
+		UpdateMask: mask,
+	})
+	requireStatusCode(t, err, codes.InvalidArgument)
+
+	_, err = svc.CreateEkmConnection(ctx, &kmspb.CreateEkmConnectionRequest{Parent: "projects/demo/locations/global", EkmConnectionId: "vpc"})
+	if err != nil {
+		t.Fatalf("create ekm connection in global without strict locations: %v", err)
+	}
+	strict := service.New(memory.New(), kmscrypto.NewTinkEngine(), service.WithStrictLocations())
+	_, err = strict.CreateEkmConnection(ctx, &kmspb.CreateEkmConnectionRequest{Parent: "projects/demo/locations/global", EkmConnectionId: "vpc"})
+	requireStatusCode(t, err, codes.InvalidArgument)
+}
+
+// ---- helpers ----
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// hookedStore calls its hooks after every GetCryptoKey and before every
+// UpdateCryptoKeyVersion, letting tests interleave work between a read and
+// the write that follows it.
+type hookedStore struct {
+	store.Store
+	afterGetCryptoKey            func()
+	beforeUpdateCryptoKeyVersion func()
+	createKeyHandleErr           error
+}
+
+// requireConsistentVersion fails unless the stored state of a version agrees
+// with its key material and destroy_time.
+func requireConsistentVersion(t *testing.T, st store.Store, name string) {
+	t.Helper()
+	version, material, err := st.GetCryptoKeyVersion(context.Background(), name)
+	if err != nil {
+		t.Fatalf("get stored version: %v", err)
+	}
+	destroyed := version.GetState() == kmspb.CryptoKeyVersion_DESTROYED
+	scheduled := version.GetState() == kmspb.CryptoKeyVersion_DESTROY_SCHEDULED
+	if destroyed == (len(material) > 0) || (destroyed || scheduled) != (version.GetDestroyTime() != nil) {
+		t.Fatalf("stored version is %v with %d bytes of key material and destroy_time %v", version.GetState(), len(material), version.GetDestroyTime())
+	}
+}
+
+func (s *hookedStore) UpdateCryptoKeyVersion(ctx context.Context, version *kmspb.CryptoKeyVersion) error {
+	if s.beforeUpdateCryptoKeyVersion != nil {
+		s.beforeUpdateCryptoKeyVersion()
+	}
+	return s.Store.UpdateCryptoKeyVersion(ctx, version)
+}
+
+func (s *hookedStore) CreateKeyHandle(ctx context.Context, keyHandle *kmspb.KeyHandle) error {
+	if s.createKeyHandleErr != nil {
+		return s.createKeyHandleErr
+	}
+	return s.Store.CreateKeyHandle(ctx, keyHandle)
+}
+
+func (s *hookedStore) GetCryptoKey(ctx context.Context, name string) (*kmspb.CryptoKey, error) {
+	ck, err := s.Store.GetCryptoKey(ctx, name)
+	if s.afterGetCryptoKey != nil {
+		s.afterGetCryptoKey()
+	}
+	return ck, err
+}
+
+func mustEncrypt(t *testing.T, ctx context.Context, svc service.KMSService, req *kmspb.EncryptRequest) *kmspb.EncryptResponse {
+	t.Helper()
+	resp, err := svc.Encrypt(ctx, req)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	return resp
+}
+
+func mustDecrypt(t *testing.T, ctx context.Context, svc service.KMSService, req *kmspb.DecryptRequest) *kmspb.DecryptResponse {
+	t.Helper()
+	resp, err := svc.Decrypt(ctx, req)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	return resp
+}
+
+func requireStatusCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+	if status.Code(err) != code {
+		t.Fatalf("status code = %v, want %v", status.Code(err), code)
+	}
+}
+
+func setupKey(t *testing.T) (service.KMSService, string) {
+	t.Helper()
+	svc := newTestService()
+	keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "app")
+	cryptoKey := createCryptoKey(t, svc, keyRing, "pair")
+	return svc, cryptoKey
+}
+
+func setupAsymmetricKey(t *testing.T) (service.KMSService, string) {
+	t.Helper()
+	svc := newTestService()
+	keyRing := createKeyRing(t, svc, "projects/demo/locations/global", "asym")
+	cryptoKeyName := createAsymmetricCryptoKey(t, svc, keyRing, "signer")
+	return svc, cryptoKeyName + "/cryptoKeyVersions/1"
+}
+
+// createImportJob creates an import job and reads it back once it is ACTIVE.
+func createImportJob(t *testing.T, svc service.KMSService, keyRingName, id string, method kmspb.ImportJob_ImportMethod, level kmspb.ProtectionLevel) *kmspb.ImportJob {
+	t.Helper()
+	ctx := context.Background()
+	created, err := svc.CreateImportJob(ctx, &kmspb.CreateImportJobRequest{
+		Parent:      keyRingName,
+		ImportJobId: id,
+		ImportJob:   &kmspb.ImportJob{ImportMethod: method, ProtectionLevel: level},
+	})
+	if err != nil {
+		t.Fatalf("create import job %s: %v", id, err)
+	}
+	job, err := svc.GetImportJob(ctx, &kmspb.GetImportJobRequest{Name: created.GetName()})
+	if err != nil {
+		t.Fatalf("get import job %s: %v", id, err)
+	}
+	return job
+}
+
+func wrapKeyForImport(t *testing.T, job *kmspb.ImportJob, key []byte) []byte {
+	t.Helper()
+	wrapped, err := kmscrypto.WrapKeyForImport([]byte(job.GetPublicKey().GetPem()), job.GetImportMethod().String(), key)
+	if err != nil {
+		t.Fatalf("wrap key for %s: %v", job.GetName(), err)
+	}
+	return wrapped
+}
+
+func newTestService() service.KMSService {
+	return service.New(memory.New(), kmscrypto.NewTinkEngine())
+}
+
+func createKeyRing(t *testing.T, svc service.KMSService, parent, id string) string {
+	t.Helper()
+	name := parent + "/keyRings/" + id
+	if _, err := svc.CreateKeyRing(context.Background(), &kmspb.CreateKeyRingRequest{Parent: parent, KeyRingId: id}); err != nil {
+		t.Fatalf("create key ring %s: %v", name, err)
+	}
+	return name
+}
+
+func createCryptoKey(t *testing.T, svc service.KMSService, keyRingName, id string) string {
+	t.Helper()
+	name := keyRingName + "/cryptoKeys/" + id
+	if _, err := svc.CreateCryptoKey(context.Background(), &kmspb.CreateCryptoKeyRequest{
+		Parent:      keyRingName,
+		CryptoKeyId: id,
+		CryptoKey: &kmspb.CryptoKey{
+			Purpose: kmspb.CryptoKey_ENCRYPT_DECRYPT,
+		},
+	}); err != nil {
+		t.Fatalf("create crypto key %s: %v", name, err)
+	}
+	return name
+}
+
+func createAsymmetricCryptoKey(t *testing.T, svc service.KMSService, keyRingName, id string) string {
+	t.Helper()
+	name := keyRingName + "/cryptoKeys/" + id
+	if _, err := svc.CreateCryptoKey(context.Background(), &kmspb.CreateCryptoKeyRequest{
+		Parent:      keyRingName,
+		CryptoKeyId: id,
+		CryptoKey: &kmspb.CryptoKey{
 			Purpose: kmspb.CryptoKey_ASYMMETRIC_SIGN,
 			VersionTemplate: &kmspb.CryptoKeyVersionTemplate{
 				Algorithm: kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256,
@@ -609,6 +3550,38 @@ func createAsymmetricCryptoKey(t *testing.T, svc service.KMSService, keyRingName
 	return name
 }
 
+func createRawCryptoKey(t *testing.T, svc service.KMSService, keyRingName, id string, algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm) string {
+	t.Helper()
+	name := keyRingName + "/cryptoKeys/" + id
+	if _, err := svc.CreateCryptoKey(context.Background(), &kmspb.CreateCryptoKeyRequest{
+		Parent:      keyRingName,
+		CryptoKeyId: id,
+		CryptoKey: &kmspb.CryptoKey{
+			Purpose:         kmspb.CryptoKey_RAW_ENCRYPT_DECRYPT,
+			VersionTemplate: &kmspb.CryptoKeyVersionTemplate{Algorithm: algorithm},
+		},
+	}); err != nil {
+		t.Fatalf("create raw crypto key %s: %v", name, err)
+	}
+	return name
+}
+
+func createSigningKey(t *testing.T, svc service.KMSService, keyRingName, id string, algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm) string {
+	t.Helper()
+	name := keyRingName + "/cryptoKeys/" + id
+	if _, err := svc.CreateCryptoKey(context.Background(), &kmspb.CreateCryptoKeyRequest{
+		Parent:      keyRingName,
+		CryptoKeyId: id,
+		CryptoKey: &kmspb.CryptoKey{
+			Purpose:         kmspb.CryptoKey_ASYMMETRIC_SIGN,
+			VersionTemplate: &kmspb.CryptoKeyVersionTemplate{Algorithm: algorithm},
+		},
+	}); err != nil {
+		t.Fatalf("create signing key %s: %v", name, err)
+	}
+	return name + "/cryptoKeyVersions/1"
+}
+
 func parseSecp256k1PEM(t *testing.T, pemBytes []byte) *btcec.PublicKey {
 	t.Helper()
 	block, _ := pem.Decode(pemBytes)
@@ -1,11 +1,15 @@
 package memory
 
 import (
+	"cmp"
 	"context"
 	"maps"
 	"slices"
+	"strconv"
+	"strings"
 	"sync"
 
+	"cloud.google.com/go/iam/apiv1/iampb"
 	"cloud.google.com/go/kms/apiv1/kmspb"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -20,23 +24,40 @@ import (
 type Store struct {
 	mu       sync.RWMutex
 	keyRings map[string]*keyRingRecord
+	// projectPolicies holds the IAM policies set on projects, which are not
+	// otherwise modeled.
+	projectPolicies map[string]*iampb.Policy
+	keyHandles      map[string]*kmspb.KeyHandle
+	autokeyConfigs  map[string]*kmspb.AutokeyConfig
+	ekmConnections  map[string]*kmspb.EkmConnection
+	ekmConfigs      map[string]*kmspb.EkmConfig
 }
 
 var _ store.Store = (*Store)(nil)
 
 // New creates a new in-memory store instance.
 func New() *Store {
-	return &Store{keyRings: make(map[string]*keyRingRecord)}
+	return &Store{
+		keyRings:        make(map[string]*keyRingRecord),
+		projectPolicies: make(map[string]*iampb.Policy),
+		keyHandles:      make(map[string]*kmspb.KeyHandle),
+		autokeyConfigs:  make(map[string]*kmspb.AutokeyConfig),
+		ekmConnections:  make(map[string]*kmspb.EkmConnection),
+		ekmConfigs:      make(map[string]*kmspb.EkmConfig),
+	}
 }
 
 type keyRingRecord struct {
 	keyRing    *kmspb.KeyRing
 	cryptoKeys map[string]*cryptoKeyRecord
+	importJobs map[string]*importJobRecord
+	policy     *iampb.Policy
 }
 
 type cryptoKeyRecord struct {
 	cryptoKey *kmspb.CryptoKey
 	versions  map[string]*cryptoKeyVersionRecord
+	policy    *iampb.Policy
 }
 
 type cryptoKeyVersionRecord struct {
@@ -44,6 +65,12 @@ type cryptoKeyVersionRecord struct {
 	keyMaterial kmscrypto.KeyMaterial
 }
 
+type importJobRecord struct {
+	importJob   *kmspb.ImportJob
+	keyMaterial kmscrypto.KeyMaterial
+	policy      *iampb.Policy
+}
+
 func cloneKeyRing(in *kmspb.KeyRing) *kmspb.KeyRing {
 	return proto.Clone(in).(*kmspb.KeyRing)
 }
@@ -56,6 +83,17 @@ func cloneCryptoKeyVersion(in *kmspb.CryptoKeyVersion) *kmspb.CryptoKeyVersion {
 	return proto.Clone(in).(*kmspb.CryptoKeyVersion)
 }
 
+func cloneImportJob(in *kmspb.ImportJob) *kmspb.ImportJob {
+	return proto.Clone(in).(*kmspb.ImportJob)
+}
+
+func clonePolicy(in *iampb.Policy) *iampb.Policy {
+	if in == nil {
+		return nil
+	}
+	return proto.Clone(in).(*iampb.Policy)
+}
+
 // CreateKeyRing stores a new key ring.
 func (s *Store) CreateKeyRing(_ context.Context, keyRing *kmspb.KeyRing) error {
 	s.mu.Lock()
@@ -68,6 +106,7 @@ func (s *Store) CreateKeyRing(_ context.Context, keyRing *kmspb.KeyRing) error {
 	s.keyRings[keyRing.GetName()] = &keyRingRecord{
 		keyRing:    cloneKeyRing(keyRing),
 		cryptoKeys: make(map[string]*cryptoKeyRecord),
+		importJobs: make(map[string]*importJobRecord),
 	}
 	return nil
 }
@@ -84,23 +123,29 @@ func (s *Store) GetKeyRing(_ context.Context, name string) (*kmspb.KeyRing, erro
 }
 
 // ListKeyRings lists key rings under the parent.
-func (s *Store) ListKeyRings(_ context.Context, parent string) ([]*kmspb.KeyRing, error) {
+func (s *Store) ListKeyRings(_ context.Context, parent string, opts store.ListOptions) ([]*kmspb.KeyRing, int, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	namesInStore := slices.Sorted(maps.Keys(s.keyRings))
-	rings := make([]*kmspb.KeyRing, 0, len(namesInStore))
-	for _, name := range namesInStore {
+	var namesUnderParent []string
+	for name := range s.keyRings {
 		krName, err := names.ParseKeyRing(name)
 		if err != nil || krName.ParentName() != parent {
 			continue
 		}
+		namesUnderParent = append(namesUnderParent, name)
+	}
+	slices.Sort(namesUnderParent)
+
+	window := applyListOptions(namesUnderParent, opts, strings.Compare)
+	rings := make([]*kmspb.KeyRing, 0, len(window))
+	for _, name := range window {
 		rings = append(rings, cloneKeyRing(s.keyRings[name].keyRing))
 	}
-	return rings, nil
+	return rings, len(namesUnderParent), nil
 }
 
-// CreateCryptoKey stores a crypto key and its initial primary version.
+// CreateCryptoKey stores a crypto key and its initial version, if any.
 func (s *Store) CreateCryptoKey(_ context.Context, keyRingName string, cryptoKey *kmspb.CryptoKey, primaryVersion *kmspb.CryptoKeyVersion, keyMaterial kmscrypto.KeyMaterial) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -113,16 +158,15 @@ func (s *Store) CreateCryptoKey(_ context.Context, keyRingName string, cryptoKey
 		return status.Errorf(codes.AlreadyExists, "crypto key %q already exists", cryptoKey.GetName())
 	}
 
-	versionRecord := &cryptoKeyVersionRecord{
-		version:     cloneCryptoKeyVersion(primaryVersion),
-		keyMaterial: slices.Clone(keyMaterial),
-	}
-
 	rec := &cryptoKeyRecord{
 		cryptoKey: cloneCryptoKey(cryptoKey),
-		versions: map[string]*cryptoKeyVersionRecord{
-			primaryVersion.GetName(): versionRecord,
-		},
+		versions:  make(map[string]*cryptoKeyVersionRecord),
+	}
+	if primaryVersion != nil {
+		rec.versions[primaryVersion.GetName()] = &cryptoKeyVersionRecord{
+			version:     cloneCryptoKeyVersion(primaryVersion),
+			keyMaterial: slices.Clone(keyMaterial),
+		}
 	}
 	ring.cryptoKeys[cryptoKey.GetName()] = rec
 	return nil
@@ -141,23 +185,70 @@ func (s *Store) GetCryptoKey(_ context.Context, name string) (*kmspb.CryptoKey,
 }
 
 // ListCryptoKeys lists keys under a key ring parent.
-func (s *Store) ListCryptoKeys(_ context.Context, parent string) ([]*kmspb.CryptoKey, error) {
+func (s *Store) ListCryptoKeys(_ context.Context, parent string, opts store.ListOptions) ([]*kmspb.CryptoKey, int, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	ring, ok := s.keyRings[parent]
 	if !ok {
-		return nil, status.Errorf(codes.NotFound, "key ring %q not found", parent)
+		return nil, 0, status.Errorf(codes.NotFound, "key ring %q not found", parent)
 	}
 
 	keyNames := slices.Sorted(maps.Keys(ring.cryptoKeys))
-	keys := make([]*kmspb.CryptoKey, 0, len(keyNames))
-	for _, keyName := range keyNames {
+	window := applyListOptions(keyNames, opts, strings.Compare)
+	keys := make([]*kmspb.CryptoKey, 0, len(window))
+	for _, keyName := range window {
 		keys = append(keys, cloneCryptoKey(ring.cryptoKeys[keyName].cryptoKey))
 	}
+	return keys, len(keyNames), nil
+}
+
+// ListScheduledCryptoKeys returns every crypto key with a next_rotation_time,
+// ordered by resource name.
+func (s *Store) ListScheduledCryptoKeys(_ context.Context) ([]*kmspb.CryptoKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []*kmspb.CryptoKey
+	for _, ring := range s.keyRings {
+		for _, key := range ring.cryptoKeys {
+			if key.cryptoKey.GetNextRotationTime() != nil {
+				keys = append(keys, cloneCryptoKey(key.cryptoKey))
+			}
+		}
+	}
+	slices.SortFunc(keys, func(a, b *kmspb.CryptoKey) int { return strings.Compare(a.GetName(), b.GetName()) })
 	return keys, nil
 }
 
+// UpdateCryptoKey replaces the stored metadata of an existing crypto key.
+// The primary version is managed by SetPrimaryVersion and is left untouched.
+func (s *Store) UpdateCryptoKey(_ context.Context, cryptoKey *kmspb.CryptoKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lookup, err := s.findCryptoKey(cryptoKey.GetName())
+	if err != nil {
+		return err
+	}
+
+	updated := cloneCryptoKey(cryptoKey)
+	updated.Primary = lookup.key.cryptoKey.GetPrimary()
+	lookup.key.cryptoKey = updated
+	return nil
+}
+
+// DeleteCryptoKey removes a crypto key with its versions and policy.
+func (s *Store) DeleteCryptoKey(_ context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lookup, err := s.findCryptoKey(name)
+	if err != nil {
+		return err
+	}
+	delete(lookup.ring.cryptoKeys, name)
+	return nil
+}
+
 // CreateCryptoKeyVersion stores a new version for a crypto key.
 func (s *Store) CreateCryptoKeyVersion(_ context.Context, cryptoKeyName string, version *kmspb.CryptoKeyVersion, keyMaterial kmscrypto.KeyMaterial) error {
 	s.mu.Lock()
@@ -192,24 +283,91 @@ func (s *Store) GetCryptoKeyVersion(_ context.Context, name string) (*kmspb.Cryp
 	return cloneCryptoKeyVersion(lookup.version.version), slices.Clone(lookup.version.keyMaterial), nil
 }
 
-// ListCryptoKeyVersions lists versions under parent.
-func (s *Store) ListCryptoKeyVersions(_ context.Context, parent string) ([]*kmspb.CryptoKeyVersion, error) {
+// ListCryptoKeyVersions lists versions under parent ordered by version ID.
+func (s *Store) ListCryptoKeyVersions(_ context.Context, parent string, opts store.ListOptions) ([]*kmspb.CryptoKeyVersion, int, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	keyLookup, err := s.findCryptoKey(parent)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	versionNames := slices.Sorted(maps.Keys(keyLookup.key.versions))
-	versions := make([]*kmspb.CryptoKeyVersion, 0, len(versionNames))
-	for _, name := range versionNames {
+	versionNames := slices.SortedFunc(maps.Keys(keyLookup.key.versions), compareVersionNames)
+	window := applyListOptions(versionNames, opts, compareVersionNames)
+	versions := make([]*kmspb.CryptoKeyVersion, 0, len(window))
+	for _, name := range window {
 		versions = append(versions, cloneCryptoKeyVersion(keyLookup.key.versions[name].version))
 	}
+	return versions, len(versionNames), nil
+}
+
+// ListDestroyScheduledCryptoKeyVersions returns every DESTROY_SCHEDULED
+// version, ordered by resource name.
+func (s *Store) ListDestroyScheduledCryptoKeyVersions(_ context.Context) ([]*kmspb.CryptoKeyVersion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var versions []*kmspb.CryptoKeyVersion
+	for _, ring := range s.keyRings {
+		for _, key := range ring.cryptoKeys {
+			for _, record := range key.versions {
+				if record.version.GetState() == kmspb.CryptoKeyVersion_DESTROY_SCHEDULED {
+					versions = append(versions, cloneCryptoKeyVersion(record.version))
+				}
+			}
+		}
+	}
+	slices.SortFunc(versions, func(a, b *kmspb.CryptoKeyVersion) int { return strings.Compare(a.GetName(), b.GetName()) })
 	return versions, nil
 }
 
+// UpdateCryptoKeyVersion replaces the stored metadata of an existing version.
+// Key material is left untouched.
+func (s *Store) UpdateCryptoKeyVersion(_ context.Context, version *kmspb.CryptoKeyVersion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lookup, err := s.findVersion(version.GetName())
+	if err != nil {
+		return err
+	}
+
+	lookup.setVersion(version)
+	return nil
+}
+
+// DestroyCryptoKeyVersion replaces the stored metadata of an existing version
+// and wipes its key material.
+func (s *Store) DestroyCryptoKeyVersion(_ context.Context, version *kmspb.CryptoKeyVersion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lookup, err := s.findVersion(version.GetName())
+	if err != nil {
+		return err
+	}
+
+	clear(lookup.version.keyMaterial)
+	lookup.version.keyMaterial = nil
+	lookup.setVersion(version)
+	return nil
+}
+
+// ReimportCryptoKeyVersion replaces the stored metadata and key material of an
+// existing version.
+func (s *Store) ReimportCryptoKeyVersion(_ context.Context, version *kmspb.CryptoKeyVersion, keyMaterial kmscrypto.KeyMaterial) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lookup, err := s.findVersion(version.GetName())
+	if err != nil {
+		return err
+	}
+
+	clear(lookup.version.keyMaterial)
+	lookup.version.keyMaterial = slices.Clone(keyMaterial)
+	lookup.setVersion(version)
+	return nil
+}
+
 // SetPrimaryVersion updates the primary version pointer.
 func (s *Store) SetPrimaryVersion(_ context.Context, cryptoKeyName, versionName string) (*kmspb.CryptoKey, error) {
 	s.mu.Lock()
@@ -227,6 +385,242 @@ func (s *Store) SetPrimaryVersion(_ context.Context, cryptoKeyName, versionName
 	return cloneCryptoKey(lookup.key.cryptoKey), nil
 }
 
+// CreateImportJob stores a new import job and its wrapping key.
+func (s *Store) CreateImportJob(_ context.Context, keyRingName string, importJob *kmspb.ImportJob, keyMaterial kmscrypto.KeyMaterial) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ring, ok := s.keyRings[keyRingName]
+	if !ok {
+		return status.Errorf(codes.NotFound, "key ring %q not found", keyRingName)
+	}
+
+	if _, exists := ring.importJobs[importJob.GetName()]; exists {
+		return status.Errorf(codes.AlreadyExists, "import job %q already exists", importJob.GetName())
+	}
+
+	ring.importJobs[importJob.GetName()] = &importJobRecord{
+		importJob:   cloneImportJob(importJob),
+		keyMaterial: slices.Clone(keyMaterial),
+	}
+	return nil
+}
+
+// GetImportJob returns the import job and its wrapping key.
+func (s *Store) GetImportJob(_ context.Context, name string) (*kmspb.ImportJob, kmscrypto.KeyMaterial, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, err := s.findImportJob(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cloneImportJob(rec.importJob), slices.Clone(rec.keyMaterial), nil
+}
+
+// ListImportJobs lists import jobs under a key ring parent.
+func (s *Store) ListImportJobs(_ context.Context, parent string, opts store.ListOptions) ([]*kmspb.ImportJob, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ring, ok := s.keyRings[parent]
+	if !ok {
+		return nil, 0, status.Errorf(codes.NotFound, "key ring %q not found", parent)
+	}
+
+	jobNames := slices.Sorted(maps.Keys(ring.importJobs))
+	window := applyListOptions(jobNames, opts, strings.Compare)
+	jobs := make([]*kmspb.ImportJob, 0, len(window))
+	for _, jobName := range window {
+		jobs = append(jobs, cloneImportJob(ring.importJobs[jobName].importJob))
+	}
+	return jobs, len(jobNames), nil
+}
+
+// UpdateImportJob replaces the stored metadata of an existing import job.
+// The wrapping key is left untouched.
+func (s *Store) UpdateImportJob(_ context.Context, importJob *kmspb.ImportJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, err := s.findImportJob(importJob.GetName())
+	if err != nil {
+		return err
+	}
+	rec.importJob = cloneImportJob(importJob)
+	return nil
+}
+
+// GetIamPolicy returns the IAM policy of a project, key ring, crypto key or
+// import job, or nil when none has been set.
+func (s *Store) GetIamPolicy(_ context.Context, resource string) (*iampb.Policy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, err := names.ParseProject(resource); err == nil {
+		return clonePolicy(s.projectPolicies[resource]), nil
+	}
+	policy, err := s.findPolicy(resource)
+	if err != nil {
+		return nil, err
+	}
+	return clonePolicy(*policy), nil
+}
+
+// SetIamPolicy replaces the IAM policy of a project, key ring, crypto key or
+// import job.
+func (s *Store) SetIamPolicy(_ context.Context, resource string, policy *iampb.Policy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := names.ParseProject(resource); err == nil {
+		s.projectPolicies[resource] = clonePolicy(policy)
+		return nil
+	}
+	stored, err := s.findPolicy(resource)
+	if err != nil {
+		return err
+	}
+	*stored = clonePolicy(policy)
+	return nil
+}
+
+// CreateKeyHandle stores a new Autokey key handle.
+func (s *Store) CreateKeyHandle(_ context.Context, keyHandle *kmspb.KeyHandle) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.keyHandles[keyHandle.GetName()]; exists {
+		return status.Errorf(codes.AlreadyExists, "key handle %q already exists", keyHandle.GetName())
+	}
+	s.keyHandles[keyHandle.GetName()] = proto.Clone(keyHandle).(*kmspb.KeyHandle)
+	return nil
+}
+
+// GetKeyHandle returns the key handle with the given name.
+func (s *Store) GetKeyHandle(_ context.Context, name string) (*kmspb.KeyHandle, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keyHandle, ok := s.keyHandles[name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "key handle %q not found", name)
+	}
+	return proto.Clone(keyHandle).(*kmspb.KeyHandle), nil
+}
+
+// ListKeyHandles returns the key handles of a project and location.
+func (s *Store) ListKeyHandles(_ context.Context, parent string, opts store.ListOptions) ([]*kmspb.KeyHandle, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var namesUnderParent []string
+	for name := range s.keyHandles {
+		handle, err := names.ParseKeyHandle(name)
+		if err != nil || handle.ParentName() != parent {
+			continue
+		}
+		namesUnderParent = append(namesUnderParent, name)
+	}
+	slices.Sort(namesUnderParent)
+
+	window := applyListOptions(namesUnderParent, opts, strings.Compare)
+	handles := make([]*kmspb.KeyHandle, 0, len(window))
+	for _, name := range window {
+		handles = append(handles, proto.Clone(s.keyHandles[name]).(*kmspb.KeyHandle))
+	}
+	return handles, len(namesUnderParent), nil
+}
+
+// GetAutokeyConfig returns the Autokey configuration with the given name, or
+// nil when none has been set.
+func (s *Store) GetAutokeyConfig(_ context.Context, name string) (*kmspb.AutokeyConfig, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	config, ok := s.autokeyConfigs[name]
+	if !ok {
+		return nil, nil
+	}
+	return proto.Clone(config).(*kmspb.AutokeyConfig), nil
+}
+
+// SetAutokeyConfig stores the Autokey configuration named by config.name.
+func (s *Store) SetAutokeyConfig(_ context.Context, config *kmspb.AutokeyConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.autokeyConfigs[config.GetName()] = proto.Clone(config).(*kmspb.AutokeyConfig)
+	return nil
+}
+
+// CreateEkmConnection stores a new EKM connection.
+func (s *Store) CreateEkmConnection(_ context.Context, connection *kmspb.EkmConnection) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.ekmConnections[connection.GetName()]; exists {
+		return status.Errorf(codes.AlreadyExists, "ekm connection %q already exists", connection.GetName())
+	}
+	s.ekmConnections[connection.GetName()] = proto.Clone(connection).(*kmspb.EkmConnection)
+	return nil
+}
+
+// GetEkmConnection returns the EKM connection with the given name.
+func (s *Store) GetEkmConnection(_ context.Context, name string) (*kmspb.EkmConnection, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	connection, ok := s.ekmConnections[name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "ekm connection %q not found", name)
+	}
+	return proto.Clone(connection).(*kmspb.EkmConnection), nil
+}
+
+// ListEkmConnections returns the EKM connections of a project and location.
+func (s *Store) ListEkmConnections(_ context.Context, parent string, opts store.ListOptions) ([]*kmspb.EkmConnection, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var namesUnderParent []string
+	for name := range s.ekmConnections {
+		connection, err := names.ParseEkmConnection(name)
+		if err != nil || connection.ParentName() != parent {
+			continue
+		}
+		namesUnderParent = append(namesUnderParent, name)
+	}
+	slices.Sort(namesUnderParent)
+
+	window := applyListOptions(namesUnderParent, opts, strings.Compare)
+	connections := make([]*kmspb.EkmConnection, 0, len(window))
+	for _, name := range window {
+		connections = append(connections, proto.Clone(s.ekmConnections[name]).(*kmspb.EkmConnection))
+	}
+	return connections, len(namesUnderParent), nil
+}
+
+// UpdateEkmConnection replaces an existing EKM connection.
+func (s *Store) UpdateEkmConnection(_ context.Context, connection *kmspb.EkmConnection) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.ekmConnections[connection.GetName()]; !ok {
+		return status.Errorf(codes.NotFound, "ekm connection %q not found", connection.GetName())
+	}
+	s.ekmConnections[connection.GetName()] = proto.Clone(connection).(*kmspb.EkmConnection)
+	return nil
+}
+
+// GetEkmConfig returns the EkmConfig with the given name, or nil when none
+// has been set.
+func (s *Store) GetEkmConfig(_ context.Context, name string) (*kmspb.EkmConfig, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	config, ok := s.ekmConfigs[name]
+	if !ok {
+		return nil, nil
+	}
+	return proto.Clone(config).(*kmspb.EkmConfig), nil
+}
+
+// SetEkmConfig stores the EkmConfig named by config.name.
+func (s *Store) SetEkmConfig(_ context.Context, config *kmspb.EkmConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ekmConfigs[config.GetName()] = proto.Clone(config).(*kmspb.EkmConfig)
+	return nil
+}
+
 type keyLookup struct {
 	ring *keyRingRecord
 	key  *cryptoKeyRecord
@@ -238,6 +632,49 @@ type versionLookup struct {
 	version *cryptoKeyVersionRecord
 }
 
+// applyListOptions returns the window of sorted selected by opts, where cmp is
+// the ordering sorted already follows.
+func applyListOptions(sorted []string, opts store.ListOptions, cmp func(a, b string) int) []string {
+	start := 0
+	if opts.StartAfter != "" {
+		start = len(sorted)
+		for i, name := range sorted {
+			if cmp(name, opts.StartAfter) > 0 {
+				start = i
+				break
+			}
+		}
+	}
+	window := sorted[start:]
+	if opts.Limit > 0 && len(window) > opts.Limit {
+		window = window[:opts.Limit]
+	}
+	return window
+}
+
+// compareVersionNames orders crypto key version names by numeric version ID.
+func compareVersionNames(a, b string) int {
+	va, errA := names.ParseCryptoKeyVersion(a)
+	vb, errB := names.ParseCryptoKeyVersion(b)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+	idA, _ := strconv.Atoi(va.Version)
+	idB, _ := strconv.Atoi(vb.Version)
+	if c := cmp.Compare(idA, idB); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+// setVersion stores version and keeps the crypto key's primary copy in sync.
+func (l *versionLookup) setVersion(version *kmspb.CryptoKeyVersion) {
+	l.version.version = cloneCryptoKeyVersion(version)
+	if l.key.cryptoKey.GetPrimary().GetName() == version.GetName() {
+		l.key.cryptoKey.Primary = cloneCryptoKeyVersion(version)
+	}
+}
+
 func (s *Store) findCryptoKey(name string) (*keyLookup, error) {
 	for _, ring := range s.keyRings {
 		if rec, ok := ring.cryptoKeys[name]; ok {
@@ -257,3 +694,27 @@ func (s *Store) findVersion(name string) (*versionLookup, error) {
 	}
 	return nil, status.Errorf(codes.NotFound, "crypto key version %q not found", name)
 }
+
+func (s *Store) findImportJob(name string) (*importJobRecord, error) {
+	for _, ring := range s.keyRings {
+		if rec, ok := ring.importJobs[name]; ok {
+			return rec, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "import job %q not found", name)
+}
+
+// findPolicy returns the policy slot of the key ring, crypto key or import job
+// named resource.
+func (s *Store) findPolicy(resource string) (**iampb.Policy, error) {
+	if ring, ok := s.keyRings[resource]; ok {
+		return &ring.policy, nil
+	}
+	if lookup, err := s.findCryptoKey(resource); err == nil {
+		return &lookup.key.policy, nil
+	}
+	if rec, err := s.findImportJob(resource); err == nil {
+		return &rec.policy, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "resource %q not found", resource)
+}
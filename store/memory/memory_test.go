@@ -2,14 +2,20 @@ package memory
 
 import (
 	"context"
+	"fmt"
+	"slices"
 	"testing"
+	"time"
 
+	"cloud.google.com/go/iam/apiv1/iampb"
 	"cloud.google.com/go/kms/apiv1/kmspb"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/winor30/fake-cloud-kms/kmscrypto"
+	kmsstore "github.com/winor30/fake-cloud-kms/store"
 )
 
 func TestKeyRingLifecycle(t *testing.T) {
@@ -53,7 +59,7 @@ func TestKeyRingLifecycle(t *testing.T) {
 			t.Fatalf("create other key ring: %v", err)
 		}
 
-		list, err := store.ListKeyRings(ctx, parent)
+		list, _, err := store.ListKeyRings(ctx, parent, kmsstore.ListOptions{})
 		if err != nil {
 			t.Fatalf("list key rings: %v", err)
 		}
@@ -61,7 +67,7 @@ func TestKeyRingLifecycle(t *testing.T) {
 			t.Fatalf("list key rings returned %#v, want only %s", list, keyRingName)
 		}
 		list[0].Name = "changed"
-		filtered, err := store.ListKeyRings(ctx, parent)
+		filtered, _, err := store.ListKeyRings(ctx, parent, kmsstore.ListOptions{})
 		if err != nil {
 			t.Fatalf("list key rings again: %v", err)
 		}
@@ -120,7 +126,7 @@ func TestCryptoKeyLifecycle(t *testing.T) {
 	})
 
 	t.Run("list clones keys", func(t *testing.T) {
-		keyList, err := store.ListCryptoKeys(ctx, keyRingName)
+		keyList, _, err := store.ListCryptoKeys(ctx, keyRingName, kmsstore.ListOptions{})
 		if err != nil {
 			t.Fatalf("list crypto keys: %v", err)
 		}
@@ -129,6 +135,26 @@ func TestCryptoKeyLifecycle(t *testing.T) {
 		}
 	})
 
+	t.Run("update replaces metadata but keeps primary", func(t *testing.T) {
+		update := &kmspb.CryptoKey{
+			Name:   cryptoKeyName,
+			Labels: map[string]string{"team": "platform"},
+		}
+		if err := store.UpdateCryptoKey(ctx, update); err != nil {
+			t.Fatalf("update crypto key: %v", err)
+		}
+		got, err := store.GetCryptoKey(ctx, cryptoKeyName)
+		if err != nil {
+			t.Fatalf("get crypto key: %v", err)
+		}
+		if got.GetLabels()["team"] != "platform" {
+			t.Fatalf("labels not updated: %v", got.GetLabels())
+		}
+		if got.GetPrimary().GetName() != primaryVersion.GetName() {
+			t.Fatalf("primary must be preserved, got %v", got.GetPrimary())
+		}
+	})
+
 	t.Run("versions are stored with material copy", func(t *testing.T) {
 		version, keyMaterial, err := store.GetCryptoKeyVersion(ctx, primaryVersion.GetName())
 		if err != nil {
@@ -152,7 +178,7 @@ func TestCryptoKeyLifecycle(t *testing.T) {
 		if err := store.CreateCryptoKeyVersion(ctx, cryptoKeyName, version2, kmscrypto.KeyMaterial{4, 5, 6}); err != nil {
 			t.Fatalf("create crypto key version: %v", err)
 		}
-		versions, err := store.ListCryptoKeyVersions(ctx, cryptoKeyName)
+		versions, _, err := store.ListCryptoKeyVersions(ctx, cryptoKeyName, kmsstore.ListOptions{})
 		if err != nil {
 			t.Fatalf("list crypto key versions: %v", err)
 		}
@@ -169,6 +195,84 @@ func TestCryptoKeyLifecycle(t *testing.T) {
 		}
 	})
 
+	t.Run("update keeps primary copy in sync", func(t *testing.T) {
+		version2 := &kmspb.CryptoKeyVersion{
+			Name:  cryptoKeyName + "/cryptoKeyVersions/2",
+			State: kmspb.CryptoKeyVersion_DISABLED,
+		}
+		if err := store.UpdateCryptoKeyVersion(ctx, version2); err != nil {
+			t.Fatalf("update crypto key version: %v", err)
+		}
+		key, err := store.GetCryptoKey(ctx, cryptoKeyName)
+		if err != nil {
+			t.Fatalf("get crypto key: %v", err)
+		}
+		if key.GetPrimary().GetState() != kmspb.CryptoKeyVersion_DISABLED {
+			t.Fatalf("primary state = %v, want DISABLED", key.GetPrimary().GetState())
+		}
+		_, material, err := store.GetCryptoKeyVersion(ctx, version2.GetName())
+		if err != nil {
+			t.Fatalf("get crypto key version: %v", err)
+		}
+		if len(material) == 0 {
+			t.Fatal("update must not touch key material")
+		}
+	})
+
+	t.Run("destroy wipes key material", func(t *testing.T) {
+		destroyed := &kmspb.CryptoKeyVersion{
+			Name:  primaryVersion.GetName(),
+			State: kmspb.CryptoKeyVersion_DESTROYED,
+		}
+		if err := store.DestroyCryptoKeyVersion(ctx, destroyed); err != nil {
+			t.Fatalf("destroy crypto key version: %v", err)
+		}
+		version, material, err := store.GetCryptoKeyVersion(ctx, primaryVersion.GetName())
+		if err != nil {
+			t.Fatalf("get crypto key version: %v", err)
+		}
+		if version.GetState() != kmspb.CryptoKeyVersion_DESTROYED || material != nil {
+			t.Fatalf("destroyed version = %v, material = %v", version, material)
+		}
+	})
+
+	t.Run("reimport restores key material", func(t *testing.T) {
+		reimported := &kmspb.CryptoKeyVersion{
+			Name:  primaryVersion.GetName(),
+			State: kmspb.CryptoKeyVersion_ENABLED,
+		}
+		if err := store.ReimportCryptoKeyVersion(ctx, reimported, kmscrypto.KeyMaterial{7, 8, 9}); err != nil {
+			t.Fatalf("reimport crypto key version: %v", err)
+		}
+		version, material, err := store.GetCryptoKeyVersion(ctx, primaryVersion.GetName())
+		if err != nil {
+			t.Fatalf("get crypto key version: %v", err)
+		}
+		if version.GetState() != kmspb.CryptoKeyVersion_ENABLED || !slices.Equal(material, kmscrypto.KeyMaterial{7, 8, 9}) {
+			t.Fatalf("reimported version = %v, material = %v", version, material)
+		}
+	})
+
+	t.Run("delete removes the key and its versions", func(t *testing.T) {
+		otherName := keyRingName + "/cryptoKeys/rollback"
+		otherVersion := &kmspb.CryptoKeyVersion{Name: otherName + "/cryptoKeyVersions/1"}
+		if err := store.CreateCryptoKey(ctx, keyRingName, &kmspb.CryptoKey{Name: otherName}, otherVersion, material); err != nil {
+			t.Fatalf("create crypto key: %v", err)
+		}
+		if err := store.DeleteCryptoKey(ctx, otherName); err != nil {
+			t.Fatalf("delete crypto key: %v", err)
+		}
+		if _, err := store.GetCryptoKey(ctx, otherName); status.Code(err) != codes.NotFound {
+			t.Fatalf("get deleted key must return NotFound, got %v", status.Code(err))
+		}
+		if _, _, err := store.GetCryptoKeyVersion(ctx, otherVersion.GetName()); status.Code(err) != codes.NotFound {
+			t.Fatalf("get version of deleted key must return NotFound, got %v", status.Code(err))
+		}
+		if err := store.DeleteCryptoKey(ctx, otherName); status.Code(err) != codes.NotFound {
+			t.Fatalf("delete missing key must return NotFound, got %v", status.Code(err))
+		}
+	})
+
 	t.Run("not found errors", func(t *testing.T) {
 		if _, err := store.SetPrimaryVersion(ctx, "projects/demo/locations/global/keyRings/app/cryptoKeys/other", cryptoKeyName+"/cryptoKeyVersions/2"); status.Code(err) != codes.NotFound {
 			t.Fatalf("set primary for missing key must return NotFound, got %v", status.Code(err))
@@ -176,5 +280,364 @@ func TestCryptoKeyLifecycle(t *testing.T) {
 		if err := store.CreateCryptoKeyVersion(ctx, "projects/demo/locations/global/keyRings/app/cryptoKeys/missing", &kmspb.CryptoKeyVersion{Name: "projects/demo/locations/global/keyRings/app/cryptoKeys/missing/cryptoKeyVersions/1"}, kmscrypto.KeyMaterial{1}); status.Code(err) != codes.NotFound {
 			t.Fatalf("create version for missing key must return NotFound, got %v", status.Code(err))
 		}
+		if err := store.UpdateCryptoKeyVersion(ctx, &kmspb.CryptoKeyVersion{Name: cryptoKeyName + "/cryptoKeyVersions/9"}); status.Code(err) != codes.NotFound {
+			t.Fatalf("update missing version must return NotFound, got %v", status.Code(err))
+		}
 	})
 }
+
+func TestCreateCryptoKeyWithoutVersions(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	store := New()
+
+	keyRingName := "projects/demo/locations/global/keyRings/app"
+	if err := store.CreateKeyRing(ctx, &kmspb.KeyRing{Name: keyRingName}); err != nil {
+		t.Fatalf("setup key ring: %v", err)
+	}
+	cryptoKeyName := keyRingName + "/cryptoKeys/imported"
+	if err := store.CreateCryptoKey(ctx, keyRingName, &kmspb.CryptoKey{Name: cryptoKeyName, ImportOnly: true}, nil, nil); err != nil {
+		t.Fatalf("create crypto key: %v", err)
+	}
+	versions, total, err := store.ListCryptoKeyVersions(ctx, cryptoKeyName, kmsstore.ListOptions{})
+	if err != nil {
+		t.Fatalf("list crypto key versions: %v", err)
+	}
+	if len(versions) != 0 || total != 0 {
+		t.Fatalf("versions = %v (total %d), want none", versions, total)
+	}
+}
+
+func TestListScheduledCryptoKeys(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	store := New()
+
+	due := timestamppb.New(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+	for _, keyRingName := range []string{"projects/demo/locations/global/keyRings/b", "projects/other/locations/us/keyRings/a"} {
+		if err := store.CreateKeyRing(ctx, &kmspb.KeyRing{Name: keyRingName}); err != nil {
+			t.Fatalf("setup key ring: %v", err)
+		}
+		for _, key := range []*kmspb.CryptoKey{
+			{Name: keyRingName + "/cryptoKeys/manual"},
+			{Name: keyRingName + "/cryptoKeys/scheduled", NextRotationTime: due},
+		} {
+			if err := store.CreateCryptoKey(ctx, keyRingName, key, nil, nil); err != nil {
+				t.Fatalf("create crypto key: %v", err)
+			}
+		}
+	}
+
+	keys, err := store.ListScheduledCryptoKeys(ctx)
+	if err != nil {
+		t.Fatalf("list scheduled crypto keys: %v", err)
+	}
+	var got []string
+	for _, key := range keys {
+		got = append(got, key.GetName())
+	}
+	want := []string{
+		"projects/demo/locations/global/keyRings/b/cryptoKeys/scheduled",
+		"projects/other/locations/us/keyRings/a/cryptoKeys/scheduled",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("scheduled keys = %v, want %v", got, want)
+	}
+}
+
+func TestListDestroyScheduledCryptoKeyVersions(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	store := New()
+
+	keyRingName := "projects/demo/locations/global/keyRings/app"
+	if err := store.CreateKeyRing(ctx, &kmspb.KeyRing{Name: keyRingName}); err != nil {
+		t.Fatalf("setup key ring: %v", err)
+	}
+	var want []string
+	for _, keyName := range []string{keyRingName + "/cryptoKeys/b", keyRingName + "/cryptoKeys/a"} {
+		if err := store.CreateCryptoKey(ctx, keyRingName, &kmspb.CryptoKey{Name: keyName}, nil, nil); err != nil {
+			t.Fatalf("create crypto key: %v", err)
+		}
+		for id, state := range []kmspb.CryptoKeyVersion_CryptoKeyVersionState{
+			kmspb.CryptoKeyVersion_ENABLED,
+			kmspb.CryptoKeyVersion_DESTROY_SCHEDULED,
+			kmspb.CryptoKeyVersion_DESTROYED,
+		} {
+			version := &kmspb.CryptoKeyVersion{Name: fmt.Sprintf("%s/cryptoKeyVersions/%d", keyName, id+1), State: state}
+			if err := store.CreateCryptoKeyVersion(ctx, keyName, version, nil); err != nil {
+				t.Fatalf("create crypto key version: %v", err)
+			}
+		}
+		want = append(want, keyName+"/cryptoKeyVersions/2")
+	}
+	slices.Sort(want)
+
+	versions, err := store.ListDestroyScheduledCryptoKeyVersions(ctx)
+	if err != nil {
+		t.Fatalf("list destroy-scheduled versions: %v", err)
+	}
+	var got []string
+	for _, version := range versions {
+		got = append(got, version.GetName())
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("destroy-scheduled versions = %v, want %v", got, want)
+	}
+}
+
+func TestImportJobLifecycle(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	store := New()
+
+	keyRingName := "projects/demo/locations/global/keyRings/app"
+	if err := store.CreateKeyRing(ctx, &kmspb.KeyRing{Name: keyRingName}); err != nil {
+		t.Fatalf("setup key ring: %v", err)
+	}
+	jobName := keyRingName + "/importJobs/byok"
+	job := &kmspb.ImportJob{Name: jobName, State: kmspb.ImportJob_PENDING_GENERATION}
+
+	t.Run("create and read copies", func(t *testing.T) {
+		if err := store.CreateImportJob(ctx, keyRingName, job, kmscrypto.KeyMaterial{1, 2, 3}); err != nil {
+			t.Fatalf("create import job: %v", err)
+		}
+		got, material, err := store.GetImportJob(ctx, jobName)
+		if err != nil {
+			t.Fatalf("get import job: %v", err)
+		}
+		if !proto.Equal(got, job) || !slices.Equal(material, kmscrypto.KeyMaterial{1, 2, 3}) {
+			t.Fatalf("import job = %v, material = %v", got, material)
+		}
+		material[0] = 99
+		_, stored, err := store.GetImportJob(ctx, jobName)
+		if err != nil {
+			t.Fatalf("get import job again: %v", err)
+		}
+		if stored[0] != 1 {
+			t.Fatalf("key material should be cloned, got %v", stored)
+		}
+	})
+
+	t.Run("duplicate rejected", func(t *testing.T) {
+		if err := store.CreateImportJob(ctx, keyRingName, job, nil); status.Code(err) != codes.AlreadyExists {
+			t.Fatalf("duplicate import job must return AlreadyExists, got %v", status.Code(err))
+		}
+	})
+
+	t.Run("update replaces metadata but keeps material", func(t *testing.T) {
+		if err := store.UpdateImportJob(ctx, &kmspb.ImportJob{Name: jobName, State: kmspb.ImportJob_ACTIVE}); err != nil {
+			t.Fatalf("update import job: %v", err)
+		}
+		got, material, err := store.GetImportJob(ctx, jobName)
+		if err != nil {
+			t.Fatalf("get import job: %v", err)
+		}
+		if got.GetState() != kmspb.ImportJob_ACTIVE || len(material) == 0 {
+			t.Fatalf("import job = %v, material = %v", got, material)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		jobs, total, err := store.ListImportJobs(ctx, keyRingName, kmsstore.ListOptions{})
+		if err != nil {
+			t.Fatalf("list import jobs: %v", err)
+		}
+		if len(jobs) != 1 || total != 1 || jobs[0].GetName() != jobName {
+			t.Fatalf("list import jobs returned %v (total %d)", jobs, total)
+		}
+	})
+
+	t.Run("not found errors", func(t *testing.T) {
+		if err := store.CreateImportJob(ctx, "projects/demo/locations/global/keyRings/missing", &kmspb.ImportJob{Name: "projects/demo/locations/global/keyRings/missing/importJobs/byok"}, nil); status.Code(err) != codes.NotFound {
+			t.Fatalf("create import job in missing key ring must return NotFound, got %v", status.Code(err))
+		}
+		if _, _, err := store.GetImportJob(ctx, keyRingName+"/importJobs/missing"); status.Code(err) != codes.NotFound {
+			t.Fatalf("get missing import job must return NotFound, got %v", status.Code(err))
+		}
+		if err := store.UpdateImportJob(ctx, &kmspb.ImportJob{Name: keyRingName + "/importJobs/missing"}); status.Code(err) != codes.NotFound {
+			t.Fatalf("update missing import job must return NotFound, got %v", status.Code(err))
+		}
+	})
+}
+
+func TestIamPolicies(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	store := New()
+
+	keyRingName := "projects/demo/locations/global/keyRings/app"
+	cryptoKeyName := keyRingName + "/cryptoKeys/pair"
+	jobName := keyRingName + "/importJobs/byok"
+	if err := store.CreateKeyRing(ctx, &kmspb.KeyRing{Name: keyRingName}); err != nil {
+		t.Fatalf("setup key ring: %v", err)
+	}
+	if err := store.CreateCryptoKey(ctx, keyRingName, &kmspb.CryptoKey{Name: cryptoKeyName}, nil, nil); err != nil {
+		t.Fatalf("setup crypto key: %v", err)
+	}
+	if err := store.CreateImportJob(ctx, keyRingName, &kmspb.ImportJob{Name: jobName}, nil); err != nil {
+		t.Fatalf("setup import job: %v", err)
+	}
+
+	for _, resource := range []string{"projects/demo", keyRingName, cryptoKeyName, jobName} {
+		t.Run(resource, func(t *testing.T) {
+			policy, err := store.GetIamPolicy(ctx, resource)
+			if err != nil || policy != nil {
+				t.Fatalf("initial policy = %v, %v; want nil", policy, err)
+			}
+			want := &iampb.Policy{
+				Version:  1,
+				Bindings: []*iampb.Binding{{Role: "roles/cloudkms.viewer", Members: []string{"user:" + resource}}},
+			}
+			if err := store.SetIamPolicy(ctx, resource, want); err != nil {
+				t.Fatalf("set policy: %v", err)
+			}
+			want.Bindings[0].Members[0] = "mutated"
+			got, err := store.GetIamPolicy(ctx, resource)
+			if err != nil {
+				t.Fatalf("get policy: %v", err)
+			}
+			if got.GetBindings()[0].GetMembers()[0] != "user:"+resource {
+				t.Fatalf("policy = %v, want the stored copy for %s", got, resource)
+			}
+		})
+	}
+
+	if _, err := store.GetIamPolicy(ctx, keyRingName+"/cryptoKeys/missing"); status.Code(err) != codes.NotFound {
+		t.Fatalf("get policy of missing resource must return NotFound, got %v", status.Code(err))
+	}
+	if err := store.SetIamPolicy(ctx, keyRingName+"/cryptoKeys/pair/cryptoKeyVersions/1", &iampb.Policy{}); status.Code(err) != codes.NotFound {
+		t.Fatalf("set policy of a version must return NotFound, got %v", status.Code(err))
+	}
+}
+
+func TestKeyHandlesAndAutokeyConfigs(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	store := New()
+
+	parent := "projects/demo/locations/us-east1"
+	for _, id := range []string{"b", "a"} {
+		if err := store.CreateKeyHandle(ctx, &kmspb.KeyHandle{Name: parent + "/keyHandles/" + id, ResourceTypeSelector: "storage.googleapis.com/Bucket"}); err != nil {
+			t.Fatalf("create key handle %s: %v", id, err)
+		}
+	}
+	if err := store.CreateKeyHandle(ctx, &kmspb.KeyHandle{Name: "projects/demo/locations/global/keyHandles/c"}); err != nil {
+		t.Fatalf("create key handle in another location: %v", err)
+	}
+	if err := store.CreateKeyHandle(ctx, &kmspb.KeyHandle{Name: parent + "/keyHandles/a"}); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("duplicate key handle must return AlreadyExists, got %v", status.Code(err))
+	}
+	handles, total, err := store.ListKeyHandles(ctx, parent, kmsstore.ListOptions{})
+	if err != nil {
+		t.Fatalf("list key handles: %v", err)
+	}
+	if total != 2 || handles[0].GetName() != parent+"/keyHandles/a" || handles[1].GetName() != parent+"/keyHandles/b" {
+		t.Fatalf("key handles = %v (total %d)", handles, total)
+	}
+	if _, err := store.GetKeyHandle(ctx, parent+"/keyHandles/missing"); status.Code(err) != codes.NotFound {
+		t.Fatalf("get missing key handle must return NotFound, got %v", status.Code(err))
+	}
+
+	name := "projects/demo/autokeyConfig"
+	if config, err := store.GetAutokeyConfig(ctx, name); err != nil || config != nil {
+		t.Fatalf("initial autokey config = %v, %v; want nil", config, err)
+	}
+	if err := store.SetAutokeyConfig(ctx, &kmspb.AutokeyConfig{Name: name, KeyProject: "projects/keys"}); err != nil {
+		t.Fatalf("set autokey config: %v", err)
+	}
+	config, err := store.GetAutokeyConfig(ctx, name)
+	if err != nil || config.GetKeyProject() != "projects/keys" {
+		t.Fatalf("autokey config = %v, %v", config, err)
+	}
+}
+
+func TestEkmConnectionsAndConfigs(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	store := New()
+
+	parent := "projects/demo/locations/us-east1"
+	name := parent + "/ekmConnections/vpc"
+	if err := store.CreateEkmConnection(ctx, &kmspb.EkmConnection{Name: name, Etag: "1"}); err != nil {
+		t.Fatalf("create ekm connection: %v", err)
+	}
+	if err := store.CreateEkmConnection(ctx, &kmspb.EkmConnection{Name: name}); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("duplicate ekm connection must return AlreadyExists, got %v", status.Code(err))
+	}
+	if err := store.UpdateEkmConnection(ctx, &kmspb.EkmConnection{Name: name, Etag: "2"}); err != nil {
+		t.Fatalf("update ekm connection: %v", err)
+	}
+	if err := store.UpdateEkmConnection(ctx, &kmspb.EkmConnection{Name: parent + "/ekmConnections/missing"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("update missing ekm connection must return NotFound, got %v", status.Code(err))
+	}
+	connections, total, err := store.ListEkmConnections(ctx, parent, kmsstore.ListOptions{})
+	if err != nil {
+		t.Fatalf("list ekm connections: %v", err)
+	}
+	if total != 1 || connections[0].GetEtag() != "2" {
+		t.Fatalf("ekm connections = %v (total %d)", connections, total)
+	}
+
+	configName := parent + "/ekmConfig"
+	if config, err := store.GetEkmConfig(ctx, configName); err != nil || config != nil {
+		t.Fatalf("initial ekm config = %v, %v; want nil", config, err)
+	}
+	if err := store.SetEkmConfig(ctx, &kmspb.EkmConfig{Name: configName, DefaultEkmConnection: name}); err != nil {
+		t.Fatalf("set ekm config: %v", err)
+	}
+	config, err := store.GetEkmConfig(ctx, configName)
+	if err != nil || config.GetDefaultEkmConnection() != name {
+		t.Fatalf("ekm config = %v, %v", config, err)
+	}
+}
+
+func TestListCursor(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	store := New()
+
+	keyRingName := "projects/demo/locations/global/keyRings/app"
+	if err := store.CreateKeyRing(ctx, &kmspb.KeyRing{Name: keyRingName}); err != nil {
+		t.Fatalf("setup key ring: %v", err)
+	}
+	cryptoKeyName := keyRingName + "/cryptoKeys/pair"
+	versionName := func(id string) string { return cryptoKeyName + "/cryptoKeyVersions/" + id }
+	if err := store.CreateCryptoKey(ctx, keyRingName, &kmspb.CryptoKey{Name: cryptoKeyName}, &kmspb.CryptoKeyVersion{Name: versionName("1")}, kmscrypto.KeyMaterial{1}); err != nil {
+		t.Fatalf("setup crypto key: %v", err)
+	}
+	for _, id := range []string{"2", "10", "3"} {
+		if err := store.CreateCryptoKeyVersion(ctx, cryptoKeyName, &kmspb.CryptoKeyVersion{Name: versionName(id)}, kmscrypto.KeyMaterial{1}); err != nil {
+			t.Fatalf("create version %s: %v", id, err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		opts kmsstore.ListOptions
+		want []string
+	}{
+		{name: "numeric order", opts: kmsstore.ListOptions{}, want: []string{"1", "2", "3", "10"}},
+		{name: "limit", opts: kmsstore.ListOptions{Limit: 2}, want: []string{"1", "2"}},
+		{name: "start after", opts: kmsstore.ListOptions{StartAfter: versionName("2"), Limit: 5}, want: []string{"3", "10"}},
+		{name: "past the end", opts: kmsstore.ListOptions{StartAfter: versionName("10")}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			versions, total, err := store.ListCryptoKeyVersions(ctx, cryptoKeyName, tt.opts)
+			if err != nil {
+				t.Fatalf("list versions: %v", err)
+			}
+			if total != 4 {
+				t.Fatalf("total = %d, want 4", total)
+			}
+			var got []string
+			for _, v := range versions {
+				got = append(got, v.GetName()[len(cryptoKeyName+"/cryptoKeyVersions/"):])
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("versions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
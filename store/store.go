@@ -3,25 +3,96 @@ package store
 import (
 	"context"
 
+	"cloud.google.com/go/iam/apiv1/iampb"
 	"cloud.google.com/go/kms/apiv1/kmspb"
 	"github.com/winor30/fake-cloud-kms/kmscrypto"
 )
 
+// ListOptions selects a cursor-delimited window of a listing.
+// Listings are ordered by resource name, with crypto key versions ordered by
+// numeric version ID. List methods also return the total number of resources
+// under the parent, ignoring StartAfter and Limit.
+type ListOptions struct {
+	// StartAfter skips resources ordered at or before this resource name.
+	StartAfter string
+	// Limit caps the number of returned resources. Zero means no limit.
+	Limit int
+}
+
 // Store defines persistence operations for key resources.
 type Store interface {
 	CreateKeyRing(ctx context.Context, keyRing *kmspb.KeyRing) error
 	GetKeyRing(ctx context.Context, name string) (*kmspb.KeyRing, error)
-	ListKeyRings(ctx context.Context, parent string) ([]*kmspb.KeyRing, error)
+	ListKeyRings(ctx context.Context, parent string, opts ListOptions) ([]*kmspb.KeyRing, int, error)
 
+	// CreateCryptoKey stores a crypto key and its initial version. A nil
+	// primaryVersion creates the key without versions.
 	CreateCryptoKey(ctx context.Context, keyRingName string, cryptoKey *kmspb.CryptoKey, primaryVersion *kmspb.CryptoKeyVersion, keyMaterial kmscrypto.KeyMaterial) error
 	GetCryptoKey(ctx context.Context, name string) (*kmspb.CryptoKey, error)
-	ListCryptoKeys(ctx context.Context, parent string) ([]*kmspb.CryptoKey, error)
+	ListCryptoKeys(ctx context.Context, parent string, opts ListOptions) ([]*kmspb.CryptoKey, int, error)
+	UpdateCryptoKey(ctx context.Context, cryptoKey *kmspb.CryptoKey) error
+	// DeleteCryptoKey removes a crypto key with its versions and policy.
+	// Cloud KMS never deletes keys; it only rolls back a key created for a
+	// request that then failed.
+	DeleteCryptoKey(ctx context.Context, name string) error
+	// ListScheduledCryptoKeys returns every crypto key with a
+	// next_rotation_time, across all key rings, ordered by resource name.
+	ListScheduledCryptoKeys(ctx context.Context) ([]*kmspb.CryptoKey, error)
 
 	CreateCryptoKeyVersion(ctx context.Context, cryptoKeyName string, version *kmspb.CryptoKeyVersion, keyMaterial kmscrypto.KeyMaterial) error
 	GetCryptoKeyVersion(ctx context.Context, name string) (*kmspb.CryptoKeyVersion, kmscrypto.KeyMaterial, error)
-	ListCryptoKeyVersions(ctx context.Context, parent string) ([]*kmspb.CryptoKeyVersion, error)
+	ListCryptoKeyVersions(ctx context.Context, parent string, opts ListOptions) ([]*kmspb.CryptoKeyVersion, int, error)
+	// ListDestroyScheduledCryptoKeyVersions returns every DESTROY_SCHEDULED
+	// version, across all crypto keys, ordered by resource name.
+	ListDestroyScheduledCryptoKeyVersions(ctx context.Context) ([]*kmspb.CryptoKeyVersion, error)
+
+	UpdateCryptoKeyVersion(ctx context.Context, version *kmspb.CryptoKeyVersion) error
+	DestroyCryptoKeyVersion(ctx context.Context, version *kmspb.CryptoKeyVersion) error
+	// ReimportCryptoKeyVersion replaces the metadata and key material of an
+	// existing version.
+	ReimportCryptoKeyVersion(ctx context.Context, version *kmspb.CryptoKeyVersion, keyMaterial kmscrypto.KeyMaterial) error
 
 	SetPrimaryVersion(ctx context.Context, cryptoKeyName, versionName string) (*kmspb.CryptoKey, error)
+
+	// CreateImportJob stores an import job and the private half of its
+	// wrapping key.
+	CreateImportJob(ctx context.Context, keyRingName string, importJob *kmspb.ImportJob, keyMaterial kmscrypto.KeyMaterial) error
+	GetImportJob(ctx context.Context, name string) (*kmspb.ImportJob, kmscrypto.KeyMaterial, error)
+	ListImportJobs(ctx context.Context, parent string, opts ListOptions) ([]*kmspb.ImportJob, int, error)
+	// UpdateImportJob replaces the stored metadata of an existing import job.
+	// Key material is left untouched.
+	UpdateImportJob(ctx context.Context, importJob *kmspb.ImportJob) error
+
+	// GetIamPolicy returns the IAM policy of a project, key ring, crypto key
+	// or import job, or nil when none has been set. Projects are not stored
+	// resources, so every well-formed project name has a policy slot.
+	GetIamPolicy(ctx context.Context, resource string) (*iampb.Policy, error)
+	// SetIamPolicy replaces the IAM policy of a project, key ring, crypto key
+	// or import job.
+	SetIamPolicy(ctx context.Context, resource string, policy *iampb.Policy) error
+
+	// CreateKeyHandle stores a new Autokey key handle.
+	CreateKeyHandle(ctx context.Context, keyHandle *kmspb.KeyHandle) error
+	GetKeyHandle(ctx context.Context, name string) (*kmspb.KeyHandle, error)
+	ListKeyHandles(ctx context.Context, parent string, opts ListOptions) ([]*kmspb.KeyHandle, int, error)
+
+	// GetAutokeyConfig returns the Autokey configuration of a folder or
+	// project, or nil when none has been set.
+	GetAutokeyConfig(ctx context.Context, name string) (*kmspb.AutokeyConfig, error)
+	// SetAutokeyConfig stores the Autokey configuration named by config.name.
+	SetAutokeyConfig(ctx context.Context, config *kmspb.AutokeyConfig) error
+
+	CreateEkmConnection(ctx context.Context, connection *kmspb.EkmConnection) error
+	GetEkmConnection(ctx context.Context, name string) (*kmspb.EkmConnection, error)
+	ListEkmConnections(ctx context.Context, parent string, opts ListOptions) ([]*kmspb.EkmConnection, int, error)
+	// UpdateEkmConnection replaces an existing EKM connection.
+	UpdateEkmConnection(ctx context.Context, connection *kmspb.EkmConnection) error
+
+	// GetEkmConfig returns the EkmConfig of a project and location, or nil
+	// when none has been set.
+	GetEkmConfig(ctx context.Context, name string) (*kmspb.EkmConfig, error)
+	// SetEkmConfig stores the EkmConfig named by config.name.
+	SetEkmConfig(ctx context.Context, config *kmspb.EkmConfig) error
 }
 
 type StoreType string
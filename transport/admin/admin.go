@@ -0,0 +1,134 @@
+// Package admin serves the emulator's HTTP admin API, which controls the
+// virtual clock behind timestamps, scheduled destruction and rotation.
+//
+//	GET  /clock          current state: {"now": "<RFC 3339>", "frozen": false}
+//	POST /clock/freeze   stop the clock
+//	POST /clock/resume   let a frozen clock run again
+//	POST /clock/set      jump to {"time": "<RFC 3339>"}
+//	POST /clock/advance  move forward by {"duration": "<Go duration, e.g. 720h>"}
+//
+// Every endpoint responds with the resulting clock state.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/winor30/fake-cloud-kms/clock"
+)
+
+// maxBodySize bounds request bodies, which only ever hold a timestamp or duration.
+const maxBodySize = 1 << 10
+
+// Server wraps the admin HTTP server lifecycle.
+type Server struct {
+	httpServer *http.Server
+}
+
+// New creates an admin server controlling c.
+func New(c *clock.Virtual) *Server {
+	return &Server{httpServer: &http.Server{
+		Handler:           NewHandler(c),
+		ReadHeaderTimeout: 10 * time.Second,
+	}}
+}
+
+// ListenAndServe listens on addr and serves requests until the context is canceled.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	var lc net.ListenConfig
+	lis, err := lc.Listen(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, lis)
+}
+
+// Serve handles requests on the provided listener until the context is canceled.
+func (s *Server) Serve(ctx context.Context, lis net.Listener) error {
+	slog.InfoContext(ctx, "Cloud KMS emulator admin API listening", "addr", lis.Addr().String())
+	go func() {
+		<-ctx.Done()
+		_ = s.httpServer.Shutdown(context.WithoutCancel(ctx))
+	}()
+	err := s.httpServer.Serve(lis)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+type clockState struct {
+	Now    time.Time `json:"now"`
+	Frozen bool      `json:"frozen"`
+}
+
+// NewHandler returns the admin API routes for c.
+func NewHandler(c *clock.Virtual) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /clock", func(w http.ResponseWriter, _ *http.Request) {
+		writeState(w, c)
+	})
+	mux.HandleFunc("POST /clock/freeze", func(w http.ResponseWriter, _ *http.Request) {
+		c.Freeze()
+		writeState(w, c)
+	})
+	mux.HandleFunc("POST /clock/resume", func(w http.ResponseWriter, _ *http.Request) {
+		c.Resume()
+		writeState(w, c)
+	})
+	mux.HandleFunc("POST /clock/set", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Time time.Time `json:"time"`
+		}
+		if err := decodeBody(w, r, &body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if body.Time.IsZero() {
+			http.Error(w, "time is required", http.StatusBadRequest)
+			return
+		}
+		c.Set(body.Time)
+		writeState(w, c)
+	})
+	mux.HandleFunc("POST /clock/advance", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Duration string `json:"duration"`
+		}
+		if err := decodeBody(w, r, &body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		d, err := time.ParseDuration(body.Duration)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid duration: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := c.Advance(d); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeState(w, c)
+	})
+	return mux
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+func writeState(w http.ResponseWriter, c *clock.Virtual) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(clockState{Now: c.Now(), Frozen: c.Frozen()})
+}
@@ -0,0 +1,69 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/winor30/fake-cloud-kms/clock"
+	"github.com/winor30/fake-cloud-kms/transport/admin"
+)
+
+type clockState struct {
+	Now    time.Time `json:"now"`
+	Frozen bool      `json:"frozen"`
+}
+
+func TestClockEndpoints(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := clock.NewVirtual(start)
+	handler := admin.NewHandler(c)
+
+	do := func(t *testing.T, method, path, body string, wantCode int) clockState {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		if rec.Code != wantCode {
+			t.Fatalf("%s %s: status = %d, want %d (%s)", method, path, rec.Code, wantCode, rec.Body)
+		}
+		var state clockState
+		if wantCode == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &state); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+		}
+		return state
+	}
+
+	frozen := do(t, http.MethodPost, "/clock/freeze", "", http.StatusOK)
+	if !frozen.Frozen || !c.Frozen() {
+		t.Fatal("clock not frozen")
+	}
+
+	advanced := do(t, http.MethodPost, "/clock/advance", `{"duration": "720h"}`, http.StatusOK)
+	if !advanced.Now.Equal(frozen.Now.Add(720 * time.Hour)) {
+		t.Fatalf("now = %v, want %v", advanced.Now, frozen.Now.Add(720*time.Hour))
+	}
+
+	target := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	set := do(t, http.MethodPost, "/clock/set", `{"time": "2030-01-01T00:00:00Z"}`, http.StatusOK)
+	if !set.Now.Equal(target) || !c.Now().Equal(target) {
+		t.Fatalf("now = %v, want %v", set.Now, target)
+	}
+
+	if got := do(t, http.MethodGet, "/clock", "", http.StatusOK); !got.Now.Equal(target) || !got.Frozen {
+		t.Fatalf("state = %+v, want frozen at %v", got, target)
+	}
+	if got := do(t, http.MethodPost, "/clock/resume", "", http.StatusOK); got.Frozen {
+		t.Fatal("clock still frozen after resume")
+	}
+
+	do(t, http.MethodPost, "/clock/advance", `{"duration": "-1h"}`, http.StatusBadRequest)
+	do(t, http.MethodPost, "/clock/advance", `{"duration": "soon"}`, http.StatusBadRequest)
+	do(t, http.MethodPost, "/clock/set", `{}`, http.StatusBadRequest)
+	do(t, http.MethodGet, "/clock/advance", "", http.StatusMethodNotAllowed)
+}
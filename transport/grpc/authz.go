@@ -0,0 +1,316 @@
+package grpcserver
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"cloud.google.com/go/iam/apiv1/iampb"
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"google.golang.org/genproto/googleapis/cloud/location"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/winor30/fake-cloud-kms/iampolicy"
+	"github.com/winor30/fake-cloud-kms/names"
+	"github.com/winor30/fake-cloud-kms/service"
+)
+
+// PrincipalHeader is the metadata key naming the caller when authorization
+// is enforced, e.g. "user:alice@example.com". It takes precedence over the
+// bearer token.
+const PrincipalHeader = "x-fake-kms-principal"
+
+// permissionCheck is one permission an RPC requires on one resource.
+type permissionCheck struct {
+	permission string
+	resource   string
+}
+
+// AuthorizationInterceptor returns a unary interceptor that enforces the IAM
+// policies stored in svc. Each RPC requires the cloudkms.* permission Cloud
+// KMS checks for it, granted by a policy on the target resource or one of its
+// ancestors (crypto key, key ring, project); otherwise it fails with
+// PermissionDenied, as does any RPC the interceptor has no rule for. Callers
+// identify themselves with PrincipalHeader or a bearer token that is either a
+// member string or a JWT with an email claim.
+//
+// A project policy needs resourcemanager.projects.setIamPolicy like any other
+// write, so initial access is granted out of band, e.g. by the iamBindings of
+// a seed file. TestIamPermissions returns only the permissions the caller
+// holds.
+func AuthorizationInterceptor(svc service.KMSService) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		checks, known := requiredPermissions(req)
+		if !known {
+			return nil, status.Errorf(codes.PermissionDenied, "%s has no authorization rule in the emulator", info.FullMethod)
+		}
+		testReq, isTest := req.(*iampb.TestIamPermissionsRequest)
+		if len(checks) == 0 && !isTest {
+			return handler(ctx, req)
+		}
+		principal, err := callerPrincipal(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, check := range checks {
+			granted, err := authorized(ctx, svc, principal, check.resource, check.permission)
+			if err != nil {
+				return nil, err
+			}
+			if !granted {
+				return nil, status.Errorf(codes.PermissionDenied, "Permission '%s' denied on resource '%s' (or it may not exist).", check.permission, check.resource)
+			}
+		}
+
+		resp, err := handler(ctx, req)
+		if err != nil || !isTest {
+			return resp, err
+		}
+		tested := resp.(*iampb.TestIamPermissionsResponse)
+		var held []string
+		for _, permission := range tested.GetPermissions() {
+			granted, err := authorized(ctx, svc, principal, testReq.GetResource(), permission)
+			if err != nil {
+				return nil, err
+			}
+			if granted {
+				held = append(held, permission)
+			}
+		}
+		return &iampb.TestIamPermissionsResponse{Permissions: held}, nil
+	}
+}
+
+// authorized reports whether a policy on resource or one of its ancestors
+// grants permission to principal. Ancestors that do not exist grant nothing.
+func authorized(ctx context.Context, svc service.KMSService, principal, resource, permission string) (bool, error) {
+	for _, ancestor := range iampolicy.Ancestors(resource) {
+		policy, err := svc.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
+			Resource: ancestor,
+			Options:  &iampb.GetPolicyOptions{RequestedPolicyVersion: 3},
+		})
+		if status.Code(err) == codes.NotFound {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if iampolicy.Grants(policy, principal, permission) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// requiredPermissions returns the permission checks for req. known is false
+// for RPCs missing from this list, which the interceptor denies so that a new
+// RPC cannot skip authorization by accident.
+func requiredPermissions(req any) (checks []permissionCheck, known bool) {
+	one := func(permission, resource string) []permissionCheck {
+		return []permissionCheck{{permission: permission, resource: resource}}
+	}
+	switch r := req.(type) {
+	case *kmspb.CreateKeyRingRequest:
+		return one("cloudkms.keyRings.create", r.GetParent()), true
+	case *kmspb.GetKeyRingRequest:
+		return one("cloudkms.keyRings.get", r.GetName()), true
+	case *kmspb.ListKeyRingsRequest:
+		return one("cloudkms.keyRings.list", r.GetParent()), true
+	case *kmspb.CreateCryptoKeyRequest:
+		return one("cloudkms.cryptoKeys.create", r.GetParent()), true
+	case *kmspb.GetCryptoKeyRequest:
+		return one("cloudkms.cryptoKeys.get", r.GetName()), true
+	case *kmspb.ListCryptoKeysRequest:
+		return one("cloudkms.cryptoKeys.list", r.GetParent()), true
+	case *kmspb.UpdateCryptoKeyRequest:
+		return one("cloudkms.cryptoKeys.update", r.GetCryptoKey().GetName()), true
+	case *kmspb.UpdateCryptoKeyPrimaryVersionRequest:
+		return one("cloudkms.cryptoKeys.update", r.GetName()), true
+	case *kmspb.CreateCryptoKeyVersionRequest:
+		return one("cloudkms.cryptoKeyVersions.create", r.GetParent()), true
+	case *kmspb.GetCryptoKeyVersionRequest:
+		return one("cloudkms.cryptoKeyVersions.get", r.GetName()), true
+	case *kmspb.ListCryptoKeyVersionsRequest:
+		return one("cloudkms.cryptoKeyVersions.list", r.GetParent()), true
+	case *kmspb.UpdateCryptoKeyVersionRequest:
+		return one("cloudkms.cryptoKeyVersions.update", r.GetCryptoKeyVersion().GetName()), true
+	case *kmspb.DestroyCryptoKeyVersionRequest:
+		return one("cloudkms.cryptoKeyVersions.destroy", r.GetName()), true
+	case *kmspb.RestoreCryptoKeyVersionRequest:
+		return one("cloudkms.cryptoKeyVersions.restore", r.GetName()), true
+	case *kmspb.CreateImportJobRequest:
+		return one("cloudkms.importJobs.create", r.GetParent()), true
+	case *kmspb.GetImportJobRequest:
+		return one("cloudkms.importJobs.get", r.GetName()), true
+	case *kmspb.ListImportJobsRequest:
+		return one("cloudkms.importJobs.list", r.GetParent()), true
+	case *kmspb.ImportCryptoKeyVersionRequest:
+		return []permissionCheck{
+			{permission: "cloudkms.cryptoKeyVersions.create", resource: r.GetParent()},
+			{permission: "cloudkms.importJobs.useToImport", resource: r.GetImportJob()},
+		}, true
+	case *kmspb.EncryptRequest:
+		return one("cloudkms.cryptoKeyVersions.useToEncrypt", r.GetName()), true
+	case *kmspb.DecryptRequest:
+		return one("cloudkms.cryptoKeyVersions.useToDecrypt", r.GetName()), true
+	case *kmspb.RawEncryptRequest:
+		return one("cloudkms.cryptoKeyVersions.useToEncrypt", r.GetName()), true
+	case *kmspb.RawDecryptRequest:
+		return one("cloudkms.cryptoKeyVersions.useToDecrypt", r.GetName()), true
+	case *kmspb.AsymmetricDecryptRequest:
+		return one("cloudkms.cryptoKeyVersions.useToDecrypt", r.GetName()), true
+	case *kmspb.AsymmetricSignRequest:
+		return one("cloudkms.cryptoKeyVersions.useToSign", r.GetName()), true
+	case *kmspb.MacSignRequest:
+		return one("cloudkms.cryptoKeyVersions.useToSign", r.GetName()), true
+	case *kmspb.MacVerifyRequest:
+		return one("cloudkms.cryptoKeyVersions.useToVerify", r.GetName()), true
+	case *kmspb.DecapsulateRequest:
+		return one("cloudkms.cryptoKeyVersions.useToDecapsulate", r.GetName()), true
+	case *kmspb.GetPublicKeyRequest:
+		return one("cloudkms.cryptoKeyVersions.viewPublicKey", r.GetName()), true
+	case *kmspb.GenerateRandomBytesRequest:
+		return one("cloudkms.locations.generateRandomBytes", r.GetLocation()), true
+	case *kmspb.CreateKeyHandleRequest:
+		return one("cloudkms.keyHandles.create", r.GetParent()), true
+	case *kmspb.GetKeyHandleRequest:
+		return one("cloudkms.keyHandles.get", r.GetName()), true
+	case *kmspb.ListKeyHandlesRequest:
+		return one("cloudkms.keyHandles.list", r.GetParent()), true
+	case *kmspb.GetAutokeyConfigRequest:
+		return autokeyConfigCheck(r.GetName(), "cloudkms.autokeyConfigs.get"), true
+	case *kmspb.UpdateAutokeyConfigRequest:
+		return autokeyConfigCheck(r.GetAutokeyConfig().GetName(), "cloudkms.autokeyConfigs.update"), true
+	case *kmspb.ShowEffectiveAutokeyConfigRequest:
+		return one("cloudkms.projects.showEffectiveAutokeyConfig", r.GetParent()), true
+	case *kmspb.CreateEkmConnectionRequest:
+		return one("cloudkms.ekmConnections.create", r.GetParent()), true
+	case *kmspb.GetEkmConnectionRequest:
+		return one("cloudkms.ekmConnections.get", r.GetName()), true
+	case *kmspb.ListEkmConnectionsRequest:
+		return one("cloudkms.ekmConnections.list", r.GetParent()), true
+	case *kmspb.UpdateEkmConnectionRequest:
+		return one("cloudkms.ekmConnections.update", r.GetEkmConnection().GetName()), true
+	case *kmspb.VerifyConnectivityRequest:
+		return one("cloudkms.ekmConnections.verifyConnectivity", r.GetName()), true
+	case *kmspb.GetEkmConfigRequest:
+		return one("cloudkms.ekmConfigs.get", r.GetName()), true
+	case *kmspb.UpdateEkmConfigRequest:
+		return one("cloudkms.ekmConfigs.update", r.GetEkmConfig().GetName()), true
+	case *longrunningpb.GetOperationRequest:
+		return one("cloudkms.operations.get", r.GetName()), true
+	case *longrunningpb.WaitOperationRequest:
+		return one("cloudkms.operations.get", r.GetName()), true
+	case *longrunningpb.ListOperationsRequest:
+		return one("cloudkms.operations.list", r.GetName()), true
+	case *longrunningpb.CancelOperationRequest:
+		return one("cloudkms.operations.cancel", r.GetName()), true
+	case *location.GetLocationRequest:
+		return one("cloudkms.locations.get", r.GetName()), true
+	case *location.ListLocationsRequest:
+		return one("cloudkms.locations.list", r.GetName()), true
+	case *iampb.GetIamPolicyRequest:
+		return iamPolicyCheck(r.GetResource(), "getIamPolicy"), true
+	case *iampb.SetIamPolicyRequest:
+		return iamPolicyCheck(r.GetResource(), "setIamPolicy"), true
+	case *iampb.TestIamPermissionsRequest:
+		// The response is narrowed to the caller's permissions instead.
+		return nil, true
+	}
+	return nil, false
+}
+
+// iamPolicyCheck returns the check for reading or writing the policy of
+// resource. A project policy is guarded by the Resource Manager permission, as
+// in Cloud IAM. Malformed names need none; the service rejects them.
+func iamPolicyCheck(resource, verb string) []permissionCheck {
+	var permission string
+	switch {
+	case isName(names.ParseProject, resource):
+		permission = "resourcemanager.projects." + verb
+	case isName(names.ParseKeyRing, resource):
+		permission = "cloudkms.keyRings." + verb
+	case isName(names.ParseCryptoKey, resource):
+		permission = "cloudkms.cryptoKeys." + verb
+	case isName(names.ParseImportJob, resource):
+		permission = "cloudkms.importJobs." + verb
+	default:
+		return nil
+	}
+	return []permissionCheck{{permission: permission, resource: resource}}
+}
+
+// autokeyConfigCheck returns the check for an Autokey configuration, which is
+// governed by its project's policy. Folders are not modeled, so folder
+// configurations need none.
+func autokeyConfigCheck(name, permission string) []permissionCheck {
+	owner, err := names.ParseAutokeyConfig(name)
+	if err != nil || !isName(names.ParseProject, owner) {
+		return nil
+	}
+	return []permissionCheck{{permission: permission, resource: owner}}
+}
+
+func isName[T any](parse func(string) (T, error), name string) bool {
+	_, err := parse(name)
+	return err == nil
+}
+
+// principalKinds lists the member kinds a caller may authenticate as.
+var principalKinds = []string{"user", "serviceAccount", "principal"}
+
+// callerPrincipal identifies the caller from PrincipalHeader or the bearer
+// token in the authorization metadata.
+func callerPrincipal(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(PrincipalHeader); len(values) > 0 {
+		return parsePrincipal(values[0])
+	}
+	for _, value := range md.Get("authorization") {
+		scheme, token, ok := strings.Cut(value, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return principalFromToken(strings.TrimSpace(token))
+		}
+	}
+	return "", status.Errorf(codes.Unauthenticated, "request has no caller identity; send a bearer token or the %s header", PrincipalHeader)
+}
+
+// principalFromToken reads the email claim of a JWT, without verifying it,
+// or takes any other token as a member string.
+func principalFromToken(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return parsePrincipal(token)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", status.Errorf(codes.Unauthenticated, "bearer token is not a valid JWT: %v", err)
+	}
+	var claims struct {
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", status.Errorf(codes.Unauthenticated, "bearer token is not a valid JWT: %v", err)
+	}
+	if claims.Email == "" {
+		return "", status.Error(codes.Unauthenticated, "bearer token has no email claim")
+	}
+	if strings.HasSuffix(claims.Email, ".gserviceaccount.com") {
+		return "serviceAccount:" + claims.Email, nil
+	}
+	return "user:" + claims.Email, nil
+}
+
+func parsePrincipal(value string) (string, error) {
+	kind, id, ok := strings.Cut(value, ":")
+	if !ok || id == "" || !slices.Contains(principalKinds, kind) {
+		return "", status.Errorf(codes.Unauthenticated, "caller principal %q must look like user:<email> or serviceAccount:<email>", value)
+	}
+	return value, nil
+}
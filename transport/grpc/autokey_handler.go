@@ -0,0 +1,56 @@
+package grpcserver
+
+import (
+	"context"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+
+	"github.com/winor30/fake-cloud-kms/service"
+)
+
+// autokeyHandler adapts the key handle methods of KMSService to the Autokey
+// gRPC service.
+type autokeyHandler struct {
+	kmspb.UnimplementedAutokeyServer
+	svc service.KMSService
+}
+
+func newAutokeyHandler(svc service.KMSService) *autokeyHandler {
+	return &autokeyHandler{svc: svc}
+}
+
+func (h *autokeyHandler) CreateKeyHandle(ctx context.Context, req *kmspb.CreateKeyHandleRequest) (*longrunningpb.Operation, error) {
+	return h.svc.CreateKeyHandle(ctx, req)
+}
+
+func (h *autokeyHandler) GetKeyHandle(ctx context.Context, req *kmspb.GetKeyHandleRequest) (*kmspb.KeyHandle, error) {
+	return h.svc.GetKeyHandle(ctx, req)
+}
+
+func (h *autokeyHandler) ListKeyHandles(ctx context.Context, req *kmspb.ListKeyHandlesRequest) (*kmspb.ListKeyHandlesResponse, error) {
+	return h.svc.ListKeyHandles(ctx, req)
+}
+
+// autokeyAdminHandler adapts the Autokey configuration methods of KMSService
+// to the AutokeyAdmin gRPC service.
+type autokeyAdminHandler struct {
+	kmspb.UnimplementedAutokeyAdminServer
+	svc service.KMSService
+}
+
+func newAutokeyAdminHandler(svc service.KMSService) *autokeyAdminHandler {
+	return &autokeyAdminHandler{svc: svc}
+}
+
+func (h *autokeyAdminHandler) UpdateAutokeyConfig(ctx context.Context, req *kmspb.UpdateAutokeyConfigRequest) (*kmspb.AutokeyConfig, error) {
+	return h.svc.UpdateAutokeyConfig(ctx, req)
+}
+
+func (h *autokeyAdminHandler) GetAutokeyConfig(ctx context.Context, req *kmspb.GetAutokeyConfigRequest) (*kmspb.AutokeyConfig, error) {
+	return h.svc.GetAutokeyConfig(ctx, req)
+}
+
+func (h *autokeyAdminHandler) ShowEffectiveAutokeyConfig(ctx context.Context, req *kmspb.ShowEffectiveAutokeyConfigRequest) (*kmspb.ShowEffectiveAutokeyConfigResponse, error) {
+	return h.svc.ShowEffectiveAutokeyConfig(ctx, req)
+}
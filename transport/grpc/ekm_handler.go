@@ -0,0 +1,48 @@
+package grpcserver
+
+import (
+	"context"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+
+	"github.com/winor30/fake-cloud-kms/service"
+)
+
+// ekmHandler adapts the EKM methods of KMSService to the EkmService gRPC
+// service.
+type ekmHandler struct {
+	kmspb.UnimplementedEkmServiceServer
+	svc service.KMSService
+}
+
+func newEkmHandler(svc service.KMSService) *ekmHandler {
+	return &ekmHandler{svc: svc}
+}
+
+func (h *ekmHandler) CreateEkmConnection(ctx context.Context, req *kmspb.CreateEkmConnectionRequest) (*kmspb.EkmConnection, error) {
+	return h.svc.CreateEkmConnection(ctx, req)
+}
+
+func (h *ekmHandler) GetEkmConnection(ctx context.Context, req *kmspb.GetEkmConnectionRequest) (*kmspb.EkmConnection, error) {
+	return h.svc.GetEkmConnection(ctx, req)
+}
+
+func (h *ekmHandler) ListEkmConnections(ctx context.Context, req *kmspb.ListEkmConnectionsRequest) (*kmspb.ListEkmConnectionsResponse, error) {
+	return h.svc.ListEkmConnections(ctx, req)
+}
+
+func (h *ekmHandler) UpdateEkmConnection(ctx context.Context, req *kmspb.UpdateEkmConnectionRequest) (*kmspb.EkmConnection, error) {
+	return h.svc.UpdateEkmConnection(ctx, req)
+}
+
+func (h *ekmHandler) GetEkmConfig(ctx context.Context, req *kmspb.GetEkmConfigRequest) (*kmspb.EkmConfig, error) {
+	return h.svc.GetEkmConfig(ctx, req)
+}
+
+func (h *ekmHandler) UpdateEkmConfig(ctx context.Context, req *kmspb.UpdateEkmConfigRequest) (*kmspb.EkmConfig, error) {
+	return h.svc.UpdateEkmConfig(ctx, req)
+}
+
+func (h *ekmHandler) VerifyConnectivity(ctx context.Context, req *kmspb.VerifyConnectivityRequest) (*kmspb.VerifyConnectivityResponse, error) {
+	return h.svc.VerifyConnectivity(ctx, req)
+}
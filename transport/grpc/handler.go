@@ -42,6 +42,10 @@ func (h *handler) ListCryptoKeys(ctx context.Context, req *kmspb.ListCryptoKeysR
 	return h.svc.ListCryptoKeys(ctx, req)
 }
 
+func (h *handler) UpdateCryptoKey(ctx context.Context, req *kmspb.UpdateCryptoKeyRequest) (*kmspb.CryptoKey, error) {
+	return h.svc.UpdateCryptoKey(ctx, req)
+}
+
 func (h *handler) CreateCryptoKeyVersion(ctx context.Context, req *kmspb.CreateCryptoKeyVersionRequest) (*kmspb.CryptoKeyVersion, error) {
 	return h.svc.CreateCryptoKeyVersion(ctx, req)
 }
@@ -58,6 +62,34 @@ func (h *handler) UpdateCryptoKeyPrimaryVersion(ctx context.Context, req *kmspb.
 	return h.svc.UpdateCryptoKeyPrimaryVersion(ctx, req)
 }
 
+func (h *handler) UpdateCryptoKeyVersion(ctx context.Context, req *kmspb.UpdateCryptoKeyVersionRequest) (*kmspb.CryptoKeyVersion, error) {
+	return h.svc.UpdateCryptoKeyVersion(ctx, req)
+}
+
+func (h *handler) DestroyCryptoKeyVersion(ctx context.Context, req *kmspb.DestroyCryptoKeyVersionRequest) (*kmspb.CryptoKeyVersion, error) {
+	return h.svc.DestroyCryptoKeyVersion(ctx, req)
+}
+
+func (h *handler) RestoreCryptoKeyVersion(ctx context.Context, req *kmspb.RestoreCryptoKeyVersionRequest) (*kmspb.CryptoKeyVersion, error) {
+	return h.svc.RestoreCryptoKeyVersion(ctx, req)
+}
+
+func (h *handler) CreateImportJob(ctx context.Context, req *kmspb.CreateImportJobRequest) (*kmspb.ImportJob, error) {
+	return h.svc.CreateImportJob(ctx, req)
+}
+
+func (h *handler) GetImportJob(ctx context.Context, req *kmspb.GetImportJobRequest) (*kmspb.ImportJob, error) {
+	return h.svc.GetImportJob(ctx, req)
+}
+
+func (h *handler) ListImportJobs(ctx context.Context, req *kmspb.ListImportJobsRequest) (*kmspb.ListImportJobsResponse, error) {
+	return h.svc.ListImportJobs(ctx, req)
+}
+
+func (h *handler) ImportCryptoKeyVersion(ctx context.Context, req *kmspb.ImportCryptoKeyVersionRequest) (*kmspb.CryptoKeyVersion, error) {
+	return h.svc.ImportCryptoKeyVersion(ctx, req)
+}
+
 func (h *handler) Encrypt(ctx context.Context, req *kmspb.EncryptRequest) (*kmspb.EncryptResponse, error) {
 	return h.svc.Encrypt(ctx, req)
 }
@@ -73,3 +105,31 @@ func (h *handler) GetPublicKey(ctx context.Context, req *kmspb.GetPublicKeyReque
 func (h *handler) AsymmetricSign(ctx context.Context, req *kmspb.AsymmetricSignRequest) (*kmspb.AsymmetricSignResponse, error) {
 	return h.svc.AsymmetricSign(ctx, req)
 }
+
+func (h *handler) MacSign(ctx context.Context, req *kmspb.MacSignRequest) (*kmspb.MacSignResponse, error) {
+	return h.svc.MacSign(ctx, req)
+}
+
+func (h *handler) MacVerify(ctx context.Context, req *kmspb.MacVerifyRequest) (*kmspb.MacVerifyResponse, error) {
+	return h.svc.MacVerify(ctx, req)
+}
+
+func (h *handler) RawEncrypt(ctx context.Context, req *kmspb.RawEncryptRequest) (*kmspb.RawEncryptResponse, error) {
+	return h.svc.RawEncrypt(ctx, req)
+}
+
+func (h *handler) RawDecrypt(ctx context.Context, req *kmspb.RawDecryptRequest) (*kmspb.RawDecryptResponse, error) {
+	return h.svc.RawDecrypt(ctx, req)
+}
+
+func (h *handler) AsymmetricDecrypt(ctx context.Context, req *kmspb.AsymmetricDecryptRequest) (*kmspb.AsymmetricDecryptResponse, error) {
+	return h.svc.AsymmetricDecrypt(ctx, req)
+}
+
+func (h *handler) Decapsulate(ctx context.Context, req *kmspb.DecapsulateRequest) (*kmspb.DecapsulateResponse, error) {
+	return h.svc.Decapsulate(ctx, req)
+}
+
+func (h *handler) GenerateRandomBytes(ctx context.Context, req *kmspb.GenerateRandomBytesRequest) (*kmspb.GenerateRandomBytesResponse, error) {
+	return h.svc.GenerateRandomBytes(ctx, req)
+}
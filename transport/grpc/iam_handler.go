@@ -0,0 +1,31 @@
+package grpcserver
+
+import (
+	"context"
+
+	"cloud.google.com/go/iam/apiv1/iampb"
+
+	"github.com/winor30/fake-cloud-kms/service"
+)
+
+// iamHandler adapts the IAM methods of KMSService to the IAMPolicy gRPC service.
+type iamHandler struct {
+	iampb.UnimplementedIAMPolicyServer
+	svc service.KMSService
+}
+
+func newIAMHandler(svc service.KMSService) *iamHandler {
+	return &iamHandler{svc: svc}
+}
+
+func (h *iamHandler) GetIamPolicy(ctx context.Context, req *iampb.GetIamPolicyRequest) (*iampb.Policy, error) {
+	return h.svc.GetIamPolicy(ctx, req)
+}
+
+func (h *iamHandler) SetIamPolicy(ctx context.Context, req *iampb.SetIamPolicyRequest) (*iampb.Policy, error) {
+	return h.svc.SetIamPolicy(ctx, req)
+}
+
+func (h *iamHandler) TestIamPermissions(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+	return h.svc.TestIamPermissions(ctx, req)
+}
@@ -0,0 +1,28 @@
+package grpcserver
+
+import (
+	"context"
+
+	"google.golang.org/genproto/googleapis/cloud/location"
+
+	"github.com/winor30/fake-cloud-kms/service"
+)
+
+// locationsHandler adapts the location methods of KMSService to the
+// Locations gRPC service.
+type locationsHandler struct {
+	location.UnimplementedLocationsServer
+	svc service.KMSService
+}
+
+func newLocationsHandler(svc service.KMSService) *locationsHandler {
+	return &locationsHandler{svc: svc}
+}
+
+func (h *locationsHandler) ListLocations(ctx context.Context, req *location.ListLocationsRequest) (*location.ListLocationsResponse, error) {
+	return h.svc.ListLocations(ctx, req)
+}
+
+func (h *locationsHandler) GetLocation(ctx context.Context, req *location.GetLocationRequest) (*location.Location, error) {
+	return h.svc.GetLocation(ctx, req)
+}
@@ -0,0 +1,37 @@
+package grpcserver
+
+import (
+	"context"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/winor30/fake-cloud-kms/service"
+)
+
+// operationsHandler adapts the operation methods of KMSService to the
+// google.longrunning Operations gRPC service.
+type operationsHandler struct {
+	longrunningpb.UnimplementedOperationsServer
+	svc service.KMSService
+}
+
+func newOperationsHandler(svc service.KMSService) *operationsHandler {
+	return &operationsHandler{svc: svc}
+}
+
+func (h *operationsHandler) GetOperation(ctx context.Context, req *longrunningpb.GetOperationRequest) (*longrunningpb.Operation, error) {
+	return h.svc.GetOperation(ctx, req)
+}
+
+func (h *operationsHandler) ListOperations(ctx context.Context, req *longrunningpb.ListOperationsRequest) (*longrunningpb.ListOperationsResponse, error) {
+	return h.svc.ListOperations(ctx, req)
+}
+
+func (h *operationsHandler) WaitOperation(ctx context.Context, req *longrunningpb.WaitOperationRequest) (*longrunningpb.Operation, error) {
+	return h.svc.WaitOperation(ctx, req)
+}
+
+func (h *operationsHandler) CancelOperation(ctx context.Context, req *longrunningpb.CancelOperationRequest) (*emptypb.Empty, error) {
+	return h.svc.CancelOperation(ctx, req)
+}
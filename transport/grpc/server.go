@@ -5,7 +5,10 @@ import (
 	"log/slog"
 	"net"
 
+	"cloud.google.com/go/iam/apiv1/iampb"
 	"cloud.google.com/go/kms/apiv1/kmspb"
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"google.golang.org/genproto/googleapis/cloud/location"
 	"google.golang.org/grpc"
 
 	"github.com/winor30/fake-cloud-kms/service"
@@ -16,10 +19,19 @@ type Server struct {
 	grpcServer *grpc.Server
 }
 
-// New creates a gRPC server that exposes the provided KMS service.
+// New creates a gRPC server that exposes the provided KMS service, including
+// the Autokey, AutokeyAdmin and EkmService services, the IAMPolicy service for its key
+// rings, crypto keys and import jobs, the Locations service for its location
+// catalog and the google.longrunning Operations service.
 func New(svc service.KMSService, opts ...grpc.ServerOption) *Server {
 	grpcServer := grpc.NewServer(opts...)
 	kmspb.RegisterKeyManagementServiceServer(grpcServer, newHandler(svc))
+	kmspb.RegisterAutokeyServer(grpcServer, newAutokeyHandler(svc))
+	kmspb.RegisterAutokeyAdminServer(grpcServer, newAutokeyAdminHandler(svc))
+	kmspb.RegisterEkmServiceServer(grpcServer, newEkmHandler(svc))
+	iampb.RegisterIAMPolicyServer(grpcServer, newIAMHandler(svc))
+	location.RegisterLocationsServer(grpcServer, newLocationsHandler(svc))
+	longrunningpb.RegisterOperationsServer(grpcServer, newOperationsHandler(svc))
 	return &Server{grpcServer: grpcServer}
 }
 